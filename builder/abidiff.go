@@ -0,0 +1,257 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ABILibsFile lists the sonames provided by a package, one per line
+	ABILibsFile = "abi_libs"
+
+	// ABISymbolsFile lists the symbols exported by a package, as soname:symbol
+	ABISymbolsFile = "abi_symbols"
+)
+
+var (
+	// FailOnABIBreak will fail the build when the ABI report shows that
+	// sonames or symbols were removed since the previous build
+	FailOnABIBreak bool
+
+	// ErrABIBreak is matched by any ABIBreakError
+	ErrABIBreak = errors.New("The ABI of the package has changed incompatibly")
+)
+
+// An ABIBreakError is returned when --fail-on-abi-break is used, and the
+// build removed sonames or symbols
+type ABIBreakError struct {
+	Diff *ABIDiff
+}
+
+// Error will count what was removed
+func (e *ABIBreakError) Error() string {
+	return fmt.Sprintf("%s: %d soname(s) removed, %d symbol(s) removed, %d symbol(s) changed", ErrABIBreak,
+		len(e.Diff.RemovedSonames), len(e.Diff.RemovedSymbols), len(e.Diff.ChangedSymbols))
+}
+
+// Is will match ErrABIBreak
+func (e *ABIBreakError) Is(target error) bool {
+	return target == ErrABIBreak
+}
+
+// An ABIReport holds the sonames and exported symbols of a build, as written
+// by abi-wizard
+type ABIReport struct {
+	Sonames map[string]bool
+	Symbols map[string][]string // Sonames exporting each symbol
+}
+
+// NewABIReport will create a report from the lines of abi_libs and abi_symbols
+func NewABIReport(libs, symbols []string) *ABIReport {
+	r := &ABIReport{
+		Sonames: make(map[string]bool),
+		Symbols: make(map[string][]string),
+	}
+	for _, lib := range libs {
+		if lib = strings.TrimSpace(lib); lib != "" {
+			r.Sonames[lib] = true
+		}
+	}
+	for _, line := range symbols {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		soname, symbol := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if symbol == "" {
+			continue
+		}
+		r.Symbols[symbol] = append(r.Symbols[symbol], soname)
+	}
+	for _, sonames := range r.Symbols {
+		sort.Strings(sonames)
+	}
+	return r
+}
+
+// readLines will return the lines of the file at path
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+// LoadABIReport will load the ABI report within dir, returning nil when there
+// is none
+func LoadABIReport(dir string) (*ABIReport, error) {
+	libsPath := filepath.Join(dir, ABILibsFile)
+	symbolsPath := filepath.Join(dir, ABISymbolsFile)
+	if !PathExists(libsPath) && !PathExists(symbolsPath) {
+		return nil, nil
+	}
+	var lines [2][]string
+	for i, path := range []string{libsPath, symbolsPath} {
+		if !PathExists(path) {
+			continue
+		}
+		l, err := readLines(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read ABI report %s, reason: %s\n", path, err)
+		}
+		lines[i] = l
+	}
+	return NewABIReport(lines[0], lines[1]), nil
+}
+
+// An ABIDiff is the difference between the ABI reports of two builds. Each
+// list is sorted, and symbols are listed as soname:symbol.
+type ABIDiff struct {
+	AddedSonames   []string
+	RemovedSonames []string
+	AddedSymbols   []string
+	RemovedSymbols []string
+	ChangedSymbols []string // Symbols now exported by other sonames, as old -> new
+}
+
+// DiffABI will compare the ABI report of the previous build against that of
+// the current build. A symbol still exported, but by different sonames, such
+// as after a soname bump, is changed rather than removed and added.
+func DiffABI(old, cur *ABIReport) *ABIDiff {
+	d := &ABIDiff{}
+	for soname := range cur.Sonames {
+		if !old.Sonames[soname] {
+			d.AddedSonames = append(d.AddedSonames, soname)
+		}
+	}
+	for soname := range old.Sonames {
+		if !cur.Sonames[soname] {
+			d.RemovedSonames = append(d.RemovedSonames, soname)
+		}
+	}
+	for symbol, sonames := range cur.Symbols {
+		oldSonames, ok := old.Symbols[symbol]
+		if !ok {
+			for _, soname := range sonames {
+				d.AddedSymbols = append(d.AddedSymbols, soname+":"+symbol)
+			}
+			continue
+		}
+		if was, now := strings.Join(oldSonames, ","), strings.Join(sonames, ","); was != now {
+			d.ChangedSymbols = append(d.ChangedSymbols, fmt.Sprintf("%s: %s -> %s", symbol, was, now))
+		}
+	}
+	for symbol, sonames := range old.Symbols {
+		if _, ok := cur.Symbols[symbol]; ok {
+			continue
+		}
+		for _, soname := range sonames {
+			d.RemovedSymbols = append(d.RemovedSymbols, soname+":"+symbol)
+		}
+	}
+	for _, list := range [][]string{d.AddedSonames, d.RemovedSonames, d.AddedSymbols, d.RemovedSymbols, d.ChangedSymbols} {
+		sort.Strings(list)
+	}
+	return d
+}
+
+// Empty will determine whether the ABI is unchanged
+func (d *ABIDiff) Empty() bool {
+	return len(d.AddedSonames)+len(d.AddedSymbols) == 0 && !d.Breaks()
+}
+
+// Breaks will determine whether anything was removed or moved, which may
+// break packages built against the previous build
+func (d *ABIDiff) Breaks() bool {
+	return len(d.RemovedSonames)+len(d.RemovedSymbols)+len(d.ChangedSymbols) > 0
+}
+
+// Log will print the changes, warning of those that may break the ABI
+func (d *ABIDiff) Log() {
+	if d.Empty() {
+		log.Infoln("The ABI is unchanged since the previous build")
+		return
+	}
+	for _, soname := range d.AddedSonames {
+		log.Infof("ABI: added soname %s\n", soname)
+	}
+	for _, symbol := range d.AddedSymbols {
+		log.Infof("ABI: added symbol %s\n", symbol)
+	}
+	if !d.Breaks() {
+		return
+	}
+	log.Warnln("POTENTIAL ABI BREAK since the previous build:")
+	for _, soname := range d.RemovedSonames {
+		log.Warnf("ABI: removed soname %s\n", soname)
+	}
+	for _, symbol := range d.RemovedSymbols {
+		log.Warnf("ABI: removed symbol %s\n", symbol)
+	}
+	for _, symbol := range d.ChangedSymbols {
+		log.Warnf("ABI: changed symbol %s\n", symbol)
+	}
+}
+
+// CompareABI will compare the new ABI report in collectionDir against the one
+// collected by the previous build, within outputDir or beside the recipe. The
+// differences are logged, and an ABIBreakError returned for a break when
+// FailOnABIBreak is set.
+func (p *Package) CompareABI(collectionDir, outputDir string) error {
+	if DisableABIReport {
+		return nil
+	}
+	current, err := LoadABIReport(collectionDir)
+	if err != nil || current == nil {
+		return err
+	}
+	var previous *ABIReport
+	for _, dir := range []string{outputDir, filepath.Dir(p.Path)} {
+		if previous, err = LoadABIReport(dir); err != nil {
+			return err
+		}
+		if previous != nil {
+			log.Debugf("Comparing the ABI against the previous report in %s\n", dir)
+			break
+		}
+	}
+	if previous == nil {
+		log.Debugln("No previous ABI report to compare against")
+		return nil
+	}
+	diff := DiffABI(previous, current)
+	diff.Log()
+	if diff.Breaks() && FailOnABIBreak {
+		return &ABIBreakError{Diff: diff}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffABI(t *testing.T) {
+	old := NewABIReport(
+		[]string{"libfoo.so.1", "libbar.so.2"},
+		[]string{"libfoo.so.1:foo_init", "libfoo.so.1:foo_free", "libbar.so.2:bar_open", "libbar.so.2:bar_legacy"},
+	)
+	cur := NewABIReport(
+		[]string{"libfoo.so.2", "libbar.so.2", ""},
+		[]string{"libfoo.so.2:foo_init", "libfoo.so.2:foo_free", "libbar.so.2:bar_open", "libbar.so.2:bar_close", "garbage"},
+	)
+	diff := DiffABI(old, cur)
+	expected := &ABIDiff{
+		AddedSonames:   []string{"libfoo.so.2"},
+		RemovedSonames: []string{"libfoo.so.1"},
+		AddedSymbols:   []string{"libbar.so.2:bar_close"},
+		RemovedSymbols: []string{"libbar.so.2:bar_legacy"},
+		ChangedSymbols: []string{"foo_free: libfoo.so.1 -> libfoo.so.2", "foo_init: libfoo.so.1 -> libfoo.so.2"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("Wrong ABI diff:\n%+v\nexpected:\n%+v", diff, expected)
+	}
+	if !diff.Breaks() || diff.Empty() {
+		t.Fatal("Removals were not a break")
+	}
+
+	added := DiffABI(cur, NewABIReport(
+		[]string{"libfoo.so.2", "libbar.so.2", "libbaz.so.1"},
+		[]string{"libfoo.so.2:foo_init", "libfoo.so.2:foo_free", "libbar.so.2:bar_open", "libbar.so.2:bar_close", "libbaz.so.1:baz"},
+	))
+	if added.Breaks() || added.Empty() || len(added.AddedSonames) != 1 || len(added.AddedSymbols) != 1 {
+		t.Fatalf("Additions were wrongly compared: %+v", added)
+	}
+	if same := DiffABI(cur, cur); !same.Empty() {
+		t.Fatalf("Identical reports differ: %+v", same)
+	}
+}
+
+func TestCompareABI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-abi")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	recipeDir := filepath.Join(dir, "recipe")
+	workDir := filepath.Join(dir, "work")
+	for _, d := range []string{recipeDir, workDir} {
+		os.Mkdir(d, 00755)
+	}
+	ioutil.WriteFile(filepath.Join(workDir, ABILibsFile), []byte("libfoo.so.1\n"), 00644)
+	ioutil.WriteFile(filepath.Join(workDir, ABISymbolsFile), []byte("libfoo.so.1:foo_init\n"), 00644)
+	p := &Package{Path: filepath.Join(recipeDir, "package.yml")}
+
+	defer func() { FailOnABIBreak = false }()
+	FailOnABIBreak = true
+	if err := p.CompareABI(workDir, dir); err != nil {
+		t.Fatalf("Failed without a previous report: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(recipeDir, ABILibsFile), []byte("libfoo.so.1\n"), 00644)
+	ioutil.WriteFile(filepath.Join(recipeDir, ABISymbolsFile), []byte("libfoo.so.1:foo_init\nlibfoo.so.1:foo_free\n"), 00644)
+	if err := p.CompareABI(workDir, dir); !errors.Is(err, ErrABIBreak) {
+		t.Fatalf("Expected an ABI break, got: %v", err)
+	}
+	FailOnABIBreak = false
+	if err := p.CompareABI(workDir, dir); err != nil {
+		t.Fatalf("Failed without --fail-on-abi-break: %v", err)
+	}
+}
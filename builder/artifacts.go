@@ -0,0 +1,81 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrDuplicateArtifact is matched by any DuplicateArtifactError
+	ErrDuplicateArtifact = errors.New("Duplicate build artifact")
+
+	// OverwriteArtifacts allows packages to replace those already in the
+	// output directory
+	OverwriteArtifacts bool
+)
+
+// A DuplicateArtifactError is returned when collecting a package would
+// replace another with the same file name
+type DuplicateArtifactError struct {
+	Name     string
+	Existing bool // The package was already in the output directory
+}
+
+// Error will name the conflicting file
+func (e *DuplicateArtifactError) Error() string {
+	if e.Existing {
+		return fmt.Sprintf("Package %s already exists in the output directory, use --overwrite to replace it", e.Name)
+	}
+	return fmt.Sprintf("Package %s was produced more than once", e.Name)
+}
+
+// Is will match ErrDuplicateArtifact
+func (e *DuplicateArtifactError) Is(target error) bool {
+	return target == ErrDuplicateArtifact
+}
+
+// artifactTargets will resolve where each collected file is copied to within
+// the output directory. Packages may never share a name, and replacing a
+// package from an earlier build requires OverwriteArtifacts. Everything is
+// checked before any file is copied.
+func artifactTargets(collections []string, outputDir string) ([]string, error) {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, p := range collections {
+		name := filepath.Base(p)
+		tgt := filepath.Join(outputDir, name)
+		if strings.HasSuffix(name, ".eopkg") {
+			if seen[name] {
+				return nil, &DuplicateArtifactError{Name: name}
+			}
+			if PathExists(tgt) {
+				if !OverwriteArtifacts {
+					return nil, &DuplicateArtifactError{Name: name, Existing: true}
+				}
+				log.Warnf("Overwriting existing package %s\n", name)
+			}
+		}
+		seen[name] = true
+		targets = append(targets, tgt)
+	}
+	return targets, nil
+}
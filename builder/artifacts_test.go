@@ -0,0 +1,66 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-artifacts")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	collections := []string{
+		"/work/nano-5.0-1-1-x86_64.eopkg",
+		"/work/pspec_x86_64.xml",
+	}
+	targets, err := artifactTargets(collections, dir)
+	if err != nil {
+		t.Fatalf("Failed to resolve targets: %v", err)
+	}
+	if targets[0] != filepath.Join(dir, "nano-5.0-1-1-x86_64.eopkg") {
+		t.Fatalf("Wrong target: %s", targets[0])
+	}
+
+	duplicate := append(collections, "/other/nano-5.0-1-1-x86_64.eopkg")
+	var dupErr *DuplicateArtifactError
+	if _, err = artifactTargets(duplicate, dir); !errors.As(err, &dupErr) || dupErr.Existing {
+		t.Fatalf("Expected a duplicate package, got: %v", err)
+	}
+
+	// Only packages from an earlier build are protected
+	for _, p := range collections {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(p)), nil, 00644); err != nil {
+			t.Fatalf("Failed to write artifact: %v", err)
+		}
+	}
+	if _, err = artifactTargets(collections, dir); !errors.Is(err, ErrDuplicateArtifact) {
+		t.Fatalf("Expected an existing package to be refused, got: %v", err)
+	}
+	OverwriteArtifacts = true
+	defer func() { OverwriteArtifacts = false }()
+	if _, err = artifactTargets(collections, dir); err != nil {
+		t.Fatalf("Failed to overwrite existing package: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// EopkgMetadataFile is the file within each .eopkg describing the package
+const EopkgMetadataFile = "metadata.xml"
+
+var (
+	// ErrVersionMismatch is matched by any VersionMismatchError
+	ErrVersionMismatch = errors.New("Package version does not match")
+
+	// ErrNoMetadata is returned when an .eopkg has no usable metadata
+	ErrNoMetadata = errors.New("Package has no version in its metadata")
+)
+
+// A VersionMismatchError is returned when a built package does not have the
+// version that was asserted for the build
+type VersionMismatchError struct {
+	Artifact string // Name of the .eopkg
+	Expected string
+	Found    string
+}
+
+// Error will describe the mismatched versions
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s has version %s, expected %s", e.Artifact, e.Found, e.Expected)
+}
+
+// Is will match ErrVersionMismatch
+func (e *VersionMismatchError) Is(target error) bool {
+	return target == ErrVersionMismatch
+}
+
+// eopkgMetadata is the part of the .eopkg metadata we care about, the most
+// recent update being listed first
+type eopkgMetadata struct {
+	Name    string      `xml:"Package>Name"`
+	History []XMLUpdate `xml:"Package>History>Update"`
+}
+
+// ReadEopkgVersion will return the version recorded in the metadata of the
+// .eopkg at path
+func ReadEopkgVersion(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	for _, f := range archive.File {
+		if f.Name != EopkgMetadataFile {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		var meta eopkgMetadata
+		if err := xml.NewDecoder(r).Decode(&meta); err != nil {
+			return "", fmt.Errorf("Failed to parse %s, reason: %s\n", EopkgMetadataFile, err)
+		}
+		if len(meta.History) < 1 || meta.History[0].Version == "" {
+			return "", ErrNoMetadata
+		}
+		return meta.History[0].Version, nil
+	}
+	return "", ErrNoMetadata
+}
+
+// Verify will ensure that each of the given .eopkg files has the version
+// asserted for the build, if any
+func (p *Package) Verify(artifacts []string) error {
+	if p.AssertVersion == "" {
+		return nil
+	}
+	for _, artifact := range artifacts {
+		version, err := ReadEopkgVersion(artifact)
+		if err != nil {
+			return fmt.Errorf("Failed to read the version of %s, reason: %s\n", filepath.Base(artifact), err)
+		}
+		if version != p.AssertVersion {
+			return &VersionMismatchError{
+				Artifact: filepath.Base(artifact),
+				Expected: p.AssertVersion,
+				Found:    version,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/zip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testEopkgMetadata = `<?xml version="1.0" ?>
+<PISI>
+    <Source>
+        <Name>nano</Name>
+    </Source>
+    <Package>
+        <Name>nano</Name>
+        <History>
+            <Update release="120">
+                <Date>2024-01-01</Date>
+                <Version>7.2</Version>
+            </Update>
+            <Update release="119">
+                <Date>2023-06-01</Date>
+                <Version>7.1</Version>
+            </Update>
+        </History>
+    </Package>
+</PISI>
+`
+
+// writeTestEopkg will write an .eopkg with the given metadata to dir
+func writeTestEopkg(t *testing.T, dir, metadata string) string {
+	path := filepath.Join(dir, "nano-7.2-120-1-x86_64.eopkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create package: %v", err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	if metadata != "" {
+		m, err := w.Create(EopkgMetadataFile)
+		if err != nil {
+			t.Fatalf("Failed to add metadata: %v", err)
+		}
+		m.Write([]byte(metadata))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	return path
+}
+
+func TestAssertVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-version")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	eopkg := writeTestEopkg(t, dir, testEopkgMetadata)
+
+	version, err := ReadEopkgVersion(eopkg)
+	if err != nil || version != "7.2" {
+		t.Fatalf("Expected version 7.2, got '%s': %v", version, err)
+	}
+
+	pkg := &Package{Name: "nano"}
+	if err := pkg.Verify([]string{eopkg}); err != nil {
+		t.Fatalf("Verified without an asserted version: %v", err)
+	}
+	pkg.AssertVersion = "7.2"
+	if err := pkg.Verify([]string{eopkg}); err != nil {
+		t.Fatalf("Failed to verify matching version: %v", err)
+	}
+	pkg.AssertVersion = "7.3"
+	err = pkg.Verify([]string{eopkg})
+	var mismatch *VersionMismatchError
+	if !errors.Is(err, ErrVersionMismatch) || !errors.As(err, &mismatch) || mismatch.Found != "7.2" {
+		t.Fatalf("Expected a version mismatch, got: %v", err)
+	}
+
+	if _, err := ReadEopkgVersion(writeTestEopkg(t, dir, "")); err != ErrNoMetadata {
+		t.Fatalf("Expected missing metadata, got: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxAssetSize is the largest asset file copied into a build, which
+// is unlimited unless set with --max-asset-size
+const DefaultMaxAssetSize int64 = 0
+
+var (
+	// ErrInvalidAssetGlob is returned for an extra asset pattern that is
+	// malformed, or reaches outside of the package directory
+	ErrInvalidAssetGlob = errors.New("Invalid asset pattern")
+
+	// ExtraAssets are patterns of additional files beside the recipe to copy
+	// into the build, i.e. *.patch
+	ExtraAssets []string
+
+	// ErrAssetTooLarge is matched by any AssetTooLargeError
+	ErrAssetTooLarge = errors.New("Asset too large")
+
+	// MaxAssetSize is the size, in bytes, of the largest file that may be
+	// copied into the build as an asset. Zero disables the check.
+	MaxAssetSize = DefaultMaxAssetSize
+)
+
+// An AssetTooLargeError is returned for an asset file larger than MaxAssetSize
+type AssetTooLargeError struct {
+	Path string
+	Size int64
+}
+
+// Error will describe the file and its size
+func (e *AssetTooLargeError) Error() string {
+	return fmt.Sprintf("Asset %s is too large: %s, the limit is %s", e.Path, FormatBytes(e.Size), FormatBytes(MaxAssetSize))
+}
+
+// Is will match ErrAssetTooLarge
+func (e *AssetTooLargeError) Is(target error) bool {
+	return target == ErrAssetTooLarge
+}
+
+// ParseAssetGlobs will validate the patterns of extra assets, which are
+// relative to the package directory
+func ParseAssetGlobs(globs []string) ([]string, error) {
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil || filepath.IsAbs(glob) || strings.Contains(glob, "..") {
+			return nil, fmt.Errorf("%s: %s", ErrInvalidAssetGlob, glob)
+		}
+	}
+	return globs, nil
+}
+
+// copyAsset will copy the asset at path into destdir. Only the recipe is
+// required, any other missing asset is skipped.
+func copyAsset(path, destdir string, required bool) error {
+	if _, err := os.Lstat(path); err != nil {
+		if required {
+			return fmt.Errorf("Missing required asset %s, reason: %s\n", path, err)
+		}
+		log.Debugf("Skipping missing optional asset %s\n", filepath.Base(path))
+		return nil
+	}
+	if err := checkAssetSize(path); err != nil {
+		return err
+	}
+	return CopyAll(path, destdir)
+}
+
+// checkAssetSize will ensure no file at or beneath path is larger than
+// MaxAssetSize, before anything is copied
+func checkAssetSize(path string) error {
+	if MaxAssetSize <= 0 {
+		return nil
+	}
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() > MaxAssetSize {
+			return &AssetTooLargeError{Path: file, Size: info.Size()}
+		}
+		return nil
+	})
+}
+
+// copyExtraAssets will copy every file within baseDir matching ExtraAssets
+// into destdir
+func copyExtraAssets(baseDir, destdir string) error {
+	for _, glob := range ExtraAssets {
+		matches, err := filepath.Glob(filepath.Join(baseDir, glob))
+		if err != nil {
+			return fmt.Errorf("%s: %s", ErrInvalidAssetGlob, glob)
+		}
+		if len(matches) < 1 {
+			log.Debugf("No assets match %s\n", glob)
+		}
+		for _, match := range matches {
+			// Keep the layout of assets within subdirectories
+			rel, err := filepath.Rel(baseDir, match)
+			if err != nil {
+				return err
+			}
+			log.Debugf("Copying extra asset %s\n", rel)
+			if err := checkAssetSize(match); err != nil {
+				return err
+			}
+			if err := CopyAll(match, filepath.Join(destdir, filepath.Dir(rel))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
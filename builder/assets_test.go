@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyAssets(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "solbuild-assets")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	pkgDir := filepath.Join(tmp, "nano")
+	if err := os.MkdirAll(filepath.Join(pkgDir, "patches"), 00755); err != nil {
+		t.Fatalf("Failed to create package directory: %v", err)
+	}
+	for _, name := range []string{"package.yml", "fix-build.patch", "patches/cve.patch", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, name), []byte(name), 00644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	ExtraAssets = []string{"*.patch", "patches/*.patch", "*.diff"}
+	defer func() { ExtraAssets = nil }()
+
+	// Neither files, comar nor component.xml exist
+	p := &Package{Type: PackageTypeYpkg, Path: filepath.Join(pkgDir, "package.yml")}
+	o := &Overlay{MountPoint: filepath.Join(tmp, "root")}
+	if err := p.CopyAssets(nil, o); err != nil {
+		t.Fatalf("Failed to copy assets without optional paths: %v", err)
+	}
+	workDir := p.GetWorkDir(o)
+	for _, name := range []string{"package.yml", "fix-build.patch", "patches/cve.patch"} {
+		if !PathExists(filepath.Join(workDir, name)) {
+			t.Fatalf("Asset %s was not copied", name)
+		}
+	}
+	if PathExists(filepath.Join(workDir, "notes.txt")) {
+		t.Fatal("Copied an asset that was not requested")
+	}
+
+	p.Path = filepath.Join(pkgDir, "pspec.xml")
+	p.Type = PackageTypeXML
+	if err := p.CopyAssets(nil, o); err == nil {
+		t.Fatal("Copied assets without the recipe")
+	}
+}
+
+func TestParseAssetGlobs(t *testing.T) {
+	if _, err := ParseAssetGlobs([]string{"*.patch", "patches/*"}); err != nil {
+		t.Fatalf("Failed to parse valid patterns: %v", err)
+	}
+	for _, glob := range []string{"[", "../*.patch", "/etc/*"} {
+		if _, err := ParseAssetGlobs([]string{glob}); err == nil {
+			t.Fatalf("Accepted invalid pattern %s", glob)
+		}
+	}
+}
+
+func TestCopyAssetsTooLarge(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "solbuild-assets")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	pkgDir := filepath.Join(tmp, "nano")
+	if err := os.MkdirAll(filepath.Join(pkgDir, "files"), 00755); err != nil {
+		t.Fatalf("Failed to create package directory: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(pkgDir, "package.yml"), []byte("name: nano"), 00644)
+	ioutil.WriteFile(filepath.Join(pkgDir, "files", "sdk.bin"), make([]byte, 2048), 00644)
+
+	defer func() { MaxAssetSize = DefaultMaxAssetSize }()
+	MaxAssetSize = 1024
+	p := &Package{Type: PackageTypeYpkg, Path: filepath.Join(pkgDir, "package.yml")}
+	o := &Overlay{MountPoint: filepath.Join(tmp, "root")}
+	err = p.CopyAssets(nil, o)
+	if !errors.Is(err, ErrAssetTooLarge) {
+		t.Fatalf("Expected ErrAssetTooLarge, got %v", err)
+	}
+	if PathExists(filepath.Join(p.GetWorkDir(o), "files", "sdk.bin")) {
+		t.Fatal("Copied an asset that was too large")
+	}
+
+	MaxAssetSize = 0
+	if err = p.CopyAssets(nil, o); err != nil {
+		t.Fatalf("Failed to copy assets with the limit disabled: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// BatchStateFile records the progress of a batch build, within the
+	// output directory
+	BatchStateFile = ".solbuild-batch.json"
+
+	// BatchSummaryFile is written to the output directory at the end of
+	// every batch build
+	BatchSummaryFile = "solbuild-batch-summary.json"
+
+	// BatchStateVersion is the version of the batch state format, which
+	// must be increased with any incompatible change
+	BatchStateVersion = 1
+)
+
+// BatchResult is the outcome of a single package within a batch build
+type BatchResult string
+
+const (
+	// BatchPending packages have not been built yet
+	BatchPending BatchResult = "pending"
+
+	// BatchSucceeded packages were built by this run
+	BatchSucceeded BatchResult = "succeeded"
+
+	// BatchFailed packages failed to build
+	BatchFailed BatchResult = "failed"
+
+	// BatchSkipped packages were built by a previous run, and their recipe
+	// has not changed since
+	BatchSkipped BatchResult = "skipped"
+)
+
+// ErrBatchStateVersion is returned when loading batch state written by an
+// incompatible version of solbuild
+var ErrBatchStateVersion = errors.New("Unsupported batch state version")
+
+// A BatchEntry records the progress of a single package in a batch build
+type BatchEntry struct {
+	Recipe     string        `json:"recipe"` // Absolute path of the recipe
+	Name       string        `json:"name"`
+	RecipeHash string        `json:"recipe_hash"` // sha256sum of the recipe
+	Result     BatchResult   `json:"result"`
+	Duration   time.Duration `json:"duration"`
+	Artifacts  int           `json:"artifacts"` // Number of .eopkg files produced
+	Error      string        `json:"error,omitempty"`
+}
+
+// Built will determine whether the package no longer needs to be built
+func (e *BatchEntry) Built() bool {
+	return e.Result == BatchSucceeded || e.Result == BatchSkipped
+}
+
+// BatchState is the progress of a batch build, saved after every package so
+// that an interrupted or failed batch can be resumed
+type BatchState struct {
+	Version int           `json:"version"`
+	Started time.Time     `json:"started"`
+	Entries []*BatchEntry `json:"entries"`
+
+	path string
+}
+
+// NewBatchState will create the state of a new batch build of pkgs, in
+// order, to be stored at path
+func NewBatchState(path string, pkgs []*Package) (*BatchState, error) {
+	s := &BatchState{
+		Version: BatchStateVersion,
+		Started: time.Now().UTC(),
+		path:    path,
+	}
+	for _, pkg := range pkgs {
+		recipe, err := filepath.Abs(pkg.Path)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hashFile(recipe, false)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to hash recipe %s, reason: %s\n", recipe, err)
+		}
+		s.Entries = append(s.Entries, &BatchEntry{
+			Recipe:     recipe,
+			Name:       pkg.Name,
+			RecipeHash: sum,
+			Result:     BatchPending,
+		})
+	}
+	return s, nil
+}
+
+// LoadBatchState will load the batch state stored at path
+func LoadBatchState(path string) (*BatchState, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &BatchState{path: path}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("Failed to parse batch state %s, reason: %s\n", path, err)
+	}
+	if s.Version != BatchStateVersion {
+		return nil, fmt.Errorf("%s: %s has version %d, expected %d", ErrBatchStateVersion, path, s.Version, BatchStateVersion)
+	}
+	return s, nil
+}
+
+// Resume will skip every package that the previous run built, unless its
+// recipe has changed since, returning the number of packages skipped
+func (s *BatchState) Resume(previous *BatchState) int {
+	built := make(map[string]*BatchEntry)
+	for _, entry := range previous.Entries {
+		if entry.Built() {
+			built[entry.Recipe] = entry
+		}
+	}
+	skipped := 0
+	for _, entry := range s.Entries {
+		prev, ok := built[entry.Recipe]
+		if !ok {
+			continue
+		}
+		if prev.RecipeHash != entry.RecipeHash {
+			log.Infof("Recipe of %s has changed since the previous run, rebuilding\n", entry.Name)
+			continue
+		}
+		entry.Result = BatchSkipped
+		entry.Artifacts = prev.Artifacts
+		skipped++
+	}
+	return skipped
+}
+
+// Save will write the state out, replacing any previous state
+func (s *BatchState) Save() error {
+	b, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+	// Never leave a partially written file behind
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 00644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Count will return the number of packages with the given result
+func (s *BatchState) Count(result BatchResult) int {
+	n := 0
+	for _, entry := range s.Entries {
+		if entry.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// A BatchSummary is written at the end of every batch build
+type BatchSummary struct {
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+	Pending   int           `json:"pending"`
+	Packages  []*BatchEntry `json:"packages"`
+}
+
+// Summary will summarise the batch build so far
+func (s *BatchState) Summary() *BatchSummary {
+	return &BatchSummary{
+		Started:   s.Started,
+		Duration:  time.Since(s.Started),
+		Succeeded: s.Count(BatchSucceeded),
+		Failed:    s.Count(BatchFailed),
+		Skipped:   s.Count(BatchSkipped),
+		Pending:   s.Count(BatchPending),
+		Packages:  s.Entries,
+	}
+}
+
+// WriteSummary will write the summary of the batch build to path
+func (s *BatchState) WriteSummary(path string) error {
+	b, err := json.MarshalIndent(s.Summary(), "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 00644)
+}
+
+// NewArtifacts will return the .eopkg files of pkg in dir that have been
+// created or replaced since the given time
+func NewArtifacts(dir string, pkg *Package, since time.Time) ([]string, error) {
+	eopkgs, err := filepath.Glob(filepath.Join(dir, "*.eopkg"))
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []string
+	for _, eopkg := range eopkgs {
+		if !pkg.ownsArtifact(filepath.Base(eopkg)) {
+			continue
+		}
+		st, err := os.Stat(eopkg)
+		if err != nil {
+			continue
+		}
+		if !st.ModTime().Before(since) {
+			artifacts = append(artifacts, eopkg)
+		}
+	}
+	return artifacts, nil
+}
+
+// ownsArtifact will determine whether the named .eopkg was built from the
+// recipe of p, as name-version-release-build-arch.eopkg
+func (p *Package) ownsArtifact(name string) bool {
+	names := append([]string{p.Name}, p.Provides...)
+	if p.Type == PackageTypeYpkg {
+		for _, suffix := range implicitSubpackages {
+			names = append(names, p.Name+"-"+suffix)
+		}
+	}
+	for _, n := range names {
+		if strings.HasPrefix(name, fmt.Sprintf("%s-%s-%d-", n, p.Version, p.Release)) {
+			return true
+		}
+	}
+	return false
+}
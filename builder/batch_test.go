@@ -0,0 +1,109 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-batch")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	var pkgs []*Package
+	for _, name := range []string{"nano", "gdb", "vim"} {
+		recipe := filepath.Join(dir, name, "package.yml")
+		os.MkdirAll(filepath.Dir(recipe), 00755)
+		if err := ioutil.WriteFile(recipe, []byte("name: "+name), 00644); err != nil {
+			t.Fatalf("Failed to write recipe: %v", err)
+		}
+		pkgs = append(pkgs, &Package{Name: name, Path: recipe})
+	}
+	statePath := filepath.Join(dir, BatchStateFile)
+	state, err := NewBatchState(statePath, pkgs)
+	if err != nil {
+		t.Fatalf("Failed to create batch state: %v", err)
+	}
+	state.Entries[0].Result = BatchSucceeded
+	state.Entries[0].Artifacts = 2
+	state.Entries[1].Result = BatchSucceeded
+	state.Entries[2].Result = BatchFailed
+	if err := state.Save(); err != nil {
+		t.Fatalf("Failed to save batch state: %v", err)
+	}
+
+	// gdb changed since, so only nano is skipped
+	ioutil.WriteFile(pkgs[1].Path, []byte("name: gdb\nrelease: 2"), 00644)
+	previous, err := LoadBatchState(statePath)
+	if err != nil {
+		t.Fatalf("Failed to load batch state: %v", err)
+	}
+	resumed, err := NewBatchState(statePath, pkgs)
+	if err != nil {
+		t.Fatalf("Failed to create batch state: %v", err)
+	}
+	if skipped := resumed.Resume(previous); skipped != 1 {
+		t.Fatalf("Expected 1 package to be skipped, got %d", skipped)
+	}
+	if resumed.Entries[0].Result != BatchSkipped || resumed.Entries[0].Artifacts != 2 {
+		t.Fatalf("Built package was not skipped: %+v", resumed.Entries[0])
+	}
+	if resumed.Count(BatchPending) != 2 {
+		t.Fatalf("Expected changed and failed packages to be rebuilt, got %+v", resumed.Summary())
+	}
+
+	// Incompatible state is refused
+	ioutil.WriteFile(statePath, []byte(`{"version": 99}`), 00644)
+	if _, err := LoadBatchState(statePath); err == nil || !strings.HasPrefix(err.Error(), ErrBatchStateVersion.Error()) {
+		t.Fatalf("Expected unsupported version, got: %v", err)
+	}
+}
+
+func TestNewArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-artifacts")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"nano-5.8-151-1-x86_64.eopkg",
+		"nano-dbginfo-5.8-151-1-x86_64.eopkg",
+		"nano-docs-5.8-151-1-x86_64.eopkg",
+		"nano-5.7-150-1-x86_64.eopkg",
+		"nano-syntax-1.0-2-1-x86_64.eopkg",
+	} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 00644)
+	}
+	pkg := &Package{Name: "nano", Version: "5.8", Release: 151, Type: PackageTypeYpkg, Provides: []string{"nano", "nano-docs"}}
+	artifacts, err := NewArtifacts(dir, pkg, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to find artifacts: %v", err)
+	}
+	if len(artifacts) != 3 {
+		t.Fatalf("Expected 3 artifacts, got: %v", artifacts)
+	}
+	if artifacts, _ := NewArtifacts(dir, pkg, time.Now().Add(time.Minute)); len(artifacts) != 0 {
+		t.Fatalf("Found artifacts older than the build: %v", artifacts)
+	}
+}
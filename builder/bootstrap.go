@@ -0,0 +1,193 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"os"
+	"os/exec"
+)
+
+const (
+	// DefaultBootstrapSize is the size of a bootstrapped image, unless the
+	// profile says otherwise
+	DefaultBootstrapSize = "20G"
+
+	// DefaultBootstrapRepoName is the name of the repository a bootstrapped
+	// image is installed and later updated from
+	DefaultBootstrapRepoName = "Solus"
+
+	// BootstrapPartialSuffix is appended to the path of an image while it is
+	// bootstrapped, so that an interrupted bootstrap never looks installed
+	BootstrapPartialSuffix = ".partial"
+)
+
+var (
+	// ErrNoBootstrap is returned when bootstrapping an image for a profile
+	// without a [bootstrap] section
+	ErrNoBootstrap = errors.New("The profile does not describe how to bootstrap its image")
+
+	// ErrInvalidBootstrap is returned for an incomplete [bootstrap] section
+	ErrInvalidBootstrap = errors.New("Invalid bootstrap configuration")
+
+	// ErrNoHostEopkg is returned when bootstrapping without eopkg on the host
+	ErrNoHostEopkg = errors.New("eopkg must be installed on the host to bootstrap an image")
+)
+
+// A BootstrapConfig describes how to build the image of a profile from
+// scratch, for derivatives without a published image
+type BootstrapConfig struct {
+	Repo       string   `toml:"repo"`       // URI of the repository to install from
+	RepoName   string   `toml:"repo_name"`  // Name of the repository within the image
+	Components []string `toml:"components"` // Components making up the base system, i.e. system.base
+	Packages   []string `toml:"packages"`   // Any further packages to install
+	Size       string   `toml:"size"`       // Size of the image, i.e. 20G
+}
+
+// Validate will ensure the configuration describes a usable base system,
+// returning the size of the image in bytes
+func (c *BootstrapConfig) Validate() (int64, error) {
+	if c.Repo == "" {
+		return 0, fmt.Errorf("%s: no repo is set", ErrInvalidBootstrap)
+	}
+	if len(c.Components) < 1 && len(c.Packages) < 1 {
+		return 0, fmt.Errorf("%s: no components or packages are set", ErrInvalidBootstrap)
+	}
+	size := c.Size
+	if size == "" {
+		size = DefaultBootstrapSize
+	}
+	bytes, err := ParseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", ErrInvalidBootstrap, err)
+	}
+	if bytes < GiB {
+		return 0, fmt.Errorf("%s: an image of %s is too small", ErrInvalidBootstrap, size)
+	}
+	return bytes, nil
+}
+
+// createImage will create a sparse ext4 image of the given size
+func (b *BackingImage) createImage(size int64) error {
+	log.Infof("Creating %s image %s\n", FormatBytes(size), b.ImagePath)
+	f, err := os.OpenFile(b.ImagePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 00644)
+	if err != nil {
+		return fmt.Errorf("Failed to create image %s, reason: %s\n", b.ImagePath, err)
+	}
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to size image %s, reason: %s\n", b.ImagePath, err)
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err := commands.ExecStdoutArgs("mkfs.ext4", []string{"-q", "-F", "-L", b.Name, b.ImagePath}); err != nil {
+		return fmt.Errorf("Failed to create filesystem in %s, reason: %s\n", b.ImagePath, err)
+	}
+	return nil
+}
+
+// hostEopkg will run eopkg on the host against the mounted image
+func (b *BackingImage) hostEopkg(args ...string) error {
+	args = append(args, "-D", b.RootDir)
+	if DisableColors {
+		args = append(args, "-N")
+	}
+	log.Debugf("Running eopkg %v\n", args)
+	return commands.ExecStdoutArgs("eopkg", args)
+}
+
+// Bootstrap will build the image from scratch in two stages. The base system
+// is first installed by eopkg on the host into the mounted image, without
+// running any configuration scripts, which are then run from within the
+// image once it can be entered. The image is built beside its final path,
+// and only moved into place once complete, while still mounted.
+func (b *BackingImage) Bootstrap(notif PidNotifier, pkgManager PackageManager, config *BootstrapConfig) error {
+	size, err := config.Validate()
+	if err != nil {
+		return err
+	}
+	if b.IsInstalled() {
+		return ErrImageExists
+	}
+	if _, err := exec.LookPath("eopkg"); err != nil {
+		return ErrNoHostEopkg
+	}
+	partial := *b
+	partial.ImagePath = b.ImagePath + BootstrapPartialSuffix
+	if err := os.Remove(partial.ImagePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := partial.createImage(size); err != nil {
+		return err
+	}
+	if err := partial.mountRoot(); err != nil {
+		return err
+	}
+
+	repoName := config.RepoName
+	if repoName == "" {
+		repoName = DefaultBootstrapRepoName
+	}
+	log.Infof("Installing the base system from %s\n", config.Repo)
+	if err := b.hostEopkg("add-repo", repoName, config.Repo); err != nil {
+		return fmt.Errorf("Failed to add repository %s, reason: %s\n", config.Repo, err)
+	}
+	install := []string{"install", "-y", "--ignore-comar"}
+	for _, comp := range config.Components {
+		install = append(install, "-c", comp)
+	}
+	install = append(install, config.Packages...)
+	if err := b.hostEopkg(install...); err != nil {
+		return fmt.Errorf("Failed to install the base system, reason: %s\n", err)
+	}
+
+	log.Infoln("Configuring the base system")
+	if err := pkgManager.Init(); err != nil {
+		return fmt.Errorf("Failed to initialise package manager, reason: %s\n", err)
+	}
+	if err := pkgManager.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %s\n", err)
+	}
+	err = ChrootExec(notif, b.RootDir, eopkgCommand("eopkg configure-pending"))
+	notif.SetActivePID(0)
+	if err != nil {
+		return fmt.Errorf("Failed to configure the base system, reason: %s\n", err)
+	}
+	log.Debugln("Asserting system.devel component")
+	if err := pkgManager.InstallComponent("system.devel"); err != nil {
+		return fmt.Errorf("Failed to install system.devel, reason: %s\n", err)
+	}
+	if err := pkgManager.StopDBUS(); err != nil {
+		return fmt.Errorf("Failed to stop d-bus, reason: %s\n", err)
+	}
+
+	if err := AddBuildUser(b.RootDir); err != nil {
+		return err
+	}
+	if err := os.Rename(partial.ImagePath, b.ImagePath); err != nil {
+		return fmt.Errorf("Failed to install image %s, reason: %s\n", b.ImagePath, err)
+	}
+	if err := b.WriteStamp(); err != nil {
+		return err
+	}
+	log.Infof("Image successfully bootstrapped %s\n", b.Name)
+	return nil
+}
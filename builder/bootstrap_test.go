@@ -0,0 +1,67 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bootstrapProfile = `image = "mydistro-x86_64"
+
+[bootstrap]
+repo = "https://example.com/mydistro/eopkg-index.xml.xz"
+components = ["system.base"]
+packages = ["nano"]
+size = "40G"
+`
+
+func TestLoadBootstrapProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydistro.profile")
+	if err := ioutil.WriteFile(path, []byte(bootstrapProfile), 00644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := NewProfileFromPath(path)
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+	if profile.Bootstrap == nil || profile.Bootstrap.Repo != "https://example.com/mydistro/eopkg-index.xml.xz" {
+		t.Fatalf("Wrong bootstrap configuration: %+v", profile.Bootstrap)
+	}
+	size, err := profile.Bootstrap.Validate()
+	if err != nil || size != 40*GiB {
+		t.Fatalf("Expected a 40G image, got %d %v", size, err)
+	}
+}
+
+func TestBootstrapConfigValidate(t *testing.T) {
+	if size, err := (&BootstrapConfig{Repo: "https://example.com", Components: []string{"system.base"}}).Validate(); err != nil || size != 20*GiB {
+		t.Fatalf("Expected the default size, got %d %v", size, err)
+	}
+	for _, config := range []*BootstrapConfig{
+		{Components: []string{"system.base"}},
+		{Repo: "https://example.com"},
+		{Repo: "https://example.com", Packages: []string{"nano"}, Size: "big"},
+		{Repo: "https://example.com", Packages: []string{"nano"}, Size: "100M"},
+	} {
+		if _, err := config.Validate(); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidBootstrap.Error()) {
+			t.Errorf("Expected %+v to be invalid, got: %v", config, err)
+		}
+	}
+}
@@ -21,8 +21,11 @@ import (
 	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/disk"
+	"github.com/getsolus/solbuild/builder/source"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // CreateDirs creates any directories we may need later on
@@ -70,18 +73,55 @@ func (p *Package) CreateDirs(o *Overlay) error {
 // FetchSources will attempt to fetch the sources from the network
 // if necessary
 func (p *Package) FetchSources(o *Overlay) error {
+	var stamps *SourceStamps
+	if VerifySources {
+		stamps = LoadSourceStamps(filepath.Join(source.SourceDir, SourceStampsFile))
+		defer func() {
+			if err := stamps.Save(); err != nil {
+				log.Warnf("Failed to save source stamps, reason: %s\n", err)
+			}
+		}()
+	}
 	for _, source := range p.Sources {
-		// Already fetched, skip it
+		// Already fetched, skip it unless it has been corrupted
 		if source.IsFetched() {
-			continue
+			if stamps == nil {
+				continue
+			}
+			valid, err := stamps.verifyCached(source)
+			if err != nil {
+				return err
+			}
+			if valid {
+				continue
+			}
 		}
-		if err := source.Fetch(); err != nil {
+		if err := fetchWithRetry(source); err != nil {
 			return fmt.Errorf("Failed to fetch source %s, reason: %s\n", source.GetIdentifier(), err)
 		}
 	}
 	return nil
 }
 
+// fetchWithRetry will fetch the source, retrying transient failures up to
+// FetchRetries times with an exponential backoff.
+func fetchWithRetry(src source.Source) error {
+	backoff := FetchBackoff
+	for attempt := 1; ; attempt++ {
+		err := src.Fetch()
+		if err == nil || !source.IsTransient(err) || attempt >= FetchRetries {
+			return err
+		}
+		// No point in retrying once the fetch phase has run out of time
+		if !source.Deadline.IsZero() && time.Now().Add(backoff).After(source.Deadline) {
+			return err
+		}
+		log.Warnf("Fetch of %s failed (attempt %d of %d), retrying in %s, reason: %s\n", src.GetIdentifier(), attempt, FetchRetries, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
 // BindSources will make the sources available to the chroot by bind mounting
 // them into place.
 func (p *Package) BindSources(o *Overlay) error {
@@ -226,8 +266,37 @@ func (p *Package) GetSccacheDirInternal() string {
 	return filepath.Join(BuildUserHome, ".cache", "sccache")
 }
 
-// CopyAssets will copy all of the required assets into the builder root
+// FindComponentXML will look for the component.xml beside the recipe, then
+// walk up through the parent directories to find the nearest one. The search
+// is bounded to ComponentSearchDepth levels, and stops at a repository root.
+func FindComponentXML(baseDir string) string {
+	dir := baseDir
+	for i := 0; i <= ComponentSearchDepth; i++ {
+		path := filepath.Join(dir, "component.xml")
+		if PathExists(path) {
+			if dir != baseDir {
+				log.Infof("Using component.xml from %s\n", path)
+			}
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || PathExists(filepath.Join(dir, ".git")) {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// CopyAssets will copy all of the required assets into the builder root.
+// The recipe must exist, while all other assets are optional.
 func (p *Package) CopyAssets(h *PackageHistory, o *Overlay) error {
+	return p.copyAssetsTo(h, p.GetWorkDir(o))
+}
+
+// copyAssetsTo will copy the recipe, its assets and the history of the
+// package into destdir
+func (p *Package) copyAssetsTo(h *PackageHistory, destdir string) error {
 	baseDir := filepath.Dir(p.Path)
 
 	if abs, err := filepath.Abs(baseDir); err == nil {
@@ -247,20 +316,26 @@ func (p *Package) CopyAssets(h *PackageHistory, o *Overlay) error {
 		copyPaths = append(copyPaths, "actions.py")
 	}
 
-	// This should be changed for ypkg.
-	destdir := p.GetWorkDir(o)
-
 	for _, pat := range copyPaths {
 		fso := filepath.Join(baseDir, pat)
+		if pat == "component.xml" {
+			if fso = FindComponentXML(baseDir); fso == "" {
+				continue
+			}
+		}
 		newDest := destdir
 		if p.Type == PackageTypeXML && pat == "component.xml" {
 			newDest = filepath.Dir(destdir)
 		}
-		if err := CopyAll(fso, newDest); err != nil {
+		if err := copyAsset(fso, newDest, pat == filepath.Base(p.Path)); err != nil {
 			return err
 		}
 	}
 
+	if err := copyExtraAssets(baseDir, destdir); err != nil {
+		return err
+	}
+
 	if h == nil {
 		return nil
 	}
@@ -270,7 +345,7 @@ func (p *Package) CopyAssets(h *PackageHistory, o *Overlay) error {
 }
 
 // PrepYpkg will do the initial leg work of preparing us for a ypkg build.
-func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager, overlay *Overlay, h *PackageHistory) error {
+func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman PackageManager, overlay *Overlay, h *PackageHistory) error {
 	log.Debugln("Writing packager file")
 	fp := filepath.Join(overlay.MountPoint, BuildUserHome, ".config", "solus", "packager")
 	fpd := filepath.Dir(fp)
@@ -287,18 +362,13 @@ func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager,
 
 	wdir := p.GetWorkDirInternal()
 	ymlFile := filepath.Join(wdir, filepath.Base(p.Path))
-	cmd := fmt.Sprintf("ypkg-install-deps -f %s", ymlFile)
-	if DisableColors {
-		cmd += " -n"
-	}
 
 	// Install build dependencies
 	log.Debugf("Installing build dependencies %s\n", ymlFile)
 
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
+	if err := pman.InstallBuildDeps(ymlFile); err != nil {
 		return fmt.Errorf("Failed to install build dependencies %s, reason: %s\n", ymlFile, err)
 	}
-	notif.SetActivePID(0)
 
 	// Cleanup now
 	log.Debugln("Stopping D-BUS")
@@ -307,7 +377,7 @@ func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager,
 	}
 
 	// Chwn the directory before bringing up sources
-	cmd = fmt.Sprintf("chown -R %s:%s %s", BuildUser, BuildUser, BuildUserHome)
+	cmd := fmt.Sprintf("chown -R %s:%s %s", BuildUser, BuildUser, BuildUserHome)
 	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
 		return fmt.Errorf("Failed to set home directory permissions, reason: %s\n", err)
 	}
@@ -317,13 +387,21 @@ func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager,
 
 // BuildYpkg will take care of the ypkg specific build process and is called only
 // by Build()
-func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager, overlay *Overlay, h *PackageHistory) error {
+func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman PackageManager, overlay *Overlay, h *PackageHistory, timer *StageTimer) error {
+	timer.Start(StageDeps)
 	if err := p.PrepYpkg(notif, usr, pman, overlay, h); err != nil {
 		return err
 	}
 
-	// Now kill networking
-	if !p.CanNetwork {
+	timer.Start(StageBuild)
+
+	// Now kill networking, leaving only the distcc hosts reachable if enabled
+	if !Isolation.DropsNetwork() {
+		log.Warnln("Isolation disabled, the build may access the network")
+		if err := overlay.EnableNetworking(); err != nil {
+			return err
+		}
+	} else if !p.CanNetwork {
 		if err := DropNetworking(); err != nil {
 			return err
 		}
@@ -334,6 +412,19 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 		}
 	} else {
 		log.Warnln("Package has explicitly requested networking, sandboxing disabled")
+		if err := overlay.EnableNetworking(); err != nil {
+			return err
+		}
+	}
+	if len(DistccHosts) > 0 {
+		if err := ConfigureDistcc(overlay); err != nil {
+			return err
+		}
+	}
+	if p.IceCCEnabled {
+		if err := p.BindIcecc(overlay); err != nil {
+			return err
+		}
 	}
 
 	// Bring up sources
@@ -361,23 +452,36 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 		return err
 	}
 
+	if LintSources {
+		if err := p.Lint(notif, overlay); err != nil {
+			return err
+		}
+	}
+
 	wdir := p.GetWorkDirInternal()
 	ymlFile := filepath.Join(wdir, filepath.Base(p.Path))
 
 	// Now build the package
 	cmd := fmt.Sprintf("/bin/su %s -- fakeroot ypkg-build -D %s %s", BuildUser, wdir, ymlFile)
-	if DisableColors {
-		cmd += " -n"
+	if len(DistccHosts) > 0 && distccPump(DistccHosts, chrootHasTool(notif, overlay.MountPoint)) {
+		cmd = fmt.Sprintf("/bin/su %s -- pump fakeroot ypkg-build -D %s %s", BuildUser, wdir, ymlFile)
 	}
-	// Pass unix timestamp of last git update
-	if h != nil && len(h.Updates) > 0 {
-		cmd += fmt.Sprintf(" -t %v", h.GetLastVersionTimestamp())
+	if flags := p.ypkgBuildFlags(h); len(flags) > 0 {
+		cmd += " " + strings.Join(flags, " ")
 	}
 
+	ccache := p.ccacheStats(notif, overlay)
 	log.Infoln("Now starting build of package")
+	steps := watchYpkgSteps(ChrootOutput)
 	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
+		if steps.checkFailed() {
+			// Fail in the test stage, so that CI can tell the package built
+			timer.Start(StageTest)
+			return fmt.Errorf("Package tests failed, reason: %s\n", err)
+		}
 		return fmt.Errorf("Failed to start build of package, reason: %s\n", err)
 	}
+	p.recordCcache(notif, overlay, ccache)
 
 	// Generate ABI Report
 	if !DisableABIReport {
@@ -392,11 +496,29 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 	return nil
 }
 
+// ypkgBuildFlags returns the options passed to ypkg-build for a build
+func (p *Package) ypkgBuildFlags(h *PackageHistory) []string {
+	var flags []string
+	if DisableColors {
+		flags = append(flags, "-n")
+	}
+	// Pass the fixed build time, or the unix timestamp of last git update
+	if p.FixedTime {
+		flags = append(flags, "-t", fmt.Sprint(p.BuildTime.Unix()))
+	} else if h != nil && len(h.Updates) > 0 {
+		flags = append(flags, "-t", fmt.Sprint(h.GetLastVersionTimestamp()))
+	}
+	return flags
+}
+
 // BuildXML will take care of building the legacy pspec.xml format, and is called only
 // by Build()
-func (p *Package) BuildXML(notif PidNotifier, pman *EopkgManager, overlay *Overlay) error {
+func (p *Package) BuildXML(notif PidNotifier, pman PackageManager, overlay *Overlay) error {
 	// Just straight up build it with eopkg
 	log.Warnln("Full sandboxing is not possible with legacy format")
+	if err := overlay.EnableNetworking(); err != nil {
+		return err
+	}
 
 	wdir := p.GetWorkDirInternal()
 	xmlFile := filepath.Join(wdir, filepath.Base(p.Path))
@@ -423,11 +545,17 @@ func (p *Package) BuildXML(notif PidNotifier, pman *EopkgManager, overlay *Overl
 
 	// Now build the package, ignore-sandbox in case someone is stupid
 	// and activates it in eopkg.conf..
-	cmd := eopkgCommand(fmt.Sprintf("eopkg build --ignore-sandbox --yes-all -O %s %s", wdir, xmlFile))
+	cmd, err := xmlBuildCommand(chrootHasTool(notif, overlay.MountPoint),
+		eopkgCommand(fmt.Sprintf("eopkg build --ignore-sandbox --yes-all -O %s %s", wdir, xmlFile)))
+	if err != nil {
+		return err
+	}
+	ccache := p.ccacheStats(notif, overlay)
 	log.Infof("Now starting build of package %s\n", p.Name)
 	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		return fmt.Errorf("Failed to start build of package.\n")
+		return fmt.Errorf("Failed to start build of package, reason: %s\n", err)
 	}
+	p.recordCcache(notif, overlay, ccache)
 	notif.SetActivePID(0)
 
 	// Now we can stop dbus..
@@ -455,14 +583,24 @@ func (p *Package) GenerateABIReport(notif PidNotifier, overlay *Overlay) error {
 // CollectAssets will search for the build files and copy them back to the
 // users current directory. If solbuild was invoked via sudo, solbuild will
 // then attempt to set the owner as the original user.
-func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget string) error {
-	collectionDir := p.GetWorkDir(overlay)
+func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget string, timer *StageTimer) error {
+	return p.collectArtifacts(p.GetWorkDir(overlay), usr, manifestTarget, timer)
+}
+
+// collectArtifacts will copy the build artifacts within collectionDir out to
+// the current directory
+func (p *Package) collectArtifacts(collectionDir string, usr *UserInfo, manifestTarget string, timer *StageTimer) error {
 	collections, _ := filepath.Glob(filepath.Join(collectionDir, "*.eopkg"))
 	if len(collections) < 1 {
 		log.Errorln("Mysterious lack of eopkg files is mysterious")
 		return errors.New("Internal error: .eopkg files are missing")
 	}
 
+	// Refuse to hand out packages of the wrong version
+	if err := p.Verify(collections); err != nil {
+		return err
+	}
+
 	// Prior to blitting the files out, let's grab the manifest if requested
 	if manifestTarget != "" {
 		tram := NewTransitManifest(manifestTarget)
@@ -471,6 +609,8 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 				return fmt.Errorf("Failed to collect eopkg asset for transit manifest %s, reason: %s\n", p, err)
 			}
 		}
+		tram.AddTimings(timer.Timings)
+		tram.BuildTime = p.BuildTime
 
 		// $source-$version-$release.tram
 		// We omit arch for *now*, Solus isn't multiple architecture yet.
@@ -497,11 +637,21 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 
 	log.Debugf("Collecting files %d\n", len(collections))
 
-	for _, p := range collections {
-		tgt, err := filepath.Abs(filepath.Join(".", filepath.Base(p)))
-		if err != nil {
-			return fmt.Errorf("Unable to find working directory, reason: %s\n", err)
-		}
+	outputDir, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("Unable to find working directory, reason: %s\n", err)
+	}
+	// Compare before the previous ABI report is replaced
+	if err := p.CompareABI(collectionDir, outputDir); err != nil {
+		return err
+	}
+	targets, err := artifactTargets(collections, outputDir)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range collections {
+		tgt := targets[i]
 
 		log.Debugf("Collecting build artifact %s\n", filepath.Base(p))
 
@@ -515,84 +665,240 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 			log.Errorf("Error in restoring file ownership %s, reason: %s\n", filepath.Base(p), err)
 		}
 	}
+
+	if PolicyCheck {
+		var eopkgs []string
+		for _, tgt := range targets {
+			if strings.HasSuffix(tgt, ".eopkg") {
+				eopkgs = append(eopkgs, tgt)
+			}
+		}
+		log.Infof("Checking %d package(s) against the packaging policy\n", len(eopkgs))
+		return CheckPolicy(eopkgs)
+	}
 	return nil
 }
 
+// PrepareRoot will upgrade the root and install the base development
+// packages, and is called only by Build()
+func (p *Package) PrepareRoot(notif PidNotifier, profile *Profile, pman PackageManager, overlay *Overlay, timer *StageTimer) error {
+	timer.Start(StageUpgrade)
+
+	// Set up package manager
+	if err := pman.Init(); err != nil {
+		return err
+	}
+
+	// Bring up dbus to do Things
+	log.Debugln("Starting D-BUS")
+	if err := pman.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %s\n", err)
+	}
+
+	// Get the repos in place before asserting anything
+	if err := p.ConfigureRepos(notif, overlay, pman, profile); err != nil {
+		return fmt.Errorf("Configuring repositories failed, reason: %s\n", err)
+	}
+	if err := recordRepos(pman); err != nil {
+		return err
+	}
+
+	upgrade, reason := upgradeNeeded(overlay, profile, time.Now())
+	if !upgrade {
+		log.Infof("Skipping upgrade of system base %s\n", reason)
+		if err := pman.RefreshRepos(); err != nil {
+			return fmt.Errorf("Failed to refresh repositories, reason: %s\n", err)
+		}
+	} else {
+		log.Infof("Upgrading system base %s\n", reason)
+		if err := pman.Upgrade(); err != nil {
+			return fmt.Errorf("Failed to upgrade rootfs, reason: %s\n", err)
+		}
+		if overlay != nil {
+			if err := overlay.RecordUpgrade(); err != nil {
+				log.Warnf("Failed to record upgrade, reason: %s\n", err)
+			}
+		}
+	}
+
+	timer.Start(StageDevel)
+
+	log.Debugln("Checking system.devel component for conflicts")
+	if err := CheckConflicts(pman.DryRunComponent("system.devel")); err != nil {
+		return err
+	}
+
+	log.Debugln("Asserting system.devel component installation")
+	if err := pman.InstallComponent("system.devel"); err != nil {
+		return fmt.Errorf("Failed to assert system.devel, reason: %s\n", err)
+	}
+
+	for _, comp := range p.ExtraComponents {
+		log.Infof("Installing component %s for the package\n", comp)
+		if err := pman.InstallComponent(comp); err != nil {
+			return fmt.Errorf("Failed to install component %s, reason: %s\n", comp, err)
+		}
+	}
+
+	if err := pman.InstallExtras(); err != nil {
+		return err
+	}
+
+	if len(profile.PreInstall) > 0 {
+		log.Infof("Installing packages for profile %s: %s\n", profile.Name, strings.Join(profile.PreInstall, " "))
+		if err := pman.InstallPackages(profile.PreInstall); err != nil {
+			return fmt.Errorf("Failed to install packages for profile %s, reason: %s\n", profile.Name, err)
+		}
+	}
+
+	if len(DistccHosts) > 0 && p.Type == PackageTypeYpkg {
+		log.Debugln("Installing distcc")
+		if err := pman.InstallPackages([]string{"distcc"}); err != nil {
+			return fmt.Errorf("Failed to install distcc, reason: %s\n", err)
+		}
+	}
+
+	if p.IceCCEnabled && p.Type == PackageTypeYpkg {
+		log.Debugln("Installing icecc")
+		if err := pman.InstallPackages([]string{IceccPackage}); err != nil {
+			return fmt.Errorf("Failed to install icecc, reason: %s\n", err)
+		}
+	}
+
+	// Pins are applied last, as anything installed before may upgrade them
+	return pman.ApplyPins()
+}
+
 // Build will attempt to build the package in the overlayfs system
-func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Profile, pman *EopkgManager, overlay *Overlay, manifestTarget string) error {
-	log.Debugf("Building package %s %s %d %s %s\n", p.Name, p.Version, p.Release, p.Type, overlay.Back.Name)
+//
+// Each stage of the build is recorded by the timer, and any error will be
+// wrapped in a StageError identifying the stage that failed.
+func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Profile, pman PackageManager, overlay *Overlay, manifestTarget string, timer *StageTimer) error {
+	log.Debugf("Building package %s %s %d %s %s\n", p.Name, p.Version, p.Release, p.Type, overlay.BackingImage.Name)
+
+	if CrossArch != "" && p.Type != PackageTypeYpkg {
+		return ErrCrossUnsupported
+	}
+
+	// Colliding sources would be bound on top of each other
+	if collisions := p.SourceCollisions(); len(collisions) > 0 {
+		return collisions[0]
+	}
 
 	usr := GetUserInfo()
 
+	config, err := LoadProfileConfig(profile.Name)
+	if err != nil {
+		return err
+	}
+	profile = config.Merge(profile)
+	if profile, err = profile.OverrideRepos(); err != nil {
+		return err
+	}
+
 	var env []string
 	if p.Type == PackageTypeXML {
 		env = SaneEnvironment("root", "/root")
 	} else {
 		env = SaneEnvironment(BuildUser, BuildUserHome)
 	}
+	env = config.Environment(env)
+	env = buildEnvironment(env, p.BuildEnv)
+	if p.FixedTime {
+		env = append(env, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", p.BuildTime.Unix()))
+	}
 	ChrootEnvironment = env
+	DumpEnvironment(env)
 
-	// Set up environment
-	if err := overlay.CleanExisting(); err != nil {
-		return err
+	timer.Start(StageActivate)
+
+	if MinDiskSpace > 0 {
+		if err := overlay.BackingImage.CheckDiskSpace(MinDiskSpace); err != nil {
+			return timer.Fail(err)
+		}
+		// The build itself is written beneath the overlay root
+		if !overlay.EnableTmpfs {
+			if err := checkFreeSpace(overlay.BaseDir, MinDiskSpace); err != nil {
+				return timer.Fail(err)
+			}
+		}
 	}
 
-	// Bring up the root
-	if err := p.ActivateRoot(overlay); err != nil {
-		return err
+	overlay.Direct = !Isolation.UsesOverlay()
+	if Isolation != IsolationFull {
+		log.Warnf("Building with reduced isolation: %s\n", Isolation)
 	}
 
-	// Ensure source assets are in place
-	if err := p.CopyAssets(history, overlay); err != nil {
-		return fmt.Errorf("Failed to copy required source assets, reason: %s\n", err)
+	reused := false
+	if overlay.Incremental && !overlay.Direct && RepoURL == "" && RepoSnapshot == "" {
+		if reused, err = overlay.ReuseIfValid(); err != nil {
+			return timer.Fail(err)
+		}
 	}
 
-	log.Debugln("Validating sources")
-	if err := p.FetchSources(overlay); err != nil {
-		return err
+	// Set up environment
+	if !reused {
+		if err := overlay.CleanExisting(); err != nil {
+			return timer.Fail(err)
+		}
 	}
 
-	// Set up package manager
-	if err := pman.Init(); err != nil {
-		return err
+	// Bring up the root
+	if err := p.ActivateRoot(overlay); err != nil {
+		return timer.Fail(err)
 	}
 
-	// Bring up dbus to do Things
-	log.Debugln("Starting D-BUS")
-	if err := pman.StartDBUS(); err != nil {
-		return fmt.Errorf("Failed to start d-bus, reason: %s\n", err)
+	if overlay.Incremental && !overlay.Direct && !reused && !overlay.EnableTmpfs {
+		if err := overlay.WriteMetadata(); err != nil {
+			return timer.Fail(err)
+		}
 	}
 
-	// Get the repos in place before asserting anything
-	if err := p.ConfigureRepos(notif, overlay, pman, profile); err != nil {
-		return fmt.Errorf("Configuring repositories failed, reason: %s\n", err)
+	timer.Start(StageFetch)
+
+	// Ensure source assets are in place
+	if err := p.CopyAssets(history, overlay); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to copy required source assets, reason: %s\n", err))
 	}
 
-	log.Debugln("Upgrading system base")
-	if err := pman.Upgrade(); err != nil {
-		return fmt.Errorf("Failed to upgrade rootfs, reason: %s\n", err)
+	if err := p.RunPreBuildHooks(profile); err != nil {
+		return timer.Fail(err)
 	}
 
-	log.Debugln("Asserting system.devel component installation")
-	if err := pman.InstallComponent("system.devel"); err != nil {
-		return fmt.Errorf("Failed to assert system.devel, reason: %s\n", err)
+	log.Debugln("Validating sources")
+	if err := p.FetchSources(overlay); err != nil {
+		return timer.Fail(err)
+	}
+
+	if err := p.PrepareRoot(notif, profile, pman, overlay, timer); err != nil {
+		return timer.Fail(err)
 	}
 
 	// Ensure all directories are in place
 	if err := p.CreateDirs(overlay); err != nil {
-		return err
+		return timer.Fail(err)
 	}
 
 	// Call the relevant build function
-	if p.Type == PackageTypeYpkg {
-		if err := p.BuildYpkg(notif, usr, pman, overlay, history); err != nil {
-			return err
+	if p.Type == PackageTypeYpkg && CrossArch != "" {
+		if err := p.CrossCompile(notif, usr, pman, overlay, history, timer, CrossArch); err != nil {
+			return timer.Fail(overlay.tmpfsFull(err))
+		}
+	} else if p.Type == PackageTypeYpkg {
+		if err := p.BuildYpkg(notif, usr, pman, overlay, history, timer); err != nil {
+			return timer.Fail(overlay.tmpfsFull(err))
 		}
 	} else {
+		timer.Start(StageBuild)
 		if err := p.BuildXML(notif, pman, overlay); err != nil {
-			return err
+			return timer.Fail(overlay.tmpfsFull(err))
 		}
 	}
 
-	return p.CollectAssets(overlay, usr, manifestTarget)
+	timer.Start(StageCollect)
+	if err := p.CollectAssets(overlay, usr, manifestTarget, timer); err != nil {
+		return timer.Fail(err)
+	}
+	timer.Stop()
+	return nil
 }
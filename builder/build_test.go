@@ -0,0 +1,117 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"github.com/getsolus/solbuild/builder/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSource fails to fetch with each of the errors in turn
+type fakeSource struct {
+	errs    []error
+	fetches int
+}
+
+func (f *fakeSource) IsFetched() bool { return false }
+
+func (f *fakeSource) Fetch() error {
+	f.fetches++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeSource) GetBindConfiguration(rootfs string) source.BindConfiguration {
+	return source.BindConfiguration{}
+}
+
+func (f *fakeSource) GetIdentifier() string { return "fake" }
+
+func (f *fakeSource) IsGit() bool { return false }
+
+func TestFetchWithRetry(t *testing.T) {
+	FetchBackoff = time.Millisecond
+	defer func() { FetchBackoff = time.Second }()
+
+	transient := &source.FetchError{Err: errors.New("connection reset"), Transient: true}
+	permanent := &source.FetchError{Err: errors.New("404")}
+
+	src := &fakeSource{errs: []error{transient, transient}}
+	if err := fetchWithRetry(src); err != nil || src.fetches != 3 {
+		t.Fatalf("Transient failures not retried: %v after %d fetches", err, src.fetches)
+	}
+	src = &fakeSource{errs: []error{transient, transient, transient, transient}}
+	if err := fetchWithRetry(src); err == nil || src.fetches != FetchRetries {
+		t.Fatalf("Retried beyond the limit: %v after %d fetches", err, src.fetches)
+	}
+	src = &fakeSource{errs: []error{permanent}}
+	if err := fetchWithRetry(src); err == nil || src.fetches != 1 {
+		t.Fatalf("Permanent failure was retried: %v after %d fetches", err, src.fetches)
+	}
+}
+
+func TestFindComponentXML(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-component")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	pkgDir := filepath.Join(root, "repo", "n", "nano")
+	if err := os.MkdirAll(pkgDir, 00755); err != nil {
+		t.Fatalf("Failed to create package directory: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "repo", ".git"), 00755); err != nil {
+		t.Fatalf("Failed to create repository marker: %v", err)
+	}
+	if got := FindComponentXML(pkgDir); got != "" {
+		t.Fatalf("Found a component.xml that doesn't exist: %s", got)
+	}
+
+	// Beyond the repository root must not be used
+	if err := ioutil.WriteFile(filepath.Join(root, "component.xml"), nil, 00644); err != nil {
+		t.Fatalf("Failed to write component.xml: %v", err)
+	}
+	if got := FindComponentXML(pkgDir); got != "" {
+		t.Fatalf("Searched beyond the repository root: %s", got)
+	}
+
+	parent := filepath.Join(root, "repo", "n", "component.xml")
+	if err := ioutil.WriteFile(parent, nil, 00644); err != nil {
+		t.Fatalf("Failed to write component.xml: %v", err)
+	}
+	if got := FindComponentXML(pkgDir); got != parent {
+		t.Fatalf("Wrong component.xml: %s vs expected %s", got, parent)
+	}
+
+	local := filepath.Join(pkgDir, "component.xml")
+	if err := ioutil.WriteFile(local, nil, 00644); err != nil {
+		t.Fatalf("Failed to write component.xml: %v", err)
+	}
+	if got := FindComponentXML(pkgDir); got != local {
+		t.Fatalf("Local component.xml not preferred: %s", got)
+	}
+}
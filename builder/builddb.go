@@ -0,0 +1,164 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BuildDatabasePath is where every build is recorded
+var BuildDatabasePath = "/var/lib/solbuild/builds.jsonl"
+
+// A BuildRecord describes a single build of a package
+type BuildRecord struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Release  int           `json:"release"`
+	Profile  string        `json:"profile"`
+	Commit   string        `json:"commit,omitempty"` // Commit of the recipe, when in git
+	BuildID  string        `json:"build_id,omitempty"`
+	Repos    []string      `json:"repos,omitempty"`           // Repositories enabled within the build root
+	PeakDisk int64         `json:"peak_disk_usage,omitempty"` // Peak disk usage of the overlay while building
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+}
+
+// A BuildDatabase records every build, one JSON object per line. Records are
+// only ever appended while holding an exclusive lock on the file, so that
+// concurrent builds never interleave their writes.
+type BuildDatabase struct {
+	path string
+}
+
+// NewBuildDatabase will return the database stored at path
+func NewBuildDatabase(path string) *BuildDatabase {
+	return &BuildDatabase{path: path}
+}
+
+// open will open the database, holding a lock of the given type
+func (d *BuildDatabase) open(flag, how int) (*os.File, error) {
+	f, err := os.OpenFile(d.path, flag, 00644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to lock build database %s, reason: %s\n", d.path, err)
+	}
+	return f, nil
+}
+
+// Add will append the record to the database
+func (d *BuildDatabase) Add(record *BuildRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 00755); err != nil {
+		return err
+	}
+	f, err := d.open(os.O_WRONLY|os.O_APPEND|os.O_CREATE, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("Failed to write build database %s, reason: %s\n", d.path, err)
+	}
+	return f.Sync()
+}
+
+// Records will return every record for the named package, oldest first, or
+// for all packages when name is empty. Lines that cannot be parsed are
+// skipped.
+func (d *BuildDatabase) Records(name string) ([]*BuildRecord, error) {
+	f, err := d.open(os.O_RDONLY, syscall.LOCK_SH)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var records []*BuildRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var record BuildRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Debugf("Skipping invalid build record %s:%d, reason: %s\n", d.path, line, err)
+			continue
+		}
+		if name == "" || record.Name == name {
+			records = append(records, &record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// HasSucceeded will determine whether the release of the package has
+// already been built successfully for the profile
+func (d *BuildDatabase) HasSucceeded(name string, release int, profile string) (bool, error) {
+	records, err := d.Records(name)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if record.Success && record.Release == release && record.Profile == profile {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordBuild will add the finished build to the build database
+func (m *Manager) recordBuild(started time.Time, result error) {
+	if dockerRootless() {
+		log.Debugln("Not recording the build, as only root may write to the build database")
+		return
+	}
+	record := &BuildRecord{
+		Name:     m.pkg.Name,
+		Version:  m.pkg.Version,
+		Release:  m.pkg.Release,
+		Profile:  m.profile.Name,
+		Success:  result == nil,
+		Started:  started.UTC(),
+		Duration: time.Since(started),
+		BuildID:  BuildID,
+		Repos:    BuildRepos,
+		PeakDisk: BuildPeakDisk,
+	}
+	if m.history != nil {
+		record.Commit = m.history.Head
+	}
+	if result != nil {
+		record.Error = strings.TrimSpace(result.Error())
+	}
+	if err := NewBuildDatabase(BuildDatabasePath).Add(record); err != nil {
+		log.Warnf("Failed to record build, reason: %s\n", err)
+	}
+}
@@ -0,0 +1,94 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuildDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-builddb")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewBuildDatabase(filepath.Join(dir, "solbuild", "builds.jsonl"))
+	if records, err := db.Records(""); err != nil || len(records) != 0 {
+		t.Fatalf("Expected an empty database, got: %v (%v)", records, err)
+	}
+
+	// Concurrent builds must never interleave their records
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(release int) {
+			defer wg.Done()
+			record := &BuildRecord{Name: "nano", Version: "5.8", Release: release, Profile: "unstable-x86_64", Success: release%2 == 0, Started: time.Now()}
+			if err := db.Add(record); err != nil {
+				t.Errorf("Failed to add record: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := db.Add(&BuildRecord{Name: "vim", Release: 10, Profile: "unstable-x86_64", Success: true}); err != nil {
+		t.Fatalf("Failed to add record: %v", err)
+	}
+
+	// A damaged line is skipped
+	f, err := os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND, 00644)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	f.WriteString("{\"name\": \"na\n")
+	f.Close()
+
+	records, err := db.Records("nano")
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+	if len(records) != 20 {
+		t.Fatalf("Expected 20 records for nano, got %d", len(records))
+	}
+	if all, _ := db.Records(""); len(all) != 21 {
+		t.Fatalf("Expected 21 records, got %d", len(all))
+	}
+
+	tests := []struct {
+		name     string
+		release  int
+		profile  string
+		expected bool
+	}{
+		{"nano", 4, "unstable-x86_64", true},
+		{"nano", 5, "unstable-x86_64", false},
+		{"nano", 4, "main-x86_64", false},
+		{"nano", 40, "unstable-x86_64", false},
+		{"vim", 10, "unstable-x86_64", true},
+	}
+	for _, test := range tests {
+		built, err := db.HasSucceeded(test.name, test.release, test.profile)
+		if err != nil || built != test.expected {
+			t.Fatalf("Expected %t for %s-%d on %s, got %t (%v)", test.expected, test.name, test.release, test.profile, built, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+// A Builder builds a package and collects the resulting artifacts into the
+// current directory. Builds within an overlayfs root of the backing image
+// and within a Docker container are each a Builder.
+type Builder interface {
+	Build(notif PidNotifier, history *PackageHistory, manifestTarget string, timer *StageTimer) error
+}
+
+// OverlayBuilder builds a package within an overlayfs root of the backing
+// image of the profile, which requires root
+type OverlayBuilder struct {
+	pkg        *Package
+	profile    *Profile
+	pkgManager PackageManager
+	overlay    *Overlay
+}
+
+// NewOverlayBuilder will return a builder using the overlay and the package
+// manager within it
+func NewOverlayBuilder(pkg *Package, profile *Profile, pkgManager PackageManager, overlay *Overlay) *OverlayBuilder {
+	return &OverlayBuilder{
+		pkg:        pkg,
+		profile:    profile,
+		pkgManager: pkgManager,
+		overlay:    overlay,
+	}
+}
+
+// Build will build the package within the overlay, and collect the resulting
+// artifacts into the current directory.
+func (o *OverlayBuilder) Build(notif PidNotifier, history *PackageHistory, manifestTarget string, timer *StageTimer) error {
+	return o.pkg.Build(notif, history, o.profile, o.pkgManager, o.overlay, manifestTarget, timer)
+}
@@ -0,0 +1,82 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"os"
+	"regexp"
+)
+
+// BuildLogDir holds the build logs of each package, within the overlay
+// directory of the profile. It begins with a dot so that it can never clash
+// with the overlay of a package.
+const BuildLogDir = ".logs"
+
+var (
+	// BuildID tags the log output, build log and manifests of a build so
+	// that they may be correlated when several builds run at once
+	BuildID string
+
+	// ErrInvalidBuildID is returned for build IDs that are unsafe to use in
+	// a file name
+	ErrInvalidBuildID = errors.New("Build ID may only contain letters, digits, '.', '_' and '-'")
+
+	// validBuildID matches the build IDs we accept
+	validBuildID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// NewBuildID will generate a random version 4 UUID to identify a build
+func NewBuildID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// SetBuildID will validate and use the build ID, tagging every following
+// log message with build_id=<id>
+func SetBuildID(id string) error {
+	if !validBuildID.MatchString(id) {
+		return fmt.Errorf("%s: %s", ErrInvalidBuildID, id)
+	}
+	BuildID = id
+	log.SetOutput(&lineTagger{out: os.Stdout, tag: []byte(" build_id=" + id + "\n")})
+	return nil
+}
+
+// A lineTagger appends a tag to the end of every line written through it
+type lineTagger struct {
+	out io.Writer
+	tag []byte
+}
+
+// Write will write p, tagging every line within it
+func (t *lineTagger) Write(p []byte) (int, error) {
+	if _, err := t.out.Write(bytes.Replace(p, []byte("\n"), t.tag, -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
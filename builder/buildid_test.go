@@ -0,0 +1,50 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestBuildID(t *testing.T) {
+	id, err := NewBuildID()
+	if err != nil {
+		t.Fatalf("Failed to generate build ID: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Fatalf("Build ID is not a UUID: %s", id)
+	}
+	if other, _ := NewBuildID(); other == id {
+		t.Fatalf("Generated the same build ID twice: %s", id)
+	}
+	for _, invalid := range []string{"", "../etc", "ci job", "-rf"} {
+		if err := SetBuildID(invalid); err == nil {
+			t.Fatalf("Accepted invalid build ID '%s'", invalid)
+		}
+	}
+
+	var out bytes.Buffer
+	w := &lineTagger{out: &out, tag: []byte(" build_id=abc123\n")}
+	if n, err := w.Write([]byte("Building nano\nFetching sources\n")); err != nil || n != 31 {
+		t.Fatalf("Failed to write: %d %v", n, err)
+	}
+	if expected := "Building nano build_id=abc123\nFetching sources build_id=abc123\n"; out.String() != expected {
+		t.Fatalf("Wrong output: %q", out.String())
+	}
+}
@@ -0,0 +1,56 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+)
+
+var (
+	// ErrNoBuildTool is returned when a legacy build has neither fakeroot nor
+	// sudo available within the chroot
+	ErrNoBuildTool = errors.New("Neither fakeroot nor sudo is available in the chroot, install fakeroot with 'eopkg install fakeroot' in the image")
+)
+
+// xmlBuildCommand wraps the eopkg build command of a legacy pspec.xml build
+// with fakeroot when has reports it as available, falling back to sudo
+func xmlBuildCommand(has func(tool string) bool, command string) (string, error) {
+	if has("fakeroot") {
+		return fmt.Sprintf("fakeroot %s", command), nil
+	}
+	if has("sudo") {
+		log.Warnln("fakeroot is not available in the chroot, falling back to sudo")
+		return fmt.Sprintf("sudo -u root %s", command), nil
+	}
+	return "", ErrNoBuildTool
+}
+
+// chrootHasTool returns a function reporting whether a tool can be found on
+// the PATH within the chroot at root
+func chrootHasTool(notif PidNotifier, root string) func(tool string) bool {
+	return func(tool string) bool {
+		err := ChrootExec(notif, root, fmt.Sprintf("which %s >/dev/null 2>&1", tool))
+		notif.SetActivePID(0)
+		if err != nil {
+			log.Debugf("%s not found in the chroot\n", tool)
+			return false
+		}
+		return true
+	}
+}
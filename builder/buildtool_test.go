@@ -0,0 +1,54 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"testing"
+)
+
+func TestXMLBuildCommand(t *testing.T) {
+	available := func(tools ...string) func(string) bool {
+		return func(tool string) bool {
+			for _, t := range tools {
+				if t == tool {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	tests := []struct {
+		tools []string
+		want  string
+	}{
+		{[]string{"fakeroot", "sudo"}, "fakeroot eopkg build pspec.xml"},
+		{[]string{"fakeroot"}, "fakeroot eopkg build pspec.xml"},
+		{[]string{"sudo"}, "sudo -u root eopkg build pspec.xml"},
+	}
+	for _, test := range tests {
+		cmd, err := xmlBuildCommand(available(test.tools...), "eopkg build pspec.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error with %v: %s", test.tools, err)
+		}
+		if cmd != test.want {
+			t.Errorf("Expected '%s' with %v, got '%s'", test.want, test.tools, cmd)
+		}
+	}
+	if _, err := xmlBuildCommand(available(), "eopkg build pspec.xml"); err != ErrNoBuildTool {
+		t.Fatalf("Expected ErrNoBuildTool without a build tool, got: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ccacheStatsCommand prints the ccache statistics as tab separated counters
+const ccacheStatsCommand = "ccache --print-stats"
+
+var (
+	// BuildCcache are the ccache statistics of the last build, when ccache
+	// was used by it
+	BuildCcache *CcacheStats
+
+	// CcacheDirectories are the ccache directories shared by every build, for
+	// package.yml and pspec.xml builds respectively
+	CcacheDirectories = []string{CcacheDirectory, LegacyCcacheDirectory}
+
+	// ErrNoHostCcache is returned when the ccache helpers are used without
+	// ccache installed on the host
+	ErrNoHostCcache = errors.New("ccache must be installed on the host to inspect the cache")
+)
+
+// CcacheStats are the hits and misses of a build against the ccache, along
+// with the size of the cache once it was complete
+type CcacheStats struct {
+	Hits   int64 `json:"hits"   toml:"hits"`
+	Misses int64 `json:"misses" toml:"misses"`
+	Size   int64 `json:"size"   toml:"size"` // Size of the whole cache in bytes
+}
+
+// ParseCcacheStats will parse the output of ccache --print-stats. Hits are
+// counted whether they were direct or preprocessed.
+func ParseCcacheStats(out string) (*CcacheStats, error) {
+	stats := &CcacheStats{}
+	found := false
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "direct_cache_hit", "preprocessed_cache_hit":
+			stats.Hits += value
+		case "cache_miss":
+			stats.Misses += value
+		case "cache_size_kibibyte":
+			stats.Size = value * 1024
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("No ccache statistics found in: %s", strings.TrimSpace(out))
+	}
+	return stats, nil
+}
+
+// Since will return the hits and misses since the earlier statistics of
+// the same cache were taken
+func (s *CcacheStats) Since(before *CcacheStats) *CcacheStats {
+	return &CcacheStats{
+		Hits:   s.Hits - before.Hits,
+		Misses: s.Misses - before.Misses,
+		Size:   s.Size,
+	}
+}
+
+// HitRate is the percentage of compilations served from the cache
+func (s *CcacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) * 100 / float64(total)
+	}
+	return 0
+}
+
+// String returns a one line summary of the statistics
+func (s *CcacheStats) String() string {
+	return fmt.Sprintf("ccache: %.1f%% hit rate (%d hits, %d misses), cache size %s", s.HitRate(), s.Hits, s.Misses, FormatBytes(s.Size))
+}
+
+// ccacheStats will read the statistics of the ccache bound into the chroot,
+// returning nil if ccache isn't installed within it
+func (p *Package) ccacheStats(notif PidNotifier, overlay *Overlay) *CcacheStats {
+	if !chrootHasTool(notif, overlay.MountPoint)("ccache") {
+		return nil
+	}
+	cmd := fmt.Sprintf("CCACHE_DIR=%s %s", p.GetCcacheDirInternal(), ccacheStatsCommand)
+	if p.Type == PackageTypeYpkg {
+		cmd = buildUserCommand(cmd)
+	}
+	out, err := ChrootExecOutput(notif, overlay.MountPoint, cmd)
+	if err != nil {
+		log.Debugf("Failed to read ccache statistics, reason: %s\n", err)
+		return nil
+	}
+	stats, err := ParseCcacheStats(out)
+	if err != nil {
+		log.Debugln(err)
+		return nil
+	}
+	return stats
+}
+
+// recordCcache will record and summarise the ccache statistics of the build,
+// given those from before it started
+func (p *Package) recordCcache(notif PidNotifier, overlay *Overlay, before *CcacheStats) {
+	if before == nil {
+		return
+	}
+	after := p.ccacheStats(notif, overlay)
+	if after == nil {
+		return
+	}
+	BuildCcache = after.Since(before)
+	log.Infoln(BuildCcache)
+}
+
+// CcacheCommand will return the command to run ccache on the host against
+// one of the CcacheDirectories
+func CcacheCommand(dir string, args ...string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("ccache"); err != nil {
+		return nil, ErrNoHostCcache
+	}
+	c := exec.Command("ccache", args...)
+	c.Env = append(os.Environ(), "CCACHE_DIR="+dir)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c, nil
+}
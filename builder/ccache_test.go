@@ -0,0 +1,73 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"github.com/BurntSushi/toml"
+	"strings"
+	"testing"
+)
+
+const ccacheStatsOutput = `stats_updated_timestamp	1706659200
+direct_cache_hit	40
+preprocessed_cache_hit	10
+cache_miss	50
+cache_size_kibibyte	2048
+files_in_cache	120
+`
+
+func TestParseCcacheStats(t *testing.T) {
+	stats, err := ParseCcacheStats(ccacheStatsOutput)
+	if err != nil {
+		t.Fatalf("Failed to parse ccache statistics: %s", err)
+	}
+	if stats.Hits != 50 || stats.Misses != 50 || stats.Size != 2048*1024 {
+		t.Fatalf("Wrong statistics: %+v", stats)
+	}
+	build := stats.Since(&CcacheStats{Hits: 20, Misses: 45})
+	if build.Hits != 30 || build.Misses != 5 || build.Size != stats.Size {
+		t.Fatalf("Wrong statistics for the build: %+v", build)
+	}
+	if summary := build.String(); summary != "ccache: 85.7% hit rate (30 hits, 5 misses), cache size 2.0MiB" {
+		t.Fatalf("Wrong summary: %s", summary)
+	}
+	if _, err := ParseCcacheStats("ccache: invalid option -- 'print-stats'\n"); err == nil {
+		t.Fatal("Expected an error without any statistics")
+	}
+}
+
+func TestTransitManifestCcache(t *testing.T) {
+	BuildCcache = &CcacheStats{Hits: 3, Misses: 1, Size: 4096}
+	defer func() { BuildCcache = nil }()
+	tram := NewTransitManifest("unstable")
+	tram.File = append(tram.File, TransitManifestFile{Path: "nano-1-1-1-x86_64.eopkg", Sha256: "00"})
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tram); err != nil {
+		t.Fatalf("Failed to encode manifest: %s", err)
+	}
+	if !strings.Contains(buf.String(), "[ccache]") {
+		t.Fatalf("Manifest has no ccache statistics:\n%s", buf.String())
+	}
+	decoded := &TransitManifest{}
+	if _, err := toml.Decode(buf.String(), decoded); err != nil {
+		t.Fatalf("Failed to decode manifest: %s", err)
+	}
+	if decoded.Ccache == nil || *decoded.Ccache != *BuildCcache || len(decoded.File) != 1 {
+		t.Fatalf("Wrong manifest after decoding: %+v", decoded)
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	log "github.com/DataDrake/waterlog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// ChecksumCacheFile records the sha256sum of files that have already been
+	// hashed, within the package cache directory
+	ChecksumCacheFile = ".checksum_cache.json"
+)
+
+// ChecksumCachePath is where CachedSha256sum keeps its cache
+var ChecksumCachePath = filepath.Join(PackageCacheDirectory, ChecksumCacheFile)
+
+// checksumEntry records the state of a file when it was hashed
+type checksumEntry struct {
+	Sha256  string    `json:"sha256"`
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+}
+
+// ChecksumCache avoids hashing large files, such as the backing images,
+// again when they have not changed since they were last hashed. A cached
+// hash is used only while the mtime and size of the file are unchanged.
+type ChecksumCache struct {
+	path    string
+	entries map[string]checksumEntry
+	dirty   bool
+	lock    sync.Mutex
+}
+
+// LoadChecksumCache will load the cache stored at path. A missing or corrupt
+// cache is discarded, so that every file is hashed again.
+func LoadChecksumCache(path string) *ChecksumCache {
+	c := &ChecksumCache{
+		path:    path,
+		entries: make(map[string]checksumEntry),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read checksum cache %s, reason: %s\n", path, err)
+		}
+		return c
+	}
+	if err = json.Unmarshal(b, &c.entries); err != nil {
+		log.Warnf("Discarding corrupted checksum cache %s, reason: %s\n", path, err)
+		c.entries = make(map[string]checksumEntry)
+	}
+	return c
+}
+
+// Sum will return the sha256sum of the file at path, only reading the file
+// when it has changed since it was last hashed
+func (c *ChecksumCache) Sum(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if entry, ok := c.entries[path]; ok && entry.ModTime.Equal(st.ModTime()) && entry.Size == st.Size() {
+		log.Debugf("Using cached sha256sum of %s\n", path)
+		return entry.Sha256, nil
+	}
+	sum, err := FileSha256sum(path)
+	if err != nil {
+		return "", err
+	}
+	c.entries[path] = checksumEntry{
+		Sha256:  sum,
+		ModTime: st.ModTime(),
+		Size:    st.Size(),
+	}
+	c.dirty = true
+	return sum, nil
+}
+
+// Save will write the cache back out if it has changed, forgetting any files
+// which no longer exist
+func (c *ChecksumCache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	for path := range c.entries {
+		if !PathExists(path) {
+			delete(c.entries, path)
+		}
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 00755); err != nil {
+		return err
+	}
+	// Never leave a partially written file behind
+	tmp := c.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 00644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// CachedSha256sum will return the sha256sum of the file at path, using the
+// checksum cache within the package cache directory
+func CachedSha256sum(path string) (string, error) {
+	c := LoadChecksumCache(ChecksumCachePath)
+	sum, err := c.Sum(path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.Save(); err != nil {
+		log.Warnf("Failed to save checksum cache, reason: %s\n", err)
+	}
+	return sum, nil
+}
@@ -0,0 +1,95 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChecksumCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cachePath := filepath.Join(dir, "cache", ChecksumCacheFile)
+	file := filepath.Join(dir, "nano-5.5.tar.xz")
+	if err := ioutil.WriteFile(file, []byte("nano"), 00644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	mtime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	expected, err := FileSha256sum(file)
+	if err != nil {
+		t.Fatalf("Failed to hash file: %v", err)
+	}
+
+	c := LoadChecksumCache(cachePath)
+	if sum, err := c.Sum(file); err != nil || sum != expected {
+		t.Fatalf("Expected %s, got: %s (%v)", expected, sum, err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+
+	// Same size and mtime, so the file must not be read again
+	if err := ioutil.WriteFile(file, []byte("vim!"), 00644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	c = LoadChecksumCache(cachePath)
+	if sum, err := c.Sum(file); err != nil || sum != expected {
+		t.Fatalf("Expected cached %s, got: %s (%v)", expected, sum, err)
+	}
+
+	// A new mtime means the file is hashed again
+	if err := os.Chtimes(file, mtime, mtime.Add(time.Second)); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	updated, _ := FileSha256sum(file)
+	if sum, err := c.Sum(file); err != nil || sum != updated || sum == expected {
+		t.Fatalf("Expected %s, got: %s (%v)", updated, sum, err)
+	}
+
+	// Corrupt caches are discarded, and removed files are forgotten
+	if err := ioutil.WriteFile(cachePath, []byte("{"), 00644); err != nil {
+		t.Fatalf("Failed to corrupt cache: %v", err)
+	}
+	c = LoadChecksumCache(cachePath)
+	if len(c.entries) != 0 {
+		t.Fatalf("Expected corrupt cache to be discarded, got: %v", c.entries)
+	}
+	if _, err := c.Sum(file); err != nil {
+		t.Fatalf("Failed to hash file: %v", err)
+	}
+	os.Remove(file)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+	if c = LoadChecksumCache(cachePath); len(c.entries) != 0 {
+		t.Fatalf("Expected removed file to be forgotten, got: %v", c.entries)
+	}
+}
@@ -24,8 +24,8 @@ import (
 )
 
 // Chroot will attempt to spawn a chroot in the overlayfs system
-func (p *Package) Chroot(notif PidNotifier, pman *EopkgManager, overlay *Overlay) error {
-	log.Debugf("Beginning chroot: profile='%s' version='%s' package='%s' type='%s' release='%d'\n", overlay.Back.Name, p.Version, p.Name, p.Type, p.Release)
+func (p *Package) Chroot(notif PidNotifier, pman PackageManager, overlay *Overlay) error {
+	log.Debugf("Beginning chroot: profile='%s' version='%s' package='%s' type='%s' release='%d'\n", overlay.BackingImage.Name, p.Version, p.Name, p.Type, p.Release)
 
 	var env []string
 	if p.Type == PackageTypeXML {
@@ -52,7 +52,12 @@ func (p *Package) Chroot(notif PidNotifier, pman *EopkgManager, overlay *Overlay
 			}
 		} else {
 			log.Warnln("Package has explicitly requested networking, sandboxing disabled")
+			if err := overlay.EnableNetworking(); err != nil {
+				return err
+			}
 		}
+	} else if err := overlay.EnableNetworking(); err != nil {
+		return err
 	}
 
 	log.Debugln("Spawning login shell")
@@ -0,0 +1,102 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"time"
+)
+
+var (
+	// CIMode is set when running non-interactively under a CI system
+	CIMode bool
+
+	// HeartbeatInterval controls how often we'll emit a log line while
+	// a chroot command is running. Zero disables the heartbeat.
+	HeartbeatInterval time.Duration
+)
+
+const (
+	// DefaultHeartbeatInterval is used in CI mode when no interval is configured
+	DefaultHeartbeatInterval = time.Minute
+)
+
+// heartbeat will periodically log that the command is still running, until
+// the done channel is closed.
+func heartbeat(command string, done chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.Infof("Still running after %s: %s\n", time.Since(start).Round(time.Second), command)
+		}
+	}
+}
+
+// CISections will emit collapsible section markers for each build stage,
+// in the syntax understood by the detected CI system.
+type CISections struct {
+	current string
+	gitlab  bool
+	github  bool
+}
+
+// NewCISections will return a new CISections for the current CI system
+func NewCISections() *CISections {
+	return &CISections{
+		gitlab: os.Getenv("GITLAB_CI") != "",
+		github: os.Getenv("GITHUB_ACTIONS") != "",
+	}
+}
+
+// Start will close any open section, and open a new one for the stage
+func (c *CISections) Start(s Stage) {
+	c.End()
+	c.current = s.String()
+	switch {
+	case c.gitlab:
+		fmt.Printf("\033[0Ksection_start:%d:%s[collapsed=true]\r\033[0KStage: %s\n", time.Now().Unix(), gitlabSection(c.current), c.current)
+	case c.github:
+		fmt.Printf("::group::Stage: %s\n", c.current)
+	}
+}
+
+// End will close the currently open section, if any
+func (c *CISections) End() {
+	if c.current == "" {
+		return
+	}
+	switch {
+	case c.gitlab:
+		fmt.Printf("\033[0Ksection_end:%d:%s\r\033[0K\n", time.Now().Unix(), gitlabSection(c.current))
+	case c.github:
+		fmt.Println("::endgroup::")
+	}
+	c.current = ""
+}
+
+// gitlabSection will return a section name acceptable to GitLab, which only
+// permits letters, numbers, underscores, dashes and dots.
+func gitlabSection(name string) string {
+	return "solbuild_" + name
+}
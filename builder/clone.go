@@ -0,0 +1,162 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// ioctlFICLONE shares the extents of one file with another, on
+	// filesystems supporting reflinks such as btrfs and xfs
+	ioctlFICLONE = 0x40049409
+)
+
+var (
+	// ErrImageExists is returned when cloning onto an existing image
+	ErrImageExists = errors.New("An image with that name already exists")
+
+	// ErrNotClone is returned when deleting an image that wasn't cloned
+	ErrNotClone = errors.New("Only cloned images may be deleted")
+
+	// ErrDirectShared is returned when mounting a shared image read-write
+	ErrDirectShared = errors.New("Only cloned images may be built in directly")
+
+	// clonedImages are the ephemeral images cloned by this process. They are
+	// treated as valid images, but are never added to ValidImages.
+	clonedImages = make(map[string]*BackingImage)
+)
+
+// IsClonedImage will determine whether the named image was cloned by
+// this process
+func IsClonedImage(name string) bool {
+	_, ok := clonedImages[name]
+	return ok
+}
+
+// Clone will copy the backing image to a new, ephemeral image alongside it,
+// so that it may be modified without affecting the original. The copy is a
+// reflink when the filesystem supports it.
+func (b *BackingImage) Clone(newName string) (*BackingImage, error) {
+	if newName == "" || strings.ContainsRune(newName, os.PathSeparator) {
+		return nil, fmt.Errorf("Invalid image name: %s", newName)
+	}
+	if IsValidImage(newName) {
+		return nil, ErrImageExists
+	}
+	if !b.IsInstalled() {
+		return nil, ErrProfileNotInstalled
+	}
+	dir := filepath.Dir(b.ImagePath)
+	clone := &BackingImage{
+		Name:      newName,
+		ImagePath: filepath.Join(dir, newName+ImageSuffix),
+		LockPath:  filepath.Join(dir, newName+".lock"),
+		StampPath: filepath.Join(dir, newName+StampSuffix),
+		RootDir:   filepath.Join(filepath.Dir(b.RootDir), newName),
+	}
+	if PathExists(clone.ImagePath) {
+		return nil, ErrImageExists
+	}
+
+	log.Debugf("Cloning image %s to %s\n", b.Name, newName)
+	if err := reflinkFile(b.ImagePath, clone.ImagePath); err != nil {
+		log.Debugf("Unable to reflink image, copying instead: %s\n", err)
+		if err := commands.ExecStdoutArgs("cp", []string{"--reflink=auto", b.ImagePath, clone.ImagePath}); err != nil {
+			os.Remove(clone.ImagePath)
+			return nil, fmt.Errorf("Failed to clone image %s, reason: %s\n", b.Name, err)
+		}
+	}
+	// The clone is exactly as fresh as the original
+	if stamp, err := ioutil.ReadFile(b.StampPath); err == nil {
+		ioutil.WriteFile(clone.StampPath, stamp, 00644)
+	}
+	clonedImages[newName] = clone
+	return clone, nil
+}
+
+// Delete will remove a cloned image along with its root directory
+func (b *BackingImage) Delete() error {
+	if !IsClonedImage(b.Name) {
+		return ErrNotClone
+	}
+	log.Debugf("Deleting cloned image %s\n", b.Name)
+	for _, path := range []string{b.ImagePath, b.LockPath, b.StampPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove %s, reason: %s\n", path, err)
+		}
+	}
+	if err := os.RemoveAll(b.RootDir); err != nil {
+		return fmt.Errorf("Failed to remove %s, reason: %s\n", b.RootDir, err)
+	}
+	delete(clonedImages, b.Name)
+	return nil
+}
+
+// cloneDirectImage will clone the backing image for a build without an
+// overlay, which would otherwise write to the shared image. The image is
+// locked while it is copied, so that no update may change it meanwhile.
+func (m *Manager) cloneDirectImage() error {
+	lock, err := NewLockFile(m.image.LockPath)
+	if err != nil {
+		log.Errorf("Failed to lock image %s, reason: %s\n", m.image.Name, err)
+		return err
+	}
+	if err := lock.Lock(); err != nil {
+		log.Errorf("Failed to lock image %s - another process (%s,%d) is using it, reason: %s\n", m.image.Name, lock.GetOwnerProcess(), lock.GetOwnerPID(), err)
+		return err
+	}
+	defer func() {
+		lock.Unlock()
+		lock.Clean()
+	}()
+	clone, err := m.image.Clone(fmt.Sprintf("%s-direct-%d", m.image.Name, os.Getpid()))
+	if err != nil {
+		log.Errorf("Failed to clone image %s for a build without an overlay, reason: %s\n", m.image.Name, err)
+		return err
+	}
+	m.directImage = clone
+	m.overlay.BackingImage = clone
+	return nil
+}
+
+// reflinkFile will create dest sharing the extents of source
+func reflinkFile(source, dest string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 00644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ioctlFICLONE, src.Fd()); errno != 0 {
+		os.Remove(dest)
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackingImageClone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-clone")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &BackingImage{
+		Name:      "main-x86_64",
+		ImagePath: filepath.Join(dir, "images", "main-x86_64"+ImageSuffix),
+		RootDir:   filepath.Join(dir, "roots", "main-x86_64"),
+	}
+	if _, err := b.Clone("ci-1"); err != ErrProfileNotInstalled {
+		t.Fatalf("Expected ErrProfileNotInstalled, got: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(b.ImagePath), 00755); err != nil {
+		t.Fatalf("Failed to create image directory: %v", err)
+	}
+	if err := ioutil.WriteFile(b.ImagePath, []byte("image"), 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if _, err := b.Clone("unstable-x86_64"); err != ErrImageExists {
+		t.Fatalf("Expected ErrImageExists, got: %v", err)
+	}
+	if err := b.Delete(); err != ErrNotClone {
+		t.Fatalf("Expected ErrNotClone, got: %v", err)
+	}
+
+	clone, err := b.Clone("ci-1")
+	if err != nil {
+		t.Fatalf("Failed to clone image: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(clone.ImagePath); string(b) != "image" {
+		t.Fatalf("Wrong clone contents: %s", b)
+	}
+	if !IsValidImage("ci-1") {
+		t.Fatal("Clone is not a valid image")
+	}
+	if err := os.MkdirAll(clone.RootDir, 00755); err != nil {
+		t.Fatalf("Failed to create clone root: %v", err)
+	}
+	if err := clone.Delete(); err != nil {
+		t.Fatalf("Failed to delete clone: %v", err)
+	}
+	if PathExists(clone.ImagePath) || PathExists(clone.RootDir) || IsValidImage("ci-1") {
+		t.Fatal("Clone was not fully deleted")
+	}
+	if !PathExists(b.ImagePath) {
+		t.Fatal("Original image was deleted")
+	}
+}
+
+func TestCloneDirectImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-clone")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &BackingImage{
+		Name:      "main-x86_64",
+		ImagePath: filepath.Join(dir, "main-x86_64"+ImageSuffix),
+		LockPath:  filepath.Join(dir, "main-x86_64.lock"),
+		RootDir:   filepath.Join(dir, "roots", "main-x86_64"),
+	}
+	if err := ioutil.WriteFile(b.ImagePath, []byte("image"), 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	o := &Overlay{BackingImage: b, Direct: true}
+	if err := o.mountDirect(); err != ErrDirectShared {
+		t.Fatalf("Expected ErrDirectShared, got: %v", err)
+	}
+
+	m := &Manager{image: b, overlay: o}
+	if err := m.cloneDirectImage(); err != nil {
+		t.Fatalf("Failed to clone image: %v", err)
+	}
+	clone := m.directImage
+	if clone == nil || o.BackingImage != clone || clone.ImagePath == b.ImagePath {
+		t.Fatalf("Overlay does not use the clone: %+v", o.BackingImage)
+	}
+	if PathExists(b.LockPath) {
+		t.Fatal("Image is still locked after cloning")
+	}
+	if err := clone.Delete(); err != nil {
+		t.Fatalf("Failed to delete clone: %v", err)
+	}
+}
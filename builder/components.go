@@ -0,0 +1,99 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	//go:embed components.json
+	componentsFS embed.FS
+
+	// ErrNoComponent is returned when a package doesn't declare a component
+	ErrNoComponent = errors.New("Package does not declare a component")
+
+	// componentDB is the set of valid components, loaded on first use
+	componentDB map[string]bool
+)
+
+// parseComponents will parse a JSON list of component names
+func parseComponents(b []byte) (map[string]bool, error) {
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, err
+	}
+	db := make(map[string]bool)
+	for _, name := range names {
+		db[name] = true
+	}
+	return db, nil
+}
+
+// LoadComponentDB will replace the built in list of valid components with
+// the JSON list stored at path.
+func LoadComponentDB(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	db, err := parseComponents(b)
+	if err != nil {
+		return fmt.Errorf("Invalid component database %s, reason: %s\n", path, err)
+	}
+	componentDB = db
+	return nil
+}
+
+// ValidComponent will determine whether the named component is known
+func ValidComponent(name string) (bool, error) {
+	if componentDB == nil {
+		b, err := componentsFS.ReadFile("components.json")
+		if err != nil {
+			return false, err
+		}
+		if componentDB, err = parseComponents(b); err != nil {
+			return false, err
+		}
+	}
+	return componentDB[name], nil
+}
+
+// ValidateComponent will ensure that the package and all of its subpackages
+// belong to known Solus components. Legacy packages may not declare any.
+func (p *Package) ValidateComponent() error {
+	if len(p.Components) < 1 {
+		if p.Type == PackageTypeXML {
+			return nil
+		}
+		return ErrNoComponent
+	}
+	for _, component := range p.Components {
+		valid, err := ValidComponent(component)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("Unknown component: %s", component)
+		}
+	}
+	return nil
+}
@@ -30,6 +30,39 @@ type Config struct {
 	EnableTmpfs    bool   `toml:"enable_tmpfs"`     // Whether to enable tmpfs builds or
 	OverlayRootDir string `toml:"overlay_root_dir"` // Custom Overlay Root Dir
 	TmpfsSize      string `toml:"tmpfs_size"`       // Bounding size on the tmpfs
+	TmpfsCeiling   string `toml:"tmpfs_ceiling"`    // Largest tmpfs sized from the available memory
+
+	DiskUsageInterval string `toml:"disk_usage_interval"` // How often to sample the disk usage of a build
+
+	EnableNotify bool      `toml:"enable_notify"` // Whether to notify webhooks on build completion
+	Webhooks     []Webhook `toml:"webhook"`       // Webhooks to notify on build completion
+
+	HeartbeatInterval string `toml:"ci_heartbeat_interval"` // How often to log progress in CI mode
+
+	EnvPassthrough []string `toml:"env_passthrough"` // Host variables to pass into the chroot, as KEY or KEY=VALUE
+
+	Distcc DistccConfig `toml:"distcc"` // Distributed compilation settings
+
+	BindCABundle bool `toml:"bind_ca_bundle"` // Use the host's CA bundle in networked builds
+
+	PackageRetries int `toml:"package_retries"` // Attempts for package operations that fail due to the network
+
+	UpgradeFreshness string `toml:"upgrade_freshness"` // How long after an update to skip upgrading the build root
+
+	VerifySources bool `toml:"verify_sources"` // Re-verify the hash of cached sources before each build
+
+	XzThreads int `toml:"xz_threads"` // Threads used to decompress images, 0 for one per core
+
+	LogArchiveDir         string `toml:"log_archive_dir"`         // Where to archive the logs of failed builds
+	LogArchiveCompression string `toml:"log_archive_compression"` // Compression of archived logs, gzip or zstd
+	LogArchiveKeep        int    `toml:"log_archive_keep"`        // Archived logs kept for each package
+	DeleteSuccessfulLogs  bool   `toml:"delete_successful_logs"`  // Remove the log once a build succeeds
+
+	Aliases map[string]string `toml:"aliases"` // Short names for profiles
+
+	PolicyRules []string `toml:"policy_rules"` // Rules checked by build --policy-check, all if empty
+
+	Hostname string `toml:"hostname"` // Hostname seen within the chroot
 }
 
 var (
@@ -52,6 +85,8 @@ func NewConfig() (*Config, error) {
 		EnableTmpfs:    false,
 		OverlayRootDir: "/var/cache/solbuild",
 		TmpfsSize:      "",
+		EnableNotify:   true,
+		Hostname:       DefaultHostname,
 	}
 
 	// Reverse because /etc takes precedence in stateless
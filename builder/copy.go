@@ -19,35 +19,59 @@ package builder
 import (
 	"fmt"
 	log "github.com/DataDrake/waterlog"
-	"github.com/getsolus/libosdev/disk"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
+)
+
+const (
+	// copyBufferSize is the size of the buffer used when files cannot be
+	// copied within the kernel
+	copyBufferSize = 1024 * 1024
+
+	// ficlone is the ioctl sharing the extents of one file with another
+	ficlone = 0x40049409
+
+	// preservedModeBits are the mode bits of each file kept by CopyAll
+	preservedModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
 )
 
 // CopyAll will copy the source asset into the given destdir.
 // If the source is a directory, it will be recursively copied
-// into the directory destdir.
+// into the directory destdir, including any empty directories.
 //
 // Note that all directories are created as 00755, as solbuild
 // has no interest in the individual folder permissions, just
-// the files themselves.
+// the files themselves. Files keep their mode and modification
+// time, and are reflinked where the filesystem allows it.
+//
+// Symlinks are recreated as symlinks with the same target, rather
+// than copying the file they point to.
 func CopyAll(source, destdir string) error {
 	// We double stat, get over it.
-	st, err := os.Stat(source)
+	st, err := os.Lstat(source)
 	// File doesn't exist, move on
 	if err != nil || st == nil {
 		return nil
 	}
 
+	if st.Mode()&os.ModeSymlink != 0 {
+		return copySymlink(source, destdir)
+	}
+
 	if st.Mode().IsDir() {
 		var files []os.FileInfo
 		if files, err = ioutil.ReadDir(source); err != nil {
 			return err
 		}
+		dpath := filepath.Join(destdir, filepath.Base(source))
+		if err = os.MkdirAll(dpath, 00755); err != nil {
+			return fmt.Errorf("Failed to create target directory: %s, reason: %s\n", dpath, err)
+		}
 		for _, f := range files {
 			spath := filepath.Join(source, f.Name())
-			dpath := filepath.Join(destdir, filepath.Base(source))
 			if err := CopyAll(spath, dpath); err != nil {
 				return err
 			}
@@ -61,9 +85,101 @@ func CopyAll(source, destdir string) error {
 		}
 		tgt := filepath.Join(destdir, filepath.Base(source))
 		log.Debugf("Copying source asset %s to %s\n", source, tgt)
-		if err = disk.CopyFile(source, tgt); err != nil {
+		if err = copyFile(source, tgt, st); err != nil {
 			return fmt.Errorf("Failed to copy source asset to target: source='%s' target='%s', reason: %s\n", source, tgt, err)
 		}
 	}
 	return nil
 }
+
+// copyFile will copy the regular file at source to tgt, replacing anything
+// already there, and preserve its mode and modification time
+func copyFile(source, tgt string, st os.FileInfo) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Never write through an existing symlink
+	if existing, err := os.Lstat(tgt); err == nil && !existing.IsDir() {
+		if err = os.Remove(tgt); err != nil {
+			return err
+		}
+	}
+	dst, err := os.OpenFile(tgt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 00600)
+	if err != nil {
+		return err
+	}
+	if err = copyContents(dst, src, sameFilesystem(st, filepath.Dir(tgt))); err != nil {
+		dst.Close()
+		return err
+	}
+	// Set the mode explicitly, as it is otherwise masked by the umask
+	if err = dst.Chmod(st.Mode() & preservedModeBits); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(tgt, st.ModTime(), st.ModTime())
+}
+
+// sameFilesystem will determine whether the file described by st is on the
+// same filesystem as the directory dir
+func sameFilesystem(st os.FileInfo, dir string) bool {
+	dirSt, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+	a, ok := st.Sys().(*syscall.Stat_t)
+	b, ok2 := dirSt.Sys().(*syscall.Stat_t)
+	return ok && ok2 && a.Dev == b.Dev
+}
+
+// copyContents will copy the contents of src into dst. On the same
+// filesystem the extents are shared with FICLONE where supported, and
+// otherwise copied within the kernel by copy_file_range. Across filesystems
+// a plain buffered copy is used.
+func copyContents(dst, src *os.File, sameFS bool) error {
+	if sameFS {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd()); errno == 0 {
+			return nil
+		}
+		// ReadFrom uses copy_file_range, falling back to a buffered copy
+		// when the kernel refuses it
+		_, err := dst.ReadFrom(src)
+		return err
+	}
+	// Hide ReadFrom and WriteTo, so that io.CopyBuffer uses the buffer
+	_, err := io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, make([]byte, copyBufferSize))
+	return err
+}
+
+// copySymlink will recreate the symlink at source within destdir, preserving
+// the original link target whether relative or absolute.
+func copySymlink(source, destdir string) error {
+	target, err := os.Readlink(source)
+	if err != nil {
+		return fmt.Errorf("Failed to read symlink: source='%s', reason: %s\n", source, err)
+	}
+	if !PathExists(destdir) {
+		log.Debugf("Creating target directory: %s\n", destdir)
+		if err = os.MkdirAll(destdir, 00755); err != nil {
+			return fmt.Errorf("Failed to create target directory: %s, reason: %s\n", destdir, err)
+		}
+	}
+	tgt := filepath.Join(destdir, filepath.Base(source))
+	// Replace any existing file, as CopyFile would have done
+	if _, err := os.Lstat(tgt); err == nil {
+		if err = os.Remove(tgt); err != nil {
+			return fmt.Errorf("Failed to replace existing target: %s, reason: %s\n", tgt, err)
+		}
+	}
+	log.Debugf("Copying source symlink %s to %s\n", source, tgt)
+	if err = os.Symlink(target, tgt); err != nil {
+		return fmt.Errorf("Failed to create symlink: target='%s' link='%s', reason: %s\n", target, tgt, err)
+	}
+	return nil
+}
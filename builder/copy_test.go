@@ -0,0 +1,219 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyAllSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "solbuild-copy")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	files := filepath.Join(tmp, "src", "files")
+	if err := os.MkdirAll(filepath.Join(files, "sub"), 00755); err != nil {
+		t.Fatalf("Failed to create source tree: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(files, "shared.conf"), []byte("shared"), 00644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	if err := os.Symlink("../shared.conf", filepath.Join(files, "sub", "relative.conf")); err != nil {
+		t.Fatalf("Failed to create relative symlink: %v", err)
+	}
+	if err := os.Symlink("/usr/share/defaults/shared.conf", filepath.Join(files, "absolute.conf")); err != nil {
+		t.Fatalf("Failed to create absolute symlink: %v", err)
+	}
+
+	dest := filepath.Join(tmp, "dest")
+	if err := CopyAll(files, dest); err != nil {
+		t.Fatalf("Failed to copy source tree: %v", err)
+	}
+
+	links := map[string]string{
+		filepath.Join(dest, "files", "sub", "relative.conf"): "../shared.conf",
+		filepath.Join(dest, "files", "absolute.conf"):        "/usr/share/defaults/shared.conf",
+	}
+	for link, want := range links {
+		st, err := os.Lstat(link)
+		if err != nil {
+			t.Fatalf("Missing copied symlink %s: %v", link, err)
+		}
+		if st.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("Copied %s is not a symlink", link)
+		}
+		got, err := os.Readlink(link)
+		if err != nil {
+			t.Fatalf("Failed to read copied symlink %s: %v", link, err)
+		}
+		if got != want {
+			t.Fatalf("Wrong symlink target for %s: '%s' vs expected '%s'", link, got, want)
+		}
+	}
+
+	// Relative links must still resolve within the copied tree
+	b, err := ioutil.ReadFile(filepath.Join(dest, "files", "sub", "relative.conf"))
+	if err != nil {
+		t.Fatalf("Failed to read through relative symlink: %v", err)
+	}
+	if string(b) != "shared" {
+		t.Fatalf("Wrong contents through relative symlink: %s", string(b))
+	}
+}
+
+func TestCopyAllMetadata(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "solbuild-copy")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	files := filepath.Join(tmp, "src", "files")
+	if err := os.MkdirAll(filepath.Join(files, "empty"), 00755); err != nil {
+		t.Fatalf("Failed to create source tree: %v", err)
+	}
+	modes := map[string]os.FileMode{
+		"setup.sh":   00755,
+		"secret.key": 00600,
+	}
+	mtime := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for name, mode := range modes {
+		path := filepath.Join(files, name)
+		if err := ioutil.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatalf("Failed to write source file: %v", err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("Failed to set source mode: %v", err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set source time: %v", err)
+		}
+	}
+
+	dest := filepath.Join(tmp, "dest")
+	if err := CopyAll(files, dest); err != nil {
+		t.Fatalf("Failed to copy source tree: %v", err)
+	}
+	// Copying again must replace the files
+	if err := CopyAll(files, dest); err != nil {
+		t.Fatalf("Failed to copy source tree over itself: %v", err)
+	}
+
+	for name, mode := range modes {
+		st, err := os.Stat(filepath.Join(dest, "files", name))
+		if err != nil {
+			t.Fatalf("Missing copied file %s: %v", name, err)
+		}
+		if st.Mode().Perm() != mode {
+			t.Fatalf("Wrong mode for %s: %v vs expected %v", name, st.Mode().Perm(), mode)
+		}
+		if !st.ModTime().Equal(mtime) {
+			t.Fatalf("Wrong modification time for %s: %v", name, st.ModTime())
+		}
+	}
+	if st, err := os.Stat(filepath.Join(dest, "files", "empty")); err != nil || !st.IsDir() {
+		t.Fatalf("Empty directory was not copied: %v", err)
+	}
+}
+
+// writeLargeFile will write a file spanning several copy buffers, ending
+// part way through the last
+func writeLargeFile(t testing.TB, path string) []byte {
+	data := make([]byte, 3*copyBufferSize+4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := ioutil.WriteFile(path, data, 00644); err != nil {
+		t.Fatalf("Failed to write large file: %v", err)
+	}
+	return data
+}
+
+func TestCopyContentsLarge(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "solbuild-copy")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "firmware.bin")
+	data := writeLargeFile(t, source)
+	for _, sameFS := range []bool{true, false} {
+		src, err := os.Open(source)
+		if err != nil {
+			t.Fatalf("Failed to open source: %v", err)
+		}
+		tgt := filepath.Join(tmp, fmt.Sprintf("copy-%v.bin", sameFS))
+		dst, err := os.Create(tgt)
+		if err != nil {
+			t.Fatalf("Failed to create target: %v", err)
+		}
+		err = copyContents(dst, src, sameFS)
+		src.Close()
+		dst.Close()
+		if err != nil {
+			t.Fatalf("Failed to copy large file (same filesystem: %v): %v", sameFS, err)
+		}
+		b, err := ioutil.ReadFile(tgt)
+		if err != nil {
+			t.Fatalf("Failed to read copied file: %v", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("Copied file differs (same filesystem: %v)", sameFS)
+		}
+	}
+}
+
+func benchmarkCopyContents(b *testing.B, sameFS bool) {
+	tmp, err := ioutil.TempDir("", "solbuild-copy")
+	if err != nil {
+		b.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "firmware.bin")
+	data := writeLargeFile(b, source)
+	tgt := filepath.Join(tmp, "copy.bin")
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src, err := os.Open(source)
+		if err != nil {
+			b.Fatalf("Failed to open source: %v", err)
+		}
+		dst, err := os.Create(tgt)
+		if err != nil {
+			b.Fatalf("Failed to create target: %v", err)
+		}
+		err = copyContents(dst, src, sameFS)
+		src.Close()
+		dst.Close()
+		if err != nil {
+			b.Fatalf("Failed to copy: %v", err)
+		}
+	}
+}
+
+func BenchmarkCopyContentsKernel(b *testing.B)   { benchmarkCopyContents(b, true) }
+func BenchmarkCopyContentsBuffered(b *testing.B) { benchmarkCopyContents(b, false) }
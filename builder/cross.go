@@ -0,0 +1,171 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrUnknownCrossArch is returned when cross compiling for an unsupported architecture
+	ErrUnknownCrossArch = errors.New("Unsupported cross compilation architecture")
+
+	// ErrCrossUnsupported is returned when cross compiling a legacy package
+	ErrCrossUnsupported = errors.New("Cross compilation is only supported for package.yml builds")
+
+	// CrossArch is the architecture to cross compile for, if any
+	CrossArch string
+
+	// BinfmtMiscDir is where the kernel exposes binfmt_misc
+	BinfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+	// binfmtRestore is the state of the binfmt_misc handler before we
+	// changed it, if we did
+	binfmtRestore *binfmtChange
+)
+
+// QemuPackage provides the static emulators used when cross compiling
+const QemuPackage = "qemu-user-static"
+
+// A CrossTarget describes an architecture we can cross compile for
+type CrossTarget struct {
+	CHOST        string // GNU triplet of the target
+	CrossCompile string // Prefix of the cross toolchain binaries
+	KernelArch   string // Architecture name used by the kernel, passed as ARCH
+	Emulator     string // qemu-user-static binary to run target binaries
+	Magic        string // binfmt_misc magic, matching the target ELF header
+	Mask         string // binfmt_misc mask applied before matching the magic
+}
+
+// CrossTargets are the architectures we can cross compile for
+var CrossTargets = map[string]*CrossTarget{
+	"aarch64": {
+		CHOST:        "aarch64-solus-linux",
+		CrossCompile: "aarch64-solus-linux-",
+		KernelArch:   "arm64",
+		Emulator:     "qemu-aarch64-static",
+		Magic:        `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		Mask:         `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+}
+
+// CrossArches returns the names of every supported cross architecture
+func CrossArches() []string {
+	var arches []string
+	for arch := range CrossTargets {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	return arches
+}
+
+// Environment returns the variables that direct ypkg-build at the target
+func (c *CrossTarget) Environment() []string {
+	return []string{
+		"CHOST=" + c.CHOST,
+		"CROSS_COMPILE=" + c.CrossCompile,
+		"ARCH=" + c.KernelArch,
+	}
+}
+
+// handlerName is the name of the binfmt_misc handler for the target
+func (c *CrossTarget) handlerName() string {
+	return strings.TrimSuffix(c.Emulator, "-static")
+}
+
+// A binfmtChange records how we changed a binfmt_misc handler
+type binfmtChange struct {
+	handler    string // Path of the handler within binfmt_misc
+	registered bool   // We registered the handler, so must remove it
+}
+
+// RegisterBinfmt will ensure binfmt_misc runs target binaries with the
+// emulator found beneath root. An existing handler is enabled, rather than
+// replaced, and the original state is restored by RestoreBinfmt.
+func RegisterBinfmt(target *CrossTarget, root string) error {
+	handler := filepath.Join(BinfmtMiscDir, target.handlerName())
+	if state, err := ioutil.ReadFile(handler); err == nil {
+		if strings.HasPrefix(string(state), "enabled") {
+			log.Debugf("Using existing binfmt_misc handler %s\n", handler)
+			return nil
+		}
+		log.Debugf("Enabling binfmt_misc handler %s\n", handler)
+		if err := ioutil.WriteFile(handler, []byte("1"), 00644); err != nil {
+			return fmt.Errorf("Failed to enable binfmt_misc handler %s, reason: %s\n", handler, err)
+		}
+		binfmtRestore = &binfmtChange{handler: handler}
+		return nil
+	}
+	// The F flag opens the emulator now, so it remains usable in the chroot
+	emulator := filepath.Join(root, "usr", "bin", target.Emulator)
+	if _, err := os.Stat(emulator); err != nil {
+		return fmt.Errorf("Missing emulator %s, reason: %s\n", emulator, err)
+	}
+	rule := fmt.Sprintf(":%s:M::%s:%s:%s:F", target.handlerName(), target.Magic, target.Mask, emulator)
+	log.Debugf("Registering binfmt_misc handler %s\n", handler)
+	if err := ioutil.WriteFile(filepath.Join(BinfmtMiscDir, "register"), []byte(rule), 00644); err != nil {
+		return fmt.Errorf("Failed to register binfmt_misc handler %s, reason: %s\n", handler, err)
+	}
+	binfmtRestore = &binfmtChange{handler: handler, registered: true}
+	return nil
+}
+
+// RestoreBinfmt will undo any change made by RegisterBinfmt
+func RestoreBinfmt() error {
+	if binfmtRestore == nil {
+		return nil
+	}
+	// Writing -1 removes the handler, 0 disables it again
+	state := "0"
+	if binfmtRestore.registered {
+		state = "-1"
+	}
+	log.Debugf("Restoring binfmt_misc handler %s\n", binfmtRestore.handler)
+	if err := ioutil.WriteFile(binfmtRestore.handler, []byte(state), 00644); err != nil {
+		return fmt.Errorf("Failed to restore binfmt_misc handler %s, reason: %s\n", binfmtRestore.handler, err)
+	}
+	binfmtRestore = nil
+	return nil
+}
+
+// CrossCompile will build the package for the target architecture, running
+// target binaries under emulation. It is called only by Build(), in place of
+// BuildYpkg(), and the packages are collected as for a native build.
+func (p *Package) CrossCompile(notif PidNotifier, usr *UserInfo, pman PackageManager, overlay *Overlay, h *PackageHistory, timer *StageTimer, targetArch string) error {
+	target, ok := CrossTargets[targetArch]
+	if !ok {
+		return fmt.Errorf("%s: %s\n", ErrUnknownCrossArch, targetArch)
+	}
+	log.Infof("Cross compiling for %s\n", targetArch)
+
+	if err := pman.InstallPackages([]string{QemuPackage}); err != nil {
+		return fmt.Errorf("Failed to install %s, reason: %s\n", QemuPackage, err)
+	}
+	if err := RegisterBinfmt(target, overlay.MountPoint); err != nil {
+		return err
+	}
+
+	ChrootEnvironment = append(ChrootEnvironment, target.Environment()...)
+	return p.BuildYpkg(notif, usr, pman, overlay, h, timer)
+}
@@ -0,0 +1,97 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrossTargetEnvironment(t *testing.T) {
+	env := strings.Join(CrossTargets["aarch64"].Environment(), " ")
+	if env != "CHOST=aarch64-solus-linux CROSS_COMPILE=aarch64-solus-linux- ARCH=arm64" {
+		t.Fatalf("Wrong cross environment: %s", env)
+	}
+}
+
+func TestRegisterBinfmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-binfmt")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	BinfmtMiscDir = filepath.Join(dir, "binfmt_misc")
+	defer func() { BinfmtMiscDir = "/proc/sys/fs/binfmt_misc" }()
+	root := filepath.Join(dir, "root")
+	target := CrossTargets["aarch64"]
+	if err := os.MkdirAll(filepath.Join(root, "usr", "bin"), 00755); err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	if err := os.MkdirAll(BinfmtMiscDir, 00755); err != nil {
+		t.Fatalf("Failed to create binfmt_misc: %v", err)
+	}
+
+	// Without the emulator, nothing can be registered
+	if err := RegisterBinfmt(target, root); err == nil {
+		t.Fatal("Registered a handler without an emulator")
+	}
+	emulator := filepath.Join(root, "usr", "bin", "qemu-aarch64-static")
+	if err := ioutil.WriteFile(emulator, nil, 00755); err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	if err := RegisterBinfmt(target, root); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+	rule, _ := ioutil.ReadFile(filepath.Join(BinfmtMiscDir, "register"))
+	if !strings.HasPrefix(string(rule), ":qemu-aarch64:M::") || !strings.HasSuffix(string(rule), ":"+emulator+":F") {
+		t.Fatalf("Wrong binfmt_misc rule: %s", rule)
+	}
+	// Stand in for the kernel creating the handler
+	handler := filepath.Join(BinfmtMiscDir, "qemu-aarch64")
+	if err := ioutil.WriteFile(handler, []byte("enabled\n"), 00644); err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	if err := RestoreBinfmt(); err != nil {
+		t.Fatalf("Failed to restore handler: %v", err)
+	}
+	if state, _ := ioutil.ReadFile(handler); string(state) != "-1" {
+		t.Fatalf("Registered handler was not removed: %s", state)
+	}
+
+	// A disabled handler is enabled, then disabled again
+	if err := ioutil.WriteFile(handler, []byte("disabled\n"), 00644); err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	if err := RegisterBinfmt(target, root); err != nil {
+		t.Fatalf("Failed to enable handler: %v", err)
+	}
+	if state, _ := ioutil.ReadFile(handler); string(state) != "1" {
+		t.Fatalf("Handler was not enabled: %s", state)
+	}
+	if err := RestoreBinfmt(); err != nil {
+		t.Fatalf("Failed to restore handler: %v", err)
+	}
+	if state, _ := ioutil.ReadFile(handler); string(state) != "0" {
+		t.Fatalf("Handler was not disabled again: %s", state)
+	}
+	if err := RestoreBinfmt(); err != nil {
+		t.Fatalf("Repeated restore failed: %v", err)
+	}
+}
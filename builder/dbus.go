@@ -0,0 +1,184 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	// DBusSocketDir is where the private bus sockets are created, relative
+	// to the root
+	DBusSocketDir = "run/solbuild"
+
+	// dbusPidFile is where a system bus records its PID within the root
+	dbusPidFile = "var/run/dbus/pid"
+)
+
+var (
+	// ErrDBusNotStarted is returned when the bus exits or never creates its
+	// socket
+	ErrDBusNotStarted = errors.New("The private bus failed to start")
+
+	// DBusStartTimeout is how long to wait for the bus socket to appear
+	DBusStartTimeout = 10 * time.Second
+
+	// NoDBus skips starting the private bus, for environments where D-Bus is
+	// unavailable. eopkg then runs without a system bus.
+	NoDBus bool
+
+	// dbusUnavailable matches the output of eopkg when it could not reach a
+	// system bus
+	dbusUnavailable = regexp.MustCompile(`(?i)failed to connect to (the )?system bus`)
+)
+
+// dbusStartHint is logged when the private bus cannot be started
+const dbusStartHint = "Unable to start D-BUS, try again with --no-dbus if it is unavailable here"
+
+// suggestNoDBus will warn that the build may work without D-Bus when the
+// output shows that the system bus could not be reached
+func suggestNoDBus(out string) {
+	if !NoDBus && dbusUnavailable.MatchString(out) {
+		log.Warnln("eopkg failed to connect to the system bus, try again with --no-dbus if D-Bus is unavailable here")
+	}
+}
+
+// A privateBus is a dbus-daemon with its own socket inside the root, owned
+// by solbuild and stopped through its process handle
+type privateBus struct {
+	socket  string // Path of the socket on the host
+	address string // Address of the bus within the root
+	cmd     *exec.Cmd
+	done    chan error
+}
+
+// newPrivateBus will choose a unique socket for a bus within the root
+func newPrivateBus(root string) *privateBus {
+	name := fmt.Sprintf("dbus-%d-%d.socket", os.Getpid(), time.Now().UnixNano())
+	return &privateBus{
+		socket:  filepath.Join(root, DBusSocketDir, name),
+		address: "unix:path=" + filepath.Join("/", DBusSocketDir, name),
+	}
+}
+
+// startPrivateBus will launch a system bus within the root, listening only
+// on a private socket. It never forks, so the child is the daemon itself.
+func startPrivateBus(root string) (*privateBus, error) {
+	bus := newPrivateBus(root)
+	if err := os.MkdirAll(filepath.Dir(bus.socket), 00755); err != nil {
+		return nil, err
+	}
+	c := chrootCommand(root, fmt.Sprintf("dbus-daemon --system --nofork --nopidfile --address=%s", bus.address))
+	c.Stdout = consoleStdout()
+	c.Stderr = os.Stderr
+	c.Env = ChrootEnvironment
+	if err := bus.start(c); err != nil {
+		return nil, err
+	}
+	return bus, nil
+}
+
+// start will run the command, and wait for it to create the bus socket
+func (b *privateBus) start(c *exec.Cmd) error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	b.cmd = c
+	b.done = make(chan error, 1)
+	go func() {
+		b.done <- c.Wait()
+	}()
+	deadline := time.After(DBusStartTimeout)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for !PathExists(b.socket) {
+		select {
+		case err := <-b.done:
+			b.cmd = nil
+			return fmt.Errorf("%s, reason: %v\n", ErrDBusNotStarted, err)
+		case <-deadline:
+			b.Stop()
+			return fmt.Errorf("%s, reason: no socket after %s\n", ErrDBusNotStarted, DBusStartTimeout)
+		case <-tick.C:
+		}
+	}
+	log.Debugf("Private bus listening on %s\n", b.address)
+	return nil
+}
+
+// Stop will kill the exact process started for the bus, and remove its socket
+func (b *privateBus) Stop() error {
+	defer os.Remove(b.socket)
+	if b.cmd == nil {
+		return nil
+	}
+	if err := b.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-b.done
+	b.cmd = nil
+	return nil
+}
+
+// CleanStaleDBus will remove the pidfile and sockets left in the root by a
+// bus from a crashed build. Nothing is killed, as the recorded PID may since
+// have been reused.
+func CleanStaleDBus(root string) error {
+	pidFile := filepath.Join(root, dbusPidFile)
+	if PathExists(pidFile) {
+		log.Debugf("Removing stale dbus pidfile %s\n", pidFile)
+		if err := os.Remove(pidFile); err != nil {
+			return fmt.Errorf("Failed to remove stale dbus pidfile %s, reason: %s\n", pidFile, err)
+		}
+	}
+	sockets, _ := filepath.Glob(filepath.Join(root, DBusSocketDir, "dbus-*.socket"))
+	for _, socket := range sockets {
+		log.Debugf("Removing stale dbus socket %s\n", socket)
+		if err := os.Remove(socket); err != nil {
+			return fmt.Errorf("Failed to remove stale dbus socket %s, reason: %s\n", socket, err)
+		}
+	}
+	return nil
+}
+
+// busExecutor runs every command with the private bus as the system bus
+type busExecutor struct {
+	commandExecutor
+	address string
+}
+
+// wrap will export the bus address ahead of the command
+func (b *busExecutor) wrap(command string) string {
+	return fmt.Sprintf("export DBUS_SYSTEM_BUS_ADDRESS='%s'; %s", b.address, command)
+}
+
+// Exec will run the command with the private bus
+func (b *busExecutor) Exec(command string) (string, error) {
+	return b.commandExecutor.Exec(b.wrap(command))
+}
+
+// Output will run the command with the private bus
+func (b *busExecutor) Output(command string) (string, error) {
+	return b.commandExecutor.Output(b.wrap(command))
+}
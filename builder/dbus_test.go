@@ -0,0 +1,175 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// startBystander will start an unrelated process, standing in for whatever
+// now owns the PID recorded by a crashed build
+func startBystander(t *testing.T) *exec.Cmd {
+	c := exec.Command("sleep", "60")
+	if err := c.Start(); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	return c
+}
+
+func writeStalePidfile(t *testing.T, root string, pid int) string {
+	pidFile := filepath.Join(root, dbusPidFile)
+	if err := os.MkdirAll(filepath.Dir(pidFile), 00755); err != nil {
+		t.Fatalf("Failed to create pidfile directory: %v", err)
+	}
+	if err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", pid)), 00644); err != nil {
+		t.Fatalf("Failed to write pidfile: %v", err)
+	}
+	return pidFile
+}
+
+func TestCleanStaleDBus(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-dbus")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	bystander := startBystander(t)
+	defer func() {
+		bystander.Process.Kill()
+		bystander.Wait()
+	}()
+	pidFile := writeStalePidfile(t, root, bystander.Process.Pid)
+	socket := newPrivateBus(root).socket
+	if err := os.MkdirAll(filepath.Dir(socket), 00755); err != nil {
+		t.Fatalf("Failed to create socket directory: %v", err)
+	}
+	if err := ioutil.WriteFile(socket, nil, 00644); err != nil {
+		t.Fatalf("Failed to write socket: %v", err)
+	}
+
+	if err := CleanStaleDBus(root); err != nil {
+		t.Fatalf("Failed to clean stale bus: %v", err)
+	}
+	if PathExists(pidFile) || PathExists(socket) {
+		t.Fatal("Stale pidfile or socket was left behind")
+	}
+	if err := bystander.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("Killed the process named by a stale pidfile: %v", err)
+	}
+	if err := CleanStaleDBus(root); err != nil {
+		t.Fatalf("Failed to clean an already clean root: %v", err)
+	}
+}
+
+func TestPrivateBusStop(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-dbus")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	bystander := startBystander(t)
+	defer func() {
+		bystander.Process.Kill()
+		bystander.Wait()
+	}()
+	writeStalePidfile(t, root, bystander.Process.Pid)
+
+	bus := newPrivateBus(root)
+	if err := os.MkdirAll(filepath.Dir(bus.socket), 00755); err != nil {
+		t.Fatalf("Failed to create socket directory: %v", err)
+	}
+	daemon := exec.Command("sh", "-c", `touch "$0" && exec sleep 60`, bus.socket)
+	if err := bus.start(daemon); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	if err := bus.Stop(); err != nil {
+		t.Fatalf("Failed to stop bus: %v", err)
+	}
+	if daemon.ProcessState == nil || daemon.ProcessState.Success() {
+		t.Fatal("The bus process was not killed")
+	}
+	if PathExists(bus.socket) {
+		t.Fatal("The bus socket was left behind")
+	}
+	if err := bystander.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("Killed the process named by a stale pidfile: %v", err)
+	}
+	if err := bus.Stop(); err != nil {
+		t.Fatalf("Failed to stop a stopped bus: %v", err)
+	}
+}
+
+func TestPrivateBusExited(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-dbus")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	bus := newPrivateBus(root)
+	err = bus.start(exec.Command("false"))
+	if err == nil || !strings.HasPrefix(err.Error(), ErrDBusNotStarted.Error()) {
+		t.Fatalf("Expected the bus to fail to start, got: %v", err)
+	}
+}
+
+func TestBusExecutor(t *testing.T) {
+	exec := &mockExecutor{}
+	e := &EopkgManager{exec: &busExecutor{commandExecutor: exec, address: "unix:path=/run/solbuild/dbus-1-2.socket"}}
+	if err := e.InstallPackages([]string{"gdb"}); err != nil {
+		t.Fatalf("Failed to install packages: %v", err)
+	}
+	expected := "export DBUS_SYSTEM_BUS_ADDRESS='unix:path=/run/solbuild/dbus-1-2.socket'; eopkg install -y gdb"
+	if len(exec.commands) != 1 || exec.commands[0] != expected {
+		t.Fatalf("Bus address was not exported, got: %v", exec.commands)
+	}
+}
+
+func TestNoDBus(t *testing.T) {
+	defer func() { NoDBus = false }()
+	NoDBus = true
+	exec := &mockExecutor{}
+	e := &EopkgManager{root: "/nonexistent", exec: exec}
+	if err := e.StartDBUS(); err != nil {
+		t.Fatalf("Expected D-BUS to be skipped, got: %v", err)
+	}
+	if e.bus != nil || e.exec != exec {
+		t.Fatal("A bus was started despite NoDBus")
+	}
+	if err := e.StopDBUS(); err != nil {
+		t.Fatalf("Failed to stop skipped D-BUS: %v", err)
+	}
+
+	for out, expected := range map[string]bool{
+		"Failed to connect to system bus: No such file or directory":         true,
+		"dbus.exceptions.DBusException: Failed to connect to the system bus": true,
+		"Package nano not found in any repository":                           false,
+	} {
+		if dbusUnavailable.MatchString(out) != expected {
+			t.Fatalf("Expected match %t for %q", expected, out)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// XzThreads is the number of threads used to decompress images, where 0
+	// uses every core. Multi-threaded decoding needs more memory, and is only
+	// faster for images compressed in multiple blocks.
+	XzThreads = 0
+
+	// ErrInvalidXzThreads is returned for a negative xz_threads
+	ErrInvalidXzThreads = errors.New("Invalid number of xz threads")
+
+	// ErrInvalidXzList is returned when the size of a compressed image
+	// cannot be determined
+	ErrInvalidXzList = errors.New("Unable to determine the uncompressed size")
+)
+
+// DecompressImage will decompress the xz image at src into dst, streaming
+// straight into the preallocated target rather than staging a second copy.
+// src is removed once it has been decompressed, as unxz would.
+func DecompressImage(src, dst string) error {
+	if err := decompressImageTo(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// decompressImageTo will decompress the xz image at src into dst, leaving
+// src in place
+func decompressImageTo(src, dst string) error {
+	size, err := xzUncompressedSize(src)
+	if err != nil {
+		log.Warnf("Not preallocating %s, reason: %s\n", dst, err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 00644)
+	if err != nil {
+		return fmt.Errorf("Failed to create image %s, reason: %s\n", dst, err)
+	}
+	if err = decompressInto(out, src, size); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("Failed to write image %s, reason: %s\n", dst, err)
+	}
+	return nil
+}
+
+// decompressInto will stream the decompressed src into out
+func decompressInto(out *os.File, src string, size int64) error {
+	if size > 0 {
+		// Not every filesystem supports it, in which case we carry on
+		if err := syscall.Fallocate(int(out.Fd()), 0, 0, size); err != nil {
+			log.Debugf("Failed to preallocate %s, reason: %s\n", out.Name(), err)
+		}
+	}
+	log.Debugf("Decompressing %s with %s\n", src, xzThreadsDescription(XzThreads))
+	start := time.Now()
+	cmd := exec.Command("xz", "--decompress", "--stdout", fmt.Sprintf("--threads=%d", XzThreads), src)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to decompress image %s, reason: %s\n", src, err)
+	}
+	written, err := out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	// Drop anything preallocated beyond the real size
+	if err = out.Truncate(written); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	log.Infof("Decompressed %s in %s (%s/s)\n", FormatBytes(written), elapsed.Round(time.Millisecond), FormatBytes(int64(float64(written)/elapsed.Seconds())))
+	return nil
+}
+
+// xzUncompressedSize will ask xz for the total uncompressed size of src
+func xzUncompressedSize(src string) (int64, error) {
+	out, err := exec.Command("xz", "--robot", "--list", src).Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseXzList(string(out))
+}
+
+// parseXzList will find the uncompressed size within the output of
+// xz --robot --list
+func parseXzList(list string) (int64, error) {
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Split(line, "\t")
+		if fields[0] != "totals" || len(fields) < 5 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			break
+		}
+		return size, nil
+	}
+	return 0, ErrInvalidXzList
+}
+
+// xzThreadsDescription describes the number of threads used by xz
+func xzThreadsDescription(threads int) string {
+	switch threads {
+	case 0:
+		return "a thread per core"
+	case 1:
+		return "a single thread"
+	default:
+		return fmt.Sprintf("%d threads", threads)
+	}
+}
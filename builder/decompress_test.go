@@ -0,0 +1,89 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseXzList(t *testing.T) {
+	list := "name\t/var/lib/solbuild/images/main-x86_64.img.xz\n" +
+		"file\t1\t4\t419430400\t2147483648\t0.195\tCRC64\t0\n" +
+		"totals\t1\t4\t419430400\t2147483648\t0.195\tCRC64\t0\t1\n"
+	size, err := parseXzList(list)
+	if err != nil || size != 2147483648 {
+		t.Fatalf("Expected 2147483648, got %d: %v", size, err)
+	}
+	if _, err := parseXzList("xz: not a valid file\n"); err != ErrInvalidXzList {
+		t.Fatalf("Expected ErrInvalidXzList, got %v", err)
+	}
+}
+
+func TestDecompressImage(t *testing.T) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("xz is not available")
+	}
+	dir, err := ioutil.TempDir("", "solbuild-xz")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("solbuild"), 128*1024)
+	img := filepath.Join(dir, "main-x86_64"+ImageSuffix)
+	if err := ioutil.WriteFile(img, content, 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if err := exec.Command("xz", "--threads=0", img).Run(); err != nil {
+		t.Fatalf("Failed to compress image: %v", err)
+	}
+	xz := img + ".xz"
+	for _, threads := range []int{0, 1} {
+		XzThreads = threads
+		if err := DecompressImage(xz, img); err != nil {
+			t.Fatalf("Failed to decompress with %d threads: %v", threads, err)
+		}
+		b, err := ioutil.ReadFile(img)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Fatalf("Decompressed image differs with %d threads: %v", threads, err)
+		}
+		if PathExists(xz) {
+			t.Fatal("Compressed image was not removed")
+		}
+		if err := exec.Command("xz", "--keep", img).Run(); err != nil {
+			t.Fatalf("Failed to compress image: %v", err)
+		}
+		os.Remove(img)
+	}
+	XzThreads = 0
+
+	// A corrupted archive must not leave a partial image behind
+	if err := ioutil.WriteFile(xz, []byte("not xz"), 00644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	if err := DecompressImage(xz, img); err == nil {
+		t.Fatal("Decompressed a corrupted archive")
+	}
+	if PathExists(img) || !PathExists(xz) {
+		t.Fatal("Failed decompression should keep the archive and remove the image")
+	}
+}
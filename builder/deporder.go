@@ -0,0 +1,195 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrDependencyCycle is matched by any DependencyCycleError
+	ErrDependencyCycle = errors.New("Dependency cycle")
+
+	// ErrDuplicateProvider is returned when two recipes produce a package of
+	// the same name
+	ErrDuplicateProvider = errors.New("Package is produced by more than one recipe")
+
+	// implicitSubpackages are created by ypkg automatically when the build
+	// installs matching files, so cannot be found in the recipe
+	implicitSubpackages = []string{"devel", "32bit", "32bit-devel", "docs", "dbginfo", "32bit-dbginfo"}
+)
+
+// A DependencyCycleError is returned when packages depend upon each other
+type DependencyCycleError struct {
+	Path []string // Names of the packages in the cycle, ending where it began
+}
+
+// Error will describe the packages in the cycle
+func (e *DependencyCycleError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDependencyCycle, strings.Join(e.Path, " -> "))
+}
+
+// Is will match ErrDependencyCycle
+func (e *DependencyCycleError) Is(target error) bool {
+	return target == ErrDependencyCycle
+}
+
+// FindRecipes will return every recipe within the tree at dir, preferring
+// package.yml over pspec.xml. Hidden directories and the subdirectories of
+// packages are not searched.
+func FindRecipes(dir string) ([]string, error) {
+	var recipes []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		for _, name := range []string{"package.yml", "pspec.xml"} {
+			recipe := filepath.Join(path, name)
+			if st, err := os.Stat(recipe); err == nil && !st.IsDir() {
+				recipes = append(recipes, recipe)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return recipes, err
+}
+
+// providers will map the name of every package produced by pkgs to the
+// index of the package producing it. Implicit subpackages never take the
+// place of a package declared by another recipe.
+func providers(pkgs []*Package) (map[string]int, error) {
+	provided := make(map[string]int)
+	for i, pkg := range pkgs {
+		names := pkg.Provides
+		if len(names) == 0 {
+			names = []string{pkg.Name}
+		}
+		for _, name := range names {
+			if j, ok := provided[name]; ok && j != i {
+				return nil, fmt.Errorf("%s: %s by %s and %s", ErrDuplicateProvider, name, pkgs[j].Path, pkg.Path)
+			}
+			provided[name] = i
+		}
+	}
+	for i, pkg := range pkgs {
+		if pkg.Type != PackageTypeYpkg {
+			continue
+		}
+		for _, suffix := range implicitSubpackages {
+			name := pkg.Name + "-" + suffix
+			if _, ok := provided[name]; !ok {
+				provided[name] = i
+			}
+		}
+	}
+	return provided, nil
+}
+
+// DependencyOrder will sort pkgs so that each package is built after those
+// producing its build and runtime dependencies. The packages are returned in
+// levels, where the packages of each level depend only upon those of earlier
+// levels, and so may be built at the same time. Dependencies that none of
+// the packages produce, such as pkgconfig() names, are expected to come
+// from the repositories.
+func DependencyOrder(pkgs []*Package) ([][]*Package, error) {
+	provided, err := providers(pkgs)
+	if err != nil {
+		return nil, err
+	}
+	deps := make([][]int, len(pkgs))
+	for i, pkg := range pkgs {
+		seen := make(map[int]bool)
+		for _, dep := range append(append([]string{}, pkg.BuildDeps...), pkg.RunDeps...) {
+			j, ok := provided[strings.TrimSpace(dep)]
+			if !ok {
+				log.Debugf("Assuming %s, needed by %s, is in the repositories\n", dep, pkg.Name)
+				continue
+			}
+			if j != i && !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	// Each level is one above the highest level of its dependencies
+	const (
+		unvisited = -2
+		visiting  = -1
+	)
+	level := make([]int, len(pkgs))
+	for i := range level {
+		level[i] = unvisited
+	}
+	var stack []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch level[i] {
+		case visiting:
+			var cycle []string
+			for k := len(stack) - 1; k >= 0; k-- {
+				cycle = append([]string{pkgs[stack[k]].Name}, cycle...)
+				if stack[k] == i {
+					break
+				}
+			}
+			return &DependencyCycleError{Path: append(cycle, pkgs[i].Name)}
+		case unvisited:
+		default:
+			return nil
+		}
+		level[i] = visiting
+		stack = append(stack, i)
+		highest := 0
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+			if level[j]+1 > highest {
+				highest = level[j] + 1
+			}
+		}
+		stack = stack[:len(stack)-1]
+		level[i] = highest
+		return nil
+	}
+	var levels [][]*Package
+	for i := range pkgs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	for i, pkg := range pkgs {
+		for len(levels) <= level[i] {
+			levels = append(levels, nil)
+		}
+		levels[level[i]] = append(levels[level[i]], pkg)
+	}
+	return levels, nil
+}
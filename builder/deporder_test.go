@@ -0,0 +1,104 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// levelOrder will return the names of the packages in each level
+func levelOrder(levels [][]*Package) string {
+	var names []string
+	for _, level := range levels {
+		var levelNames []string
+		for _, pkg := range level {
+			levelNames = append(levelNames, pkg.Name)
+		}
+		names = append(names, strings.Join(levelNames, ","))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestDependencyOrder(t *testing.T) {
+	pkgs := []*Package{
+		{Name: "gtk3", Type: PackageTypeYpkg, BuildDeps: []string{"pango-devel", "pkgconfig(x11)"}},
+		{Name: "pango", Type: PackageTypeYpkg, BuildDeps: []string{"cairo-devel"}, Provides: []string{"pango", "pango-utils"}},
+		{Name: "cairo", Type: PackageTypeYpkg},
+		{Name: "nano", Type: PackageTypeYpkg, RunDeps: []string{"file"}},
+		{Name: "gedit", Type: PackageTypeYpkg, BuildDeps: []string{"gtk3-devel"}, RunDeps: []string{"pango-utils"}},
+	}
+	levels, err := DependencyOrder(pkgs)
+	if err != nil {
+		t.Fatalf("Failed to order packages: %v", err)
+	}
+	if got := levelOrder(levels); got != "cairo,nano pango gtk3 gedit" {
+		t.Fatalf("Wrong build order: %s", got)
+	}
+
+	pkgs[2].BuildDeps = []string{"gedit"}
+	_, err = DependencyOrder(pkgs)
+	var cycle *DependencyCycleError
+	if !errors.Is(err, ErrDependencyCycle) || !errors.As(err, &cycle) {
+		t.Fatalf("Expected a dependency cycle, got: %v", err)
+	}
+	if got := strings.Join(cycle.Path, " -> "); got != "gtk3 -> pango -> cairo -> gedit -> gtk3" {
+		t.Fatalf("Wrong cycle: %s", got)
+	}
+
+	pkgs[2].BuildDeps = nil
+	pkgs[3].Provides = []string{"nano", "pango-utils"}
+	if _, err := DependencyOrder(pkgs); err == nil || !strings.HasPrefix(err.Error(), ErrDuplicateProvider.Error()) {
+		t.Fatalf("Expected a duplicate provider, got: %v", err)
+	}
+}
+
+func TestFindRecipes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-recipes")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, recipe := range []string{
+		"n/nano/package.yml",
+		"n/nano/files/package.yml",
+		"h/hello/pspec.xml",
+		"g/gedit/package.yml",
+		"g/gedit/pspec.xml",
+		".git/package.yml",
+	} {
+		path := filepath.Join(dir, recipe)
+		os.MkdirAll(filepath.Dir(path), 00755)
+		if err := ioutil.WriteFile(path, nil, 00644); err != nil {
+			t.Fatalf("Failed to write recipe: %v", err)
+		}
+	}
+	recipes, err := FindRecipes(dir)
+	if err != nil {
+		t.Fatalf("Failed to find recipes: %v", err)
+	}
+	for i := range recipes {
+		recipes[i], _ = filepath.Rel(dir, recipes[i])
+	}
+	if got := strings.Join(recipes, " "); got != "g/gedit/package.yml h/hello/pspec.xml n/nano/package.yml" {
+		t.Fatalf("Wrong recipes: %s", got)
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultMinDiskSpace is the free space required to start a build, 5GiB
+const DefaultMinDiskSpace int64 = 5 * 1024 * 1024 * 1024
+
+var (
+	// ErrInsufficientDiskSpace is matched by any DiskSpaceError
+	ErrInsufficientDiskSpace = errors.New("Insufficient disk space")
+
+	// MinDiskSpace is the free space, in bytes, required to start a build.
+	// Zero disables the check.
+	MinDiskSpace = DefaultMinDiskSpace
+)
+
+// A DiskSpaceError is returned when a filesystem has too little free space
+type DiskSpaceError struct {
+	Path     string
+	Free     int64
+	Required int64
+}
+
+// Error will describe the free space and the requirement
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("Insufficient disk space for %s: %s free, %s required", e.Path, FormatBytes(e.Free), FormatBytes(e.Required))
+}
+
+// Is will match ErrInsufficientDiskSpace
+func (e *DiskSpaceError) Is(target error) bool {
+	return target == ErrInsufficientDiskSpace
+}
+
+// byteUnits are the binary size suffixes, in increasing order
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+// FormatBytes will format the size in the largest suitable binary unit
+func FormatBytes(size int64) string {
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, byteUnits[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, byteUnits[unit])
+}
+
+// ParseBytes will parse a size with an optional K, M, G or T suffix, i.e.
+// "5G". Suffixes are binary multiples, and may be followed by "iB" or "B".
+func ParseBytes(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if value != "" {
+		if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+			multiplier = int64(1) << (10 * uint(i+1))
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size: %s", size)
+	}
+	return n * multiplier, nil
+}
+
+// freeSpace will return the space available to unprivileged users on the
+// filesystem holding path. Missing directories are checked on their parent.
+func freeSpace(path string) (int64, error) {
+	for {
+		var st syscall.Statfs_t
+		err := syscall.Statfs(path, &st)
+		if err == nil {
+			return int64(st.Bavail) * int64(st.Bsize), nil
+		}
+		if !os.IsNotExist(err) || path == filepath.Dir(path) {
+			return 0, fmt.Errorf("Failed to check free space of %s, reason: %s\n", path, err)
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// checkFreeSpace will return a DiskSpaceError if path has less than the
+// required free space
+func checkFreeSpace(path string, requiredBytes int64) error {
+	free, err := freeSpace(path)
+	if err != nil {
+		return err
+	}
+	if free < requiredBytes {
+		return &DiskSpaceError{Path: path, Free: free, Required: requiredBytes}
+	}
+	return nil
+}
+
+// CheckDiskSpace will ensure the filesystems holding the images and their
+// roots have at least requiredBytes free, so that builds fail fast rather
+// than part way through
+func (b *BackingImage) CheckDiskSpace(requiredBytes int64) error {
+	for _, dir := range []string{ImagesDir, ImageRootsDir} {
+		if err := checkFreeSpace(dir, requiredBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
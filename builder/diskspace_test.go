@@ -0,0 +1,70 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	sizes := map[string]int64{
+		"0":     0,
+		"512":   512,
+		"4K":    4096,
+		"10M":   10 * 1024 * 1024,
+		"5G":    DefaultMinDiskSpace,
+		"5GiB":  DefaultMinDiskSpace,
+		"1tb":   1024 * 1024 * 1024 * 1024,
+		" 2G  ": 2 * 1024 * 1024 * 1024,
+	}
+	for value, expected := range sizes {
+		size, err := ParseBytes(value)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", value, err)
+		}
+		if size != expected {
+			t.Fatalf("Parsed %q as %d, expected %d", value, size, expected)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1G", "5X"} {
+		if _, err := ParseBytes(bad); err == nil {
+			t.Fatalf("Accepted invalid size %q", bad)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	if s := FormatBytes(512); s != "512B" {
+		t.Fatalf("Wrong format: %s", s)
+	}
+	if s := FormatBytes(DefaultMinDiskSpace); s != "5.0GiB" {
+		t.Fatalf("Wrong format: %s", s)
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	// Missing directories are checked on the nearest parent
+	if err := checkFreeSpace("/tmp/solbuild-missing/roots", 1); err != nil {
+		t.Fatalf("Failed to check free space: %v", err)
+	}
+	err := checkFreeSpace("/tmp", 1<<62)
+	var spaceErr *DiskSpaceError
+	if !errors.Is(err, ErrInsufficientDiskSpace) || !errors.As(err, &spaceErr) || spaceErr.Required != 1<<62 {
+		t.Fatalf("Expected insufficient disk space, got: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultDiskUsageInterval is how often the disk usage of the overlay is
+	// sampled while building by default
+	DefaultDiskUsageInterval = 30 * time.Second
+
+	// diskUsageThrottle is how many times longer than the last walk of the
+	// overlay to wait before walking it again
+	diskUsageThrottle = 10
+)
+
+var (
+	// DiskUsageInterval is how often the disk usage of the overlay is sampled
+	// while building. Zero disables sampling.
+	DiskUsageInterval = DefaultDiskUsageInterval
+
+	// BuildPeakDisk is the peak disk usage of the overlay during the last
+	// build, in bytes, when it was sampled
+	BuildPeakDisk int64
+
+	// ErrInvalidDiskUsageInterval is returned for a negative sampling interval
+	ErrInvalidDiskUsageInterval = errors.New("Invalid disk_usage_interval")
+)
+
+// A DiskUsageSampler tracks the peak disk usage of a directory over time
+type DiskUsageSampler struct {
+	sample   func() (int64, error)
+	interval time.Duration
+
+	lock sync.Mutex
+	peak int64
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDiskUsageSampler will sample the upper directory of the overlay. A tmpfs
+// holds nothing else, so its usage is cheaply read with statfs. Otherwise the
+// directory is walked, and never more often than diskUsageThrottle times the
+// duration of the last walk.
+func NewDiskUsageSampler(o *Overlay, interval time.Duration) *DiskUsageSampler {
+	s := &DiskUsageSampler{interval: interval}
+	if o.EnableTmpfs {
+		s.sample = func() (int64, error) { return filesystemUsage(o.BaseDir) }
+	} else {
+		s.sample = func() (int64, error) { return dirUsage(o.UpperDir) }
+	}
+	return s
+}
+
+// Start will begin sampling in the background
+func (s *DiskUsageSampler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stop, s.done)
+}
+
+// run will take a sample every interval until stopped
+func (s *DiskUsageSampler) run(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		wait := s.interval
+		if took := s.take(); took*diskUsageThrottle > wait {
+			wait = took * diskUsageThrottle
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// take will take a single sample, returning how long it took
+func (s *DiskUsageSampler) take() time.Duration {
+	start := time.Now()
+	used, err := s.sample()
+	if err != nil {
+		log.Debugf("Failed to sample disk usage, reason: %s\n", err)
+		return time.Since(start)
+	}
+	s.lock.Lock()
+	if used > s.peak {
+		s.peak = used
+	}
+	s.lock.Unlock()
+	return time.Since(start)
+}
+
+// Stop will end sampling, taking a last sample so that the usage at the end
+// of the build is always seen
+func (s *DiskUsageSampler) Stop() {
+	s.lock.Lock()
+	stop, done := s.stop, s.done
+	s.stop = nil
+	s.lock.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	s.take()
+}
+
+// Peak returns the highest usage sampled, in bytes
+func (s *DiskUsageSampler) Peak() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.peak
+}
+
+// filesystemUsage will return the space used on the filesystem holding path
+func filesystemUsage(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks-st.Bfree) * int64(st.Bsize), nil
+}
+
+// dirUsage will return the space allocated to everything within dir, counting
+// hard links once, like du(1). Files removed during the walk are skipped.
+func dirUsage(dir string) (int64, error) {
+	var used int64
+	seen := make(map[exportInode]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			used += info.Size()
+			return nil
+		}
+		if st.Nlink > 1 {
+			inode := exportInode{dev: uint64(st.Dev), ino: st.Ino}
+			if seen[inode] {
+				return nil
+			}
+			seen[inode] = true
+		}
+		// Blocks are always 512 bytes, regardless of the filesystem
+		used += st.Blocks * 512
+		return nil
+	})
+	return used, err
+}
+
+// sampleDiskUsage will sample the disk usage of the overlay during the build
+// stage, storing the peak in BuildPeakDisk. The sampler is returned so that
+// it may be stopped should the build stage never complete.
+func (m *Manager) sampleDiskUsage() *DiskUsageSampler {
+	BuildPeakDisk = 0
+	if DiskUsageInterval <= 0 || UseDocker {
+		return nil
+	}
+	sampler := NewDiskUsageSampler(m.overlay, DiskUsageInterval)
+	m.timer.OnStart(func(s Stage) {
+		if s == StageBuild {
+			sampler.Start()
+		}
+	})
+	m.timer.OnComplete(func(s Stage, err error) {
+		if s != StageBuild {
+			return
+		}
+		sampler.Stop()
+		BuildPeakDisk = sampler.Peak()
+		log.Debugf("Peak disk usage of the build: %s\n", FormatBytes(BuildPeakDisk))
+	})
+	return sampler
+}
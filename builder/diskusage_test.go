@@ -0,0 +1,80 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-diskusage")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	empty, err := dirUsage(dir)
+	if err != nil {
+		t.Fatalf("Failed to measure directory: %v", err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, make([]byte, 1024*1024), 00644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Link(file, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("Failed to link file: %v", err)
+	}
+	used, err := dirUsage(dir)
+	if err != nil {
+		t.Fatalf("Failed to measure directory: %v", err)
+	}
+	if used-empty < 1024*1024 || used-empty >= 2*1024*1024 {
+		t.Fatalf("Wrong usage %d for a hard linked 1MiB file", used-empty)
+	}
+	if _, err := dirUsage(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("Missing directory was an error: %v", err)
+	}
+}
+
+func TestDiskUsageSampler(t *testing.T) {
+	samples := []int64{100, 400, 200}
+	done := make(chan struct{})
+	s := &DiskUsageSampler{interval: time.Millisecond}
+	s.sample = func() (int64, error) {
+		if len(samples) == 0 {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+			return 50, nil
+		}
+		used := samples[0]
+		samples = samples[1:]
+		return used, nil
+	}
+	s.Start()
+	<-done
+	s.Stop()
+	s.Stop()
+	if peak := s.Peak(); peak != 400 {
+		t.Fatalf("Wrong peak disk usage: %d", peak)
+	}
+}
@@ -0,0 +1,351 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DistccPort is the default port of the distcc daemon
+	DistccPort = 3632
+
+	// DistccMasqueradeDir contains the compiler links that call distcc
+	DistccMasqueradeDir = "/usr/lib64/distcc/bin"
+
+	// DistccHostsFile is where the hosts are written within the chroot
+	DistccHostsFile = "etc/distcc/hosts"
+
+	// DistccHostsEnv lists the distcc hosts for a build with --distcc
+	DistccHostsEnv = "DISTCC_HOSTS"
+
+	// DistccUserConfig is the distcc configuration within the home directory
+	// of the user, used by --distcc when DistccHostsEnv is unset
+	DistccUserConfig = ".config/solbuild/distcc.conf"
+
+	// distccDialTimeout is how long to wait for a distcc host to accept
+	distccDialTimeout = 10 * time.Second
+
+	// distccSlots and distccLocalSlots are the jobs given to a remote host
+	// and to localhost when no limit is set, as distcc does
+	distccSlots      = 4
+	distccLocalSlots = 2
+)
+
+var (
+	// ErrNoDistccHosts is returned when distcc is enabled without any hosts
+	ErrNoDistccHosts = errors.New("distcc is enabled but no hosts are configured")
+
+	// DistccHosts are the distcc hosts to compile on. Distributed compilation
+	// is disabled when empty.
+	DistccHosts []string
+
+	// ErrDistccSSH is returned for distcc hosts reached over SSH, which an
+	// isolated build cannot forward
+	ErrDistccSSH = errors.New("distcc hosts over SSH are unsupported for builds without networking")
+)
+
+// DistccConfig is the configuration for distributed compilation
+type DistccConfig struct {
+	Enabled bool     `toml:"enabled"` // Whether to farm out compilation with distcc
+	Hosts   []string `toml:"hosts"`   // Hosts in the distcc HOST[:PORT][/LIMIT][,OPTIONS] syntax
+}
+
+// LoadDistccConfig will load the distcc configuration at the given path. A
+// missing file is not an error, and results in an empty configuration.
+func LoadDistccConfig(path string) (*DistccConfig, error) {
+	config := &DistccConfig{}
+	if !PathExists(path) {
+		return config, nil
+	}
+	if _, err := toml.DecodeFile(path, config); err != nil {
+		return nil, fmt.Errorf("Failed to load distcc configuration %s, reason: %s\n", path, err)
+	}
+	return config, nil
+}
+
+// ParseDistccHosts will split a DISTCC_HOSTS value into its hosts, ignoring
+// options such as --randomize and +zeroconf
+func ParseDistccHosts(value string) []string {
+	var hosts []string
+	for _, field := range strings.Fields(value) {
+		if strings.HasPrefix(field, "-") || strings.HasPrefix(field, "+") {
+			continue
+		}
+		hosts = append(hosts, field)
+	}
+	return hosts
+}
+
+// EnableDistcc will distribute compilation to the hosts of DistccHostsEnv,
+// or of the DistccUserConfig of the user running solbuild when it is unset.
+// sudo drops DistccHostsEnv unless it is preserved, so the user config of
+// the user invoking sudo is read instead.
+func EnableDistcc() error {
+	hosts := ParseDistccHosts(os.Getenv(DistccHostsEnv))
+	sudo := false
+	if len(hosts) < 1 {
+		usr := &UserInfo{}
+		if sudo = usr.SetFromSudo(); !sudo {
+			usr.SetFromCurrent()
+		}
+		config, err := LoadDistccConfig(filepath.Join(usr.HomeDir, DistccUserConfig))
+		if err != nil {
+			return err
+		}
+		hosts = config.Hosts
+	}
+	if len(hosts) < 1 && sudo {
+		return fmt.Errorf("%s, sudo only passes %s with --preserve-env=%s", ErrNoDistccHosts, DistccHostsEnv, DistccHostsEnv)
+	}
+	if len(hosts) < 1 {
+		return ErrNoDistccHosts
+	}
+	DistccHosts = hosts
+	return nil
+}
+
+// DistccJobs will return the number of jobs the hosts can compile at once
+func DistccJobs(hosts []string) int {
+	jobs := 0
+	for _, spec := range hosts {
+		host, _ := distccAddress(spec)
+		slots := distccSlots
+		if host == "localhost" {
+			slots = distccLocalSlots
+		}
+		if i := strings.IndexByte(spec, '/'); i >= 0 {
+			limit := spec[i+1:]
+			if j := strings.IndexByte(limit, ','); j >= 0 {
+				limit = limit[:j]
+			}
+			if n, err := strconv.Atoi(limit); err == nil && n > 0 {
+				slots = n
+			}
+		}
+		jobs += slots
+	}
+	return jobs
+}
+
+// distccPump will determine whether the build should run under the pump
+// wrapper, which requires a host accepting preprocessing with ",cpp"
+func distccPump(hosts []string, has func(tool string) bool) bool {
+	for _, spec := range hosts {
+		if !strings.Contains(spec, ",cpp") {
+			continue
+		}
+		if has("pump") {
+			return true
+		}
+		log.Warnln("distcc pump mode is configured but pump is not installed, preprocessing locally")
+		return false
+	}
+	return false
+}
+
+// distccAddress will return the host and port from a distcc host specification
+func distccAddress(spec string) (string, int) {
+	if i := strings.IndexAny(spec, "/,"); i >= 0 {
+		spec = spec[:i]
+	}
+	port := DistccPort
+	if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+		if p, err := strconv.Atoi(spec[i+1:]); err == nil {
+			port = p
+		}
+		spec = spec[:i]
+	}
+	return spec, port
+}
+
+// ConfigureDistcc will write the distcc hosts into the chroot, prepend the
+// masquerade directory to the PATH used for the build, and run as many jobs
+// as the hosts can take. When networking has been dropped, the hosts are
+// forwarded into the network namespace of the build by a DistccProxy.
+func ConfigureDistcc(o *Overlay) error {
+	hosts := DistccHosts
+	if isolateNetwork {
+		proxy, err := StartDistccProxy(DistccHosts)
+		if err != nil {
+			return err
+		}
+		distccProxy = proxy
+		distccNetNS = proxy.NetNS
+		hosts = proxy.Hosts
+	}
+	hostsFile := filepath.Join(o.MountPoint, DistccHostsFile)
+	if err := os.MkdirAll(filepath.Dir(hostsFile), 00755); err != nil {
+		return fmt.Errorf("Failed to create distcc config directory, reason: %s\n", err)
+	}
+	if err := ioutil.WriteFile(hostsFile, []byte(strings.Join(hosts, "\n")+"\n"), 00644); err != nil {
+		return fmt.Errorf("Failed to write distcc hosts, reason: %s\n", err)
+	}
+	for i, e := range ChrootEnvironment {
+		if strings.HasPrefix(e, "PATH=") {
+			ChrootEnvironment[i] = fmt.Sprintf("PATH=%s:%s", DistccMasqueradeDir, strings.TrimPrefix(e, "PATH="))
+		}
+	}
+	jobs := DistccJobs(DistccHosts)
+	ChrootEnvironment = append(ChrootEnvironment,
+		"CC=distcc gcc",
+		"CXX=distcc g++",
+		fmt.Sprintf("MAKEFLAGS=-j%d", jobs),
+	)
+	log.Infof("Distributing compilation to %d distcc host(s), running %d jobs\n", len(DistccHosts), jobs)
+	return nil
+}
+
+// A DistccProxy forwards the distcc hosts into the network namespace of an
+// isolated build. The namespace is held by a dedicated thread, and only has
+// a loopback device. Each distcc host is reached through a port on it, which
+// solbuild forwards from the host, so nothing else can be reached and host
+// networking is never changed.
+type DistccProxy struct {
+	Hosts     []string // Host specifications, rewritten to the forwarded ports
+	NetNS     string   // Path to the network namespace
+	listeners []net.Listener
+	release   chan struct{}
+}
+
+// distccProxy is the running proxy, if any
+var distccProxy *DistccProxy
+
+// distccLocalHost determines whether the host spec compiles locally, without
+// any networking
+func distccLocalHost(spec string) bool {
+	host, _ := distccAddress(spec)
+	return host == "localhost"
+}
+
+// distccProxySpec will rewrite the host specification to use the forwarded
+// port on the loopback device, keeping any limit and options
+func distccProxySpec(spec string, port int) string {
+	suffix := ""
+	if i := strings.IndexAny(spec, "/,"); i >= 0 {
+		suffix = spec[i:]
+	}
+	return fmt.Sprintf("127.0.0.1:%d%s", port, suffix)
+}
+
+// StartDistccProxy will create the network namespace of the build, with a
+// forwarded port for each of the hosts
+func StartDistccProxy(hosts []string) (*DistccProxy, error) {
+	for _, spec := range hosts {
+		if strings.HasPrefix(spec, "@") {
+			return nil, fmt.Errorf("%s: %s", ErrDistccSSH, spec)
+		}
+	}
+	release := make(chan struct{})
+	p := &DistccProxy{release: release}
+	ready := make(chan error)
+	go func() {
+		// The thread is never unlocked, so it exits along with the namespace
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			ready <- fmt.Errorf("Failed to create network namespace, reason: %s\n", err)
+			return
+		}
+		p.NetNS = fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), syscall.Gettid())
+		// Children are forked from this thread, within the namespace
+		if err := exec.Command("/bin/sh", "-c", loopbackCommand).Run(); err != nil {
+			ready <- fmt.Errorf("Failed to bring up loopback device, reason: %s\n", err)
+			return
+		}
+		for _, spec := range hosts {
+			if distccLocalHost(spec) {
+				p.Hosts = append(p.Hosts, spec)
+				continue
+			}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				ready <- fmt.Errorf("Failed to forward distcc host %s, reason: %s\n", spec, err)
+				return
+			}
+			p.listeners = append(p.listeners, l)
+			p.Hosts = append(p.Hosts, distccProxySpec(spec, l.Addr().(*net.TCPAddr).Port))
+			host, port := distccAddress(spec)
+			go forwardDistcc(l, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		ready <- nil
+		<-release
+	}()
+	if err := <-ready; err != nil {
+		p.Stop()
+		return nil, err
+	}
+	return p, nil
+}
+
+// forwardDistcc will forward each connection accepted on the listener to the
+// distcc host at addr, until the listener is closed
+func forwardDistcc(l net.Listener, addr string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			remote, err := net.DialTimeout("tcp", addr, distccDialTimeout)
+			if err != nil {
+				log.Warnf("Failed to reach distcc host %s, reason: %s\n", addr, err)
+				return
+			}
+			defer remote.Close()
+			go io.Copy(remote, conn)
+			io.Copy(conn, remote)
+		}()
+	}
+}
+
+// Stop will stop forwarding, and release the network namespace
+func (p *DistccProxy) Stop() {
+	for _, l := range p.listeners {
+		l.Close()
+	}
+	p.listeners = nil
+	if p.release != nil {
+		close(p.release)
+		p.release = nil
+	}
+}
+
+// StopDistccProxy will stop the running proxy, if any
+func StopDistccProxy() {
+	if distccProxy == nil {
+		return
+	}
+	log.Debugln("Stopping distcc forwarding")
+	distccProxy.Stop()
+	distccProxy = nil
+	distccNetNS = ""
+}
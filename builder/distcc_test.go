@@ -0,0 +1,151 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDistccAddress(t *testing.T) {
+	tests := []struct {
+		spec string
+		host string
+		port int
+	}{
+		{"node1", "node1", DistccPort},
+		{"node2/8", "node2", DistccPort},
+		{"10.0.0.3:4000/16,lzo", "10.0.0.3", 4000},
+	}
+	for _, test := range tests {
+		host, port := distccAddress(test.spec)
+		if host != test.host || port != test.port {
+			t.Fatalf("Wrong address for %s: %s:%d vs expected %s:%d", test.spec, host, port, test.host, test.port)
+		}
+	}
+}
+
+func TestParseDistccHosts(t *testing.T) {
+	hosts := ParseDistccHosts("  --randomize node1/8 10.0.0.3:4000/16,lzo,cpp +zeroconf ")
+	if len(hosts) != 2 || hosts[0] != "node1/8" || hosts[1] != "10.0.0.3:4000/16,lzo,cpp" {
+		t.Fatalf("Wrong hosts: %v", hosts)
+	}
+	if hosts := ParseDistccHosts(""); len(hosts) != 0 {
+		t.Fatalf("Found hosts in an empty value: %v", hosts)
+	}
+}
+
+func TestDistccJobs(t *testing.T) {
+	if jobs := DistccJobs([]string{"localhost", "node1", "node2/8", "10.0.0.3:4000/16,lzo"}); jobs != 30 {
+		t.Fatalf("Wrong number of jobs: %d", jobs)
+	}
+	if jobs := DistccJobs(nil); jobs != 0 {
+		t.Fatalf("Jobs without hosts: %d", jobs)
+	}
+}
+
+func TestDistccPump(t *testing.T) {
+	has := func(tool string) bool { return true }
+	missing := func(tool string) bool { return false }
+	if !distccPump([]string{"node1/8", "node2/8,cpp,lzo"}, has) {
+		t.Fatal("Pump mode was not used")
+	}
+	if distccPump([]string{"node1/8,cpp,lzo"}, missing) {
+		t.Fatal("Pump mode was used without pump")
+	}
+	if distccPump([]string{"node1/8,lzo"}, has) {
+		t.Fatal("Pump mode was used without a cpp host")
+	}
+}
+
+func TestLoadDistccConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-distcc")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "distcc.conf")
+	if config, err := LoadDistccConfig(path); err != nil || len(config.Hosts) != 0 {
+		t.Fatalf("Expected an empty configuration, got %+v: %v", config, err)
+	}
+	ioutil.WriteFile(path, []byte("hosts = [\"node1/8\", \"node2/16\"]\n"), 00644)
+	config, err := LoadDistccConfig(path)
+	if err != nil || len(config.Hosts) != 2 {
+		t.Fatalf("Wrong configuration %+v: %v", config, err)
+	}
+	ioutil.WriteFile(path, []byte("hosts = node1\n"), 00644)
+	if _, err := LoadDistccConfig(path); err == nil {
+		t.Fatal("Loaded an invalid configuration")
+	}
+}
+
+func TestDistccProxySpec(t *testing.T) {
+	tests := map[string]string{
+		"node1":                "127.0.0.1:4100",
+		"node2/8":              "127.0.0.1:4100/8",
+		"10.0.0.3:4000/16,lzo": "127.0.0.1:4100/16,lzo",
+		"node4,cpp,lzo":        "127.0.0.1:4100,cpp,lzo",
+	}
+	for spec, expected := range tests {
+		if proxied := distccProxySpec(spec, 4100); proxied != expected {
+			t.Fatalf("Wrong proxied host for %s: %s vs expected %s", spec, proxied, expected)
+		}
+	}
+	if !distccLocalHost("localhost/2") || distccLocalHost("node1") {
+		t.Fatal("Wrong detection of local hosts")
+	}
+}
+
+func TestDistccProxy(t *testing.T) {
+	if _, err := StartDistccProxy([]string{"@node1"}); err == nil {
+		t.Fatal("Forwarded a distcc host over SSH")
+	}
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer remote.Close()
+	go func() {
+		conn, err := remote.Accept()
+		if err == nil {
+			conn.Write([]byte("DONE"))
+			conn.Close()
+		}
+	}()
+	proxy, err := StartDistccProxy([]string{remote.Addr().String() + "/8", "localhost"})
+	if err != nil {
+		t.Skipf("Unable to create a network namespace: %v", err)
+	}
+	defer proxy.Stop()
+	if len(proxy.Hosts) != 2 || !strings.HasSuffix(proxy.Hosts[0], "/8") || proxy.Hosts[1] != "localhost" {
+		t.Fatalf("Wrong proxied hosts: %v", proxy.Hosts)
+	}
+	// The forwarded port is only reachable from within the namespace
+	out, err := exec.Command("nsenter", "--net="+proxy.NetNS, "bash", "-c",
+		"exec 3<>/dev/tcp/"+strings.Replace(strings.TrimSuffix(proxy.Hosts[0], "/8"), ":", "/", 1)+" && cat <&3").Output()
+	if err != nil {
+		t.Skipf("Unable to connect within the namespace: %v", err)
+	}
+	if string(out) != "DONE" {
+		t.Fatalf("Wrong data through the proxy: %q", out)
+	}
+}
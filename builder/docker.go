@@ -0,0 +1,250 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder/source"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// DockerImage is the repository of the images used for Docker builds,
+	// tagged by the name of the profile
+	DockerImage = "docker.io/getsolus/package-builder"
+
+	// DockerNetwork is the network the container is disconnected from once
+	// the build dependencies are installed, for builds without networking
+	DockerNetwork = "bridge"
+)
+
+var (
+	// UseDocker will build packages within a Docker container instead of
+	// an overlayfs root
+	UseDocker bool
+
+	// DockerCommand is the docker client used for Docker builds
+	DockerCommand = "docker"
+
+	// ErrDockerUnsupported is returned for builds that cannot be run within
+	// a Docker container
+	ErrDockerUnsupported = errors.New("Only native package.yml builds are supported with Docker")
+)
+
+// DockerBuilder builds a package within a Docker container, as an alternative
+// to the overlayfs root. Sources are fetched and validated on the host, and
+// bind mounted into the container along with a copy of the package directory.
+// The container is kept running while the build dependencies are installed,
+// and is then disconnected from the network before the package is built by
+// the build user, as within the chroot.
+type DockerBuilder struct {
+	pkg     *Package
+	profile *Profile
+	Image   string // Image to build within
+}
+
+// dockerRootless will determine whether a Docker build is run without root,
+// in which case nothing is written to the system directories of solbuild
+func dockerRootless() bool {
+	return UseDocker && os.Geteuid() != 0
+}
+
+// useUserSourceCache will keep the sources of a Docker build run without root
+// within the cache directory of the user, as the system source cache may only
+// be written by root
+func useUserSourceCache() error {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("Unable to find the user cache directory, reason: %s", err)
+	}
+	source.SourceDir = filepath.Join(cache, "solbuild", "sources")
+	source.SourceStagingDir = filepath.Join(source.SourceDir, "staging")
+	source.GitSourceDir = filepath.Join(source.SourceDir, "git")
+	ChecksumCachePath = filepath.Join(cache, "solbuild", ChecksumCacheFile)
+	log.Debugf("Caching sources in %s\n", source.SourceDir)
+	return nil
+}
+
+// NewDockerBuilder will return a builder using the image of the profile
+func NewDockerBuilder(pkg *Package, profile *Profile) *DockerBuilder {
+	return &DockerBuilder{
+		pkg:     pkg,
+		profile: profile,
+		Image:   fmt.Sprintf("%s:%s", DockerImage, profile.Name),
+	}
+}
+
+// Build will build the package within a new container, and collect the
+// resulting artifacts into the current directory.
+func (d *DockerBuilder) Build(notif PidNotifier, history *PackageHistory, manifestTarget string, timer *StageTimer) error {
+	p := d.pkg
+	log.Debugf("Building package %s %s %d with Docker image %s\n", p.Name, p.Version, p.Release, d.Image)
+
+	if p.Type != PackageTypeYpkg || CrossArch != "" {
+		return ErrDockerUnsupported
+	}
+	// Colliding sources would be bound on top of each other
+	if collisions := p.SourceCollisions(); len(collisions) > 0 {
+		return collisions[0]
+	}
+
+	usr := GetUserInfo()
+
+	timer.Start(StageFetch)
+
+	workDir, err := ioutil.TempDir("", "solbuild-docker")
+	if err != nil {
+		return timer.Fail(fmt.Errorf("Failed to create work directory, reason: %s\n", err))
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := p.copyAssetsTo(history, workDir); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to copy required source assets, reason: %s\n", err))
+	}
+
+	// The container is the only isolation, so these are never run on the host
+	if len(p.PreBuildHooks) > 0 {
+		log.Warnf("Not running %d pre-build hooks of the package with --docker\n", len(p.PreBuildHooks))
+	}
+
+	log.Debugln("Validating sources")
+	if err := p.ValidateSources(); err != nil {
+		return timer.Fail(err)
+	}
+	if err := p.FetchSources(nil); err != nil {
+		return timer.Fail(err)
+	}
+
+	timer.Start(StageDeps)
+
+	if err := d.ensureImage(); err != nil {
+		return timer.Fail(err)
+	}
+
+	name := fmt.Sprintf("solbuild-%s-%d", p.Name, os.Getpid())
+	if err := d.run(nil, d.createArgs(workDir, name)); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to start container, reason: %s\n", err))
+	}
+	defer exec.Command(DockerCommand, "rm", "-f", name).Run()
+
+	log.Infoln("Installing build dependencies")
+	if err := d.run(notif, d.depsArgs(name)); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to install build dependencies, reason: %s\n", err))
+	}
+	if !p.CanNetwork {
+		if err := d.run(nil, []string{"network", "disconnect", DockerNetwork, name}); err != nil {
+			return timer.Fail(fmt.Errorf("Failed to disconnect container from the network, reason: %s\n", err))
+		}
+	}
+	if err := d.run(notif, d.chownArgs(name)); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to set home directory permissions, reason: %s\n", err))
+	}
+
+	timer.Start(StageBuild)
+	log.Infoln("Now starting build of package")
+	if err := d.run(notif, d.buildArgs(history, name)); err != nil {
+		return timer.Fail(fmt.Errorf("Failed to start build of package, reason: %s\n", err))
+	}
+
+	timer.Start(StageCollect)
+	if err := p.collectArtifacts(workDir, usr, manifestTarget, timer); err != nil {
+		return timer.Fail(err)
+	}
+	timer.Stop()
+	return nil
+}
+
+// ensureImage will pull the image unless it is already available locally
+func (d *DockerBuilder) ensureImage() error {
+	if err := exec.Command(DockerCommand, "image", "inspect", d.Image).Run(); err == nil {
+		return nil
+	}
+	log.Infof("Pulling Docker image %s\n", d.Image)
+	if err := d.run(nil, []string{"pull", d.Image}); err != nil {
+		return fmt.Errorf("Failed to pull Docker image %s, reason: %s\n", d.Image, err)
+	}
+	return nil
+}
+
+// createArgs returns the arguments to docker for starting the container of
+// the build, with workDir mounted as the work directory. The container idles
+// until it is removed, with each step run within it by docker exec.
+func (d *DockerBuilder) createArgs(workDir, name string) []string {
+	p := d.pkg
+	wdir := p.GetWorkDirInternal()
+	args := []string{"run", "-d", "--name", name, "-v", workDir + ":" + wdir}
+	for _, variable := range buildEnvironment(nil, p.BuildEnv) {
+		args = append(args, "-e", variable)
+	}
+	for _, src := range p.Sources {
+		bind := src.GetBindConfiguration(p.GetSourceDirInternal())
+		args = append(args, "-v", bind.BindSource+":"+bind.BindTarget+":ro")
+	}
+	return append(args, "-w", wdir, d.Image, "sleep", "infinity")
+}
+
+// depsArgs returns the arguments to docker for installing the build
+// dependencies within the container
+func (d *DockerBuilder) depsArgs(name string) []string {
+	wdir := d.pkg.GetWorkDirInternal()
+	args := []string{"exec", name, "ypkg-install-deps", "-f", filepath.Join(wdir, filepath.Base(d.pkg.Path))}
+	if DisableColors {
+		args = append(args, "-n")
+	}
+	return args
+}
+
+// chownArgs returns the arguments to docker for giving the build user its
+// home directory. The read-only sources beneath it are left alone.
+func (d *DockerBuilder) chownArgs(name string) []string {
+	owner := BuildUser + ":" + BuildUser
+	cmd := fmt.Sprintf("chown %s %s %s && chown -R %s %s", owner, BuildUserHome, filepath.Join(BuildUserHome, "YPKG"), owner, d.pkg.GetWorkDirInternal())
+	return []string{"exec", name, "/bin/sh", "-c", cmd}
+}
+
+// buildArgs returns the arguments to docker for building the package as the
+// build user under fakeroot
+func (d *DockerBuilder) buildArgs(history *PackageHistory, name string) []string {
+	wdir := d.pkg.GetWorkDirInternal()
+	args := []string{"exec", name, "/bin/su", BuildUser, "--", "fakeroot", "ypkg-build", "-D", wdir, filepath.Join(wdir, filepath.Base(d.pkg.Path))}
+	return append(args, d.pkg.ypkgBuildFlags(history)...)
+}
+
+// run will run the docker client with args, sending the output through the
+// build log
+func (d *DockerBuilder) run(notif PidNotifier, args []string) error {
+	stdout, stderr, flush := hookOutput("docker")
+	defer flush()
+	c := exec.Command(DockerCommand, args...)
+	c.Stdout = stdout
+	c.Stderr = stderr
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	if notif != nil {
+		notif.SetActivePID(c.Process.Pid)
+		defer notif.SetActivePID(0)
+	}
+	return c.Wait()
+}
@@ -0,0 +1,97 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDockerRunArgs(t *testing.T) {
+	pkg, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 1
+source:
+    - https://www.nano-editor.org/dist/v5/nano-5.8.tar.xz : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768c
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	pkg.Path = "/home/packager/nano/package.yml"
+	d := NewDockerBuilder(pkg, &Profile{Name: "unstable-x86_64"})
+	if d.Image != DockerImage+":unstable-x86_64" {
+		t.Fatalf("Unexpected image: %s", d.Image)
+	}
+	args := strings.Join(d.createArgs("/tmp/work", "solbuild-nano"), " ")
+	wdir := pkg.GetWorkDirInternal()
+	for _, want := range []string{
+		"run -d --name solbuild-nano -v /tmp/work:" + wdir,
+		"-w " + wdir + " " + d.Image + " sleep infinity",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("Expected '%s' in docker arguments: %s", want, args)
+		}
+	}
+	if strings.Count(args, ":ro") != len(pkg.Sources) {
+		t.Fatalf("Expected %d read-only source mounts: %s", len(pkg.Sources), args)
+	}
+	if args := strings.Join(d.depsArgs("solbuild-nano"), " "); args != "exec solbuild-nano ypkg-install-deps -f "+wdir+"/package.yml" {
+		t.Fatalf("Wrong build dependency arguments: %s", args)
+	}
+	if args := strings.Join(d.chownArgs("solbuild-nano"), " "); !strings.HasSuffix(args, "chown -R build:build "+wdir) {
+		t.Fatalf("Wrong ownership arguments: %s", args)
+	}
+	if args := strings.Join(d.buildArgs(nil, "solbuild-nano"), " "); args != "exec solbuild-nano /bin/su build -- fakeroot ypkg-build -D "+wdir+" "+wdir+"/package.yml" {
+		t.Fatalf("Wrong build arguments: %s", args)
+	}
+}
+
+func TestDockerSetPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-docker")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { UseDocker = false }()
+
+	profile := &Profile{Name: "unstable-x86_64", Image: "unstable-x86_64"}
+	image := &BackingImage{Name: "unstable-x86_64", ImagePath: filepath.Join(dir, "unstable-x86_64"+ImageSuffix)}
+	// Only root may write to the overlay root directory
+	config := &Config{OverlayRootDir: filepath.Join(dir, "missing", "overlays")}
+	pkg := &Package{Name: "nano", Type: PackageTypeYpkg, Path: filepath.Join(dir, "package.yml")}
+
+	m := &Manager{Config: config, image: image, profile: profile, lock: new(sync.Mutex)}
+	if err := m.SetPackage(pkg); err != ErrProfileNotInstalled {
+		t.Fatalf("Expected ErrProfileNotInstalled without Docker, got %v", err)
+	}
+
+	UseDocker = true
+	m = &Manager{Config: config, image: image, profile: profile, lock: new(sync.Mutex)}
+	if err := m.SetPackage(pkg); err != nil {
+		t.Fatalf("Failed to set package for a Docker build: %v", err)
+	}
+	if m.overlay != nil || m.pkgManager != nil {
+		t.Fatalf("Expected no overlay or package manager for a Docker build, got %v %v", m.overlay, m.pkgManager)
+	}
+	if _, ok := m.builder.(*DockerBuilder); !ok {
+		t.Fatalf("Expected a DockerBuilder, got %T", m.builder)
+	}
+}
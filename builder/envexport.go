@@ -0,0 +1,143 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ExportPreserveOwner will keep the uid and gid of every file exported by
+// ExportToTar, rather than making root the owner of everything
+var ExportPreserveOwner bool
+
+// exportExcludes are the pseudo filesystems within the root whose contents
+// are never exported. The directories themselves are kept, so that they
+// exist as mount points once the archive is unpacked.
+var exportExcludes = []string{"dev", "proc", "sys"}
+
+// exportInode identifies a file linked more than once. Files of the overlay
+// report the device of the layer they are stored in, so both are needed.
+type exportInode struct {
+	dev uint64
+	ino uint64
+}
+
+// ExportToTar will write a gzip compressed tarball of the merged view of the
+// overlay to destPath, so that the exact build environment may be shared.
+// Files are streamed into the archive one at a time, and any file linked
+// more than once is stored as a hard link.
+func (o *Overlay) ExportToTar(destPath string) error {
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s, reason: %s\n", destPath, err)
+	}
+	if err = o.writeTar(out); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("Failed to export %s, reason: %s\n", o.MountPoint, err)
+	}
+	return nil
+}
+
+// writeTar will write the compressed tarball of the root to w
+func (o *Overlay) writeTar(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	links := make(map[exportInode]string)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(o.MountPoint, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.Mode()&os.ModeSocket != 0 {
+			log.Debugf("Not exporting socket /%s\n", rel)
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		// Names are those of the host, not the root
+		hdr.Uname, hdr.Gname = "", ""
+		if !ExportPreserveOwner {
+			hdr.Uid, hdr.Gid = 0, 0
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && st.Nlink > 1 {
+			id := exportInode{uint64(st.Dev), uint64(st.Ino)}
+			if target, ok := links[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+			} else {
+				links[id] = hdr.Name
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			for _, exclude := range exportExcludes {
+				if rel == exclude {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}
+	if err := filepath.Walk(o.MountPoint, walk); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
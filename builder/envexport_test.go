@@ -0,0 +1,112 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportToTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-export")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "union")
+	for _, d := range []string{"usr/bin", "proc/1", "dev", "sys/kernel"} {
+		if err = os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatalf("Failed to create root directory: %s", err)
+		}
+	}
+	files := map[string]string{
+		"usr/bin/nano":   "nano",
+		"proc/1/cmdline": "init",
+		"dev/null":       "",
+	}
+	for path, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", path, err)
+		}
+	}
+	if err = os.Link(filepath.Join(root, "usr/bin/nano"), filepath.Join(root, "usr/bin/pico")); err != nil {
+		t.Fatalf("Failed to link file: %s", err)
+	}
+	if err = os.Symlink("nano", filepath.Join(root, "usr/bin/editor")); err != nil {
+		t.Fatalf("Failed to link file: %s", err)
+	}
+
+	o := &Overlay{MountPoint: root}
+	archive := filepath.Join(dir, "env.tar.gz")
+	if err = o.ExportToTar(archive); err != nil {
+		t.Fatalf("Failed to export root: %s", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to decompress archive: %s", err)
+	}
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to read archive: %s", err)
+		}
+		headers[hdr.Name] = hdr
+		data, _ := ioutil.ReadAll(tr)
+		contents[hdr.Name] = string(data)
+	}
+
+	for _, name := range []string{"usr/", "usr/bin/", "proc/", "dev/", "sys/"} {
+		if headers[name] == nil || headers[name].Typeflag != tar.TypeDir {
+			t.Errorf("Expected directory %s in the archive", name)
+		}
+	}
+	for _, name := range []string{"proc/1/", "proc/1/cmdline", "dev/null", "sys/kernel/"} {
+		if headers[name] != nil {
+			t.Errorf("Expected %s to be excluded from the archive", name)
+		}
+	}
+	if contents["usr/bin/nano"] != "nano" {
+		t.Errorf("Expected the contents of usr/bin/nano, got '%s'", contents["usr/bin/nano"])
+	}
+	if hdr := headers["usr/bin/pico"]; hdr == nil || hdr.Typeflag != tar.TypeLink || hdr.Linkname != "usr/bin/nano" {
+		t.Errorf("Expected usr/bin/pico to be a hard link to usr/bin/nano, got %+v", hdr)
+	}
+	if hdr := headers["usr/bin/editor"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "nano" {
+		t.Errorf("Expected usr/bin/editor to be a symlink to nano, got %+v", hdr)
+	}
+	for name, hdr := range headers {
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("Expected %s to be owned by root, got %d:%d", name, hdr.Uid, hdr.Gid)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// DefaultPassthrough are the host variables always passed into the chroot,
+	// when set. Lower case proxy variables fall back to their upper case form.
+	DefaultPassthrough = []string{
+		"http_proxy",
+		"https_proxy",
+		"no_proxy",
+		"ftp_proxy",
+	}
+
+	// EnvironmentPassthrough are the additional variables to pass into the
+	// chroot, from the configuration and command line. Each entry is either
+	// KEY, to take the value from the host, or KEY=VALUE.
+	EnvironmentPassthrough []string
+
+	// DeniedEnvironment may never be passed through from the host, as they
+	// would either break the build root or leak access to the host.
+	DeniedEnvironment = map[string]bool{
+		"HOME":           true,
+		"USER":           true,
+		"USERNAME":       true,
+		"LOGNAME":        true,
+		"PATH":           true,
+		"SSH_AUTH_SOCK":  true,
+		"SSH_AGENT_PID":  true,
+		"SSH_CONNECTION": true,
+		"SSH_CLIENT":     true,
+		"SSH_TTY":        true,
+		"GPG_AGENT_INFO": true,
+		"SUDO_USER":      true,
+		"SUDO_UID":       true,
+		"SUDO_GID":       true,
+		"SUDO_COMMAND":   true,
+		"LD_PRELOAD":     true,
+	}
+
+	// ErrInvalidBuildEnv is returned for a malformed variable within the
+	// environment of a package.yml
+	ErrInvalidBuildEnv = errors.New("Invalid build environment")
+
+	// buildEnvKey matches the names permitted in the environment of a package
+	buildEnvKey = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+	// sensitiveKeys are substrings of variable names whose values must never
+	// be written to the logs
+	sensitiveKeys = []string{
+		"TOKEN",
+		"SECRET",
+		"PASSWORD",
+		"PASSWD",
+		"CREDENTIAL",
+		"AUTH",
+		"KEY",
+	}
+)
+
+// passthroughEnvironment will resolve the passthrough variables against the
+// host environment, skipping anything that is denied or unset.
+func passthroughEnvironment() []string {
+	var environment []string
+	entries := append(append([]string{}, DefaultPassthrough...), EnvironmentPassthrough...)
+	for _, entry := range entries {
+		key, value, explicit := splitEnv(entry)
+		if DeniedEnvironment[strings.ToUpper(key)] {
+			log.Warnf("Refusing to pass %s into the chroot\n", key)
+			continue
+		}
+		if !explicit {
+			value = os.Getenv(key)
+			if value == "" {
+				key = strings.ToUpper(key)
+				value = os.Getenv(key)
+			}
+			if value == "" {
+				continue
+			}
+		}
+		environment = setEnv(environment, key, value)
+	}
+	return environment
+}
+
+// parseBuildEnv will convert the environment map of a package.yml into
+// variables, ensuring each name is valid, is not denied, and no value spans
+// multiple lines.
+// ypkg itself accepts a script as the environment, which is left to it.
+func parseBuildEnv(value interface{}) (map[string]string, error) {
+	vars, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil
+	}
+	env := make(map[string]string, len(vars))
+	for k, v := range vars {
+		key := fmt.Sprint(k)
+		if !buildEnvKey.MatchString(key) {
+			return nil, fmt.Errorf("%s: variable name %q must match %s", ErrInvalidBuildEnv, key, buildEnvKey)
+		}
+		if DeniedEnvironment[key] {
+			return nil, fmt.Errorf("%s: %s may not be set", ErrInvalidBuildEnv, key)
+		}
+		val := ""
+		if v != nil {
+			val = fmt.Sprint(v)
+		}
+		if strings.ContainsAny(val, "\r\n") {
+			return nil, fmt.Errorf("%s: value of %s must not contain newlines", ErrInvalidBuildEnv, key)
+		}
+		env[key] = val
+	}
+	return env, nil
+}
+
+// buildEnvironment will set the variables of the package within the
+// environment, in a stable order. Only the names are logged.
+func buildEnvironment(env []string, vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		log.Debugf("Setting build environment variable %s\n", key)
+		env = setEnv(env, key, vars[key])
+	}
+	return env
+}
+
+// splitEnv will split the KEY[=VALUE] entry, reporting whether a value was given
+func splitEnv(entry string) (string, string, bool) {
+	i := strings.IndexByte(entry, '=')
+	if i < 0 {
+		return entry, "", false
+	}
+	return entry[:i], entry[i+1:], true
+}
+
+// setEnv will set the variable in the environment, replacing any existing value
+func setEnv(environment []string, key, value string) []string {
+	variable := fmt.Sprintf("%s=%s", key, value)
+	for i, e := range environment {
+		if k, _, _ := splitEnv(e); k == key {
+			environment[i] = variable
+			return environment
+		}
+	}
+	return append(environment, variable)
+}
+
+// redactEnv will hide the value of sensitive variables, along with any
+// credentials embedded within URLs such as proxy settings.
+func redactEnv(variable string) string {
+	key, value, _ := splitEnv(variable)
+	upper := strings.ToUpper(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(upper, s) {
+			return key + "=REDACTED"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = url.User("REDACTED")
+		return key + "=" + u.String()
+	}
+	return variable
+}
+
+// DumpEnvironment will record the effective chroot environment, with any
+// sensitive values redacted, at debug level and in the build log.
+func DumpEnvironment(environment []string) {
+	for _, e := range environment {
+		line := redactEnv(e)
+		log.Debugf("Chroot environment: %s\n", line)
+		if ChrootOutput != nil {
+			ChrootOutput.Annotate("env", line)
+		}
+	}
+}
@@ -17,16 +17,143 @@
 package builder
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	log "github.com/DataDrake/waterlog"
-	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/libosdev/disk"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
+var (
+	// ErrEopkgTimeout is returned when another eopkg holds the database
+	// lock for too long
+	ErrEopkgTimeout = errors.New("Timed out waiting for the eopkg lock")
+
+	// EopkgLockTimeout is how long to wait for another eopkg to release the
+	// database lock of the root
+	EopkgLockTimeout = 5 * time.Minute
+
+	// eopkgLockPoll is how often the eopkg lock is checked while waiting
+	eopkgLockPoll = time.Second
+
+	// eopkgLockWarnInterval is how often a warning is logged while waiting
+	eopkgLockWarnInterval = 10 * time.Second
+
+	// ErrNoHistory is returned when there is no upgrade in the eopkg history
+	// to roll back
+	ErrNoHistory = errors.New("No upgrade found in the eopkg history")
+
+	// eopkgOperation matches each operation header in eopkg history
+	eopkgOperation = regexp.MustCompile(`(?m)^Operation #(\d+): (\w+)`)
+
+	// ErrDependencyConflict is matched by any DependencyConflictError
+	ErrDependencyConflict = errors.New("Dependency conflict")
+
+	// ErrRepoExists is matched by any RepoExistsError
+	ErrRepoExists = errors.New("Repository already exists")
+
+	// ErrNoSuchRepo is returned when changing a repo that is not configured
+	ErrNoSuchRepo = errors.New("No such repository")
+
+	// eopkgRepoHeader matches the name and status of each repo in eopkg list-repo
+	eopkgRepoHeader = regexp.MustCompile(`^(\S+) \[(active|inactive)\]$`)
+
+	// ErrPackageNotFound is matched by any PackageNotFoundError
+	ErrPackageNotFound = errors.New("Package not found")
+
+	// eopkgNetworkFailure matches the errors eopkg reports when the network
+	// or a mirror fails
+	eopkgNetworkFailure = regexp.MustCompile(`(?i)(could not (fetch|download|connect)|cannot connect|connection (timed out|refused|reset)|temporary failure in name resolution|name or service not known|network is unreachable|http error 5\d\d|urlopen error|fetch error|read timed out)`)
+
+	// eopkgSearchResult matches each package listed by eopkg search
+	eopkgSearchResult = regexp.MustCompile(`^(\S+)\s+- (.*)$`)
+
+	// eopkgInfoName matches the name and version of each package described
+	// by eopkg info
+	eopkgInfoName = regexp.MustCompile(`(?m)^Name\s*:\s*([^,\s]+), version: ([^,\s]+), release: (\d+)`)
+
+	// EopkgErrorLines is how many of the final lines of output are logged
+	// when an eopkg operation fails
+	EopkgErrorLines = 50
+
+	// eopkgNotFound matches the packages eopkg could not find in any repository
+	eopkgNotFound = regexp.MustCompile(`Package (\S+) not found in any active repository`)
+
+	// eopkgConflicts match the conflicts reported by eopkg install
+	eopkgConflicts = []*regexp.Regexp{
+		regexp.MustCompile(`\[(\S+ conflicts with: [^\]]*)\]`),
+		regexp.MustCompile(`Selected packages \[[^\]]*\] are in conflict with each other`),
+	}
+)
+
+// A DependencyConflictError is returned when installing packages would
+// cause a conflict, and lists every conflict found.
+type DependencyConflictError struct {
+	Conflicts []string
+}
+
+// Error will list all of the conflicts
+func (e *DependencyConflictError) Error() string {
+	return fmt.Sprintf("Dependency conflict:\n    %s", strings.Join(e.Conflicts, "\n    "))
+}
+
+// Is will match ErrDependencyConflict
+func (e *DependencyConflictError) Is(target error) bool {
+	return target == ErrDependencyConflict
+}
+
+// A PackageNotFoundError is returned when installing packages that are not
+// available in any active repository, and lists every missing package.
+type PackageNotFoundError struct {
+	Packages []string
+}
+
+// Error will list all of the missing packages
+func (e *PackageNotFoundError) Error() string {
+	return fmt.Sprintf("Packages not found in any active repository: %s", strings.Join(e.Packages, ", "))
+}
+
+// Is will match ErrPackageNotFound
+func (e *PackageNotFoundError) Is(target error) bool {
+	return target == ErrPackageNotFound
+}
+
+// A commandExecutor runs commands within the root of an EopkgManager
+type commandExecutor interface {
+	// Exec will run the command, passing its output to the console, and
+	// return a copy of the output
+	Exec(command string) (string, error)
+
+	// Output will run the command, returning its combined output
+	Output(command string) (string, error)
+}
+
+// chrootExecutor runs commands within a chroot, notifying of the active PID
+type chrootExecutor struct {
+	notif PidNotifier
+	root  string
+}
+
+// Exec will run the command within the chroot
+func (c *chrootExecutor) Exec(command string) (string, error) {
+	var out bytes.Buffer
+	err := ChrootExecCapture(c.notif, c.root, command, &out)
+	c.notif.SetActivePID(0)
+	return out.String(), err
+}
+
+// Output will run the command within the chroot, capturing its output
+func (c *chrootExecutor) Output(command string) (string, error) {
+	return ChrootExecOutput(c.notif, c.root, command)
+}
+
 // eopkgCommand utility wraps all eopkg calls to autodisable colours
 // where appropriate, as eopkg largely ignores the console type.
 func eopkgCommand(c string) string {
@@ -39,31 +166,57 @@ func eopkgCommand(c string) string {
 // An EopkgRepo is a simplistic representation of a repo found in any given
 // chroot.
 type EopkgRepo struct {
+	ID     string
+	URI    string
+	Active bool
+}
+
+// A RepoExistsError is returned when adding a repo whose name is taken
+type RepoExistsError struct {
 	ID  string
-	URI string
+	URI string // URI of the existing repo
+}
+
+// Error will describe the existing repo
+func (e *RepoExistsError) Error() string {
+	return fmt.Sprintf("Repository %s already exists: %s", e.ID, e.URI)
+}
+
+// Is will match ErrRepoExists
+func (e *RepoExistsError) Is(target error) bool {
+	return target == ErrRepoExists
 }
 
 // EopkgManager is our own very shorted version of libosdev EopkgManager, to
 // enable very very simple operations
 type EopkgManager struct {
-	dbusActive  bool
 	root        string
 	cacheSource string
 	cacheTarget string
-	dbusPid     string
+
+	// The private system bus, while running
+	bus *privateBus
+
+	// Extra packages and components requested for debugging, which are
+	// not declared by the package itself
+	extraPackages   []string
+	extraComponents []string
+
+	// Packages held at a fixed version, by name
+	pins map[string]string
 
 	notif PidNotifier
+	exec  commandExecutor
 }
 
 // NewEopkgManager will return a new eopkg manager
 func NewEopkgManager(notif PidNotifier, root string) *EopkgManager {
 	return &EopkgManager{
-		dbusActive:  false,
 		root:        root,
 		cacheSource: PackageCacheDirectory,
 		cacheTarget: filepath.Join(root, "var/cache/eopkg/packages"),
-		dbusPid:     filepath.Join(root, "var/run/dbus/pid"),
 		notif:       notif,
+		exec:        &chrootExecutor{notif: notif, root: root},
 	}
 }
 
@@ -72,7 +225,7 @@ func NewEopkgManager(notif PidNotifier, root string) *EopkgManager {
 // or installing deps, prior to building, could clobber the files.
 func (e *EopkgManager) CopyAssets() error {
 	requiredAssets := map[string]string{
-		"/etc/resolv.conf":      filepath.Join(e.root, "etc/resolv.conf"),
+		HostResolvConf:          filepath.Join(e.root, "etc/resolv.conf"),
 		"/etc/eopkg/eopkg.conf": filepath.Join(e.root, "etc/eopkg/eopkg.conf"),
 	}
 
@@ -80,6 +233,16 @@ func (e *EopkgManager) CopyAssets() error {
 		if !PathExists(key) {
 			continue
 		}
+		// Copy the real file, and never write through a symlink in the root
+		// as it would be resolved against the host
+		if path, err := filepath.EvalSymlinks(key); err == nil {
+			key = path
+		}
+		if st, err := os.Lstat(value); err == nil && st.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(value); err != nil {
+				return fmt.Errorf("Failed to remove asset symlink %s, reason: %s\n", value, err)
+			}
+		}
 		dirName := filepath.Dir(value)
 		if !PathExists(dirName) {
 			log.Debugf("Creating required directory: %s\n", dirName)
@@ -97,11 +260,13 @@ func (e *EopkgManager) CopyAssets() error {
 
 // Init will do some basic preparation of the chroot
 func (e *EopkgManager) Init() error {
-	// Ensure dbus pid is gone
-	if PathExists(e.dbusPid) {
-		if err := os.Remove(e.dbusPid); err != nil {
-			return err
-		}
+	if err := e.WaitForLock(EopkgLockTimeout); err != nil {
+		return err
+	}
+
+	// Ensure nothing is left of a bus from a crashed run
+	if err := CleanStaleDBus(e.root); err != nil {
+		return err
 	}
 
 	if err := e.CopyAssets(); err != nil {
@@ -122,9 +287,61 @@ func (e *EopkgManager) Init() error {
 	return disk.GetMountManager().BindMount(e.cacheSource, e.cacheTarget)
 }
 
-// StartDBUS will bring up dbus within the chroot
+// WaitForLock will wait for any other eopkg to release the database lock
+// within the root, such as while the image is updated, returning
+// ErrEopkgTimeout if it is still held after the timeout.
+//
+// eopkg leaves the lock file in place, so the lock itself is tested.
+func (e *EopkgManager) WaitForLock(timeout time.Duration) error {
+	path := filepath.Join(e.root, "var", "lib", "eopkg", "lock")
+	start := time.Now()
+	warned := start
+	for {
+		held, err := lockHeld(path)
+		if err != nil {
+			return fmt.Errorf("Failed to check eopkg lock %s, reason: %s\n", path, err)
+		}
+		if !held {
+			return nil
+		}
+		if time.Since(start) >= timeout {
+			return ErrEopkgTimeout
+		}
+		if time.Since(warned) >= eopkgLockWarnInterval {
+			log.Warnf("Waiting for another eopkg to release its lock, %s elapsed\n", time.Since(start).Round(time.Second))
+			warned = time.Now()
+		}
+		time.Sleep(eopkgLockPoll)
+	}
+}
+
+// lockHeld will determine if another process holds a lock on the file
+func lockHeld(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// StartDBUS will bring up a private system bus within the chroot, which is
+// used by every following eopkg command
 func (e *EopkgManager) StartDBUS() error {
-	if e.dbusActive {
+	if e.bus != nil {
+		return nil
+	}
+	if NoDBus {
+		log.Debugln("Not starting D-BUS as requested")
 		return nil
 	}
 	dbusDir := filepath.Join(e.root, "run", "dbus")
@@ -132,42 +349,32 @@ func (e *EopkgManager) StartDBUS() error {
 		return err
 	}
 	if err := ChrootExec(e.notif, e.root, "dbus-uuidgen --ensure"); err != nil {
+		log.Warnln(dbusStartHint)
 		return err
 	}
 	e.notif.SetActivePID(0)
-	if err := ChrootExec(e.notif, e.root, "dbus-daemon --system"); err != nil {
+	bus, err := startPrivateBus(e.root)
+	if err != nil {
+		log.Warnln(dbusStartHint)
 		return err
 	}
-	e.notif.SetActivePID(0)
-	e.dbusActive = true
+	e.bus = bus
+	e.exec = &busExecutor{commandExecutor: e.exec, address: bus.address}
 	return nil
 }
 
-// StopDBUS will tear down dbus
+// StopDBUS will tear down the private bus
 func (e *EopkgManager) StopDBUS() error {
 	// No sense killing dbus twice
-	if !e.dbusActive {
+	if e.bus == nil {
 		return nil
 	}
-	var b []byte
-	var err error
-	var f *os.File
-
-	if f, err = os.Open(e.dbusPid); err != nil {
-		return err
+	if b, ok := e.exec.(*busExecutor); ok {
+		e.exec = b.commandExecutor
 	}
-	defer func() {
-		f.Close()
-		os.Remove(e.dbusPid)
-		e.dbusActive = false
-	}()
-
-	if b, err = ioutil.ReadAll(f); err != nil {
-		return err
-	}
-
-	pid := strings.Split(string(b), "\n")[0]
-	return commands.ExecStdoutArgs("kill", []string{"-9", pid})
+	err := e.bus.Stop()
+	e.bus = nil
+	return err
 }
 
 // Cleanup will take care of any work we've already done before
@@ -178,26 +385,233 @@ func (e *EopkgManager) Cleanup() {
 
 // Upgrade will perform an eopkg upgrade inside the chroot
 func (e *EopkgManager) Upgrade() error {
-	// Certain requirements may not be in system.base, but are required for
-	// proper containerized functionality.
+	if err := e.execWithRetry(eopkgCommand("eopkg upgrade -y")); err != nil {
+		return err
+	}
+	return e.installRequirements()
+}
+
+// RefreshRepos will refresh the repository indexes without upgrading, so
+// that build dependencies resolve against the current repos
+func (e *EopkgManager) RefreshRepos() error {
+	if err := e.execWithRetry(eopkgCommand("eopkg update-repo")); err != nil {
+		return err
+	}
+	return e.installRequirements()
+}
+
+// installRequirements will assert the packages that may not be in
+// system.base, but are required for proper containerized functionality.
+func (e *EopkgManager) installRequirements() error {
 	newReqs := []string{
 		"abi-wizard",
 		"iproute2",
 		"sccache",
 	}
-	if err := ChrootExec(e.notif, e.root, eopkgCommand("eopkg upgrade -y")); err != nil {
+	return e.execWithRetry(eopkgCommand(fmt.Sprintf("eopkg install -y %s", strings.Join(newReqs, " "))))
+}
+
+// SetExtras will set the extra packages and components to be installed
+// into the root, in addition to those declared by the package.
+func (e *EopkgManager) SetExtras(pkgs, components []string) {
+	e.extraPackages = pkgs
+	e.extraComponents = components
+}
+
+// HasExtras will return true if any extra packages or components are set
+func (e *EopkgManager) HasExtras() bool {
+	return len(e.extraPackages) > 0 || len(e.extraComponents) > 0
+}
+
+// InstallExtras will install any extra packages and components inside the
+// chroot. These are never recorded as build dependencies.
+func (e *EopkgManager) InstallExtras() error {
+	for _, comp := range e.extraComponents {
+		log.Warnf("Installing extra component %s\n", comp)
+		if err := e.InstallComponent(comp); err != nil {
+			return fmt.Errorf("Failed to install extra component %s, reason: %s\n", comp, err)
+		}
+	}
+	if len(e.extraPackages) < 1 {
+		return nil
+	}
+	if err := CheckConflicts(e.DryRunInstall(e.extraPackages)); err != nil {
 		return err
 	}
-	e.notif.SetActivePID(0)
-	err := ChrootExec(e.notif, e.root, eopkgCommand(fmt.Sprintf("eopkg install -y %s", strings.Join(newReqs, " "))))
+	log.Warnf("Installing extra packages: %s\n", strings.Join(e.extraPackages, " "))
+	if err := e.InstallPackages(e.extraPackages); err != nil {
+		return fmt.Errorf("Failed to install extra packages, reason: %s\n", err)
+	}
+	return nil
+}
+
+// InstallPackages will install the named packages inside the chroot, in a
+// single transaction. Duplicate names are ignored, and a PackageNotFoundError
+// is returned when any of the packages are unavailable.
+func (e *EopkgManager) InstallPackages(pkgs []string) error {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if pkg == "" || seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		unique = append(unique, pkg)
+	}
+	if len(unique) < 1 {
+		return nil
+	}
+	args := strings.Join(unique, " ")
+	err := e.execWithRetry(eopkgCommand(fmt.Sprintf("eopkg install -y %s", args)))
+	if err == nil {
+		return nil
+	}
+	// Find out which packages could not be found, if any
+	out, _ := e.exec.Output(eopkgCommand(fmt.Sprintf("eopkg install --dry-run -y %s", args)))
+	if missing := parseNotFound(out); len(missing) > 0 {
+		return &PackageNotFoundError{Packages: missing}
+	}
+	return err
+}
+
+// parseNotFound will find all missing packages reported in the eopkg output
+func parseNotFound(out string) []string {
+	var missing []string
+	for _, match := range eopkgNotFound.FindAllStringSubmatch(out, -1) {
+		missing = append(missing, strings.TrimSuffix(match[1], "."))
+	}
+	return missing
+}
+
+// DryRunInstall will simulate the installation of the packages inside the
+// chroot, returning a description of each conflict that would occur.
+func (e *EopkgManager) DryRunInstall(packages []string) ([]string, error) {
+	return e.dryRun(strings.Join(packages, " "))
+}
+
+// DryRunComponent will simulate the installation of the component inside the
+// chroot, returning a description of each conflict that would occur.
+func (e *EopkgManager) DryRunComponent(comp string) ([]string, error) {
+	return e.dryRun("-c " + comp)
+}
+
+// CheckConflicts will return a DependencyConflictError if any conflicts
+// were found by a dry run.
+func CheckConflicts(conflicts []string, err error) error {
+	if len(conflicts) > 0 {
+		return &DependencyConflictError{Conflicts: conflicts}
+	}
+	return err
+}
+
+// dryRun will simulate an eopkg install with the given arguments, returning
+// any conflicts found. An error is only returned when eopkg failed without
+// reporting a conflict.
+func (e *EopkgManager) dryRun(args string) ([]string, error) {
+	out, err := e.exec.Output(eopkgCommand(fmt.Sprintf("eopkg install --dry-run -y %s", args)))
+	conflicts := parseConflicts(out)
+	if err != nil && len(conflicts) < 1 {
+		return nil, fmt.Errorf("Failed to simulate installation, reason: %s\n%s", err, out)
+	}
+	return conflicts, nil
+}
+
+// parseConflicts will find all conflicts reported in the eopkg output
+func parseConflicts(out string) []string {
+	var conflicts []string
+	for _, re := range eopkgConflicts {
+		for _, match := range re.FindAllStringSubmatch(out, -1) {
+			conflicts = append(conflicts, match[len(match)-1])
+		}
+	}
+	return conflicts
+}
+
+// Rollback will revert the most recent upgrade inside the chroot, by taking
+// the system back to the operation preceding it in the eopkg history.
+func (e *EopkgManager) Rollback() error {
+	out, err := e.exec.Output(eopkgCommand("eopkg history"))
+	if err != nil {
+		log.Debugf("Failed to read eopkg history, reason: %s\n", err)
+		return ErrNoHistory
+	}
+	op, err := lastUpgrade(out)
+	if err != nil {
+		return err
+	}
+	log.Infof("Reverting upgrade #%d\n", op)
+	_, err = e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg history -y --take %d", op-1)))
 	return err
 }
 
+// lastUpgrade will find the ID of the most recent upgrade operation in the
+// output of eopkg history. The operation preceding it must also exist.
+func lastUpgrade(history string) (int, error) {
+	last := 0
+	for _, match := range eopkgOperation.FindAllStringSubmatch(history, -1) {
+		if match[2] != "upgrade" {
+			continue
+		}
+		if id, err := strconv.Atoi(match[1]); err == nil && id > last {
+			last = id
+		}
+	}
+	if last < 2 {
+		return 0, ErrNoHistory
+	}
+	return last, nil
+}
+
 // InstallComponent will install the named component inside the chroot
 func (e *EopkgManager) InstallComponent(comp string) error {
-	err := ChrootExec(e.notif, e.root, eopkgCommand(fmt.Sprintf("eopkg install -c %v -y", comp)))
-	e.notif.SetActivePID(0)
-	return err
+	return e.execWithRetry(eopkgCommand(fmt.Sprintf("eopkg install -c %v -y", comp)))
+}
+
+// InstallBuildDeps will install the build dependencies of the recipe, given
+// by its path inside the chroot
+func (e *EopkgManager) InstallBuildDeps(recipe string) error {
+	cmd := fmt.Sprintf("ypkg-install-deps -f %s", recipe)
+	if DisableColors {
+		cmd += " -n"
+	}
+	return e.execWithRetry(cmd)
+}
+
+// isTransientFailure will determine whether the output of a failed command
+// shows it failed due to the network, and so may succeed if retried.
+// Conflicts and missing packages are never transient.
+func isTransientFailure(out string) bool {
+	if len(parseConflicts(out)) > 0 || eopkgNotFound.MatchString(out) {
+		return false
+	}
+	return eopkgNetworkFailure.MatchString(out)
+}
+
+// execWithRetry will run the command, retrying failures caused by the network
+// up to PackageRetries times with an exponential backoff. The repository
+// indexes are refreshed before each retry.
+func (e *EopkgManager) execWithRetry(command string) error {
+	backoff := PackageBackoff
+	for attempt := 1; ; attempt++ {
+		out, err := e.exec.Exec(command)
+		if err != nil {
+			suggestNoDBus(out)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= PackageRetries || !isTransientFailure(out) {
+			logEopkgFailure(command, out)
+			return err
+		}
+		log.Warnf("Network failure (attempt %d of %d), retrying in %s: %s\n", attempt, PackageRetries, backoff, command)
+		time.Sleep(backoff)
+		backoff *= 2
+		log.Infoln("Refreshing repository indexes")
+		if _, err := e.exec.Exec(eopkgCommand("eopkg update-repo")); err != nil {
+			log.Warnf("Failed to refresh repository indexes, reason: %s\n", err)
+		}
+	}
 }
 
 // EnsureEopkgLayout will enforce changes to the filesystem to make sure that
@@ -247,58 +661,178 @@ func EnsureEopkgLayout(root string) error {
 	return nil
 }
 
-// Read the given plaintext URI file to find the target
-func readURIFile(path string) (string, error) {
-	fi, err := os.Open(path)
+// ListRepos will return the repositories configured in the root, in order of
+// priority
+func (e *EopkgManager) ListRepos() ([]*EopkgRepo, error) {
+	// Colours are always disabled, as they'd interfere with parsing
+	out, err := e.exec.Output("eopkg list-repo -N")
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("Failed to list repositories, reason: %s\n%s", err, out)
 	}
-	defer fi.Close()
-	contents, err := ioutil.ReadAll(fi)
+	return parseRepoList(out), nil
+}
+
+// parseRepoList will parse the output of eopkg list-repo, in which each
+// repository name and status is followed by an indented URI:
+//
+//	Solus [active]
+//	   https://packages.getsol.us/shannon/eopkg-index.xml.xz
+func parseRepoList(out string) []*EopkgRepo {
+	var repos []*EopkgRepo
+	var last *EopkgRepo
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if match := eopkgRepoHeader.FindStringSubmatch(trimmed); match != nil && line == strings.TrimLeft(line, " \t") {
+			last = &EopkgRepo{ID: match[1], Active: match[2] == "active"}
+			repos = append(repos, last)
+			continue
+		}
+		if last != nil && last.URI == "" {
+			last.URI = trimmed
+		}
+	}
+	return repos
+}
+
+// findRepo will return the named repository and its position, if present
+func (e *EopkgManager) findRepo(id string) (*EopkgRepo, int, error) {
+	repos, err := e.ListRepos()
+	if err != nil {
+		return nil, -1, err
+	}
+	for i, repo := range repos {
+		if repo.ID == id {
+			return repo, i, nil
+		}
+	}
+	return nil, -1, nil
+}
+
+// AddRepo will attempt to add a repo to the filesystem. A RepoExistsError
+// is returned if a repo with the same name is already present.
+func (e *EopkgManager) AddRepo(id, source string) error {
+	existing, _, err := e.findRepo(id)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(contents), nil
+	if existing != nil {
+		return &RepoExistsError{ID: id, URI: existing.URI}
+	}
+	_, err = e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg add-repo '%s' '%s'", id, source)))
+	return err
 }
 
-// GetRepos will attempt to discover all the repos on the target filesystem
-func (e *EopkgManager) GetRepos() ([]*EopkgRepo, error) {
-	globPat := filepath.Join(e.root, "var", "lib", "eopkg", "index", "*", "uri")
-	var repoFiles []string
+// RemoveRepo will attempt to remove a named repo from the filesystem
+func (e *EopkgManager) RemoveRepo(id string) error {
+	existing, _, err := e.findRepo(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNoSuchRepo
+	}
+	_, err = e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg remove-repo '%s'", id)))
+	return err
+}
 
-	log.Debugln("Discovering repos in rootfs")
+// SetRepoPriority will move the named repo to the given position, where 0
+// is the highest priority
+func (e *EopkgManager) SetRepoPriority(id string, position int) error {
+	existing, current, err := e.findRepo(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNoSuchRepo
+	}
+	if current == position {
+		return nil
+	}
+	// eopkg can only set the position of a repo as it is added
+	if _, err := e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg remove-repo '%s'", id))); err != nil {
+		return err
+	}
+	_, err = e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg add-repo '%s' '%s' --at %d", id, existing.URI, position)))
+	return err
+}
 
-	repoFiles, _ = filepath.Glob(globPat)
-	// No repos
-	if len(repoFiles) < 1 {
-		return nil, nil
+// logEopkgFailure will log the tail of the output of a failed eopkg command,
+// so that the cause is visible without searching the build log
+func logEopkgFailure(command, out string) {
+	tail := lastLines(out, EopkgErrorLines)
+	if tail == "" {
+		return
 	}
+	log.Errorf("eopkg failed: %s\n%s\n", command, tail)
+}
 
-	var repos []*EopkgRepo
+// lastLines will return at most the final n lines of out
+func lastLines(out string, n int) string {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
 
-	for _, repo := range repoFiles {
-		uri, err := readURIFile(repo)
-		if err != nil {
-			log.Errorf("Unable to read repository file %s, reason: %s\n", repo, err)
-			return nil, err
+// SearchPackage will search the repositories of the root for packages whose
+// name or summary match the query. Only the name, version, release and
+// summary of each package are known.
+func (e *EopkgManager) SearchPackage(query string) ([]PackageInfo, error) {
+	// Colours are always disabled, as they'd interfere with parsing
+	out, err := e.exec.Output(fmt.Sprintf("eopkg search -N %s", shellQuote(query)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to search for packages, reason: %s\n%s", err, out)
+	}
+	results := parseSearch(out)
+	if len(results) == 0 {
+		return results, nil
+	}
+	// eopkg search doesn't list versions
+	var names []string
+	for _, result := range results {
+		names = append(names, shellQuote(result.Name))
+	}
+	out, err = e.exec.Output(fmt.Sprintf("eopkg info -N %s", strings.Join(names, " ")))
+	if err != nil {
+		log.Warnf("Failed to find the versions of the packages, reason: %s\n", err)
+		return results, nil
+	}
+	versions := make(map[string][]string)
+	for _, match := range eopkgInfoName.FindAllStringSubmatch(out, -1) {
+		// The repository version follows that installed
+		versions[match[1]] = match[2:]
+	}
+	for i := range results {
+		if v, ok := versions[results[i].Name]; ok {
+			results[i].Version = v[0]
+			results[i].Release, _ = strconv.Atoi(v[1])
 		}
-		repoName := filepath.Base(filepath.Dir(repo))
-		repos = append(repos, &EopkgRepo{
-			ID:  repoName,
-			URI: uri,
-		})
 	}
-	return repos, nil
+	return results, nil
 }
 
-// AddRepo will attempt to add a repo to the filesystem
-func (e *EopkgManager) AddRepo(id, source string) error {
-	e.notif.SetActivePID(0)
-	return ChrootExec(e.notif, e.root, eopkgCommand(fmt.Sprintf("eopkg add-repo '%s' '%s'", id, source)))
+// parseSearch will parse the output of eopkg search, which lists the name
+// and summary of each package:
+//
+//	nano            - Small, friendly text editor inspired by Pico
+func parseSearch(out string) []PackageInfo {
+	results := []PackageInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		if match := eopkgSearchResult.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			results = append(results, PackageInfo{
+				Name:    match[1],
+				Summary: strings.TrimSpace(match[2]),
+			})
+		}
+	}
+	return results
 }
 
-// RemoveRepo will attempt to remove a named repo from the filesystem
-func (e *EopkgManager) RemoveRepo(id string) error {
-	e.notif.SetActivePID(0)
-	return ChrootExec(e.notif, e.root, eopkgCommand(fmt.Sprintf("eopkg remove-repo '%s'", id)))
+// shellQuote will quote s for use as a single argument within a chroot command
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
 }
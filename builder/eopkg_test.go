@@ -0,0 +1,335 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const historyOutput = `Operation #4: upgrade
+Date: 2021-06-02 10:00
+
+    nano is upgraded from 5.7-150-1-x86_64 to 5.8-151-1-x86_64.
+
+Operation #3: install
+Date: 2021-06-01 12:00
+
+    gdb 10.2-40-1-x86_64 is installed.
+
+Operation #2: upgrade
+Date: 2021-06-01 11:00
+
+Operation #1: snapshot
+Date: 2021-06-01 10:00
+`
+
+func TestLastUpgrade(t *testing.T) {
+	op, err := lastUpgrade(historyOutput)
+	if err != nil {
+		t.Fatalf("Failed to find last upgrade: %v", err)
+	}
+	if op != 4 {
+		t.Fatalf("Wrong upgrade operation: %d vs expected 4", op)
+	}
+	if _, err := lastUpgrade("Operation #1: snapshot\n"); err != ErrNoHistory {
+		t.Fatalf("Expected ErrNoHistory without an upgrade, got: %v", err)
+	}
+	if _, err := lastUpgrade(""); err != ErrNoHistory {
+		t.Fatalf("Expected ErrNoHistory for empty history, got: %v", err)
+	}
+}
+
+func TestParseConflicts(t *testing.T) {
+	out := `Checking for conflicts...
+The following packages have conflicts:
+[libressl conflicts with: openssl]
+[mesalib conflicts with: libglvnd, mesa]
+
+Remove the following conflicting packages? (yes/no)
+`
+	conflicts := parseConflicts(out)
+	if len(conflicts) != 2 {
+		t.Fatalf("Invalid number of conflicts: %d vs expected 2", len(conflicts))
+	}
+	if conflicts[1] != "mesalib conflicts with: libglvnd, mesa" {
+		t.Fatalf("Wrong conflict: %s", conflicts[1])
+	}
+	if err := CheckConflicts(conflicts, nil); !errors.Is(err, ErrDependencyConflict) {
+		t.Fatalf("Expected a dependency conflict, got: %v", err)
+	}
+	if len(parseConflicts("Package nano is already installed\n")) != 0 {
+		t.Fatal("Found conflicts in output without any")
+	}
+}
+
+// mockExecutor records the commands run by an EopkgManager
+type mockExecutor struct {
+	commands []string
+	err      error
+	output   string
+}
+
+func (m *mockExecutor) Exec(command string) (string, error) {
+	m.commands = append(m.commands, command)
+	return m.output, m.err
+}
+
+func (m *mockExecutor) Output(command string) (string, error) {
+	m.commands = append(m.commands, command)
+	return m.output, m.err
+}
+
+func TestInstallPackages(t *testing.T) {
+	exec := &mockExecutor{}
+	e := &EopkgManager{exec: exec}
+	if err := e.InstallPackages(nil); err != nil || len(exec.commands) != 0 {
+		t.Fatalf("Expected no-op for an empty list, got %v: %v", err, exec.commands)
+	}
+	if err := e.InstallPackages([]string{"distcc", "gdb", "distcc"}); err != nil {
+		t.Fatalf("Failed to install packages: %v", err)
+	}
+	if len(exec.commands) != 1 || exec.commands[0] != "eopkg install -y distcc gdb" {
+		t.Fatalf("Expected a single deduplicated transaction, got: %v", exec.commands)
+	}
+}
+
+func TestInstallPackagesNotFound(t *testing.T) {
+	exec := &mockExecutor{
+		err:    errors.New("exit status 1"),
+		output: "Package nope not found in any active repository.\nPackage nada not found in any active repository.\n",
+	}
+	e := &EopkgManager{exec: exec}
+	err := e.InstallPackages([]string{"gdb", "nope", "nada"})
+	if !errors.Is(err, ErrPackageNotFound) {
+		t.Fatalf("Expected missing packages, got: %v", err)
+	}
+	var notFound *PackageNotFoundError
+	if !errors.As(err, &notFound) || len(notFound.Packages) != 2 || notFound.Packages[0] != "nope" || notFound.Packages[1] != "nada" {
+		t.Fatalf("Wrong missing packages: %v", err)
+	}
+
+	// Other failures are passed through untouched
+	exec.output = ""
+	if err := e.InstallPackages([]string{"gdb"}); err != exec.err {
+		t.Fatalf("Expected the install error, got: %v", err)
+	}
+}
+
+const repoListOutput = `Solus [active]
+   https://packages.getsol.us/shannon/eopkg-index.xml.xz
+Local [inactive]
+   /hostRepos/Local/eopkg-index.xml.xz
+`
+
+func TestParseRepoList(t *testing.T) {
+	repos := parseRepoList(repoListOutput)
+	if len(repos) != 2 {
+		t.Fatalf("Expected 2 repos, got %d", len(repos))
+	}
+	if repos[0].ID != "Solus" || !repos[0].Active || repos[0].URI != "https://packages.getsol.us/shannon/eopkg-index.xml.xz" {
+		t.Fatalf("Wrong first repo: %+v", repos[0])
+	}
+	if repos[1].ID != "Local" || repos[1].Active || repos[1].URI != "/hostRepos/Local/eopkg-index.xml.xz" {
+		t.Fatalf("Wrong second repo: %+v", repos[1])
+	}
+}
+
+func TestRepoManagement(t *testing.T) {
+	exec := &mockExecutor{output: repoListOutput}
+	e := &EopkgManager{exec: exec}
+	err := e.AddRepo("Solus", "https://example.com/eopkg-index.xml.xz")
+	var exists *RepoExistsError
+	if !errors.Is(err, ErrRepoExists) || !errors.As(err, &exists) || exists.URI != "https://packages.getsol.us/shannon/eopkg-index.xml.xz" {
+		t.Fatalf("Expected the existing repo to be reported, got: %v", err)
+	}
+	if err := e.RemoveRepo("Unstable"); err != ErrNoSuchRepo {
+		t.Fatalf("Expected a missing repo, got: %v", err)
+	}
+
+	exec.commands = nil
+	if err := e.SetRepoPriority("Local", 0); err != nil {
+		t.Fatalf("Failed to set repo priority: %v", err)
+	}
+	expected := []string{
+		"eopkg list-repo -N",
+		"eopkg remove-repo 'Local'",
+		"eopkg add-repo 'Local' '/hostRepos/Local/eopkg-index.xml.xz' --at 0",
+	}
+	if strings.Join(exec.commands, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Wrong commands:\n%v\nexpected:\n%v", exec.commands, expected)
+	}
+
+	// A genuine failure is not mistaken for an existing repo
+	exec.err = errors.New("exit status 1")
+	if err := e.AddRepo("Unstable", "https://example.com/eopkg-index.xml.xz"); err == nil || errors.Is(err, ErrRepoExists) {
+		t.Fatalf("Expected a genuine failure, got: %v", err)
+	}
+}
+
+// flakyExecutor fails the first attempts of every command other than a
+// repository refresh, with the given output
+type flakyExecutor struct {
+	mockExecutor
+	failures int
+}
+
+func (f *flakyExecutor) Exec(command string) (string, error) {
+	f.commands = append(f.commands, command)
+	if command == "eopkg update-repo" || f.failures < 1 {
+		return "", nil
+	}
+	f.failures--
+	return f.output, errors.New("exit status 1")
+}
+
+func TestExecWithRetry(t *testing.T) {
+	backoff := PackageBackoff
+	PackageBackoff = 0
+	defer func() { PackageBackoff = backoff }()
+
+	flaky := &flakyExecutor{failures: 2}
+	flaky.output = "Could not fetch https://packages.getsol.us/shannon/eopkg-index.xml.xz: Connection timed out\n"
+	e := &EopkgManager{exec: flaky}
+	if err := e.InstallComponent("system.devel"); err != nil {
+		t.Fatalf("Failed to retry transient failure: %v", err)
+	}
+	expected := []string{
+		"eopkg install -c system.devel -y",
+		"eopkg update-repo",
+		"eopkg install -c system.devel -y",
+		"eopkg update-repo",
+		"eopkg install -c system.devel -y",
+	}
+	if strings.Join(flaky.commands, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Wrong commands:\n%v\nexpected:\n%v", flaky.commands, expected)
+	}
+
+	// Give up after PackageRetries attempts
+	flaky = &flakyExecutor{failures: PackageRetries + 1}
+	flaky.output = "Temporary failure in name resolution\n"
+	e.exec = flaky
+	if err := e.InstallBuildDeps("/home/build/work/package.yml"); err == nil {
+		t.Fatal("Expected failure after exhausting retries")
+	}
+	if flaky.failures != 1 {
+		t.Fatalf("Expected %d attempts, got %d", PackageRetries, PackageRetries+1-flaky.failures)
+	}
+
+	// Conflicts are not retried, even alongside network errors
+	flaky = &flakyExecutor{failures: 1}
+	flaky.output = "Connection reset by peer\n[foo conflicts with: bar]\n"
+	e.exec = flaky
+	if err := e.Upgrade(); err == nil || len(flaky.commands) != 1 {
+		t.Fatalf("Retried a dependency conflict: %v", flaky.commands)
+	}
+}
+
+func TestWaitForLock(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-eopkg-lock")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	defer func(poll time.Duration) { eopkgLockPoll = poll }(eopkgLockPoll)
+	eopkgLockPoll = 10 * time.Millisecond
+
+	e := &EopkgManager{root: root}
+	if err := e.WaitForLock(time.Second); err != nil {
+		t.Fatalf("Expected a missing lock to be free, got: %v", err)
+	}
+
+	path := filepath.Join(root, "var", "lib", "eopkg", "lock")
+	if err := os.MkdirAll(filepath.Dir(path), 00755); err != nil {
+		t.Fatalf("Failed to create eopkg directory: %v", err)
+	}
+	lock, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create lock: %v", err)
+	}
+	defer lock.Close()
+	// An unlocked file is left behind by every eopkg run
+	if err := e.WaitForLock(time.Second); err != nil {
+		t.Fatalf("Expected an unlocked file to be free, got: %v", err)
+	}
+
+	fd := int(lock.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := e.WaitForLock(50 * time.Millisecond); !errors.Is(err, ErrEopkgTimeout) {
+		t.Fatalf("Expected ErrEopkgTimeout, got: %v", err)
+	}
+	// Joined before the deferred Close, which must not race the unlock
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(50 * time.Millisecond)
+		syscall.Flock(fd, syscall.LOCK_UN)
+	}()
+	err = e.WaitForLock(5 * time.Second)
+	<-released
+	if err != nil {
+		t.Fatalf("Expected the lock to be released, got: %v", err)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	var out strings.Builder
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&out, "line %d\n", i)
+	}
+	tail := strings.Split(lastLines(out.String(), 50), "\n")
+	if len(tail) != 50 || tail[0] != "line 11" || tail[49] != "line 60" {
+		t.Fatalf("Wrong tail: %v", tail)
+	}
+	if tail := lastLines("Program terminated.\n", 50); tail != "Program terminated." {
+		t.Fatalf("Wrong tail for short output: %q", tail)
+	}
+	if tail := lastLines("\n", 50); tail != "" {
+		t.Fatalf("Expected no tail, got: %q", tail)
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	results := parseSearch(`nano            - Small, friendly text editor inspired by Pico
+nano-docs       - Documentation for nano
+
+`)
+	if len(results) != 2 || results[0].Name != "nano" || results[1].Summary != "Documentation for nano" {
+		t.Fatalf("Wrong search results: %+v", results)
+	}
+	info := `Installed package:
+Name                : nano, version: 7.1, release: 119
+Package found in Solus repository:
+Name                : nano, version: 7.2, release: 120
+`
+	matches := eopkgInfoName.FindAllStringSubmatch(info, -1)
+	if len(matches) != 2 || matches[1][2] != "7.2" || matches[1][3] != "120" {
+		t.Fatalf("Wrong package versions: %v", matches)
+	}
+	if quoted := shellQuote("it's"); quoted != `'it'\''s'` {
+		t.Fatalf("Wrong quoting: %s", quoted)
+	}
+}
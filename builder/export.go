@@ -0,0 +1,96 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/disk"
+	"github.com/getsolus/solbuild/builder/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SHA256SumsFile lists the checksums of exported sources, in the format
+	// understood by sha256sum -c
+	SHA256SumsFile = "SHA256SUMS"
+)
+
+// ValidateSources will ensure that every source is well formed before we
+// attempt to fetch it
+func (p *Package) ValidateSources() error {
+	for _, src := range p.Sources {
+		if problems := source.Validate(src); len(problems) > 0 {
+			return fmt.Errorf("Invalid source %s: %s", src.GetIdentifier(), strings.Join(problems, ", "))
+		}
+	}
+	return nil
+}
+
+// ExportSources will fetch the sources of the package and copy each archive
+// into destDir under its original filename, along with a SHA256SUMS file.
+// The current directory is used when destDir is empty. Git sources cannot
+// be exported and are skipped.
+func (p *Package) ExportSources(destDir string) error {
+	if destDir == "" {
+		destDir = "."
+	}
+	if err := p.ValidateSources(); err != nil {
+		return err
+	}
+	if err := p.FetchSources(nil); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 00755); err != nil {
+		return fmt.Errorf("Failed to create export directory %s, reason: %s\n", destDir, err)
+	}
+
+	var sums strings.Builder
+	exported := make(map[string]bool)
+	for _, src := range p.Sources {
+		s, ok := cachedTarball(src)
+		if !ok {
+			log.Warnf("Not exporting git source %s\n", src.GetIdentifier())
+			continue
+		}
+		if exported[s.File] {
+			log.Warnf("Not exporting %s, another source has the same filename\n", s.URI)
+			continue
+		}
+		path := s.GetPath(s.GetValidator())
+		dest := filepath.Join(destDir, s.File)
+		log.Debugf("Exporting source %s\n", s.File)
+		if err := disk.CopyFile(path, dest); err != nil {
+			return fmt.Errorf("Failed to export source %s, reason: %s\n", s.File, err)
+		}
+		sum, err := s.GetSHA256Sum(dest)
+		if err != nil {
+			return fmt.Errorf("Failed to checksum source %s, reason: %s\n", s.File, err)
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, s.File)
+		exported[s.File] = true
+	}
+
+	sumsPath := filepath.Join(destDir, SHA256SumsFile)
+	if err := ioutil.WriteFile(sumsPath, []byte(sums.String()), 00644); err != nil {
+		return fmt.Errorf("Failed to write %s, reason: %s\n", sumsPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// DefaultFreshnessWindow is how long after an upgrade a root is still
+// considered fresh enough to build in without upgrading again
+const DefaultFreshnessWindow = 24 * time.Hour
+
+var (
+	// FreshnessWindow is how long after an upgrade the per-build upgrade
+	// is skipped. Zero always upgrades.
+	FreshnessWindow = DefaultFreshnessWindow
+
+	// ForceUpgrade will always upgrade the build root
+	ForceUpgrade bool
+)
+
+// StampSuffix is the extension of the file recording when an image was
+// last updated
+const StampSuffix = ".stamp"
+
+// LastUpdated returns when the image was last updated by solbuild, or the
+// zero time if that is unknown
+func (b *BackingImage) LastUpdated() time.Time {
+	if b.StampPath == "" {
+		return time.Time{}
+	}
+	data, err := ioutil.ReadFile(b.StampPath)
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// WriteStamp will record that the image has just been updated
+func (b *BackingImage) WriteStamp() error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := ioutil.WriteFile(b.StampPath, []byte(now+"\n"), 00644); err != nil {
+		return fmt.Errorf("Failed to write update stamp %s, reason: %s\n", b.StampPath, err)
+	}
+	return nil
+}
+
+// upgradeNeeded will determine whether the build root must be upgraded,
+// along with the reason why or why not. The root is as fresh as the last
+// update of the image or, when an overlay is reused, its last upgrade.
+// Profiles that change the repos always upgrade, as the image was updated
+// from different repos.
+func upgradeNeeded(overlay *Overlay, profile *Profile, now time.Time) (bool, string) {
+	if ForceUpgrade {
+		return true, "as requested"
+	}
+	if FreshnessWindow <= 0 {
+		return true, "as the freshness window is disabled"
+	}
+	if profile != nil && (len(profile.Repos) > 0 || len(profile.RemoveRepos) > 0) {
+		return true, fmt.Sprintf("as profile %s changes the repositories", profile.Name)
+	}
+	if overlay == nil {
+		return true, "as the last update of the root is unknown"
+	}
+	last := overlay.BackingImage.LastUpdated()
+	if overlay.LastUpgrade.After(last) {
+		last = overlay.LastUpgrade
+	}
+	if last.IsZero() {
+		return true, "as the last update of the image is unknown"
+	}
+	age := now.Sub(last).Round(time.Minute)
+	if age >= FreshnessWindow {
+		return true, fmt.Sprintf("as the root was last updated %s ago", age)
+	}
+	return false, fmt.Sprintf("as the root was updated %s ago, within %s", age, FreshnessWindow)
+}
@@ -0,0 +1,94 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpgradeNeeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-freshness")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := &BackingImage{StampPath: filepath.Join(dir, "main-x86_64"+StampSuffix)}
+	overlay := &Overlay{BackingImage: image}
+	profile := &Profile{Name: "main-x86_64"}
+	now := time.Now()
+
+	if upgrade, _ := upgradeNeeded(overlay, profile, now); !upgrade {
+		t.Fatal("Skipped upgrade without a stamp")
+	}
+	if err := image.WriteStamp(); err != nil {
+		t.Fatalf("Failed to write stamp: %v", err)
+	}
+	if upgrade, reason := upgradeNeeded(overlay, profile, now); upgrade {
+		t.Fatalf("Upgraded a fresh image: %s", reason)
+	}
+	if upgrade, _ := upgradeNeeded(overlay, profile, now.Add(DefaultFreshnessWindow)); !upgrade {
+		t.Fatal("Skipped upgrade of a stale image")
+	}
+
+	overlay.LastUpgrade = now.Add(DefaultFreshnessWindow - time.Hour)
+	if upgrade, reason := upgradeNeeded(overlay, profile, now.Add(DefaultFreshnessWindow)); upgrade {
+		t.Fatalf("Upgraded a freshly upgraded overlay: %s", reason)
+	}
+
+	ForceUpgrade = true
+	upgrade, _ := upgradeNeeded(overlay, profile, now)
+	ForceUpgrade = false
+	if !upgrade {
+		t.Fatal("Skipped a forced upgrade")
+	}
+
+	profile.RemoveRepos = []string{"*"}
+	if upgrade, _ := upgradeNeeded(overlay, profile, now); !upgrade {
+		t.Fatal("Skipped upgrade for a profile that changes the repos")
+	}
+}
+
+func TestPrepareRootFresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-freshness")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := &BackingImage{StampPath: filepath.Join(dir, "main-x86_64"+StampSuffix)}
+	if err := image.WriteStamp(); err != nil {
+		t.Fatalf("Failed to write stamp: %v", err)
+	}
+	pman := newMockPackageManager()
+	pkg := &Package{Type: PackageTypeYpkg}
+	if err := pkg.PrepareRoot(pman, &Profile{}, pman, &Overlay{BackingImage: image}, NewStageTimer()); err != nil {
+		t.Fatalf("Failed to prepare root: %v", err)
+	}
+	for _, call := range pman.calls {
+		if call == "Upgrade" {
+			t.Fatal("Upgraded a fresh root")
+		}
+	}
+	if pman.calls[4] != "RefreshRepos" {
+		t.Fatalf("Repositories were not refreshed, calls: %v", pman.calls)
+	}
+}
@@ -65,6 +65,7 @@ func init() {
 // more features will come in time.
 type PackageHistory struct {
 	Updates []*PackageUpdate
+	Head    string // The commit currently checked out
 
 	pkgfile string // Path of the package
 }
@@ -218,6 +219,9 @@ func NewPackageHistory(pkgfile string) (*PackageHistory, error) {
 	sort.Sort(sort.Reverse(sort.StringSlice(tags)))
 
 	ret := &PackageHistory{pkgfile: pkgfile}
+	if head, err := repo.Head(); err == nil {
+		ret.Head = head.Target().String()
+	}
 	ret.scanUpdates(repo, updates, tags)
 	updates = nil
 
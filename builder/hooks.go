@@ -0,0 +1,179 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	// PreBuildHooksDir contains executables run on the host before each build
+	PreBuildHooksDir = "/etc/solbuild/hooks/pre-build.d"
+
+	// PostBuildHooksDir contains executables run on the host after each build,
+	// whether or not it succeeded
+	PostBuildHooksDir = "/etc/solbuild/hooks/post-build.d"
+)
+
+var (
+	// DisableHooks will skip running the pre and post build hooks
+	DisableHooks bool
+
+	// AllowPreBuildHooks will run the prebuild commands of a package on the
+	// host. These run as root outside of the chroot, so are only run when
+	// the recipe is trusted.
+	AllowPreBuildHooks bool
+
+	// ErrPreBuildHook is matched by any PreBuildHookError
+	ErrPreBuildHook = errors.New("Pre-build hook failed")
+)
+
+// A PreBuildHookError is returned when a prebuild command of the package fails
+type PreBuildHookError struct {
+	Command string
+	Err     error
+}
+
+// Error will name the failed command
+func (e *PreBuildHookError) Error() string {
+	return fmt.Sprintf("Pre-build hook '%s' failed, reason: %s", e.Command, e.Err)
+}
+
+// Is will match ErrPreBuildHook
+func (e *PreBuildHookError) Is(target error) bool {
+	return target == ErrPreBuildHook
+}
+
+// FindHooks will return the executables within dir, in lexical order.
+// A missing directory is not an error, and simply has no hooks.
+func FindHooks(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var hooks []string
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || entry.Mode().Perm()&0111 == 0 {
+			log.Debugf("Skipping non-executable hook %s\n", entry.Name())
+			continue
+		}
+		hooks = append(hooks, filepath.Join(dir, entry.Name()))
+	}
+	return hooks, nil
+}
+
+// HookEnvironment returns the environment variables describing the package
+// to the hooks. The result is only set for post-build hooks.
+func HookEnvironment(pkg *Package, profile *Profile, outputDir string, result error, post bool) []string {
+	env := append(os.Environ(),
+		fmt.Sprintf("SOLBUILD_PACKAGE=%s", pkg.Name),
+		fmt.Sprintf("SOLBUILD_VERSION=%s", pkg.Version),
+		fmt.Sprintf("SOLBUILD_RELEASE=%d", pkg.Release),
+		fmt.Sprintf("SOLBUILD_PROFILE=%s", profile.Name),
+		fmt.Sprintf("SOLBUILD_OUTPUT_DIR=%s", outputDir),
+	)
+	if !post {
+		return env
+	}
+	if result == nil {
+		return append(env, "SOLBUILD_RESULT=success")
+	}
+	return append(env, "SOLBUILD_RESULT=failure", fmt.Sprintf("SOLBUILD_ERROR=%s", result))
+}
+
+// RunHooks will run each of the hooks on the host with the given environment.
+// When stopOnError is set the first failing hook aborts the run, otherwise
+// failures are only logged and all hooks are run.
+func RunHooks(hooks, env []string, stdout, stderr io.Writer, stopOnError bool) error {
+	for _, hook := range hooks {
+		log.Infof("Running hook %s\n", filepath.Base(hook))
+		c := exec.Command(hook)
+		c.Env = env
+		c.Stdout = stdout
+		c.Stderr = stderr
+		if err := c.Run(); err != nil {
+			err = fmt.Errorf("Hook %s failed, reason: %s\n", hook, err)
+			if stopOnError {
+				return err
+			}
+			log.Errorf("%s", err)
+		}
+	}
+	return nil
+}
+
+// hookOutput returns the writers for the output of hooks, through the build
+// log when one is in use, along with a function to flush them
+func hookOutput(tag string) (io.Writer, io.Writer, func()) {
+	if ChrootOutput == nil {
+		return consoleStdout(), os.Stderr, func() {}
+	}
+	ChrootOutput.SetTag(tag)
+	stdout := ChrootOutput.Writer(consoleStdout())
+	stderr := ChrootOutput.Writer(os.Stderr)
+	return stdout, stderr, func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
+
+// RunPreBuildHooks will run the prebuild commands of the package on the host,
+// from the directory containing the recipe, when AllowPreBuildHooks is set.
+// The first failure aborts the build.
+func (p *Package) RunPreBuildHooks(profile *Profile) error {
+	if len(p.PreBuildHooks) < 1 {
+		return nil
+	}
+	if DisableHooks || !AllowPreBuildHooks {
+		log.Warnf("Not running %d pre-build hooks of the package on the host, see --allow-prebuild-hooks\n", len(p.PreBuildHooks))
+		return nil
+	}
+	outputDir, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("Unable to find working directory, reason: %s\n", err)
+	}
+	env := HookEnvironment(p, profile, outputDir, nil, false)
+	stdout, stderr, flush := hookOutput("prebuild")
+	defer flush()
+	return runPreBuildHooks(p.PreBuildHooks, filepath.Dir(p.Path), env, stdout, stderr)
+}
+
+// runPreBuildHooks will run each command with the shell in dir
+func runPreBuildHooks(commands []string, dir string, env []string, stdout, stderr io.Writer) error {
+	for _, command := range commands {
+		log.Infof("Running pre-build hook: %s\n", command)
+		c := exec.Command("/bin/sh", "-c", command)
+		c.Dir = dir
+		c.Env = env
+		c.Stdout = stdout
+		c.Stderr = stderr
+		if err := c.Run(); err != nil {
+			return &PreBuildHookError{Command: command, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHook(t *testing.T, dir, name, script string, mode os.FileMode) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), mode); err != nil {
+		t.Fatalf("Failed to write hook %s: %v", name, err)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-hooks")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeHook(t, dir, "20-second", "echo second $SOLBUILD_PACKAGE", 0755)
+	writeHook(t, dir, "10-first", "echo first; exit 1", 0755)
+	writeHook(t, dir, "30-disabled", "echo disabled", 0644)
+
+	hooks, err := FindHooks(dir)
+	if err != nil {
+		t.Fatalf("Failed to find hooks: %v", err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("Invalid number of hooks: %d vs expected 2", len(hooks))
+	}
+
+	env := []string{"SOLBUILD_PACKAGE=nano"}
+	var out bytes.Buffer
+	if err := RunHooks(hooks, env, &out, &out, true); err == nil {
+		t.Fatal("Failing hook should abort the run")
+	}
+	if out.String() != "first\n" {
+		t.Fatalf("Hooks ran after a failure: %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunHooks(hooks, env, &out, &out, false); err != nil {
+		t.Fatalf("Failing hook should only be logged: %v", err)
+	}
+	if out.String() != "first\nsecond nano\n" {
+		t.Fatalf("Hooks did not run in order: %q", out.String())
+	}
+
+	if hooks, err = FindHooks(filepath.Join(dir, "missing")); err != nil || len(hooks) != 0 {
+		t.Fatalf("Missing hook directory should be empty: %v", err)
+	}
+}
+
+func TestRunPreBuildHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-prebuild")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := NewYmlPackageFromBytes([]byte(`name: sdk
+version: 1.0
+release: 1
+prebuild:
+    - echo "$SOLBUILD_PACKAGE" > generated.txt
+    - test -f missing.txt
+    - touch never.txt
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	if len(p.PreBuildHooks) != 3 {
+		t.Fatalf("Invalid number of pre-build hooks: %d vs expected 3", len(p.PreBuildHooks))
+	}
+
+	env := HookEnvironment(p, &Profile{Name: "main-x86_64"}, dir, nil, false)
+	var out bytes.Buffer
+	err = runPreBuildHooks(p.PreBuildHooks, dir, env, &out, &out)
+	if !errors.Is(err, ErrPreBuildHook) {
+		t.Fatalf("Expected a failed pre-build hook, got: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "generated.txt"))
+	if err != nil || string(b) != "sdk\n" {
+		t.Fatalf("Hook did not run in the package directory: %v '%s'", err, string(b))
+	}
+	if PathExists(filepath.Join(dir, "never.txt")) {
+		t.Fatal("Continued running hooks after a failure")
+	}
+
+	// Only run on the host when allowed
+	p.Path = filepath.Join(dir, "package.yml")
+	p.PreBuildHooks = []string{"touch allowed.txt"}
+	if err := p.RunPreBuildHooks(&Profile{}); err != nil || PathExists(filepath.Join(dir, "allowed.txt")) {
+		t.Fatalf("Ran pre-build hooks without --allow-prebuild-hooks: %v", err)
+	}
+}
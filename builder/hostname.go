@@ -0,0 +1,98 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"regexp"
+)
+
+const (
+	// DefaultHostname is the hostname seen within the chroot when none is
+	// configured
+	DefaultHostname = "solbuild"
+
+	// hostnameSysctl sets the hostname of the UTS namespace of its writer
+	hostnameSysctl = "/proc/sys/kernel/hostname"
+)
+
+var (
+	// BuildHostname is the hostname seen within the chroot, so that the
+	// hostname of the host never leaks into packages
+	BuildHostname = DefaultHostname
+
+	// ErrInvalidHostname is returned for hostnames the kernel or resolver
+	// would reject
+	ErrInvalidHostname = errors.New("Invalid hostname")
+
+	// validHostname matches dot separated labels of letters, digits and '-'
+	validHostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+)
+
+// ValidateHostname will ensure the hostname may be used within the chroot
+func ValidateHostname(name string) error {
+	// HOST_NAME_MAX of Linux
+	if len(name) > 64 || !validHostname.MatchString(name) {
+		return fmt.Errorf("%s: '%s'", ErrInvalidHostname, name)
+	}
+	return nil
+}
+
+// hostsFile is the /etc/hosts of the chroot, resolving both localhost and
+// the hostname of the build to the loopback device
+func hostsFile(hostname string) string {
+	return fmt.Sprintf("127.0.0.1\tlocalhost %[1]s\n::1\tlocalhost %[1]s\n", hostname)
+}
+
+// hostnameCommand sets the hostname within the UTS namespace of a chroot
+// command, whenever /proc is mounted in the chroot
+func hostnameCommand(hostname string) string {
+	return fmt.Sprintf("{ [ ! -w %[1]s ] || echo %[2]s > %[1]s; }", hostnameSysctl, hostname)
+}
+
+// newMachineID will generate a random machine-id, as systemd-machine-id-setup
+// would for a new system
+func newMachineID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x\n", b), nil
+}
+
+// ConfigureHost will give the chroot an identity of its own, rather than
+// that of the image or the host. The hostname is written to /etc/hostname
+// and resolved by /etc/hosts, and a transient /etc/machine-id is generated.
+// Everything is restored when the overlay is unmounted. The clock needs no
+// configuration, as the chroot is never given a time namespace.
+func (o *Overlay) ConfigureHost() error {
+	log.Debugf("Configuring chroot identity: hostname='%s'\n", BuildHostname)
+	if err := o.writeEtc("hostname", BuildHostname+"\n"); err != nil {
+		return err
+	}
+	if err := o.writeEtc("hosts", hostsFile(BuildHostname)); err != nil {
+		return err
+	}
+	id, err := newMachineID()
+	if err != nil {
+		return fmt.Errorf("Failed to generate machine-id, reason: %s\n", err)
+	}
+	return o.writeEtc("machine-id", id)
+}
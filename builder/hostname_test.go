@@ -0,0 +1,81 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateHostname(t *testing.T) {
+	for _, name := range []string{"solbuild", "build-01", "builder.example.com", "a"} {
+		if err := ValidateHostname(name); err != nil {
+			t.Errorf("Expected %s to be valid, got: %s", name, err)
+		}
+	}
+	for _, name := range []string{"", "-build", "build-", "build host", "build;reboot", "a..b", strings.Repeat("a", 65)} {
+		err := ValidateHostname(name)
+		if err == nil || !strings.HasPrefix(err.Error(), ErrInvalidHostname.Error()) {
+			t.Errorf("Expected %s to be invalid, got: %v", name, err)
+		}
+	}
+}
+
+func TestConfigureHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-host")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	o := &Overlay{MountPoint: dir}
+	if err = os.MkdirAll(filepath.Join(dir, "etc"), 0755); err != nil {
+		t.Fatalf("Failed to create etc: %s", err)
+	}
+	hosts := filepath.Join(dir, "etc", "hosts")
+	if err = ioutil.WriteFile(hosts, []byte("10.0.0.1\timage\n"), 0644); err != nil {
+		t.Fatalf("Failed to write hosts: %s", err)
+	}
+
+	BuildHostname = "builder"
+	defer func() { BuildHostname = DefaultHostname }()
+	if err = o.ConfigureHost(); err != nil {
+		t.Fatalf("Failed to configure host: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(hosts); string(b) != "127.0.0.1\tlocalhost builder\n::1\tlocalhost builder\n" {
+		t.Fatalf("Wrong hosts: %s", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "etc", "hostname")); string(b) != "builder\n" {
+		t.Fatalf("Wrong hostname: %s", b)
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "etc", "machine-id"))
+	if id := strings.TrimSpace(string(b)); len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		t.Fatalf("Invalid machine-id: %s", b)
+	}
+
+	o.restoreEtc()
+	if b, _ := ioutil.ReadFile(hosts); string(b) != "10.0.0.1\timage\n" {
+		t.Fatalf("Original hosts was not restored: %s", b)
+	}
+	for _, name := range []string{"hostname", "machine-id"} {
+		if PathExists(filepath.Join(dir, "etc", name)) {
+			t.Fatalf("New %s was not removed", name)
+		}
+	}
+}
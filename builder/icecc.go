@@ -0,0 +1,80 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/disk"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// IceccSocket is where the icecream daemon listens on the host, and where
+	// it is made available within the chroot
+	IceccSocket = "/var/run/icecream/default.sock"
+
+	// IceccPackage provides the icecream compiler wrapper
+	IceccPackage = "icecc"
+
+	// iceccDialTimeout is how long to wait for the daemon to accept
+	iceccDialTimeout = 2 * time.Second
+)
+
+// iceccRunning will determine whether the icecream daemon is accepting
+// connections on the given socket
+func iceccRunning(socket string) bool {
+	conn, err := net.DialTimeout("unix", socket, iceccDialTimeout)
+	if err != nil {
+		log.Debugf("icecream daemon is unreachable, reason: %s\n", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// BindIcecc will make the socket of the icecream daemon available to the build,
+// and compile through icecc. When the daemon is not running the package is
+// compiled locally, with a warning.
+func (p *Package) BindIcecc(o *Overlay) error {
+	if !iceccRunning(IceccSocket) {
+		log.Warnf("The icecream daemon is not running at %s, compiling locally\n", IceccSocket)
+		return nil
+	}
+	socket := filepath.Join(o.MountPoint, IceccSocket[1:])
+	if err := os.MkdirAll(filepath.Dir(socket), 00755); err != nil {
+		return fmt.Errorf("Failed to create icecream socket directory, reason: %s\n", err)
+	}
+	// Bind mounts need an existing target
+	f, err := os.OpenFile(socket, os.O_CREATE|os.O_RDONLY, 00644)
+	if err != nil {
+		return fmt.Errorf("Failed to create icecream socket %s, reason: %s\n", socket, err)
+	}
+	f.Close()
+
+	log.Debugf("Exposing icecream daemon to build %s\n", socket)
+	if err := disk.GetMountManager().BindMount(IceccSocket, socket); err != nil {
+		return fmt.Errorf("Failed to bind mount icecream socket %s, reason: %s\n", socket, err)
+	}
+	o.ExtraMounts = append(o.ExtraMounts, socket)
+	ChrootEnvironment = append(ChrootEnvironment, "CC=icecc gcc", "CXX=icecc g++")
+	log.Infoln("Distributing compilation with icecream")
+	return nil
+}
@@ -0,0 +1,181 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ImageHashesSuffix is appended to the image name for its recorded hashes
+const ImageHashesSuffix = ".hashes"
+
+// ImageState describes the integrity of an installed image
+type ImageState string
+
+const (
+	// ImagePristine is an image unchanged since it was initialised
+	ImagePristine ImageState = "pristine"
+
+	// ImageUpdated is an image changed only by solbuild updates
+	ImageUpdated ImageState = "modified-by-update"
+
+	// ImageUnrecorded is an image with a clean filesystem, but with no
+	// recorded hash to compare against
+	ImageUnrecorded ImageState = "unrecorded"
+
+	// ImageDamaged is an image changed outside of solbuild, or whose
+	// filesystem has errors
+	ImageDamaged ImageState = "damaged"
+)
+
+// ImageHashes records the sha256sum of an image when it was initialised and
+// when it was last changed by solbuild
+type ImageHashes struct {
+	Initial string    `json:"initial"`
+	Current string    `json:"current"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// ImageReport is the result of verifying an image
+type ImageReport struct {
+	State  ImageState
+	Sha256 string       // Hash of the image as it is now
+	Hashes *ImageHashes // Recorded hashes, nil when none were recorded
+	Fsck   string       // Output of the filesystem check
+	Clean  bool         // Whether the filesystem check passed
+}
+
+// loadHashes will read the recorded hashes of the image, if any
+func (b *BackingImage) loadHashes() (*ImageHashes, error) {
+	data, err := ioutil.ReadFile(b.HashesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var hashes ImageHashes
+	if err := json.Unmarshal(data, &hashes); err != nil {
+		return nil, fmt.Errorf("Invalid image hashes %s, reason: %s\n", b.HashesPath, err)
+	}
+	return &hashes, nil
+}
+
+// RecordHash will store the hash of the image as it is now. The first hash
+// recorded after init is kept as the initial hash, and later calls after
+// updates only replace the current hash.
+func (b *BackingImage) RecordHash(initial bool) error {
+	if b.HashesPath == "" {
+		return nil
+	}
+	log.Debugf("Hashing image %s\n", b.ImagePath)
+	sum, err := FileSha256sum(b.ImagePath)
+	if err != nil {
+		return fmt.Errorf("Failed to hash image %s, reason: %s\n", b.ImagePath, err)
+	}
+	hashes := &ImageHashes{Initial: sum, Current: sum}
+	if !initial {
+		if prev, err := b.loadHashes(); err == nil && prev != nil {
+			hashes.Initial = prev.Initial
+		}
+		hashes.Updated = time.Now().UTC()
+	}
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(b.HashesPath, data, 00644); err != nil {
+		return fmt.Errorf("Failed to write image hashes %s, reason: %s\n", b.HashesPath, err)
+	}
+	return nil
+}
+
+// Verify will hash the image again, without trusting any cached hash, and
+// run a read-only check of its filesystem through a loop device. The image
+// must not be in use.
+func (b *BackingImage) Verify() (*ImageReport, error) {
+	hashes, err := b.loadHashes()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Hashing image %s\n", b.ImagePath)
+	sum, err := FileSha256sum(b.ImagePath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to hash image %s, reason: %s\n", b.ImagePath, err)
+	}
+	log.Infoln("Checking image filesystem")
+	output, clean, err := fsckImage(b.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageReport{
+		State:  classifyImage(sum, hashes, clean),
+		Sha256: sum,
+		Hashes: hashes,
+		Fsck:   output,
+		Clean:  clean,
+	}, nil
+}
+
+// classifyImage will determine the state of an image from its hash and the
+// result of the filesystem check
+func classifyImage(sum string, hashes *ImageHashes, clean bool) ImageState {
+	switch {
+	case !clean:
+		return ImageDamaged
+	case hashes == nil:
+		return ImageUnrecorded
+	case sum == hashes.Initial:
+		return ImagePristine
+	case sum == hashes.Current:
+		return ImageUpdated
+	default:
+		return ImageDamaged
+	}
+}
+
+// fsckImage will attach the image to a read-only loop device and check its
+// filesystem without making any changes. The output of fsck is returned
+// along with whether the filesystem is clean.
+func fsckImage(path string) (string, bool, error) {
+	out, err := exec.Command("losetup", "--find", "--show", "--read-only", path).Output()
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to attach loop device for %s, reason: %s\n", path, err)
+	}
+	device := strings.TrimSpace(string(out))
+	defer func() {
+		if err := exec.Command("losetup", "--detach", device).Run(); err != nil {
+			log.Warnf("Failed to detach loop device %s, reason: %s\n", device, err)
+		}
+	}()
+	// -n answers "no" to every question, so nothing is ever written
+	output, err := exec.Command("fsck", "-T", "-n", "-f", device).CombinedOutput()
+	if err == nil {
+		return string(output), true, nil
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return string(output), false, nil
+	}
+	return "", false, fmt.Errorf("Failed to run fsck on %s, reason: %s\n", device, err)
+}
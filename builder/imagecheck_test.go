@@ -0,0 +1,85 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageRecordHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-imagecheck")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &BackingImage{
+		Name:       "unstable-x86_64",
+		ImagePath:  filepath.Join(dir, "unstable-x86_64"+ImageSuffix),
+		HashesPath: filepath.Join(dir, "unstable-x86_64"+ImageHashesSuffix),
+	}
+	if hashes, err := b.loadHashes(); err != nil || hashes != nil {
+		t.Fatalf("Expected no recorded hashes, got: %v (%v)", hashes, err)
+	}
+	if err := ioutil.WriteFile(b.ImagePath, []byte("image"), 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if err := b.RecordHash(true); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+	initial, _ := FileSha256sum(b.ImagePath)
+
+	if err := ioutil.WriteFile(b.ImagePath, []byte("updated image"), 00644); err != nil {
+		t.Fatalf("Failed to update image: %v", err)
+	}
+	if err := b.RecordHash(false); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+	current, _ := FileSha256sum(b.ImagePath)
+	hashes, err := b.loadHashes()
+	if err != nil {
+		t.Fatalf("Failed to load hashes: %v", err)
+	}
+	if hashes.Initial != initial || hashes.Current != current || hashes.Updated.IsZero() {
+		t.Fatalf("Unexpected hashes: %+v", hashes)
+	}
+}
+
+func TestClassifyImage(t *testing.T) {
+	hashes := &ImageHashes{Initial: "aaaa", Current: "bbbb"}
+	tests := []struct {
+		sum      string
+		hashes   *ImageHashes
+		clean    bool
+		expected ImageState
+	}{
+		{"aaaa", hashes, true, ImagePristine},
+		{"bbbb", hashes, true, ImageUpdated},
+		{"cccc", hashes, true, ImageDamaged},
+		{"aaaa", hashes, false, ImageDamaged},
+		{"cccc", nil, true, ImageUnrecorded},
+		{"cccc", nil, false, ImageDamaged},
+	}
+	for _, test := range tests {
+		if state := classifyImage(test.sum, test.hashes, test.clean); state != test.expected {
+			t.Fatalf("Expected %s for %s, got: %s", test.expected, test.sum, state)
+		}
+	}
+}
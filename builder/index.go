@@ -35,7 +35,7 @@ var (
 
 // Index will attempt to index the given directory
 func (p *Package) Index(notif PidNotifier, dir string, overlay *Overlay) error {
-	log.Debugf("Beginning indexer: profile='%s'\n", overlay.Back.Name)
+	log.Debugf("Beginning indexer: profile='%s'\n", overlay.BackingImage.Name)
 
 	mman := disk.GetMountManager()
 
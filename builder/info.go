@@ -0,0 +1,99 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// SourceInfo describes a single source of a package. The field names are
+// stable, for use by scripts consuming the JSON form.
+type SourceInfo struct {
+	Type     string `json:"type"`                // Either "tarball", "git" or "git-archive"
+	URI      string `json:"uri"`                 // Location of the source
+	Hash     string `json:"hash,omitempty"`      // Expected hash of a tarball
+	HashType string `json:"hash_type,omitempty"` // Either "sha256", or "sha1" for legacy packages
+	Ref      string `json:"ref,omitempty"`       // Ref to check out for git sources
+}
+
+// PackageInfo is the parsed metadata of a package. The field names are
+// stable, for use by scripts consuming the JSON form.
+type PackageInfo struct {
+	Name        string       `json:"name"`
+	Version     string       `json:"version"`
+	Release     int          `json:"release"`
+	Type        PackageType  `json:"type"`
+	Path        string       `json:"path"`
+	Summary     string       `json:"summary"`
+	Description string       `json:"description"`
+	Homepage    string       `json:"homepage"`
+	Components  []string     `json:"components"`
+	Licenses    []string     `json:"licenses"`
+	Sources     []SourceInfo `json:"sources"`
+	BuildDeps   []string     `json:"build_dependencies"`
+	RunDeps     []string     `json:"run_dependencies"`
+}
+
+// Info will return the metadata of the package, with every list non-nil so
+// that the JSON form is consistent.
+func (p *Package) Info() PackageInfo {
+	info := PackageInfo{
+		Name:        p.Name,
+		Version:     p.Version,
+		Release:     p.Release,
+		Type:        p.Type,
+		Path:        p.Path,
+		Summary:     p.Summary,
+		Description: p.Description,
+		Homepage:    p.Homepage,
+		Components:  append([]string{}, p.Components...),
+		Licenses:    append([]string{}, p.Licenses...),
+		Sources:     []SourceInfo{},
+		BuildDeps:   append([]string{}, p.BuildDeps...),
+		RunDeps:     append([]string{}, p.RunDeps...),
+	}
+	hashType := "sha256"
+	if p.Type == PackageTypeXML {
+		hashType = "sha1"
+	}
+	for _, src := range p.Sources {
+		switch s := src.(type) {
+		case *source.SimpleSource:
+			info.Sources = append(info.Sources, SourceInfo{
+				Type:     "tarball",
+				URI:      s.URI,
+				Hash:     s.GetValidator(),
+				HashType: hashType,
+			})
+		case *source.GitArchiveSource:
+			info.Sources = append(info.Sources, SourceInfo{
+				Type:     "git-archive",
+				URI:      s.URI,
+				Hash:     s.GetValidator(),
+				HashType: hashType,
+				Ref:      s.Ref,
+			})
+		case *source.GitSource:
+			info.Sources = append(info.Sources, SourceInfo{
+				Type: "git",
+				URI:  s.URI,
+				Ref:  s.Ref,
+			})
+		}
+	}
+	return info
+}
@@ -0,0 +1,61 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 151
+source:
+    - https://www.nano-editor.org/dist/v5/nano-5.8.tar.xz : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768c
+    - git|https://git.savannah.gnu.org/git/nano.git : v5.8
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	info := p.Info()
+	if len(info.Sources) != 2 {
+		t.Fatalf("Invalid number of sources: %d vs expected 2", len(info.Sources))
+	}
+	if s := info.Sources[0]; s.Type != "tarball" || s.HashType != "sha256" || !strings.HasPrefix(s.Hash, "e43b63db") {
+		t.Fatalf("Wrong tarball source: %+v", s)
+	}
+	if s := info.Sources[1]; s.Type != "git" || s.Ref != "v5.8" || s.Hash != "" {
+		t.Fatalf("Wrong git source: %+v", s)
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Failed to encode info: %v", err)
+	}
+	if !strings.Contains(string(b), `"licenses":[]`) {
+		t.Fatalf("Empty lists must be encoded as arrays: %s", b)
+	}
+
+	legacy, err := NewPackage(LegacyTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load legacy package: %v", err)
+	}
+	if s := legacy.Info().Sources[0]; s.HashType != "sha1" {
+		t.Fatalf("Wrong legacy hash type: %s", s.HashType)
+	}
+}
@@ -0,0 +1,146 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// LintSources will run static analysis over the package sources before
+	// they are built
+	LintSources bool
+
+	// ErrLintFailure is matched by a LintError, via errors.Is
+	ErrLintFailure = errors.New("Static analysis found errors in the sources")
+)
+
+// A LintError is returned when static analysis finds errors in the sources
+type LintError struct {
+	Tool   string
+	Errors int
+}
+
+// Error returns a summary of the errors found
+func (e *LintError) Error() string {
+	return fmt.Sprintf("%s found %d error(s) in the sources", e.Tool, e.Errors)
+}
+
+// Is allows matching the LintError against ErrLintFailure
+func (e *LintError) Is(target error) bool {
+	return target == ErrLintFailure
+}
+
+// A linter is a static analysis tool that may be installed by the builddeps
+type linter struct {
+	Name    string // Name of the tool
+	Binary  string // Path to the tool within the chroot
+	Command string // Command run from the root of the extracted sources
+}
+
+// linters are all of the supported static analysis tools. Both emit one
+// "file:line: error: message" line per problem.
+var linters = []linter{
+	{
+		Name:    "cppcheck",
+		Binary:  "/usr/bin/cppcheck",
+		Command: "cppcheck --quiet --error-exitcode=1 --template='{file}:{line}: {severity}: {message}' .",
+	},
+	{
+		Name:    "shellcheck",
+		Binary:  "/usr/bin/shellcheck",
+		Command: "find . -name '*.sh' -exec shellcheck --format=gcc {} +",
+	},
+}
+
+// GetLintDirInternal will return the chroot-internal directory the sources
+// are extracted to for static analysis
+func (p *Package) GetLintDirInternal() string {
+	return filepath.Join(BuildUserHome, "lint")
+}
+
+// Lint will validate the component of the package, then extract the package
+// sources and run every static analysis tool installed by the builddeps over
+// them, returning a LintError if any errors are found.
+func (p *Package) Lint(notif PidNotifier, overlay *Overlay) error {
+	if err := p.ValidateComponent(); err != nil {
+		return fmt.Errorf("Invalid package component: %s\n", err)
+	}
+	var tools []linter
+	for _, l := range linters {
+		if PathExists(filepath.Join(overlay.MountPoint, l.Binary)) {
+			tools = append(tools, l)
+		}
+	}
+	if len(tools) < 1 {
+		log.Warnln("Not linting sources as neither cppcheck nor shellcheck is in the builddeps")
+		return nil
+	}
+
+	lintDir := p.GetLintDirInternal()
+	extract := []string{fmt.Sprintf("rm -rf %s && mkdir -p %s", lintDir, lintDir)}
+	for _, src := range p.Sources {
+		s, ok := cachedTarball(src)
+		if !ok {
+			log.Debugf("Not linting non-tarball source %s\n", src.GetIdentifier())
+			continue
+		}
+		archive := filepath.Join(p.GetSourceDirInternal(), s.File)
+		extract = append(extract, fmt.Sprintf("(tar -xf '%s' -C %s 2>/dev/null || true)", archive, lintDir))
+	}
+	log.Debugln("Extracting sources for static analysis")
+	if err := ChrootExec(notif, overlay.MountPoint, buildUserCommand(strings.Join(extract, " && "))); err != nil {
+		return fmt.Errorf("Failed to extract sources for static analysis, reason: %s\n", err)
+	}
+
+	for _, l := range tools {
+		log.Infof("Running %s over the sources\n", l.Name)
+		out, _ := ChrootExecOutput(notif, overlay.MountPoint, buildUserCommand(fmt.Sprintf("cd %s && %s", lintDir, l.Command)))
+		count := countLintErrors(out)
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if line != "" && ChrootOutput != nil {
+				ChrootOutput.Annotate(l.Name, line)
+			}
+		}
+		if count > 0 {
+			return &LintError{Tool: l.Name, Errors: count}
+		}
+	}
+	return nil
+}
+
+// buildUserCommand will wrap the shell command to run as the build user
+func buildUserCommand(command string) string {
+	return fmt.Sprintf("/bin/su %s -s /bin/sh -c %s", BuildUser, shellQuote(command))
+}
+
+// countLintErrors will count the errors reported in the linter output,
+// logging each of them
+func countLintErrors(out string) int {
+	count := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, ": error: ") {
+			log.Errorln(line)
+			count++
+		}
+	}
+	return count
+}
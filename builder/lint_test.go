@@ -0,0 +1,59 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCountLintErrors(t *testing.T) {
+	out := `src/main.c:12: error: Memory leak: buf
+src/main.c:40: style: The scope of the variable 'i' can be reduced.
+scripts/install.sh:3:1: warning: Quote this to prevent word splitting. [SC2046]
+scripts/install.sh:9:5: error: Couldn't parse this test expression. [SC1073]
+`
+	if n := countLintErrors(out); n != 2 {
+		t.Fatalf("Invalid number of errors: %d vs expected 2", n)
+	}
+	if n := countLintErrors(""); n != 0 {
+		t.Fatalf("Found errors in empty output: %d", n)
+	}
+	var err error = &LintError{Tool: "cppcheck", Errors: 2}
+	if !errors.Is(err, ErrLintFailure) {
+		t.Fatal("LintError does not match ErrLintFailure")
+	}
+}
+
+func TestBuildUserCommand(t *testing.T) {
+	command := `echo "$HOME" $(id -u) 'it'\''s' \\`
+	got := buildUserCommand(command)
+	prefix := "/bin/su build -s /bin/sh -c "
+	if !strings.HasPrefix(got, prefix) {
+		t.Fatalf("Expected '%s' to start with '%s'", got, prefix)
+	}
+	// The shell must pass the command through unchanged
+	out, err := exec.Command("/bin/sh", "-c", "printf %s "+strings.TrimPrefix(got, prefix)).Output()
+	if err != nil {
+		t.Fatalf("Failed to run shell: %v", err)
+	}
+	if string(out) != command {
+		t.Fatalf("Expected '%s', got '%s'", command, out)
+	}
+}
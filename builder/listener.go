@@ -0,0 +1,72 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"sync"
+)
+
+// A BuildListener is told of the progress of a build as it happens, such as
+// to update a CI dashboard. The methods are called from within the build, so
+// they must return quickly.
+type BuildListener interface {
+	// OnPhaseStart is called as each stage of the build starts
+	OnPhaseStart(phase Stage)
+
+	// OnPhaseComplete is called as each stage ends, with the error it
+	// failed with, if any
+	OnPhaseComplete(phase Stage, err error)
+
+	// OnLogLine is called with each line of output from the chroot
+	OnLogLine(phase Stage, line string)
+}
+
+// NullListener ignores every build event, and is used when no listener is set
+type NullListener struct{}
+
+// OnPhaseStart does nothing
+func (NullListener) OnPhaseStart(phase Stage) {}
+
+// OnPhaseComplete does nothing
+func (NullListener) OnPhaseComplete(phase Stage, err error) {}
+
+// OnLogLine does nothing
+func (NullListener) OnLogLine(phase Stage, line string) {}
+
+// attachListener will forward the stages of the timer, and every line of the
+// output, to the listener. The output may be nil when it is passed straight
+// through to the terminal, in which case no lines are forwarded.
+func attachListener(l BuildListener, timer *StageTimer, output *OutputLogger) {
+	var lock sync.Mutex
+	current := StageActivate
+	timer.OnStart(func(s Stage) {
+		lock.Lock()
+		current = s
+		lock.Unlock()
+		l.OnPhaseStart(s)
+	})
+	timer.OnComplete(l.OnPhaseComplete)
+	if output == nil {
+		return
+	}
+	output.OnLine(func(line string) {
+		lock.Lock()
+		s := current
+		lock.Unlock()
+		l.OnLogLine(s, line)
+	})
+}
@@ -0,0 +1,115 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingListener records every event it is told of
+type recordingListener struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recordingListener) record(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingListener) OnPhaseStart(phase Stage) {
+	r.record("start " + phase.String())
+}
+
+func (r *recordingListener) OnPhaseComplete(phase Stage, err error) {
+	r.record(fmt.Sprintf("complete %s %v", phase, err))
+}
+
+func (r *recordingListener) OnLogLine(phase Stage, line string) {
+	r.record(fmt.Sprintf("line %s %s", phase, line))
+}
+
+func TestAttachListener(t *testing.T) {
+	l := &recordingListener{}
+	timer := NewStageTimer()
+	output := NewOutputLogger(nil)
+	attachListener(l, timer, output)
+
+	w := output.Writer(ioutil.Discard)
+	timer.Start(StageFetch)
+	w.Write([]byte("fetching\n"))
+	timer.Start(StageBuild)
+	w.Write([]byte("make: *** Error 1\n"))
+	timer.Fail(errors.New("build failed"))
+
+	expected := []string{
+		"start fetch",
+		"line fetch fetching",
+		"complete fetch <nil>",
+		"start build",
+		"line build make: *** Error 1",
+		"complete build build failed",
+	}
+	if strings.Join(l.events, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected events:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(l.events, "\n"))
+	}
+}
+
+func TestWebhookListener(t *testing.T) {
+	var lock sync.Mutex
+	var events []*BuildEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &BuildEvent{}
+		if err := json.NewDecoder(r.Body).Decode(e); err != nil {
+			t.Errorf("Invalid event: %s", err)
+		}
+		lock.Lock()
+		events = append(events, e)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	l := NewWebhookListener(server.URL, "nano")
+	l.OnPhaseStart(StageBuild)
+	l.OnLogLine(StageBuild, "make")
+	l.OnPhaseComplete(StageBuild, errors.New("build failed\n"))
+	l.Close()
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, event := range []string{WebhookEventPhaseStart, WebhookEventLogLine, WebhookEventPhaseComplete} {
+		if events[i].Event != event || events[i].Phase != "build" || events[i].Package != "nano" {
+			t.Errorf("Expected %s event for the build of nano, got %+v", event, events[i])
+		}
+	}
+	if events[1].Line != "make" {
+		t.Errorf("Expected the log line 'make', got '%s'", events[1].Line)
+	}
+	if e := events[2]; e.Success == nil || *e.Success || e.Error != "build failed" {
+		t.Errorf("Expected an unsuccessful phase_complete, got %+v", e)
+	}
+}
@@ -0,0 +1,128 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrImageNameMismatch is returned when installing a local image file
+	// named for a different image than that of the profile
+	ErrImageNameMismatch = errors.New("The image file does not match the profile")
+
+	// ErrImageChecksum is returned when a local image file does not match the
+	// sha256sum beside it
+	ErrImageChecksum = errors.New("The image file failed verification")
+
+	// localHashSuffixes are the extensions of a sha256sum of a local image
+	// file, kept beside it
+	localHashSuffixes = []string{".sha256sum", ImageHashSuffix}
+)
+
+// verifyLocalHash will check the file against the first of the hash files
+// that exists, if any
+func verifyLocalHash(path string, hashFiles ...string) error {
+	for _, hashFile := range hashFiles {
+		if !PathExists(hashFile) {
+			continue
+		}
+		b, err := ioutil.ReadFile(hashFile)
+		if err != nil {
+			return err
+		}
+		expected, err := parseImageHash(hashFile, b)
+		if err != nil {
+			return err
+		}
+		log.Infof("Verifying %s against %s\n", filepath.Base(path), filepath.Base(hashFile))
+		sum, err := FileSha256sum(path)
+		if err != nil {
+			return fmt.Errorf("Failed to hash %s, reason: %s\n", path, err)
+		}
+		if sum != expected {
+			return fmt.Errorf("%s: %s has sha256 %s, expected %s from %s", ErrImageChecksum, filepath.Base(path), sum, expected, filepath.Base(hashFile))
+		}
+		return nil
+	}
+	log.Warnf("No sha256sum found beside %s, it cannot be verified\n", path)
+	return nil
+}
+
+// InstallLocal will install the image from a local file rather than
+// downloading it, i.e. for machines without network access. The file must be
+// named for the image, as either a compressed .img.xz or a plain .img, and is
+// verified against a sha256sum beside it when there is one. The file itself
+// is left in place.
+func (b *BackingImage) InstallLocal(path string) error {
+	if b.IsInstalled() {
+		return ErrImageExists
+	}
+	compressed := false
+	switch filepath.Base(path) {
+	case b.Name + ImageCompressedSuffix:
+		compressed = true
+	case b.Name + ImageSuffix:
+	default:
+		return fmt.Errorf("%s: expected %s%s or %s%s, got %s", ErrImageNameMismatch, b.Name, ImageCompressedSuffix, b.Name, ImageSuffix, filepath.Base(path))
+	}
+	if st, err := os.Stat(path); err != nil {
+		return err
+	} else if st.IsDir() {
+		return fmt.Errorf("Not an image file: %s", path)
+	}
+
+	var hashFiles []string
+	for _, suffix := range localHashSuffixes {
+		hashFiles = append(hashFiles, path+suffix)
+	}
+	if err := verifyLocalHash(path, hashFiles...); err != nil {
+		return err
+	}
+
+	if compressed {
+		log.Infof("Decompressing %s\n", path)
+		if err := decompressImageTo(path, b.ImagePath); err != nil {
+			return err
+		}
+		// The published sha256sum is that of the decompressed image
+		published := strings.TrimSuffix(path, ".xz") + ImageHashSuffix
+		if PathExists(published) {
+			if err := verifyLocalHash(b.ImagePath, published); err != nil {
+				os.Remove(b.ImagePath)
+				return err
+			}
+		}
+	} else {
+		log.Infof("Copying %s\n", path)
+		if err := reflinkFile(path, b.ImagePath); err != nil {
+			log.Debugf("Unable to reflink image, copying instead: %s\n", err)
+			if err := commands.ExecStdoutArgs("cp", []string{"--reflink=auto", path, b.ImagePath}); err != nil {
+				os.Remove(b.ImagePath)
+				return fmt.Errorf("Failed to copy image %s, reason: %s\n", path, err)
+			}
+		}
+	}
+	return b.WriteStamp()
+}
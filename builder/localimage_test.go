@@ -0,0 +1,106 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testLocalImage will write a fake image and return it along with an
+// uninstalled image to install it as
+func testLocalImage(t *testing.T) (*BackingImage, string, []byte) {
+	dir := t.TempDir()
+	images := filepath.Join(dir, "images")
+	if err := os.Mkdir(images, 00755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("not really an ext4 image")
+	src := filepath.Join(dir, "main-x86_64"+ImageSuffix)
+	if err := ioutil.WriteFile(src, data, 00644); err != nil {
+		t.Fatal(err)
+	}
+	b := &BackingImage{
+		Name:      "main-x86_64",
+		ImagePath: filepath.Join(images, "main-x86_64"+ImageSuffix),
+		StampPath: filepath.Join(images, "main-x86_64"+StampSuffix),
+	}
+	return b, src, data
+}
+
+func TestInstallLocal(t *testing.T) {
+	b, src, data := testLocalImage(t)
+	sum := fmt.Sprintf("%x  main-x86_64.img\n", sha256.Sum256(data))
+	ioutil.WriteFile(src+".sha256sum", []byte(sum), 00644)
+	if err := b.InstallLocal(src); err != nil {
+		t.Fatalf("Failed to install local image: %v", err)
+	}
+	if got, err := ioutil.ReadFile(b.ImagePath); err != nil || string(got) != string(data) {
+		t.Fatalf("Image was not copied, got %q %v", got, err)
+	}
+	if b.LastUpdated().IsZero() {
+		t.Fatal("No freshness stamp was recorded")
+	}
+	if !PathExists(src) {
+		t.Fatal("The local image should be left in place")
+	}
+	if err := b.InstallLocal(src); err != ErrImageExists {
+		t.Fatalf("Expected an installed image to be refused, got: %v", err)
+	}
+}
+
+func TestInstallLocalCompressed(t *testing.T) {
+	b, src, data := testLocalImage(t)
+	// The published hash is that of the decompressed image
+	ioutil.WriteFile(src+ImageHashSuffix, []byte(fmt.Sprintf("%x\n", sha256.Sum256(data))), 00644)
+	if err := exec.Command("xz", "--keep", src).Run(); err != nil {
+		t.Fatalf("Failed to compress image: %v", err)
+	}
+	if err := b.InstallLocal(src + ".xz"); err != nil {
+		t.Fatalf("Failed to install compressed image: %v", err)
+	}
+	if got, err := ioutil.ReadFile(b.ImagePath); err != nil || string(got) != string(data) {
+		t.Fatalf("Image was not decompressed, got %q %v", got, err)
+	}
+	if !PathExists(src + ".xz") {
+		t.Fatal("The compressed image should be left in place")
+	}
+}
+
+func TestInstallLocalInvalid(t *testing.T) {
+	b, src, _ := testLocalImage(t)
+	other := filepath.Join(filepath.Dir(src), "unstable-x86_64"+ImageSuffix)
+	os.Rename(src, other)
+	if err := b.InstallLocal(other); err == nil || !strings.HasPrefix(err.Error(), ErrImageNameMismatch.Error()) {
+		t.Fatalf("Expected a mismatched name to fail, got: %v", err)
+	}
+	os.Rename(other, src)
+
+	ioutil.WriteFile(src+".sha256sum", []byte(strings.Repeat("0", 64)+"\n"), 00644)
+	if err := b.InstallLocal(src); err == nil || !strings.HasPrefix(err.Error(), ErrImageChecksum.Error()) {
+		t.Fatalf("Expected a bad checksum to fail, got: %v", err)
+	}
+	if b.IsInstalled() {
+		t.Fatal("An image failing verification should not be installed")
+	}
+}
@@ -0,0 +1,183 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLogArchiveKeep is how many archived logs are kept for each package
+const DefaultLogArchiveKeep = 10
+
+var (
+	// ErrInvalidLogCompression is returned for an unknown log compression
+	ErrInvalidLogCompression = errors.New("Invalid log compression")
+
+	// LogArchiveDir is where the logs of failed builds are archived, within a
+	// directory for each package. Logs are not archived when it is empty.
+	LogArchiveDir string
+
+	// LogArchiveCompression compresses archived logs, with gzip or zstd
+	LogArchiveCompression = "gzip"
+
+	// LogArchiveKeep is the most archived logs kept for each package
+	LogArchiveKeep = DefaultLogArchiveKeep
+
+	// DeleteSuccessfulLogs removes the log of a build once it has succeeded
+	DeleteSuccessfulLogs bool
+
+	// logCompressionSuffixes are the supported compressions, and the suffix
+	// of the archives they produce
+	logCompressionSuffixes = map[string]string{
+		"gzip": ".log.gz",
+		"zstd": ".log.zst",
+	}
+)
+
+// ValidateLogCompression will ensure the log compression is supported
+func ValidateLogCompression(compression string) error {
+	if _, ok := logCompressionSuffixes[compression]; !ok {
+		return fmt.Errorf("%s: %s, expected gzip or zstd", ErrInvalidLogCompression, compression)
+	}
+	return nil
+}
+
+// logArchiveName will name the archived log of a build of the package,
+// i.e. nano-5.8-151-unstable-x86_64-20210601T100000Z.log.gz
+func logArchiveName(pkg *Package, profile string, when time.Time, compression string) string {
+	return fmt.Sprintf("%s-%s-%d-%s-%s%s", pkg.Name, pkg.Version, pkg.Release, profile, when.UTC().Format("20060102T150405Z"), logCompressionSuffixes[compression])
+}
+
+// ArchiveLog will compress the log into dir under the given name, and then
+// remove the log itself. Only the newest keep archives in dir are kept.
+func ArchiveLog(path, dir, name, compression string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return "", fmt.Errorf("Failed to create log archive directory %s, reason: %s\n", dir, err)
+	}
+	dest := filepath.Join(dir, name)
+	if err := compressLog(path, dest, compression); err != nil {
+		os.Remove(dest)
+		return "", fmt.Errorf("Failed to compress build log %s, reason: %s\n", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Warnf("Failed to remove archived build log %s, reason: %s\n", path, err)
+	}
+	if err := pruneLogArchives(dir, keep); err != nil {
+		log.Warnf("Failed to prune archived build logs in %s, reason: %s\n", dir, err)
+	}
+	return dest, nil
+}
+
+// compressLog will write the compressed contents of src to dst
+func compressLog(src, dst, compression string) error {
+	switch compression {
+	case "zstd":
+		if out, err := exec.Command("zstd", "-q", "-f", "-o", dst, src).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	case "gzip":
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		gz := gzip.NewWriter(out)
+		gz.Name = filepath.Base(src)
+		if _, err = io.Copy(gz, in); err != nil {
+			return err
+		}
+		if err = gz.Close(); err != nil {
+			return err
+		}
+		return out.Close()
+	default:
+		return ValidateLogCompression(compression)
+	}
+}
+
+// pruneLogArchives will remove all but the newest keep archived logs in dir
+func pruneLogArchives(dir string, keep int) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var archives []os.FileInfo
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && strings.Contains(entry.Name(), ".log.") {
+			archives = append(archives, entry)
+		}
+	}
+	if len(archives) <= keep {
+		return nil
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ModTime().After(archives[j].ModTime())
+	})
+	for _, old := range archives[keep:] {
+		log.Debugf("Removing old build log %s\n", old.Name())
+		if err := os.Remove(filepath.Join(dir, old.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disposeBuildLog will archive the log of a failed build, or remove that of
+// a successful build if requested. The log must already be closed.
+func (m *Manager) disposeBuildLog(result error) {
+	if m.logFile == "" {
+		return
+	}
+	if result == nil {
+		if DeleteSuccessfulLogs {
+			log.Debugf("Removing build log %s\n", m.logFile)
+			if err := os.Remove(m.logFile); err != nil {
+				log.Warnf("Failed to remove build log %s, reason: %s\n", m.logFile, err)
+			}
+			m.logFile = ""
+		}
+		return
+	}
+	if LogArchiveDir == "" {
+		return
+	}
+	name := logArchiveName(m.pkg, m.profile.Name, time.Now(), LogArchiveCompression)
+	dest, err := ArchiveLog(m.logFile, filepath.Join(LogArchiveDir, m.pkg.Name), name, LogArchiveCompression, LogArchiveKeep)
+	if err != nil {
+		log.Warnf("Failed to archive build log, reason: %s\n", err)
+		return
+	}
+	log.Infof("Archived build log to %s\n", dest)
+	m.logFile = dest
+}
@@ -0,0 +1,97 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogArchiveName(t *testing.T) {
+	pkg := &Package{Name: "nano", Version: "5.8", Release: 151}
+	when := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	if name := logArchiveName(pkg, "unstable-x86_64", when, "gzip"); name != "nano-5.8-151-unstable-x86_64-20210601T100000Z.log.gz" {
+		t.Fatalf("Unexpected archive name: %s", name)
+	}
+	if name := logArchiveName(pkg, "unstable-x86_64", when, "zstd"); name != "nano-5.8-151-unstable-x86_64-20210601T100000Z.log.zst" {
+		t.Fatalf("Unexpected archive name: %s", name)
+	}
+	if err := ValidateLogCompression("bzip2"); err == nil {
+		t.Fatal("Expected bzip2 to be rejected")
+	}
+}
+
+func TestArchiveLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-logarchive")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "archive", "nano")
+	if err := os.MkdirAll(archive, 00755); err != nil {
+		t.Fatalf("Failed to create archive directory: %v", err)
+	}
+	// Older archives, the oldest of which must be pruned
+	for i := 0; i < 2; i++ {
+		old := filepath.Join(archive, fmt.Sprintf("nano-5.7-%d-unstable-x86_64-20210101T000000Z.log.gz", 149+i))
+		if err := ioutil.WriteFile(old, nil, 00644); err != nil {
+			t.Fatalf("Failed to write old archive: %v", err)
+		}
+		mtime := time.Now().Add(time.Duration(i-2) * time.Hour)
+		if err := os.Chtimes(old, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+
+	logPath := filepath.Join(dir, "nano.log")
+	if err := ioutil.WriteFile(logPath, []byte("[    1.000s build] make: *** [all] Error 2\n"), 00644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	dest, err := ArchiveLog(logPath, archive, "nano-5.8-151-unstable-x86_64-20210601T100000Z.log.gz", "gzip", 2)
+	if err != nil {
+		t.Fatalf("Failed to archive log: %v", err)
+	}
+	if PathExists(logPath) {
+		t.Fatal("The log was not removed once archived")
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Archive is not gzip compressed: %v", err)
+	}
+	if b, _ := ioutil.ReadAll(gz); string(b) != "[    1.000s build] make: *** [all] Error 2\n" {
+		t.Fatalf("Wrong archive contents: %q", b)
+	}
+
+	entries, _ := ioutil.ReadDir(archive)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 archives to be kept, got %d", len(entries))
+	}
+	if PathExists(filepath.Join(archive, "nano-5.7-149-unstable-x86_64-20210101T000000Z.log.gz")) {
+		t.Fatal("The oldest archive was not pruned")
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 // DisableColors controls whether or not to use colours in the display.
@@ -30,6 +33,21 @@ var DisableColors bool
 // Controls whether or not we generate an ABI report.
 var DisableABIReport bool
 
+// FetchRetries is the maximum number of attempts made to fetch each source
+var FetchRetries = DefaultFetchRetries
+
+// PackageRetries is the maximum number of attempts made for package manager
+// operations that fail due to the network
+var PackageRetries = DefaultPackageRetries
+
+// PackageBackoff is the delay before the first retry of a package manager
+// operation, which doubles with each following attempt
+var PackageBackoff = 5 * time.Second
+
+// FetchBackoff is the delay before the first retry of a failed fetch, which
+// doubles with each following attempt
+var FetchBackoff = time.Second
+
 const (
 	// ImagesDir is where we keep the rootfs images for build profiles
 	ImagesDir = "/var/lib/solbuild/images"
@@ -40,11 +58,25 @@ const (
 	// ImageCompressedSuffix is the common suffix for a fetched evobuild image
 	ImageCompressedSuffix = ".img.xz"
 
+	// ImageHashSuffix is appended to the image name for its published sha256sum
+	ImageHashSuffix = ".sha256"
+
 	// ImageBaseURI is the storage area for base images
 	ImageBaseURI = "https://getsol.us/solbuild"
 
 	// ImageRootsDir is where updates are performed on base images
 	ImageRootsDir = "/var/lib/solbuild/roots"
+
+	// DefaultFetchRetries is the default number of attempts to fetch a source
+	DefaultFetchRetries = 3
+
+	// DefaultPackageRetries is the default number of attempts for package
+	// manager operations that fail due to the network
+	DefaultPackageRetries = 3
+
+	// ComponentSearchDepth is how many parent directories of the recipe are
+	// searched for a component.xml
+	ComponentSearchDepth = 3
 )
 
 const (
@@ -102,6 +134,9 @@ func PathExists(path string) bool {
 
 // IsValidImage will check if the specified profile is a valid one.
 func IsValidImage(profile string) bool {
+	if IsClonedImage(profile) {
+		return true
+	}
 	for _, p := range ValidImages {
 		if p == profile {
 			return true
@@ -134,8 +169,17 @@ func EmitProfileError(p string) {
 		return
 	}
 
+	names := make([]string, 0, len(profiles))
 	for key := range profiles {
-		fmt.Fprintf(os.Stderr, " * %v\n", key)
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		if aliases := AliasesOf(key); len(aliases) > 0 {
+			fmt.Fprintf(os.Stderr, " * %v (%v)\n", key, strings.Join(aliases, ", "))
+		} else {
+			fmt.Fprintf(os.Stderr, " * %v\n", key)
+		}
 	}
 }
 
@@ -145,8 +189,11 @@ type BackingImage struct {
 	ImagePath   string // Absolute path to the .img file
 	ImagePathXZ string // Absolute path to the .img.xz file
 	ImageURI    string // URI of the image origin
+	HashURI     string // URI of the sha256sum of the uncompressed image
 	RootDir     string // Where to mount the backing image for updates
 	LockPath    string // Our lock path for update operations
+	StampPath   string // Records when the image was last updated
+	HashesPath  string // Records the hashes of the image, for verification
 }
 
 // IsInstalled will determine whether the given backing image has been installed
@@ -168,7 +215,10 @@ func NewBackingImage(name string) *BackingImage {
 		ImagePath:   filepath.Join(ImagesDir, name+ImageSuffix),
 		ImagePathXZ: filepath.Join(ImagesDir, name+ImageCompressedSuffix),
 		ImageURI:    fmt.Sprintf("%s/%s%s", ImageBaseURI, name, ImageCompressedSuffix),
+		HashURI:     fmt.Sprintf("%s/%s%s%s", ImageBaseURI, name, ImageSuffix, ImageHashSuffix),
 		LockPath:    filepath.Join(ImagesDir, name+".lock"),
+		StampPath:   filepath.Join(ImagesDir, name+StampSuffix),
+		HashesPath:  filepath.Join(ImagesDir, name+ImageHashesSuffix),
 		RootDir:     filepath.Join(ImageRootsDir, name),
 	}
 }
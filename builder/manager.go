@@ -18,8 +18,10 @@ package builder
 
 import (
 	"errors"
+	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/disk"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -53,6 +55,15 @@ var (
 	ErrInterrupted = errors.New("The operation was cancelled by the user")
 )
 
+const (
+	// ExitInterrupted is the exit code used after cleaning up from an interrupt
+	ExitInterrupted = 1
+
+	// ExitForced is the exit code used when cleanup is abandoned by a second
+	// interrupt
+	ExitForced = 130
+)
+
 // A Manager is responsible for cleanly managing the entire session within solbuild,
 // i.e. setup, teardown, cleaning up, etc.
 //
@@ -61,31 +72,54 @@ var (
 type Manager struct {
 	Config *Config // Our config from the merged system/vendor configs
 
-	image      *BackingImage // Storage for the overlay
-	overlay    *Overlay      // OverlayFS configuration
-	pkg        *Package      // Current package, if any
-	pkgManager *EopkgManager // Package manager, if any
-	lock       *sync.Mutex   // Lock on all operations to prevent.. damage.
-	profile    *Profile      // The profile we've been requested to use
+	image      *BackingImage  // Storage for the overlay
+	overlay    *Overlay       // OverlayFS configuration, nil for Docker builds
+	pkg        *Package       // Current package, if any
+	builder    Builder        // Builds the current package
+	pkgManager PackageManager // Package manager, if any
+	lock       *sync.Mutex    // Lock on all operations to prevent.. damage.
+	profile    *Profile       // The profile we've been requested to use
 
 	lockfile *LockFile // We track the global lock for each operation
 	didStart bool      // Whether we got anything done.
+	reaper   *Reaper   // Releases everything acquired by the operation
 
 	cancelled  bool // Whether or not we've been cancelled
 	updateMode bool // Whether we're just updating an image
 
+	imageChanged bool          // Whether the image must be hashed again once released
+	directImage  *BackingImage // Clone built in directly, deleted once released
+
 	history *PackageHistory // Given package history, if any
 
 	manifestTarget string // Generate manifest if set
 
+	timer   *StageTimer // Timings for each stage of the build
+	metrics bool        // Whether to write the stage timings to disk
+	reuse   bool        // Whether to reuse a valid existing overlay
+	logFile string      // Path to the build log, if any
+	logSink io.Closer   // The open build log, closed once the build is released
+
+	stageHooks []func(Stage) // Called as each build stage starts
+	listener   BuildListener // Told of each event of the build as it happens
+
 	activePID int // Active PID
 }
 
 // NewManager will return a newly initialised manager instance
 func NewManager() (*Manager, error) {
-	// First things first, setup the namespace
-	if err := ConfigureNamespace(); err != nil {
-		return nil, err
+	// First things first, setup the namespace. Docker builds are isolated
+	// by the container instead, and need not be run as root.
+	if !UseDocker {
+		Sandbox.Warn()
+		if err := ConfigureNamespace(); err != nil {
+			return nil, err
+		}
+	} else if dockerRootless() {
+		if err := useUserSourceCache(); err != nil {
+			log.Errorf("%s\n", err)
+			return nil, err
+		}
 	}
 	man := &Manager{
 		cancelled:  false,
@@ -93,6 +127,7 @@ func NewManager() (*Manager, error) {
 		updateMode: false,
 		lockfile:   nil,
 		didStart:   false,
+		listener:   NullListener{},
 	}
 
 	// Now load the configuration in
@@ -103,6 +138,102 @@ func NewManager() (*Manager, error) {
 		return nil, err
 	}
 
+	if CIMode {
+		HeartbeatInterval = DefaultHeartbeatInterval
+		if man.Config.HeartbeatInterval != "" {
+			interval, err := time.ParseDuration(man.Config.HeartbeatInterval)
+			if err != nil {
+				log.Errorf("Invalid ci_heartbeat_interval %s\n", err)
+				return nil, err
+			}
+			HeartbeatInterval = interval
+		}
+	}
+
+	EnvironmentPassthrough = append(EnvironmentPassthrough, man.Config.EnvPassthrough...)
+
+	if man.Config.Distcc.Enabled {
+		if len(man.Config.Distcc.Hosts) < 1 {
+			log.Errorf("%s\n", ErrNoDistccHosts)
+			return nil, ErrNoDistccHosts
+		}
+		DistccHosts = man.Config.Distcc.Hosts
+	}
+	BindCABundle = man.Config.BindCABundle
+	VerifySources = man.Config.VerifySources
+	if man.Config.XzThreads < 0 {
+		log.Errorf("Invalid xz_threads %d, must not be negative\n", man.Config.XzThreads)
+		return nil, ErrInvalidXzThreads
+	}
+	XzThreads = man.Config.XzThreads
+	if man.Config.PackageRetries > 0 {
+		PackageRetries = man.Config.PackageRetries
+	}
+	if man.Config.UpgradeFreshness != "" {
+		window, err := time.ParseDuration(man.Config.UpgradeFreshness)
+		if err != nil {
+			log.Errorf("Invalid upgrade_freshness %s\n", err)
+			return nil, err
+		}
+		FreshnessWindow = window
+	}
+	if len(man.Config.PolicyRules) > 0 {
+		checker, err := NewDefaultPolicyChecker(man.Config.PolicyRules)
+		if err != nil {
+			log.Errorf("Invalid policy_rules %s\n", err)
+			return nil, err
+		}
+		PolicyCheckers = []PolicyChecker{checker}
+	}
+	if man.Config.DiskUsageInterval != "" {
+		interval, err := time.ParseDuration(man.Config.DiskUsageInterval)
+		if err == nil && interval < 0 {
+			err = ErrInvalidDiskUsageInterval
+		}
+		if err != nil {
+			log.Errorf("Invalid disk_usage_interval %s\n", err)
+			return nil, err
+		}
+		DiskUsageInterval = interval
+	}
+	if man.Config.TmpfsCeiling != "" {
+		ceiling, err := ParseBytes(man.Config.TmpfsCeiling)
+		if err != nil {
+			log.Errorf("Invalid tmpfs_ceiling %s\n", err)
+			return nil, err
+		}
+		TmpfsCeiling = ceiling
+	}
+	if err := ValidateHostname(man.Config.Hostname); err != nil {
+		log.Errorf("%s\n", err)
+		return nil, err
+	}
+	BuildHostname = man.Config.Hostname
+	LogArchiveDir = man.Config.LogArchiveDir
+	DeleteSuccessfulLogs = man.Config.DeleteSuccessfulLogs
+	if man.Config.LogArchiveCompression != "" {
+		if err := ValidateLogCompression(man.Config.LogArchiveCompression); err != nil {
+			log.Errorf("%s\n", err)
+			return nil, err
+		}
+		LogArchiveCompression = man.Config.LogArchiveCompression
+	}
+	if man.Config.LogArchiveKeep > 0 {
+		LogArchiveKeep = man.Config.LogArchiveKeep
+	}
+	if len(man.Config.Aliases) > 0 {
+		profiles, err := GetAllProfiles()
+		if err != nil {
+			log.Errorf("Failed to load profiles %s\n", err)
+			return nil, err
+		}
+		if err := ValidateProfileAliases(man.Config.Aliases, profiles); err != nil {
+			log.Errorf("Invalid aliases in solbuild configuration: %s\n", err)
+			return nil, err
+		}
+		ProfileAliases = man.Config.Aliases
+	}
+
 	man.lock = new(sync.Mutex)
 	return man, nil
 }
@@ -114,6 +245,15 @@ func (m *Manager) SetActivePID(pid int) {
 	m.activePID = pid
 }
 
+// killActive will kill the process group of the active task, if any
+func (m *Manager) killActive() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.activePID > 0 {
+		syscall.Kill(-m.activePID, syscall.SIGKILL)
+	}
+}
+
 // SetManifestTarget will set the manifest target to be used
 // An empty target (default) means no manifest
 func (m *Manager) SetManifestTarget(target string) {
@@ -141,7 +281,8 @@ func (m *Manager) SetProfile(profile string) error {
 		return err
 	}
 
-	if !IsValidImage(prof.Image) {
+	// Profiles that bootstrap their own image may name any image
+	if !IsValidImage(prof.Image) && prof.Bootstrap == nil {
 		EmitImageError(prof.Image)
 		return ErrInvalidImage
 	}
@@ -151,7 +292,11 @@ func (m *Manager) SetProfile(profile string) error {
 	}
 
 	m.profile = prof
-	m.image = NewBackingImage(m.profile.Image)
+	if clone, ok := clonedImages[m.profile.Image]; ok {
+		m.image = clone
+	} else {
+		m.image = NewBackingImage(m.profile.Image)
+	}
 	return nil
 }
 
@@ -172,7 +317,8 @@ func (m *Manager) SetPackage(pkg *Package) error {
 		return ErrManagerInitialised
 	}
 
-	if !m.image.IsInstalled() {
+	// Docker builds have no need of the base image
+	if !UseDocker && !m.image.IsInstalled() {
 		return ErrProfileNotInstalled
 	}
 
@@ -189,9 +335,22 @@ func (m *Manager) SetPackage(pkg *Package) error {
 		}
 	}
 
+	// Nor of an overlay, or the package manager within it
+	if UseDocker {
+		m.pkg = pkg
+		m.builder = NewDockerBuilder(pkg, m.profile)
+		return nil
+	}
+
+	overlay, err := NewOverlay(m.Config, m.profile, m.image, pkg)
+	if err != nil {
+		return err
+	}
+
 	m.pkg = pkg
-	m.overlay = NewOverlay(m.Config, m.profile, m.image, m.pkg)
+	m.overlay = overlay
 	m.pkgManager = NewEopkgManager(m, m.overlay.MountPoint)
+	m.builder = NewOverlayBuilder(pkg, m.profile, m.pkgManager, m.overlay)
 	return nil
 }
 
@@ -224,57 +383,129 @@ func (m *Manager) Cleanup() {
 	defer m.lock.Unlock()
 	log.Debugln("Cleaning up")
 
-	if m.pkgManager != nil {
-		// Potentially unnecessary but meh
-		m.pkgManager.StopDBUS()
-		// Always needed
-		m.pkgManager.Cleanup()
+	// Safe to repeat, anything already released is skipped
+	if err := m.reaper.Reap(); err != nil {
+		log.Errorf("Cleanup incomplete, reason: %s\n", err)
+		if m.logSink != nil && ChrootOutput != nil {
+			ChrootOutput.Annotate("solbuild", fmt.Sprintf("Cleanup incomplete, reason: %s", strings.TrimSpace(err.Error())))
+		}
 	}
+}
 
-	deathPoint := ""
-	if m.overlay != nil {
-		deathPoint = m.overlay.MountPoint
+// finishBuild will release everything acquired by the build before closing
+// the build log, so that the log also records any failure to clean up, and
+// then archive or remove the log
+func (m *Manager) finishBuild(result error) {
+	m.Cleanup()
+	if m.logSink == nil {
+		return
 	}
-	if m.updateMode {
-		deathPoint = m.image.RootDir
-	}
-
-	// Try to kill the active root PID first
-	if m.activePID > 0 {
-		syscall.Kill(-m.activePID, syscall.SIGKILL)
-		time.Sleep(2 * time.Second)
-		syscall.Kill(-m.activePID, syscall.SIGKILL)
-		m.activePID = 0
+	if result != nil && ChrootOutput != nil {
+		ChrootOutput.Annotate("solbuild", fmt.Sprintf("Build failed: %s", strings.TrimSpace(result.Error())))
 	}
+	m.logSink.Close()
+	m.logSink = nil
+	m.disposeBuildLog(result)
+}
 
-	// Still might have *something* alive in there, kill it with fire.
-	if deathPoint != "" {
-		for i := 0; i < 10; i++ {
+// newReaper will register everything the current operation may acquire, in
+// the order it must be released
+func (m *Manager) newReaper() *Reaper {
+	r := NewReaper()
+	r.Add("package manager", func() error {
+		if m.pkgManager != nil {
+			// Potentially unnecessary but meh
+			m.pkgManager.StopDBUS()
+			// Always needed
+			m.pkgManager.Cleanup()
+		}
+		return nil
+	})
+	r.Add("processes", func() error {
+		// Try to kill the active root PID first
+		if m.activePID > 0 {
+			syscall.Kill(-m.activePID, syscall.SIGKILL)
+			time.Sleep(2 * time.Second)
+			syscall.Kill(-m.activePID, syscall.SIGKILL)
+			m.activePID = 0
+		}
+		// Still might have *something* alive in there, kill it with fire.
+		if deathPoint := m.deathPoint(); deathPoint != "" {
+			for i := 0; i < 10; i++ {
+				MurderDeathKill(deathPoint)
+			}
+		}
+		return nil
+	})
+	r.Add("root", func() error {
+		if m.pkg != nil && m.overlay != nil {
+			m.pkg.DeactivateRoot(m.overlay)
+		}
+		// Deactivation may have started something off, kill them too
+		if deathPoint := m.deathPoint(); deathPoint != "" {
 			MurderDeathKill(deathPoint)
 		}
-	}
-
-	if m.pkg != nil {
-		m.pkg.DeactivateRoot(m.overlay)
-	}
-
-	// Deactivation may have started something off, kill them too
-	if deathPoint != "" {
-		MurderDeathKill(deathPoint)
-	}
-
-	// Unmount anything we may have mounted
-	disk.GetMountManager().UnmountAll()
-
-	// Finally clean out the lock files
-	if m.lockfile != nil {
+		return nil
+	})
+	r.Add("mounts", func() error {
+		// Unmount anything we may have mounted
+		disk.GetMountManager().UnmountAll()
+		// Catch anything still mounted, such as busy mounts or those made
+		// from within the chroot
+		if teardownPoint := m.teardownPoint(); teardownPoint != "" {
+			return UnmountTree(teardownPoint)
+		}
+		return nil
+	})
+	r.Add("cloned image", func() error {
+		if m.directImage == nil {
+			return nil
+		}
+		err := m.directImage.Delete()
+		m.directImage = nil
+		return err
+	})
+	r.Add("distcc forwarding", func() error {
+		StopDistccProxy()
+		return nil
+	})
+	r.Add("binfmt_misc", RestoreBinfmt)
+	r.Add("image hash", func() error {
+		// Only hash the image once it is no longer mounted, while still locked
+		if !m.imageChanged {
+			return nil
+		}
+		if mounts, err := ActiveMountsUnder(m.image.RootDir); err != nil || len(mounts) > 0 {
+			return fmt.Errorf("Not hashing image %s as it may still be mounted\n", m.image.Name)
+		}
+		m.imageChanged = false
+		return m.image.RecordHash(false)
+	})
+	r.Add("lockfile", func() error {
+		// Finally clean out the lock files
+		if m.lockfile == nil {
+			return nil
+		}
 		if err := m.lockfile.Unlock(); err != nil {
-			log.Errorf("Failure in unlocking root %s\n", err)
+			return fmt.Errorf("Failure in unlocking root %s\n", err)
 		}
 		if err := m.lockfile.Clean(); err != nil {
-			log.Errorf("Failure in cleaning lockfile %s\n", err)
+			return fmt.Errorf("Failure in cleaning lockfile %s\n", err)
 		}
+		return nil
+	})
+	return r
+}
+
+// deathPoint returns the root under which any remaining processes are killed
+func (m *Manager) deathPoint() string {
+	if m.updateMode {
+		return m.image.RootDir
 	}
+	if m.overlay != nil {
+		return m.overlay.MountPoint
+	}
+	return ""
 }
 
 // doLock will handle the relevant locking operation for the given path
@@ -296,26 +527,62 @@ func (m *Manager) doLock(path, opType string) error {
 		return err
 	}
 	m.didStart = true
+	m.reaper = m.newReaper()
 	return nil
 }
 
+// teardownPoint returns the directory beneath which everything mounted for
+// the current operation lives
+func (m *Manager) teardownPoint() string {
+	if m.updateMode {
+		return m.image.RootDir
+	}
+	if m.overlay != nil {
+		return m.overlay.BaseDir
+	}
+	return ""
+}
+
 // SigIntCleanup will take care of cleaning up the build process.
+// The first SIGINT or SIGTERM starts a graceful cleanup, and a second one
+// abandons it, reporting any mounts that may have been left behind.
 func (m *Manager) SigIntCleanup() {
-	ch := make(chan os.Signal, 1)
+	ch := make(chan os.Signal, 2)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-ch
-		log.Warnln("CTRL+C interrupted, cleaning up")
+		log.Warnln("Interrupt received, cleaning up (press Ctrl-C again to force quit)")
+		go func() {
+			<-ch
+			m.forceQuit()
+		}()
 		m.SetCancelled()
 		m.Cleanup()
 		log.Errorln("Exiting due to interruption")
-		os.Exit(1)
+		os.Exit(ExitInterrupted)
 	}()
 }
 
+// forceQuit will exit immediately without finishing cleanup
+func (m *Manager) forceQuit() {
+	log.Errorln("Cleanup abandoned, exiting immediately")
+	if root := m.teardownPoint(); root != "" {
+		mounts, err := ActiveMountsUnder(root)
+		if err != nil {
+			log.Errorf("Unable to determine remaining mounts, reason: %s\n", err)
+		} else if len(mounts) > 0 {
+			log.Warnln("The following mounts may have been left behind:")
+			for _, mount := range mounts {
+				log.Warnf("    %s\n", mount)
+			}
+		}
+	}
+	os.Exit(ExitForced)
+}
+
 // Build will attempt to build the package associated with this manager,
 // automatically handling any required cleanups.
-func (m *Manager) Build() error {
+func (m *Manager) Build() (err error) {
 	if m.IsCancelled() {
 		return ErrInterrupted
 	}
@@ -328,18 +595,200 @@ func (m *Manager) Build() error {
 	m.lock.Unlock()
 
 	// Now get on with the real work!
-	defer m.Cleanup()
+	defer func() { m.finishBuild(err) }()
 	m.SigIntCleanup()
+	m.applyPackageOptions()
+	m.sizeTmpfs()
 
-	// Now set our options according to the config
-	m.overlay.EnableTmpfs = m.Config.EnableTmpfs
-	m.overlay.TmpfsSize = m.Config.TmpfsSize
+	if m.overlay != nil {
+		// Now set our options according to the config
+		m.overlay.EnableTmpfs = m.Config.EnableTmpfs
+		m.overlay.TmpfsSize = m.Config.TmpfsSize
+		m.overlay.Incremental = m.reuse
+
+		if err := m.doLock(m.overlay.LockPath, "building"); err != nil {
+			return err
+		}
+		if !Isolation.UsesOverlay() {
+			if err := m.cloneDirectImage(); err != nil {
+				return err
+			}
+		}
+	} else {
+		// Docker builds share nothing on the host that must be locked
+		m.didStart = true
+		m.reaper = m.newReaper()
+	}
+
+	start := time.Now()
+	m.timer = NewStageTimer()
+	m.logSink = m.openBuildLog()
+	banner := fmt.Sprintf("solbuild %s", GetVersionInfo())
+	log.Infoln(banner)
+	if ChrootOutput != nil {
+		ChrootOutput.Annotate("solbuild", banner)
+		if BuildID != "" {
+			ChrootOutput.Annotate("solbuild", "build_id="+BuildID)
+		}
+	}
+	for _, fn := range m.stageHooks {
+		m.timer.OnStart(fn)
+	}
+	attachListener(m.listener, m.timer, ChrootOutput)
+	sampler := m.sampleDiskUsage()
+	watchdog := newPhaseWatchdog(PhaseTimeouts, m.killActive)
+	m.timer.OnStart(watchdog.Start)
+	if CIMode {
+		sections := NewCISections()
+		m.timer.OnStart(sections.Start)
+		defer sections.End()
+	}
+	err = m.runHooks(PreBuildHooksDir, nil, false)
+	if err == nil {
+		err = m.builder.Build(m, m.history, m.manifestTarget, m.timer)
+	}
+	watchdog.Stop()
+	if sampler != nil {
+		sampler.Stop()
+	}
+	err = watchdog.Wrap(err)
+	m.runHooks(PostBuildHooksDir, err, true)
+	if c, ok := m.listener.(io.Closer); ok {
+		c.Close()
+	}
+	m.report()
+	if m.pkgManager != nil && m.pkgManager.HasExtras() {
+		log.Warnln("This build used extra packages that are not declared as build dependencies")
+	}
+	m.notify(time.Since(start), err)
+	m.recordBuild(start, err)
+	return err
+}
 
-	if err := m.doLock(m.overlay.LockPath, "building"); err != nil {
+// runHooks will run the hooks within dir on the host. Output is sent through
+// the build log when one is in use.
+func (m *Manager) runHooks(dir string, result error, post bool) error {
+	if DisableHooks {
+		return nil
+	}
+	hooks, err := FindHooks(dir)
+	if err != nil {
+		log.Errorf("Failed to read hooks directory %s, reason: %s\n", dir, err)
+		if post {
+			return nil
+		}
 		return err
 	}
+	if len(hooks) < 1 {
+		return nil
+	}
+	outputDir, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("Unable to find working directory, reason: %s\n", err)
+	}
+	env := HookEnvironment(m.pkg, m.GetProfile(), outputDir, result, post)
+	stdout, stderr, flush := hookOutput("hook")
+	defer flush()
+	return RunHooks(hooks, env, stdout, stderr, !post)
+}
 
-	return m.pkg.Build(m, m.history, m.GetProfile(), m.pkgManager, m.overlay, m.manifestTarget)
+// openBuildLog will set up the prefixed chroot output, along with the log
+// file that it will be copied to.
+func (m *Manager) openBuildLog() io.Closer {
+	if RawOutput {
+		return nil
+	}
+	var f *os.File
+	if path := m.buildLogPath(); path == "" {
+		log.Debugln("Not writing a build log, as only root may write to the overlay root directory")
+	} else {
+		removeStaleLogs(filepath.Dir(path))
+		var err error
+		if f, err = os.Create(path); err != nil {
+			log.Warnf("Failed to create build log %s, reason: %s\n", path, err)
+		}
+	}
+	if f == nil {
+		ChrootOutput = NewOutputLogger(nil)
+	} else {
+		log.Debugf("Writing build log to %s\n", f.Name())
+		m.logFile = f.Name()
+		ChrootOutput = NewOutputLogger(f)
+	}
+	m.timer.OnStart(func(s Stage) {
+		ChrootOutput.SetTag(s.String())
+	})
+	if f == nil {
+		return nil
+	}
+	return f
+}
+
+// buildLogPath will return where the log of this build is written, i.e.
+// /var/cache/solbuild/unstable-x86_64/.logs/nano/nano-<build-id>.build.log,
+// or an empty string for a Docker build without root
+func (m *Manager) buildLogPath() string {
+	if dockerRootless() {
+		return ""
+	}
+	name := fmt.Sprintf("%s.build.log", m.pkg.Name)
+	if BuildID != "" {
+		name = fmt.Sprintf("%s-%s.build.log", m.pkg.Name, BuildID)
+	}
+	return filepath.Join(m.Config.OverlayRootDir, m.profile.Name, BuildLogDir, m.pkg.Name, name)
+}
+
+// removeStaleLogs will remove the logs of earlier builds of the package from
+// dir, so that only the log of the latest build is kept, creating dir if need
+// be. Failed builds may be archived to LogArchiveDir instead.
+func removeStaleLogs(dir string) {
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		log.Warnf("Failed to create build log directory %s, reason: %s\n", dir, err)
+		return
+	}
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.build.log"))
+	for _, path := range logs {
+		log.Debugf("Removing previous build log %s\n", path)
+		if err := os.Remove(path); err != nil {
+			log.Warnf("Failed to remove previous build log %s, reason: %s\n", path, err)
+		}
+	}
+}
+
+// report will print the stage timings of the build, and write them to the
+// output directory if requested.
+func (m *Manager) report() {
+	if !QuietOutput {
+		fmt.Println()
+		m.timer.WriteSummary(os.Stdout)
+	}
+	if !m.metrics {
+		return
+	}
+	// $source-$version-$release.metrics.json
+	path, err := filepath.Abs(fmt.Sprintf("%s-%s-%d%s", m.pkg.Name, m.pkg.Version, m.pkg.Release, MetricsSuffix))
+	if err != nil {
+		log.Errorf("Unable to find working directory, reason: %s\n", err)
+		return
+	}
+	if err := m.timer.WriteJSON(path); err != nil {
+		log.Errorf("Failed to write build metrics %s, reason: %s\n", path, err)
+		return
+	}
+	usr := GetUserInfo()
+	if err := os.Chown(path, usr.UID, usr.GID); err != nil {
+		log.Errorf("Error in restoring file ownership %s, reason: %s\n", filepath.Base(path), err)
+	}
+}
+
+// notify will inform any configured webhooks of the build result
+func (m *Manager) notify(duration time.Duration, err error) {
+	if !m.Config.EnableNotify || len(m.Config.Webhooks) < 1 {
+		return
+	}
+	n := NewBuildNotification(m.pkg, m.GetProfile(), duration, err)
+	n.LogFile = m.logFile
+	NotifyWebhooks(m.Config.Webhooks, n)
 }
 
 // Chroot will enter the build environment to allow users to introspect it
@@ -366,6 +815,41 @@ func (m *Manager) Chroot() error {
 	return m.pkg.Chroot(m, m.pkgManager, m.overlay)
 }
 
+// Export will activate the root of the current package and write it out to
+// destPath as a gzip compressed tarball, owned by the invoking user
+func (m *Manager) Export(destPath string) error {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+
+	m.lock.Lock()
+	if m.pkg == nil {
+		m.lock.Unlock()
+		return ErrNoPackage
+	}
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.overlay.LockPath, "export"); err != nil {
+		return err
+	}
+	if err := m.pkg.ActivateRoot(m.overlay); err != nil {
+		return err
+	}
+
+	log.Infof("Exporting build root of %s to %s\n", m.pkg.Name, destPath)
+	if err := m.overlay.ExportToTar(destPath); err != nil {
+		return err
+	}
+	usr := GetUserInfo()
+	if err := os.Chown(destPath, usr.UID, usr.GID); err != nil {
+		log.Errorf("Error in restoring file ownership %s, reason: %s\n", destPath, err)
+	}
+	return nil
+}
+
 // Update will attempt to update the base image
 func (m *Manager) Update() error {
 	if m.IsCancelled() {
@@ -391,7 +875,156 @@ func (m *Manager) Update() error {
 		return err
 	}
 
-	return m.image.Update(m, m.pkgManager)
+	if err := m.image.Update(m, m.pkgManager); err != nil {
+		return err
+	}
+	m.imageChanged = true
+	return nil
+}
+
+// Rollback will revert the most recent upgrade of the current profile
+func (m *Manager) Rollback() error {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return ErrInvalidProfile
+	}
+	if !m.image.IsInstalled() {
+		m.lock.Unlock()
+		return ErrProfileNotInstalled
+	}
+	m.updateMode = true
+	m.pkgManager = NewEopkgManager(m, m.image.RootDir)
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "rolling back"); err != nil {
+		return err
+	}
+
+	if err := m.image.Rollback(m, m.pkgManager); err != nil {
+		return err
+	}
+	m.imageChanged = true
+	return nil
+}
+
+// VerifyImage will check the installed image of the current profile for
+// corruption
+func (m *Manager) VerifyImage() (*ImageReport, error) {
+	if m.IsCancelled() {
+		return nil, ErrInterrupted
+	}
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return nil, ErrInvalidProfile
+	}
+	if !m.image.IsInstalled() {
+		m.lock.Unlock()
+		return nil, ErrProfileNotInstalled
+	}
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "verifying"); err != nil {
+		return nil, err
+	}
+	if mounts, err := ActiveMountsUnder(m.image.RootDir); err != nil {
+		return nil, err
+	} else if len(mounts) > 0 {
+		return nil, fmt.Errorf("%s: %s", ErrProfileMounted, strings.Join(mounts, ", "))
+	}
+	return m.image.Verify()
+}
+
+// Bootstrap will build the image of the current profile from scratch, as
+// described by the profile. Nothing is left behind if it fails.
+func (m *Manager) Bootstrap() (err error) {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return ErrInvalidProfile
+	}
+	if m.profile.Bootstrap == nil {
+		m.lock.Unlock()
+		return fmt.Errorf("%s: %s", ErrNoBootstrap, m.profile.Name)
+	}
+	if m.image.IsInstalled() {
+		m.lock.Unlock()
+		return ErrImageExists
+	}
+	m.updateMode = true
+	m.pkgManager = NewEopkgManager(m, m.image.RootDir)
+	m.lock.Unlock()
+
+	if err := os.MkdirAll(ImagesDir, 00755); err != nil {
+		return fmt.Errorf("Failed to create images directory %s, reason: %s\n", ImagesDir, err)
+	}
+
+	// Runs once the image has been unmounted by the cleanup
+	locked := false
+	defer func() {
+		if err != nil && locked {
+			partial := m.image.ImagePath + BootstrapPartialSuffix
+			log.Debugf("Removing incomplete image %s\n", partial)
+			os.Remove(partial)
+		}
+	}()
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "bootstrapping"); err != nil {
+		return err
+	}
+	locked = true
+
+	if err := m.image.Bootstrap(m, m.pkgManager, m.profile.Bootstrap); err != nil {
+		return err
+	}
+	m.imageChanged = true
+	return nil
+}
+
+// Resize will grow the image of the current profile to sizeGB gigabytes
+func (m *Manager) Resize(sizeGB int) error {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return ErrInvalidProfile
+	}
+	if !m.image.IsInstalled() {
+		m.lock.Unlock()
+		return ErrProfileNotInstalled
+	}
+	m.updateMode = true
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "resizing"); err != nil {
+		return err
+	}
+
+	if err := m.image.Resize(sizeGB); err != nil {
+		return err
+	}
+	m.imageChanged = true
+	return nil
 }
 
 // Index will attempt to index the given directory for eopkgs
@@ -422,6 +1055,107 @@ func (m *Manager) Index(dir string) error {
 	return m.pkg.Index(m, dir, m.overlay)
 }
 
+// Diff will list the changes made within the overlay at dir, compared to the
+// backing image of the current profile
+func (m *Manager) Diff(dir string) ([]OverlayFile, error) {
+	if m.IsCancelled() {
+		return nil, ErrInterrupted
+	}
+
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return nil, ErrInvalidProfile
+	}
+	overlay, err := OpenOverlay(dir, m.image)
+	if err != nil {
+		m.lock.Unlock()
+		return nil, err
+	}
+	m.overlay = overlay
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(overlay.LockPath, "diffing"); err != nil {
+		return nil, err
+	}
+	if err := overlay.MountImage(); err != nil {
+		return nil, err
+	}
+	return overlay.Diff()
+}
+
+// SetNotify will override whether webhooks are notified on build completion
+func (m *Manager) SetNotify(enable bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Config.EnableNotify = enable
+}
+
+// SetMetrics will control whether the build metrics are written to the
+// output directory
+func (m *Manager) SetMetrics(enable bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.metrics = enable
+}
+
+// SetExtras will set extra packages and components to install into the
+// build root, for debugging purposes. These are not recorded anywhere.
+func (m *Manager) SetExtras(pkgs, components []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.pkgManager == nil {
+		return ErrNoPackage
+	}
+	m.pkgManager.SetExtras(pkgs, components)
+	return nil
+}
+
+// OnStage will call fn as each stage of the build starts
+func (m *Manager) OnStage(fn func(Stage)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stageHooks = append(m.stageHooks, fn)
+}
+
+// SetListener will tell l of each event of the build as it happens
+func (m *Manager) SetListener(l BuildListener) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.listener = l
+}
+
+// SetPins will hold the named packages at a fixed version in the build root,
+// keyed by package name
+func (m *Manager) SetPins(pins map[string]string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.pkgManager == nil {
+		return ErrNoPackage
+	}
+	m.pkgManager.SetPins(pins)
+	return nil
+}
+
+// AddEnvironment will pass the given variables into the chroot, in addition
+// to those configured. Each is either KEY or KEY=VALUE.
+func (m *Manager) AddEnvironment(vars []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	EnvironmentPassthrough = append(EnvironmentPassthrough, vars...)
+}
+
+// SetIncremental will control whether an existing overlay may be reused
+// when it was created from the current backing image
+func (m *Manager) SetIncremental(enable bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.reuse = enable
+}
+
 // SetTmpfs sets the manager tmpfs option
 func (m *Manager) SetTmpfs(enable bool, size string) {
 	if m.IsCancelled() {
@@ -19,23 +19,82 @@ package builder
 import (
 	"fmt"
 	log "github.com/DataDrake/waterlog"
+	"os/exec"
+	"strings"
 	"syscall"
 )
 
+const (
+	// loopbackCommand brings up the loopback device in a new network namespace
+	loopbackCommand = "/sbin/ip link set lo up"
+
+	// privateMountsCommand stops mounts in a new mount namespace from
+	// propagating back to the host
+	privateMountsCommand = "/bin/mount --make-rprivate /"
+)
+
+var (
+	// isolateNetwork is set once networking has been dropped, after which
+	// every chroot command is started in a network namespace of its own
+	isolateNetwork bool
+
+	// distccNetNS is the network namespace forwarding the distcc hosts, which
+	// chroot commands join instead of creating their own, when set
+	distccNetNS string
+)
+
 // ConfigureNamespace will unshare() context, entering a new namespace
 func ConfigureNamespace() error {
 	log.Debugln("Configuring container namespace")
-	if err := syscall.Unshare(syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC); err != nil {
+	flags := syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC
+	if Sandbox.NoMountNS {
+		flags &^= syscall.CLONE_NEWNS
+	}
+	if err := syscall.Unshare(flags); err != nil {
 		return fmt.Errorf("Failed to configure namespace, reason: %s\n", err)
 	}
 	return nil
 }
 
-// DropNetworking will unshare() the context networking capabilities
+// DropNetworking will start every following chroot command in a fresh network
+// namespace, containing only a loopback device. The kernel tears each one down
+// when its processes exit, so host networking is never touched and concurrent
+// builds cannot interfere with each other.
 func DropNetworking() error {
-	log.Debugln("Dropping container networking")
-	if err := syscall.Unshare(syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS); err != nil {
-		return fmt.Errorf("Failed to drop networking capabilities, reason: %s\n", err)
+	if Sandbox.NoNetNS {
+		log.Warnln("Not dropping networking as the network namespace is disabled")
+		return nil
 	}
+	log.Debugln("Dropping container networking")
+	isolateNetwork = true
 	return nil
 }
+
+// chrootCommand will return the command to run the shell command within the
+// chroot at dir. It is started in private PID and mount namespaces, so that
+// any processes it leaves behind are killed when it exits, and any mounts it
+// makes are never seen by the host. A UTS namespace gives it the hostname of
+// the build. If networking has been dropped, it also
+// gets a network namespace with only the loopback device up, or joins that of
+// the DistccProxy.
+func chrootCommand(dir, command string) *exec.Cmd {
+	setup := []string{hostnameCommand(BuildHostname)}
+	flags := uintptr(syscall.CLONE_NEWPID | syscall.CLONE_NEWUTS)
+	if !Sandbox.NoMountNS {
+		flags |= syscall.CLONE_NEWNS
+		setup = append(setup, privateMountsCommand)
+	}
+	args := []string{"chroot", dir}
+	if isolateNetwork && distccNetNS != "" {
+		args = append([]string{"nsenter", "--net=" + distccNetNS}, args...)
+	} else if isolateNetwork {
+		flags |= syscall.CLONE_NEWNET
+		setup = append(setup, loopbackCommand)
+	}
+	// The command is passed as a positional argument to avoid quoting it,
+	// and replaces the shell as PID 1 of the namespace
+	script := strings.Join(append(setup, `exec /bin/sh -c "$1"`), " && ")
+	c := exec.Command(args[0], append(args[1:], "/bin/sh", "-c", script, "solbuild", command)...)
+	c.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags}
+	return c
+}
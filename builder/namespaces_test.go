@@ -0,0 +1,68 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestChrootCommand(t *testing.T) {
+	command := `echo "it's here" > /tmp/out`
+	c := chrootCommand("/root", command)
+	flags := c.SysProcAttr.Cloneflags
+	if flags&syscall.CLONE_NEWPID == 0 || flags&syscall.CLONE_NEWNS == 0 {
+		t.Fatal("Command is not started in new PID and mount namespaces")
+	}
+	if flags&syscall.CLONE_NEWUTS == 0 {
+		t.Fatal("Command is not started in a new UTS namespace")
+	}
+	if flags&syscall.CLONE_NEWNET != 0 {
+		t.Fatal("Command is isolated from the network before networking was dropped")
+	}
+	if !strings.Contains(c.Args[4], hostnameCommand(BuildHostname)) {
+		t.Fatalf("Command does not set the hostname: %v", c.Args)
+	}
+	if c.Args[len(c.Args)-1] != command {
+		t.Fatalf("Command must be passed unquoted as an argument: %v", c.Args)
+	}
+
+	isolateNetwork = true
+	defer func() { isolateNetwork = false }()
+	c = chrootCommand("/root", command)
+	if c.SysProcAttr.Cloneflags&syscall.CLONE_NEWNET == 0 {
+		t.Fatal("Command is not started in a new network namespace")
+	}
+
+	distccNetNS = "/proc/1/task/1/ns/net"
+	c = chrootCommand("/root", command)
+	distccNetNS = ""
+	if c.SysProcAttr.Cloneflags&syscall.CLONE_NEWNET != 0 || c.Args[0] != "nsenter" || c.Args[1] != "--net=/proc/1/task/1/ns/net" {
+		t.Fatalf("Command does not join the distcc network namespace: %v", c.Args)
+	}
+	if c.Args[len(c.Args)-1] != command {
+		t.Fatalf("Command must be passed unquoted as an argument: %v", c.Args)
+	}
+
+	Sandbox.NoMountNS = true
+	defer func() { Sandbox.NoMountNS = false }()
+	c = chrootCommand("/root", command)
+	if c.SysProcAttr.Cloneflags&syscall.CLONE_NEWNS != 0 {
+		t.Fatal("Command is started in a mount namespace when disabled")
+	}
+}
@@ -0,0 +1,163 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"github.com/getsolus/libosdev/disk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// HostResolvConf is the host's resolver configuration, which is often a
+	// symlink into /run when systemd-resolved is in use
+	HostResolvConf = "/etc/resolv.conf"
+
+	// CABundle is the location of the CA certificate bundle, on the host and
+	// within the chroot
+	CABundle = "/etc/ssl/certs/ca-certificates.crt"
+
+	// etcBackupSuffix is appended to files in the chroot's /etc while they
+	// are replaced
+	etcBackupSuffix = ".solbuild"
+)
+
+var (
+	// DNSServer is the nameserver used by builds that are permitted to
+	// network. The host's resolv.conf is used when empty.
+	DNSServer string
+
+	// BindCABundle will bind mount the host's CA bundle into the chroot for
+	// networked builds, for when the image's bundle is stale
+	BindCABundle bool
+)
+
+// EnableNetworking will prepare the chroot for commands that use the network.
+// The resolv.conf points at the DNS server requested by the user, or else is
+// a copy of the host's, and the host's CA bundle is bound in when configured.
+// Everything is restored when the overlay is unmounted.
+func (o *Overlay) EnableNetworking() error {
+	if DNSServer != "" {
+		log.Debugf("Using DNS server %s\n", DNSServer)
+		if err := o.writeEtc("resolv.conf", fmt.Sprintf("nameserver %s\n", DNSServer)); err != nil {
+			return err
+		}
+	} else if err := o.copyHostResolvConf(); err != nil {
+		return err
+	}
+	if BindCABundle {
+		return o.bindCABundle()
+	}
+	return nil
+}
+
+// copyHostResolvConf will copy the file behind the host's resolv.conf into
+// the chroot, as a symlink into the host's /run would dangle within it
+func (o *Overlay) copyHostResolvConf() error {
+	path, err := filepath.EvalSymlinks(HostResolvConf)
+	if err != nil {
+		log.Warnf("Unable to use the host resolv.conf, reason: %s\n", err)
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read host resolv.conf, reason: %s\n", err)
+	}
+	log.Debugf("Copying host resolv.conf from %s\n", path)
+	return o.writeEtc("resolv.conf", string(b))
+}
+
+// bindCABundle will bind mount the host's CA bundle over the chroot's
+func (o *Overlay) bindCABundle() error {
+	source, err := filepath.EvalSymlinks(CABundle)
+	if err != nil {
+		log.Warnf("Unable to use the host CA bundle, reason: %s\n", err)
+		return nil
+	}
+	target := filepath.Join(o.MountPoint, CABundle)
+	if st, err := os.Lstat(target); err == nil && st.Mode()&os.ModeSymlink != 0 {
+		log.Warnf("Not binding the host CA bundle over the symlink %s\n", CABundle)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+		return fmt.Errorf("Failed to create CA bundle directory, reason: %s\n", err)
+	}
+	if err := TouchFile(target); err != nil {
+		return fmt.Errorf("Failed to create CA bundle bind target, reason: %s\n", err)
+	}
+	log.Debugf("Binding host CA bundle %s\n", source)
+	if err := disk.GetMountManager().BindMount(source, target); err != nil {
+		return fmt.Errorf("Failed to bind mount CA bundle, reason: %s\n", err)
+	}
+	o.ExtraMounts = append(o.ExtraMounts, target)
+	// A bind mount ignores ro, so it must be remounted to be read-only
+	if err := commands.ExecStdoutArgs("mount", []string{"-o", "remount,bind,ro", target}); err != nil {
+		return fmt.Errorf("Failed to make CA bundle read-only, reason: %s\n", err)
+	}
+	return nil
+}
+
+// writeEtc will replace the named file in the chroot's /etc. The original is
+// moved aside rather than written through, as a symlink would otherwise be
+// followed on the host.
+func (o *Overlay) writeEtc(name, content string) error {
+	path := filepath.Join(o.MountPoint, "etc", name)
+	backup := path + etcBackupSuffix
+	if _, err := os.Lstat(backup); err == nil {
+		// Already replaced, the backup is the original
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove %s, reason: %s\n", path, err)
+		}
+	} else if _, err := os.Lstat(path); err == nil {
+		if err := os.Rename(path, backup); err != nil {
+			return fmt.Errorf("Failed to move aside %s, reason: %s\n", path, err)
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 00644); err != nil {
+		return fmt.Errorf("Failed to write %s, reason: %s\n", path, err)
+	}
+	for _, replaced := range o.ReplacedEtc {
+		if replaced == name {
+			return nil
+		}
+	}
+	o.ReplacedEtc = append(o.ReplacedEtc, name)
+	return nil
+}
+
+// restoreEtc will put back the files replaced by writeEtc, so that the image
+// contents are seen again if the overlay is reused
+func (o *Overlay) restoreEtc() {
+	for _, name := range o.ReplacedEtc {
+		path := filepath.Join(o.MountPoint, "etc", name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove %s, reason: %s\n", path, err)
+			continue
+		}
+		if _, err := os.Lstat(path + etcBackupSuffix); err != nil {
+			continue
+		}
+		if err := os.Rename(path+etcBackupSuffix, path); err != nil {
+			log.Warnf("Failed to restore %s, reason: %s\n", path, err)
+		}
+	}
+	o.ReplacedEtc = nil
+}
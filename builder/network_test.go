@@ -0,0 +1,71 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnableNetworking(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-network")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := &Overlay{MountPoint: filepath.Join(dir, "union")}
+	if err := os.MkdirAll(filepath.Join(o.MountPoint, "etc"), 00755); err != nil {
+		t.Fatalf("Failed to create etc: %v", err)
+	}
+	// A dangling resolv.conf symlink, as found in the image, must be
+	// replaced rather than followed
+	target := filepath.Join(dir, "stub-resolv.conf")
+	resolv := filepath.Join(o.MountPoint, "etc", "resolv.conf")
+	if err := os.Symlink(target, resolv); err != nil {
+		t.Fatalf("Failed to link resolv.conf: %v", err)
+	}
+
+	DNSServer = "192.0.2.1"
+	defer func() { DNSServer = "" }()
+	if err := o.EnableNetworking(); err != nil {
+		t.Fatalf("Failed to enable networking: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(resolv); string(b) != "nameserver 192.0.2.1\n" {
+		t.Fatalf("Wrong resolv.conf: %s", b)
+	}
+	if PathExists(target) {
+		t.Fatal("Symlink target was written")
+	}
+	// Replacing twice must keep the original
+	if err := o.writeEtc("resolv.conf", "nameserver 127.0.0.1\n"); err != nil {
+		t.Fatalf("Failed to replace resolv.conf: %v", err)
+	}
+	if err := o.writeEtc("hosts", hostsFile(DefaultHostname)); err != nil {
+		t.Fatalf("Failed to write hosts: %v", err)
+	}
+
+	o.restoreEtc()
+	if link, err := os.Readlink(resolv); err != nil || link != target {
+		t.Fatalf("Original resolv.conf was not restored: %s %v", link, err)
+	}
+	if PathExists(filepath.Join(o.MountPoint, "etc", "hosts")) {
+		t.Fatal("New hosts file was not removed")
+	}
+}
@@ -0,0 +1,161 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxOutputLine is the longest line we'll buffer from a chroot command
+	// before forcibly emitting it, to bound memory usage.
+	MaxOutputLine = 64 * 1024
+)
+
+var (
+	// RawOutput disables prefixing of the chroot output, instead passing it
+	// straight through to the terminal.
+	RawOutput bool
+
+	// ChrootOutput will receive all output from ChrootExec calls when set
+	ChrootOutput *OutputLogger
+
+	// QuietOutput hides the standard output of chroot commands and hooks from
+	// the console, along with the stage summary. It is still written to the
+	// build log.
+	QuietOutput bool
+)
+
+// consoleStdout will return where standard output should be shown
+func consoleStdout() io.Writer {
+	if QuietOutput {
+		return ioutil.Discard
+	}
+	return os.Stdout
+}
+
+// An OutputLogger prefixes each line of chroot output with the elapsed time
+// and a short tag, before forwarding it to the console and the build log.
+type OutputLogger struct {
+	lock  sync.Mutex
+	start time.Time
+	tag   string
+	log   io.Writer
+	lines []func(string)
+}
+
+// NewOutputLogger will return a new OutputLogger that additionally copies
+// all output to the given log. The log may be nil.
+func NewOutputLogger(log io.Writer) *OutputLogger {
+	return &OutputLogger{
+		start: time.Now(),
+		log:   log,
+	}
+}
+
+// SetTag will set the tag used to prefix all following lines
+func (o *OutputLogger) SetTag(tag string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.tag = tag
+}
+
+// OnLine will register a function to be called with every line of output,
+// without its prefix or newline. It must not block, as output is held up
+// until it returns.
+func (o *OutputLogger) OnLine(fn func(line string)) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.lines = append(o.lines, fn)
+}
+
+// Writer will return a new line buffered writer that forwards to the console
+func (o *OutputLogger) Writer(console io.Writer) *LineWriter {
+	return &LineWriter{
+		out:     o,
+		console: console,
+	}
+}
+
+// emit will write out a single, complete line
+func (o *OutputLogger) emit(console io.Writer, line []byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	elapsed := time.Since(o.start).Seconds()
+	prefix := fmt.Sprintf("[%9.3fs %-5s] ", elapsed, o.tag)
+	console.Write([]byte(prefix))
+	console.Write(line)
+	if o.log != nil {
+		o.log.Write([]byte(prefix))
+		o.log.Write(line)
+	}
+	for _, fn := range o.lines {
+		fn(string(bytes.TrimSuffix(line, []byte("\n"))))
+	}
+}
+
+// Annotate will write a single line to the log only, with the given tag
+func (o *OutputLogger) Annotate(tag, line string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.log == nil {
+		return
+	}
+	elapsed := time.Since(o.start).Seconds()
+	fmt.Fprintf(o.log, "[%9.3fs %-5s] %s\n", elapsed, tag, line)
+}
+
+// A LineWriter buffers output until a complete line is available, at which
+// point it is emitted by the OutputLogger.
+type LineWriter struct {
+	out     *OutputLogger
+	console io.Writer
+	buf     []byte
+}
+
+// Write will buffer the data, emitting any completed lines
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.out.emit(w.console, w.buf[:i+1])
+		w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	}
+	// Don't let a runaway line eat all of our memory
+	if len(w.buf) >= MaxOutputLine {
+		w.Flush()
+	}
+	return len(p), nil
+}
+
+// Flush will emit any incomplete line remaining in the buffer
+func (w *LineWriter) Flush() {
+	if len(w.buf) < 1 {
+		return
+	}
+	w.out.emit(w.console, append(w.buf, '\n'))
+	w.buf = nil
+}
@@ -0,0 +1,72 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var console, log bytes.Buffer
+	out := NewOutputLogger(&log)
+	out.SetTag("build")
+	w := out.Writer(&console)
+
+	w.Write([]byte("first li"))
+	if console.Len() != 0 {
+		t.Fatalf("Emitted an incomplete line: %s", console.String())
+	}
+	w.Write([]byte("ne\nsecond line\nthi"))
+	w.Write([]byte{0xff, 0xfe, 'r', 'd'})
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(console.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Invalid number of lines: %d vs expected 3", len(lines))
+	}
+	want := []string{"first line", "second line", "thi\xff\xferd"}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "[") || !strings.Contains(line, " build] ") {
+			t.Fatalf("Missing prefix on line %d: %s", i, line)
+		}
+		if !strings.HasSuffix(line, "] "+want[i]) {
+			t.Fatalf("Wrong contents on line %d: %q", i, line)
+		}
+	}
+	if log.String() != console.String() {
+		t.Fatal("Log file contents differ from the console")
+	}
+}
+
+func TestLineWriterLongLine(t *testing.T) {
+	var console bytes.Buffer
+	w := NewOutputLogger(nil).Writer(&console)
+
+	long := bytes.Repeat([]byte("x"), MaxOutputLine*3)
+	w.Write(long)
+	w.Write([]byte("\n"))
+	w.Flush()
+
+	if len(w.buf) != 0 {
+		t.Fatalf("Buffer not drained: %d bytes remain", len(w.buf))
+	}
+	if got := strings.Count(console.String(), "x"); got != len(long) {
+		t.Fatalf("Lost output: %d vs expected %d bytes", got, len(long))
+	}
+}
@@ -17,50 +17,134 @@
 package builder
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/libosdev/disk"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// unixWriteOK is the W_OK mode for access(2)
+	unixWriteOK = 0x2
+
+	// FilesystemsPath lists the filesystems supported by the running kernel
+	FilesystemsPath = "/proc/filesystems"
+)
+
+var (
+	// ErrInvalidOverlay is returned when an overlay is requested without a
+	// backing image or package
+	ErrInvalidOverlay = errors.New("Overlay requires both a backing image and a package")
+
+	// ErrOverlayUnsupported is returned when the kernel cannot mount overlayfs
+	ErrOverlayUnsupported = errors.New("The kernel does not support overlayfs. Try 'modprobe overlay', or enable CONFIG_OVERLAY_FS in the kernel configuration")
 )
 
 // An Overlay is formed from a backing image & Package combination.
 // Using this Overlay we can bring up new temporary build roots using the
 // overlayfs kernel module.
+//
+// All paths are derived from the configured overlay root directory, the
+// profile name and the package name, i.e.:
+//
+//	/var/cache/solbuild/unstable-x86_64/nano/union
 type Overlay struct {
-	Back    *BackingImage // This will be mounted at $dir/image
-	Package *Package      // The package we intend to interact with
+	// BackingImage is the read-only lower layer, mounted at ImgDir
+	BackingImage *BackingImage
+
+	// Package is the package we intend to build or interact with
+	Package *Package
+
+	// BaseDir is the base directory containing all of the directories below.
+	// When tmpfs builds are enabled, the tmpfs is mounted here.
+	BaseDir string
+
+	// WorkDir is the overlayfs workdir, used internally by the kernel to
+	// prepare files before they are moved into the UpperDir.
+	WorkDir string
+
+	// UpperDir is the writable upper layer, where all changes made within
+	// the build root are really stored.
+	UpperDir string
+
+	// ImgDir is where the backing image is mounted read-only, and is used
+	// as the lower layer.
+	ImgDir string
+
+	// MountPoint is where the merged view of the lower and upper layers is
+	// mounted. This is the root of the chroot.
+	MountPoint string
+
+	// LockPath is the path to the lockfile guarding this overlay
+	LockPath string
+
+	// MetaPath is the path to the OverlayMetadata, used to decide whether
+	// an existing overlay may be reused for incremental builds.
+	MetaPath string
+
+	// Incremental will reuse an existing overlay when it was created from
+	// the current backing image, instead of starting from scratch.
+	Incremental bool
+
+	// LastUpgrade is when the packages in the overlay were last upgraded, if
+	// ever. This is only known for reused incremental overlays.
+	LastUpgrade time.Time
+
+	// Direct will mount the backing image read-write as the root, instead
+	// of layering an overlayfs over it. The image must be a throwaway clone,
+	// as it is changed by the build.
+	Direct bool
 
-	BaseDir    string // BaseDir is the base directory containing the root
-	WorkDir    string // WorkDir is the overlayfs workdir lock
-	UpperDir   string // UpperDir is where real inode changes happen (tmp)
-	ImgDir     string // Where the profile is mounted (ro)
-	MountPoint string // The actual mount point for the union'd directories
-	LockPath   string // Path to the lockfile for this overlay
+	// ReadOnly will mount the backing image read-only as the root, without
+	// an upper layer, so that nothing within the root may be changed.
+	ReadOnly bool
 
 	EnableTmpfs bool   // Whether to use tmpfs for the upperdir or not
 	TmpfsSize   string // Size of the tmpfs to pass to mount, string form
 
 	ExtraMounts []string // Any extra mounts to take care of when cleaning up
+	ReplacedEtc []string // Files in /etc replaced for networking, restored when cleaning up
 
-	mountedImg     bool // Whether we mounted the image or not
-	mountedOverlay bool // Whether we mounted the overlay or not
-	mountedVFS     bool // Whether we mounted vfs or not
-	mountedTmpfs   bool // Whether we mounted tmpfs or not
+	mountedImg     bool     // Whether we mounted the image or not
+	mountedOverlay bool     // Whether we mounted the overlay or not
+	vfsMounts      []string // Pseudo filesystems we mounted, in order
+	mountedTmpfs   bool     // Whether we mounted tmpfs or not
 }
 
 // NewOverlay creates a new Overlay for us in builds, etc.
 //
 // Unlike evobuild, we use fixed names within the more dynamic profile name,
 // as opposed to a single dir with "unstable-x86_64" inside it, etc.
-func NewOverlay(config *Config, profile *Profile, back *BackingImage, pkg *Package) *Overlay {
+//
+// An error is returned if the backing image is not installed, or if the
+// overlay root directory cannot be written to.
+func NewOverlay(config *Config, profile *Profile, back *BackingImage, pkg *Package) (*Overlay, error) {
+	if back == nil || pkg == nil {
+		return nil, ErrInvalidOverlay
+	}
+	if !back.IsInstalled() {
+		return nil, ErrProfileNotInstalled
+	}
+	if err := checkWritable(config.OverlayRootDir); err != nil {
+		return nil, fmt.Errorf("Overlay root directory is not writable: dir='%s', reason: %s\n", config.OverlayRootDir, err)
+	}
+
 	// Ideally we could make this better..
 	dirname := pkg.Name
 	// i.e. /var/cache/solbuild/unstable-x86_64/nano
 	basedir := filepath.Join(config.OverlayRootDir, profile.Name, dirname)
 	return &Overlay{
-		Back:           back,
+		BackingImage:   back,
 		Package:        pkg,
 		BaseDir:        basedir,
 		WorkDir:        filepath.Join(basedir, "work"),
@@ -68,12 +152,121 @@ func NewOverlay(config *Config, profile *Profile, back *BackingImage, pkg *Packa
 		ImgDir:         filepath.Join(basedir, "img"),
 		MountPoint:     filepath.Join(basedir, "union"),
 		LockPath:       fmt.Sprintf("%s.lock", basedir),
+		MetaPath:       filepath.Join(basedir, "overlay.json"),
 		mountedImg:     false,
 		mountedOverlay: false,
-		mountedVFS:     false,
 		EnableTmpfs:    false,
 		TmpfsSize:      "",
 		mountedTmpfs:   false,
+	}, nil
+}
+
+// OverlayMetadata records which backing image an overlay was created from
+type OverlayMetadata struct {
+	ImageSha256 string    `json:"image_sha256"`
+	Created     time.Time `json:"created"`
+	Upgraded    time.Time `json:"upgraded,omitempty"` // Last upgrade within the overlay
+}
+
+// ReuseIfValid will determine whether the existing overlay was created from
+// the current backing image, in which case it may be reused rather than being
+// cleaned. Any update of the backing image changes its hash, and so will
+// invalidate the overlay.
+func (o *Overlay) ReuseIfValid() (bool, error) {
+	if o.EnableTmpfs {
+		log.Debugln("Not reusing overlay as tmpfs is enabled")
+		return false, nil
+	}
+	b, err := ioutil.ReadFile(o.MetaPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read overlay metadata %s, reason: %s\n", o.MetaPath, err)
+		}
+		return false, nil
+	}
+	var meta OverlayMetadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		log.Warnf("Invalid overlay metadata %s, reason: %s\n", o.MetaPath, err)
+		return false, nil
+	}
+	sum, err := CachedSha256sum(o.BackingImage.ImagePath)
+	if err != nil {
+		return false, fmt.Errorf("Failed to hash backing image %s, reason: %s\n", o.BackingImage.ImagePath, err)
+	}
+	if sum != meta.ImageSha256 {
+		log.Infoln("Backing image has changed, not reusing the existing overlay")
+		return false, nil
+	}
+
+	// Don't let a previous build leave artifacts behind to be collected
+	workdir := filepath.Join(o.UpperDir, o.Package.GetWorkDirInternal()[1:])
+	if err := os.RemoveAll(workdir); err != nil {
+		return false, fmt.Errorf("Failed to remove stale work directory: dir='%s', reason: %s\n", workdir, err)
+	}
+	log.Infof("Reusing overlay created %s\n", meta.Created.Format(time.RFC1123))
+	o.LastUpgrade = meta.Upgraded
+	return true, nil
+}
+
+// RecordUpgrade will note in the metadata of an incremental overlay that it
+// has just been upgraded, so that later builds reusing it may skip the
+// upgrade
+func (o *Overlay) RecordUpgrade() error {
+	o.LastUpgrade = time.Now().UTC()
+	if !o.Incremental || o.EnableTmpfs {
+		return nil
+	}
+	b, err := ioutil.ReadFile(o.MetaPath)
+	if err != nil {
+		return nil
+	}
+	var meta OverlayMetadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil
+	}
+	meta.Upgraded = o.LastUpgrade
+	if b, err = json.Marshal(&meta); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(o.MetaPath, b, 00644); err != nil {
+		return fmt.Errorf("Failed to write overlay metadata %s, reason: %s\n", o.MetaPath, err)
+	}
+	return nil
+}
+
+// WriteMetadata will record the current backing image in the overlay, so
+// that it may be reused by later incremental builds.
+func (o *Overlay) WriteMetadata() error {
+	sum, err := CachedSha256sum(o.BackingImage.ImagePath)
+	if err != nil {
+		return fmt.Errorf("Failed to hash backing image %s, reason: %s\n", o.BackingImage.ImagePath, err)
+	}
+	meta := OverlayMetadata{
+		ImageSha256: sum,
+		Created:     time.Now().UTC(),
+	}
+	b, err := json.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(o.MetaPath, b, 00644); err != nil {
+		return fmt.Errorf("Failed to write overlay metadata %s, reason: %s\n", o.MetaPath, err)
+	}
+	return nil
+}
+
+// checkWritable will ensure that the directory, or the closest existing
+// parent of it, can be written to by us.
+func checkWritable(dir string) error {
+	for {
+		if PathExists(dir) {
+			return syscall.Access(dir, unixWriteOK)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return os.ErrNotExist
+		}
+		dir = parent
 	}
 }
 
@@ -112,9 +305,68 @@ func (o *Overlay) CleanExisting() error {
 	return nil
 }
 
+// CheckOverlaySupport will ensure that the kernel can mount overlayfs,
+// attempting to load the module if needed
+func CheckOverlaySupport() error {
+	supported, err := overlaySupported()
+	if err != nil {
+		return err
+	}
+	if supported {
+		return nil
+	}
+	log.Infoln("overlayfs is not available, attempting to load the overlay module")
+	if err := commands.ExecStdoutArgs("modprobe", []string{"overlay"}); err != nil {
+		log.Warnf("Failed to load the overlay module, reason: %s\n", err)
+	}
+	if supported, err = overlaySupported(); err != nil {
+		return err
+	}
+	if !supported {
+		return ErrOverlayUnsupported
+	}
+	return nil
+}
+
+// overlaySupported will read the kernel filesystems to find overlayfs
+func overlaySupported() (bool, error) {
+	f, err := os.Open(FilesystemsPath)
+	if err != nil {
+		return false, fmt.Errorf("Failed to read %s, reason: %s\n", FilesystemsPath, err)
+	}
+	defer f.Close()
+	return hasOverlayFilesystem(f), nil
+}
+
+// hasOverlayFilesystem will determine whether overlayfs is listed in the
+// /proc/filesystems format, i.e. "nodev\toverlay"
+func hasOverlayFilesystem(r io.Reader) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+		switch fields[len(fields)-1] {
+		case "overlay", "overlayfs":
+			return true
+		}
+	}
+	return false
+}
+
 // Mount will set up the overlayfs structure with the lower/upper respected
 // properly.
 func (o *Overlay) Mount() error {
+	if o.Direct {
+		return o.mountDirect()
+	}
+	if o.ReadOnly {
+		return o.mountReadOnly()
+	}
+	if err := CheckOverlaySupport(); err != nil {
+		return err
+	}
 	log.Debugln("Mounting overlayfs")
 
 	mountMan := disk.GetMountManager()
@@ -146,9 +398,9 @@ func (o *Overlay) Mount() error {
 	}
 
 	// First up, mount the backing image
-	log.Debugf("Mounting backing image: point='%s'\n", o.Back.ImagePath)
-	if err := mountMan.Mount(o.Back.ImagePath, o.ImgDir, "auto", "ro", "loop"); err != nil {
-		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %s\n", o.Back.ImagePath, err)
+	log.Debugf("Mounting backing image: point='%s'\n", o.BackingImage.ImagePath)
+	if err := mountMan.Mount(o.BackingImage.ImagePath, o.ImgDir, "auto", "ro", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %s\n", o.BackingImage.ImagePath, err)
 	}
 	o.mountedImg = true
 
@@ -171,6 +423,37 @@ func (o *Overlay) Mount() error {
 	return EnsureEopkgLayout(o.MountPoint)
 }
 
+// mountDirect will mount the cloned backing image read-write as the root
+func (o *Overlay) mountDirect() error {
+	if !IsClonedImage(o.BackingImage.Name) {
+		return ErrDirectShared
+	}
+	log.Warnf("Building directly in a clone of the backing image: %s\n", o.BackingImage.ImagePath)
+	if err := o.EnsureDirs(); err != nil {
+		return err
+	}
+	mountMan := disk.GetMountManager()
+	if err := mountMan.Mount(o.BackingImage.ImagePath, o.MountPoint, "auto", "rw", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %s\n", o.BackingImage.ImagePath, err)
+	}
+	// Unmounted and restored as the overlay would be
+	o.mountedOverlay = true
+	return EnsureEopkgLayout(o.MountPoint)
+}
+
+// mountReadOnly will mount the backing image read-only as the root
+func (o *Overlay) mountReadOnly() error {
+	if err := o.EnsureDirs(); err != nil {
+		return err
+	}
+	mountMan := disk.GetMountManager()
+	if err := mountMan.Mount(o.BackingImage.ImagePath, o.MountPoint, "auto", "ro", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %s\n", o.BackingImage.ImagePath, err)
+	}
+	o.mountedOverlay = true
+	return nil
+}
+
 // Unmount will tear down the overlay mount again
 func (o *Overlay) Unmount() error {
 	mountMan := disk.GetMountManager()
@@ -180,19 +463,14 @@ func (o *Overlay) Unmount() error {
 	}
 	o.ExtraMounts = nil
 
-	vfsPoints := []string{
-		filepath.Join(o.MountPoint, "dev/pts"),
-		filepath.Join(o.MountPoint, "dev/shm"),
-		filepath.Join(o.MountPoint, "dev"),
-		filepath.Join(o.MountPoint, "proc"),
-		filepath.Join(o.MountPoint, "sys"),
+	if o.mountedOverlay {
+		o.restoreEtc()
 	}
-	if o.mountedVFS {
-		for _, p := range vfsPoints {
-			mountMan.Unmount(p)
-		}
-		o.mountedVFS = false
+
+	for i := len(o.vfsMounts) - 1; i >= 0; i-- {
+		mountMan.Unmount(o.vfsMounts[i])
 	}
+	o.vfsMounts = nil
 
 	if o.mountedImg {
 		if err := mountMan.Unmount(o.ImgDir); err != nil {
@@ -215,70 +493,136 @@ func (o *Overlay) Unmount() error {
 	return nil
 }
 
-// MountVFS will bring up virtual filesystems within the chroot
-func (o *Overlay) MountVFS() error {
-	mountMan := disk.GetMountManager()
+// A vfsMount is a pseudo filesystem mounted within the chroot
+type vfsMount struct {
+	source  string
+	target  string // Relative to the root of the chroot
+	fstype  string
+	options []string
+}
 
-	vfsPoints := []string{
-		filepath.Join(o.MountPoint, "dev"),
-		filepath.Join(o.MountPoint, "dev/pts"),
-		filepath.Join(o.MountPoint, "proc"),
-		filepath.Join(o.MountPoint, "sys"),
-		filepath.Join(o.MountPoint, "dev/shm"),
-	}
+var (
+	// staticDevices are bound in from the host when devtmpfs is refused
+	staticDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
 
-	for _, p := range vfsPoints {
-		if PathExists(p) {
-			continue
-		}
+	// staticLinks are created in a static /dev, as devtmpfs would provide them
+	staticLinks = map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
 
-		log.Debugf("Creating VFS directory: dir='%s'\n", p)
+	// requiredVFSNodes must exist within the chroot before building
+	requiredVFSNodes = []string{
+		"dev/null",
+		"dev/zero",
+		"dev/urandom",
+		"dev/ptmx",
+		"dev/pts/ptmx",
+		"dev/shm",
+		"proc/self",
+		"sys/kernel",
+	}
+)
 
-		if err := os.MkdirAll(p, 00755); err != nil {
-			return fmt.Errorf("Failed to create VFS directory. dir='%s', reason: %s\n", p, err)
+// MountVFS will bring up virtual filesystems within the chroot, and verify
+// that the device nodes builds rely on are available
+func (o *Overlay) MountVFS() error {
+	if err := o.mountDev(); err != nil {
+		return err
+	}
+	mounts := []vfsMount{
+		{"devpts", "dev/pts", "devpts", []string{"newinstance", "ptmxmode=666", "gid=5", "mode=620", "nosuid", "noexec"}},
+		{"tmpfs-shm", "dev/shm", "tmpfs", []string{"mode=1777", "nosuid", "nodev"}},
+		{"proc", "proc", "proc", []string{"nosuid", "noexec", "nodev"}},
+		{"sysfs", "sys", "sysfs", []string{"nosuid", "noexec", "nodev"}},
+		// Use our own devpts instance for new terminals
+		{filepath.Join(o.MountPoint, "dev/pts/ptmx"), "dev/ptmx", "--bind", nil},
+	}
+	for _, m := range mounts {
+		if err := o.mountVFS(m); err != nil {
+			return err
 		}
 	}
-
-	// Bring up dev
-	log.Debugln("Mounting vfs /dev")
-	if err := mountMan.Mount("devtmpfs", vfsPoints[0], "devtmpfs", "nosuid", "mode=755"); err != nil {
-		return fmt.Errorf("Failed to mount /dev, reason: %s\n", err)
+	// Only this mount of sysfs is made read-only, a plain remount would
+	// change the host's sysfs too
+	sys := filepath.Join(o.MountPoint, "sys")
+	if err := commands.ExecStdoutArgs("mount", []string{"-o", "remount,bind,ro", sys}); err != nil {
+		return fmt.Errorf("Failed to make /sys read-only, reason: %s\n", err)
 	}
-	o.mountedVFS = true
+	return o.VerifyVFS()
+}
 
-	// Bring up dev/pts
-	log.Debugln("Mounting vfs /dev/pts")
-	if err := mountMan.Mount("devpts", vfsPoints[1], "devpts", "gid=5", "mode=620", "nosuid", "noexec"); err != nil {
-		return fmt.Errorf("Failed to mount /dev/pts, reason: %s\n", err)
+// mountDev will mount a devtmpfs on /dev, falling back to a tmpfs populated
+// with a curated set of device nodes from the host if devtmpfs is refused
+func (o *Overlay) mountDev() error {
+	err := o.mountVFS(vfsMount{"devtmpfs", "dev", "devtmpfs", []string{"nosuid", "mode=755"}})
+	if err == nil {
+		return nil
 	}
-
-	// Bring up proc
-	log.Debugln("Mounting vfs /proc")
-	if err := mountMan.Mount("proc", vfsPoints[2], "proc", "nosuid", "noexec"); err != nil {
-		return fmt.Errorf("Failed to mount /proc, reason: %s\n", err)
+	log.Warnf("Using a static /dev as devtmpfs is unavailable: %s", err)
+	if err := o.mountVFS(vfsMount{"tmpfs-dev", "dev", "tmpfs", []string{"nosuid", "mode=755"}}); err != nil {
+		return err
 	}
+	for _, node := range staticDevices {
+		if err := o.mountVFS(vfsMount{filepath.Join("/dev", node), filepath.Join("dev", node), "--bind", nil}); err != nil {
+			return err
+		}
+	}
+	for name, target := range staticLinks {
+		if err := os.Symlink(target, filepath.Join(o.MountPoint, "dev", name)); err != nil {
+			return fmt.Errorf("Failed to create /dev/%s, reason: %s\n", name, err)
+		}
+	}
+	return nil
+}
 
-	// Bring up sys
-	log.Debugln("Mounting vfs /sys")
-	if err := mountMan.Mount("sysfs", vfsPoints[3], "sysfs"); err != nil {
-		return fmt.Errorf("Failed to mount /sys, reason: %s\n", err)
+// mountVFS will mount a single pseudo filesystem, creating the mount point
+// if needed, and track it so that they're unmounted in reverse order
+func (o *Overlay) mountVFS(m vfsMount) error {
+	target := filepath.Join(o.MountPoint, m.target)
+	if st, err := os.Stat(m.source); err == nil && filepath.IsAbs(m.source) && !st.IsDir() {
+		if err := TouchFile(target); err != nil {
+			return fmt.Errorf("Failed to create VFS node. file='%s', reason: %s\n", target, err)
+		}
+	} else if !PathExists(target) {
+		log.Debugf("Creating VFS directory: dir='%s'\n", target)
+		if err := os.MkdirAll(target, 00755); err != nil {
+			return fmt.Errorf("Failed to create VFS directory. dir='%s', reason: %s\n", target, err)
+		}
 	}
+	log.Debugf("Mounting vfs /%s\n", m.target)
+	if err := disk.GetMountManager().Mount(m.source, target, m.fstype, m.options...); err != nil {
+		return fmt.Errorf("Failed to mount /%s, reason: %s. Pseudo filesystems may only be mounted with full root privileges, and not from an unprivileged container\n", m.target, err)
+	}
+	o.vfsMounts = append(o.vfsMounts, target)
+	return nil
+}
 
-	// Bring up shm
-	log.Debugln("Mounting vfs /dev/shm")
-	if err := mountMan.Mount("tmpfs-shm", vfsPoints[4], "tmpfs"); err != nil {
-		return fmt.Errorf("Failed to mount /dev/shm, reason: %s\n", err)
+// VerifyVFS will ensure that all of the nodes required by builds exist within
+// the chroot
+func (o *Overlay) VerifyVFS() error {
+	var missing []string
+	for _, node := range requiredVFSNodes {
+		if !PathExists(filepath.Join(o.MountPoint, node)) {
+			missing = append(missing, "/"+node)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing required nodes in the chroot: %s\n", strings.Join(missing, ", "))
 	}
 	return nil
 }
 
-// ConfigureNetworking will add a loopback interface to the container so
-// that localhost networking will still work
+// ConfigureNetworking will prepare the container for localhost networking,
+// once networking has been dropped. The resolv.conf is replaced so that any
+// lookups beyond the names of /etc/hosts fail quickly. The loopback
+// device itself is brought up within each command's network namespace.
 func (o *Overlay) ConfigureNetworking() error {
-	ipCommand := "/sbin/ip link set lo up"
 	log.Debugln("Configuring container networking")
-	if err := commands.ChrootExec(o.MountPoint, ipCommand); err != nil {
-		return fmt.Errorf("Failed to configure networking, reason: %s\n", err)
+	if DNSServer != "" {
+		log.Warnf("Ignoring DNS server %s as the build cannot reach the network\n", DNSServer)
 	}
-	return nil
+	return o.writeEtc("resolv.conf", "nameserver 127.0.0.1\n")
 }
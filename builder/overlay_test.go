@@ -0,0 +1,110 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlayReuseIfValid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-overlay")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved string) { ChecksumCachePath = saved }(ChecksumCachePath)
+	ChecksumCachePath = filepath.Join(dir, ChecksumCacheFile)
+
+	imgPath := filepath.Join(dir, "base.img")
+	if err := ioutil.WriteFile(imgPath, []byte("image"), 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	o := &Overlay{
+		BackingImage: &BackingImage{ImagePath: imgPath},
+		Package:      &Package{Type: PackageTypeYpkg},
+		UpperDir:     filepath.Join(dir, "tmp"),
+		MetaPath:     filepath.Join(dir, "overlay.json"),
+	}
+
+	if reuse, err := o.ReuseIfValid(); err != nil || reuse {
+		t.Fatalf("Reused an overlay without metadata: %v", err)
+	}
+	if err := o.WriteMetadata(); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+
+	stale := filepath.Join(o.UpperDir, o.Package.GetWorkDirInternal()[1:], "stale.eopkg")
+	if err := os.MkdirAll(filepath.Dir(stale), 00755); err != nil {
+		t.Fatalf("Failed to create work directory: %v", err)
+	}
+	if err := ioutil.WriteFile(stale, nil, 00644); err != nil {
+		t.Fatalf("Failed to write stale artifact: %v", err)
+	}
+	if reuse, err := o.ReuseIfValid(); err != nil || !reuse {
+		t.Fatalf("Did not reuse a valid overlay: %v", err)
+	}
+	if PathExists(stale) {
+		t.Fatal("Stale build artifacts were not removed")
+	}
+
+	// Updating the image must invalidate the overlay
+	if err := ioutil.WriteFile(imgPath, []byte("updated image"), 00644); err != nil {
+		t.Fatalf("Failed to update image: %v", err)
+	}
+	if reuse, err := o.ReuseIfValid(); err != nil || reuse {
+		t.Fatalf("Reused an overlay from an old image: %v", err)
+	}
+}
+
+func TestOverlayVerifyVFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-overlay")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := &Overlay{MountPoint: dir}
+	if err := o.VerifyVFS(); err == nil {
+		t.Fatal("Verified an empty chroot")
+	}
+	for _, node := range requiredVFSNodes {
+		path := filepath.Join(dir, node)
+		if err := os.MkdirAll(filepath.Dir(path), 00755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := TouchFile(path); err != nil {
+			t.Fatalf("Failed to create node: %v", err)
+		}
+	}
+	if err := o.VerifyVFS(); err != nil {
+		t.Fatalf("Failed to verify a complete chroot: %v", err)
+	}
+}
+
+func TestHasOverlayFilesystem(t *testing.T) {
+	filesystems := "nodev\tsysfs\nnodev\tproc\n\text4\nnodev\toverlay\n"
+	if !hasOverlayFilesystem(strings.NewReader(filesystems)) {
+		t.Fatal("Failed to find overlay filesystem")
+	}
+	if hasOverlayFilesystem(strings.NewReader("nodev\tsysfs\n\tbtrfs\n")) {
+		t.Fatal("Found overlay filesystem when not listed")
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"github.com/getsolus/libosdev/disk"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// A ChangeType describes how a file in the overlay differs from the image
+type ChangeType string
+
+const (
+	// ChangeAdded is a file that does not exist in the backing image
+	ChangeAdded ChangeType = "added"
+
+	// ChangeModified is a file that replaces one in the backing image
+	ChangeModified ChangeType = "modified"
+
+	// ChangeDeleted is a file of the backing image removed in the overlay
+	ChangeDeleted ChangeType = "deleted"
+)
+
+var (
+	// ErrNotAnOverlay is returned when a directory has no overlay upper layer
+	ErrNotAnOverlay = errors.New("Not an overlay directory")
+)
+
+// An OverlayFile is a single change made within an overlay
+type OverlayFile struct {
+	Path       string // Absolute path within the root
+	ChangeType ChangeType
+}
+
+// OpenOverlay will open the existing overlay within dir, i.e.
+// /var/cache/solbuild/unstable-x86_64/nano, over the given backing image
+func OpenOverlay(dir string, back *BackingImage) (*Overlay, error) {
+	basedir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	o := &Overlay{
+		BackingImage: back,
+		BaseDir:      basedir,
+		WorkDir:      filepath.Join(basedir, "work"),
+		UpperDir:     filepath.Join(basedir, "tmp"),
+		ImgDir:       filepath.Join(basedir, "img"),
+		MountPoint:   filepath.Join(basedir, "union"),
+		LockPath:     fmt.Sprintf("%s.lock", basedir),
+		MetaPath:     filepath.Join(basedir, "overlay.json"),
+	}
+	if st, err := os.Stat(o.UpperDir); err != nil || !st.IsDir() {
+		return nil, fmt.Errorf("%s: %s", ErrNotAnOverlay, basedir)
+	}
+	return o, nil
+}
+
+// MountImage will mount the backing image read-only as the lower layer,
+// without mounting the overlay itself
+func (o *Overlay) MountImage() error {
+	if o.mountedImg {
+		return nil
+	}
+	if err := os.MkdirAll(o.ImgDir, 00755); err != nil {
+		return fmt.Errorf("Failed to create image directory %s, reason: %s\n", o.ImgDir, err)
+	}
+	if err := disk.GetMountManager().Mount(o.BackingImage.ImagePath, o.ImgDir, "auto", "ro", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %s\n", o.BackingImage.ImagePath, err)
+	}
+	o.mountedImg = true
+	return nil
+}
+
+// Diff will list every file added, modified or deleted by the overlay,
+// compared to the backing image, which must be mounted at ImgDir.
+// Directories are only listed when added, as existing directories are
+// copied into the upper layer whenever anything beneath them changes.
+func (o *Overlay) Diff() ([]OverlayFile, error) {
+	return diffLayers(o.UpperDir, o.ImgDir)
+}
+
+// diffLayers will classify each entry of the upper layer against the lower
+func diffLayers(upper, lower string) ([]OverlayFile, error) {
+	var files []OverlayFile
+	err := filepath.Walk(upper, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upper, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		file := OverlayFile{Path: "/" + rel}
+		_, lowerErr := os.Lstat(filepath.Join(lower, rel))
+		inLower := lowerErr == nil
+		switch {
+		case isWhiteout(info):
+			file.ChangeType = ChangeDeleted
+		case !inLower:
+			file.ChangeType = ChangeAdded
+		case info.IsDir():
+			return nil
+		default:
+			file.ChangeType = ChangeModified
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// isWhiteout will determine whether the file marks a deletion in an
+// overlayfs upper layer, being a character device numbered 0/0
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
@@ -0,0 +1,77 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDiffLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-diff")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	upper := filepath.Join(dir, "upper")
+	lower := filepath.Join(dir, "lower")
+	for _, d := range []string{"usr/bin", "etc"} {
+		for _, layer := range []string{upper, lower} {
+			if err = os.MkdirAll(filepath.Join(layer, d), 0755); err != nil {
+				t.Fatalf("Failed to create layer directory: %s", err)
+			}
+		}
+	}
+	if err = os.MkdirAll(filepath.Join(upper, "usr/share/nano"), 0755); err != nil {
+		t.Fatalf("Failed to create new directory: %s", err)
+	}
+	files := map[string]string{
+		filepath.Join(lower, "usr/bin/nano"): "old",
+		filepath.Join(upper, "usr/bin/nano"): "new",
+		filepath.Join(upper, "etc/nanorc"):   "set autoindent",
+	}
+	for path, content := range files {
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", path, err)
+		}
+	}
+	expected := map[string]ChangeType{
+		"/usr/bin/nano":   ChangeModified,
+		"/etc/nanorc":     ChangeAdded,
+		"/usr/share":      ChangeAdded,
+		"/usr/share/nano": ChangeAdded,
+	}
+	// Whiteouts can only be created by root
+	if err = syscall.Mknod(filepath.Join(upper, "etc/motd"), syscall.S_IFCHR, 0); err == nil {
+		expected["/etc/motd"] = ChangeDeleted
+	}
+	changes, err := diffLayers(upper, lower)
+	if err != nil {
+		t.Fatalf("Failed to diff layers: %s", err)
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for _, change := range changes {
+		if expected[change.Path] != change.ChangeType {
+			t.Fatalf("Expected %s to be %q, got %q", change.Path, expected[change.Path], change.ChangeType)
+		}
+	}
+}
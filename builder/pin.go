@@ -0,0 +1,141 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EopkgPackageDB is where eopkg records each installed package, within the
+// root, as a directory named name-version-release
+const EopkgPackageDB = "var/lib/eopkg/package"
+
+var (
+	// ErrPinNotInstalled is returned when pinning a package that is not installed
+	ErrPinNotInstalled = errors.New("Pinned package is not installed")
+
+	// ErrInvalidPin is returned when a pin is not in the form name=version
+	ErrInvalidPin = errors.New("Pins must be in the form name=version")
+)
+
+// ParsePins will parse the comma separated pins, i.e. "glibc=2.33,zlib=1.2.11"
+func ParsePins(value string) (map[string]string, error) {
+	pins := make(map[string]string)
+	for _, pin := range strings.Split(value, ",") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		pieces := strings.SplitN(pin, "=", 2)
+		if len(pieces) != 2 || pieces[0] == "" || pieces[1] == "" {
+			return nil, fmt.Errorf("%s: %s", ErrInvalidPin, pin)
+		}
+		pins[pieces[0]] = pieces[1]
+	}
+	return pins, nil
+}
+
+// installedPackages will return the version of every package installed in
+// the root, keyed by name
+func installedPackages(root string) (map[string]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, EopkgPackageDB))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read installed packages, reason: %s\n", err)
+	}
+	installed := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// Package names may contain hyphens, versions and releases do not
+		pieces := strings.Split(entry.Name(), "-")
+		if len(pieces) < 3 {
+			continue
+		}
+		name := strings.Join(pieces[:len(pieces)-2], "-")
+		installed[name] = pieces[len(pieces)-2]
+	}
+	return installed, nil
+}
+
+// SetPins will set the packages to be held at a fixed version
+func (e *EopkgManager) SetPins(pins map[string]string) {
+	e.pins = pins
+}
+
+// ApplyPins will pin every package set by SetPins, validating them all
+// before any are changed
+func (e *EopkgManager) ApplyPins() error {
+	if len(e.pins) < 1 {
+		return nil
+	}
+	installed, err := installedPackages(e.root)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range e.pins {
+		if _, ok := installed[name]; !ok {
+			return fmt.Errorf("Cannot pin %s, reason: %s\n", name, ErrPinNotInstalled)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.PinPackage(name, e.pins[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PinPackage will ensure the named package is installed at the given
+// version. Repositories only carry the latest release of a package, so
+// other versions are installed from the package cache.
+func (e *EopkgManager) PinPackage(name, version string) error {
+	installed, err := installedPackages(e.root)
+	if err != nil {
+		return err
+	}
+	current, ok := installed[name]
+	if !ok {
+		return fmt.Errorf("Cannot pin %s, reason: %s\n", name, ErrPinNotInstalled)
+	}
+	if current == version {
+		log.Debugf("Package %s is already at pinned version %s\n", name, version)
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(e.cacheTarget, fmt.Sprintf("%s-%s-*.eopkg", name, version)))
+	if len(matches) < 1 {
+		log.Warnf("Pinned version %s of %s is not available in the active repository, keeping %s\n", version, name, current)
+		return nil
+	}
+	// Prefer the most recent release of the pinned version
+	sort.Strings(matches)
+	pkgFile := filepath.Join("/var/cache/eopkg/packages", filepath.Base(matches[len(matches)-1]))
+	log.Warnf("Pinning %s to version %s, replacing %s\n", name, version, current)
+	if _, err = e.exec.Exec(eopkgCommand(fmt.Sprintf("eopkg install -y %s", pkgFile))); err != nil {
+		return fmt.Errorf("Failed to pin %s to version %s, reason: %s\n", name, version, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePins(t *testing.T) {
+	pins, err := ParsePins("glibc=2.33, zlib=1.2.11")
+	if err != nil {
+		t.Fatalf("Failed to parse valid pins: %v", err)
+	}
+	if len(pins) != 2 || pins["glibc"] != "2.33" || pins["zlib"] != "1.2.11" {
+		t.Fatalf("Wrong pins: %v", pins)
+	}
+	for _, bad := range []string{"glibc", "glibc=", "=2.33"} {
+		if _, err := ParsePins(bad); err == nil {
+			t.Fatalf("Accepted invalid pin: %s", bad)
+		}
+	}
+}
+
+func TestPinPackage(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-pin")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, pkg := range []string{"glibc-2.33-102", "python-setuptools-44.0.0-20"} {
+		if err := os.MkdirAll(filepath.Join(root, EopkgPackageDB, pkg), 00755); err != nil {
+			t.Fatalf("Failed to create package db: %v", err)
+		}
+	}
+	installed, err := installedPackages(root)
+	if err != nil {
+		t.Fatalf("Failed to read installed packages: %v", err)
+	}
+	if installed["python-setuptools"] != "44.0.0" || installed["glibc"] != "2.33" {
+		t.Fatalf("Wrong installed packages: %v", installed)
+	}
+
+	e := NewEopkgManager(nil, root)
+	if err := e.PinPackage("glibc", "2.33"); err != nil {
+		t.Fatalf("Failed to pin an installed version: %v", err)
+	}
+	// Not in the package cache, so only warns
+	if err := e.PinPackage("glibc", "2.32"); err != nil {
+		t.Fatalf("Failed on an unavailable version: %v", err)
+	}
+	e.SetPins(map[string]string{"glibc": "2.33", "zlib": "1.2.11"})
+	if err := e.ApplyPins(); err == nil || !strings.Contains(err.Error(), ErrPinNotInstalled.Error()) {
+		t.Fatalf("Expected an uninstalled package to be rejected, got: %v", err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 )
 
 // PackageType is simply the type of package we're building, i.e. xml / pspec
@@ -51,26 +52,61 @@ var (
 		Release: 1,
 		Path:    "",
 	}
+
+	// ErrInvalidBuildTime is returned when a fixed build time is unlikely to
+	// be what the user intended
+	ErrInvalidBuildTime = errors.New("Build time must be between the year 2000 and now")
+
+	// minBuildTime is the earliest fixed build time we'll accept
+	minBuildTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
 // Package is the main item we deal with, avoiding the internals
 type Package struct {
-	Name       string          // Name of the package
-	Version    string          // Version of this package
-	Release    int             // Solus upgrades are based entirely on relno
-	Type       PackageType     // ypkg or pspec.xml legacy
-	Path       string          // Path to the build spec
-	Sources    []source.Source // Each package has 0 or more sources that we fetch
-	CanNetwork bool            // Only applicable to ypkg builds
+	Name        string          // Name of the package
+	Version     string          // Version of this package
+	Release     int             // Solus upgrades are based entirely on relno
+	Type        PackageType     // ypkg or pspec.xml legacy
+	Path        string          // Path to the build spec
+	Sources     []source.Source // Each package has 0 or more sources that we fetch
+	CanNetwork  bool            // Only applicable to ypkg builds
+	BuildTime   time.Time       // Time of the build, used for SOURCE_DATE_EPOCH when fixed
+	FixedTime   bool            // Whether BuildTime was explicitly set by the user
+	Components  []string        // Components of the package and any subpackages
+	Summary     string          // Short summary of the main package
+	Description string          // Longer description of the main package
+	Homepage    string          // Upstream homepage, if known
+	Licenses    []string        // Licenses the package is distributed under
+	BuildDeps   []string        // Packages required to build the package
+	RunDeps     []string        // Additional runtime dependencies of the package and any subpackages
+
+	PreBuildHooks []string          // Commands run on the host before the sources are fetched
+	BuildEnv      map[string]string // Variables exported into the ypkg build
+	AssertVersion string            // Version the built packages must have, when set
+	IceCCEnabled  bool              // Whether to distribute compilation with icecream
+	Provides      []string          // Names of the package and any subpackages it declares
+
+	Options         *PackageOptions // Options from the sidecar beside the recipe, if any
+	ExtraComponents []string        // Components the package options require before building
 }
 
 // YmlPackage is a parsed ypkg build file
 type YmlPackage struct {
-	Name       string
-	Version    string
-	Release    int
-	Networking bool // If set to false (default) we disable networking in the build
-	Source     []map[string]string
+	Name        string
+	Version     string
+	Release     int
+	Networking  bool // If set to false (default) we disable networking in the build
+	Source      []map[string]string
+	Component   interface{} // Either a single component, or a list for subpackages
+	Summary     interface{} // Either a single summary, or a list for subpackages
+	Description interface{} // Either a single description, or a list for subpackages
+	Homepage    string
+	License     interface{} // Either a single license, or a list of licenses
+	BuildDeps   []string    `yaml:"builddeps"`
+	RunDeps     interface{} `yaml:"rundeps"`  // Either a list of dependencies, or per subpackage lists
+	PreBuild    []string    `yaml:"prebuild"` // Commands to run on the host before the build
+	Environment interface{} // Either a script for ypkg, or a map of variables to export
+	GitRef      string      `yaml:"git_ref"` // Ref to check out for git+https:// and git:// sources
 }
 
 // XMLUpdate represents an update in the package history
@@ -92,25 +128,64 @@ type XMLArchive struct {
 
 // XMLSource is the actual source info for each pspec.xml
 type XMLSource struct {
-	Homepage string
-	Name     string
-	Archive  []XMLArchive
+	Homepage    string
+	Name        string
+	Summary     string
+	Description string
+	License     []string
+	Archive     []XMLArchive
+	BuildDeps   []string `xml:"BuildDependencies>Dependency"`
+}
+
+// XMLSubPackage is a <Package> emitted by the pspec.xml
+type XMLSubPackage struct {
+	Name    string
+	PartOf  string
+	RunDeps []string `xml:"RuntimeDependencies>Dependency"`
 }
 
 // XMLPackage contains all of the pspec.xml metadata
 type XMLPackage struct {
-	Name    string
-	Source  XMLSource
-	History []XMLUpdate `xml:"History>Update"`
+	Name     string
+	Source   XMLSource
+	Packages []XMLSubPackage `xml:"Package"`
+	History  []XMLUpdate     `xml:"History>Update"`
 }
 
 // NewPackage will attempt to parse the given path, and return a new Package
 // instance if this succeeds.
 func NewPackage(path string) (*Package, error) {
+	var pkg *Package
+	var err error
 	if strings.HasSuffix(path, ".xml") {
-		return NewXMLPackage(path)
+		pkg, err = NewXMLPackage(path)
+	} else {
+		pkg, err = NewYmlPackage(path)
 	}
-	return NewYmlPackage(path)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Options, err = LoadPackageOptions(path); err != nil {
+		return nil, err
+	}
+	pkg.BuildTime = time.Now().UTC()
+	return pkg, nil
+}
+
+// SetBuildTime will parse the given ISO-8601 timestamp and use it as the
+// fixed time of the build, rejecting anything before 2000 or in the future
+// as a likely mistake.
+func (p *Package) SetBuildTime(timestamp string) error {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("Invalid build time '%s', reason: %s\n", timestamp, err)
+	}
+	if t.Before(minBuildTime) || t.After(time.Now()) {
+		return ErrInvalidBuildTime
+	}
+	p.BuildTime = t.UTC()
+	p.FixedTime = true
+	return nil
 }
 
 // NewXMLPackage will attempt to parse the pspec.xml file @ path
@@ -139,12 +214,27 @@ func NewXMLPackage(path string) (*Package, error) {
 
 	upd := xpkg.History[0]
 	ret := &Package{
-		Name:       strings.TrimSpace(xpkg.Source.Name),
-		Version:    strings.TrimSpace(upd.Version),
-		Release:    upd.Release,
-		Type:       PackageTypeXML,
-		Path:       path,
-		CanNetwork: true,
+		Name:        strings.TrimSpace(xpkg.Source.Name),
+		Version:     strings.TrimSpace(upd.Version),
+		Release:     upd.Release,
+		Type:        PackageTypeXML,
+		Path:        path,
+		CanNetwork:  true,
+		Summary:     strings.TrimSpace(xpkg.Source.Summary),
+		Description: strings.TrimSpace(xpkg.Source.Description),
+		Homepage:    strings.TrimSpace(xpkg.Source.Homepage),
+		Licenses:    trimAll(xpkg.Source.License),
+		BuildDeps:   trimAll(xpkg.Source.BuildDeps),
+	}
+
+	for _, sub := range xpkg.Packages {
+		if partOf := strings.TrimSpace(sub.PartOf); partOf != "" {
+			ret.Components = append(ret.Components, partOf)
+		}
+		ret.RunDeps = append(ret.RunDeps, trimAll(sub.RunDeps)...)
+		if name := strings.TrimSpace(sub.Name); name != "" {
+			ret.Provides = append(ret.Provides, name)
+		}
 	}
 
 	for _, archive := range xpkg.Source.Archive {
@@ -206,15 +296,35 @@ func NewYmlPackageFromBytes(by []byte) (*Package, error) {
 		Release:    ypkg.Release,
 		Type:       PackageTypeYpkg,
 		CanNetwork: ypkg.Networking,
+		Components: ymlStrings(ypkg.Component),
+		Homepage:   strings.TrimSpace(ypkg.Homepage),
+		Licenses:   ymlStrings(ypkg.License),
+		BuildDeps:  trimAll(ypkg.BuildDeps),
+		RunDeps:    ymlStrings(ypkg.RunDeps),
+
+		PreBuildHooks: trimAll(ypkg.PreBuild),
+	}
+	ret.Provides = ymlSubpackages(ret.Name, ypkg.Summary, ypkg.Description, ypkg.Component, ypkg.RunDeps)
+	if ret.BuildEnv, err = parseBuildEnv(ypkg.Environment); err != nil {
+		return nil, fmt.Errorf("ypkg: %s", err)
+	}
+	if summary := ymlStrings(ypkg.Summary); len(summary) > 0 {
+		ret.Summary = summary[0]
+	}
+	if description := ymlStrings(ypkg.Description); len(description) > 0 {
+		ret.Description = description[0]
 	}
 
 	for _, row := range ypkg.Source {
 		for key, value := range row {
-			source, err := source.New(key, value, false)
+			src, err := source.New(key, value, false)
 			if err != nil {
 				return nil, err
 			}
-			ret.Sources = append(ret.Sources, source)
+			if git, ok := src.(*source.GitArchiveSource); ok {
+				git.Ref = strings.TrimSpace(ypkg.GitRef)
+			}
+			ret.Sources = append(ret.Sources, src)
 		}
 	}
 
@@ -229,3 +339,78 @@ func NewYmlPackageFromBytes(by []byte) (*Package, error) {
 	}
 	return ret, nil
 }
+
+// ymlStrings will flatten ypkg keys such as component or rundeps, which are
+// either a single value or a list mixing values and "^subpackage : value" pairs.
+// The values of the main package always come first.
+func ymlStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = append(values, strings.TrimSpace(v))
+	case []interface{}:
+		var sub []string
+		for _, item := range v {
+			switch i := item.(type) {
+			case string:
+				values = append(values, strings.TrimSpace(i))
+			case map[interface{}]interface{}:
+				for _, s := range i {
+					sub = append(sub, ymlStrings(s)...)
+				}
+			default:
+				if item != nil {
+					values = append(values, strings.TrimSpace(fmt.Sprint(item)))
+				}
+			}
+		}
+		values = append(values, sub...)
+	case nil:
+	default:
+		values = append(values, strings.TrimSpace(fmt.Sprint(v)))
+	}
+	return values
+}
+
+// ymlSubpackages will return the name of the package followed by those of
+// the subpackages named by "^subpackage : value" pairs within the given keys.
+// Subpackage names starting with ^ are used as is, otherwise they are a
+// suffix of the package name.
+func ymlSubpackages(name string, keys ...interface{}) []string {
+	names := []string{name}
+	seen := map[string]bool{name: true}
+	for _, key := range keys {
+		items, ok := key.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range items {
+			pairs, ok := item.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			for k := range pairs {
+				sub := strings.TrimSpace(fmt.Sprint(k))
+				if strings.HasPrefix(sub, "^") {
+					sub = sub[1:]
+				} else {
+					sub = name + "-" + sub
+				}
+				if !seen[sub] {
+					seen[sub] = true
+					names = append(names, sub)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// trimAll will trim the whitespace from every value
+func trimAll(values []string) []string {
+	var trimmed []string
+	for _, value := range values {
+		trimmed = append(trimmed, strings.TrimSpace(value))
+	}
+	return trimmed
+}
@@ -0,0 +1,183 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"github.com/getsolus/solbuild/builder/source"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	LegacyTestFile = "testdata/legacy/pspec.xml"
+)
+
+func TestNewXMLPackage(t *testing.T) {
+	p, err := NewPackage(LegacyTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load legacy package: %v", err)
+	}
+	if p.Type != PackageTypeXML {
+		t.Fatalf("Wrong package type: %v", p.Type)
+	}
+	if p.Name != "hello" || p.Version != "2.10" || p.Release != 3 {
+		t.Fatalf("Wrong package metadata: %s %s %d", p.Name, p.Version, p.Release)
+	}
+	if !p.CanNetwork {
+		t.Fatal("Legacy packages must be able to network")
+	}
+	if len(p.Sources) != 1 {
+		t.Fatalf("Invalid number of sources: %d vs expected 1", len(p.Sources))
+	}
+	if p.Summary != "GNU Hello" || p.Homepage != "https://www.gnu.org/software/hello/" {
+		t.Fatalf("Wrong package summary or homepage: %s %s", p.Summary, p.Homepage)
+	}
+	if len(p.Licenses) != 1 || len(p.BuildDeps) != 2 || len(p.RunDeps) != 1 {
+		t.Fatalf("Wrong licenses or dependencies: %v %v %v", p.Licenses, p.BuildDeps, p.RunDeps)
+	}
+	if p.GetWorkDirInternal() != "/WORK" {
+		t.Fatalf("Wrong legacy work directory: %s", p.GetWorkDirInternal())
+	}
+	if _, err := NewXMLPackage(ProfileTestFile); err == nil {
+		t.Fatal("Loaded an invalid pspec file")
+	}
+}
+
+func TestNewYmlPackageMetadata(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 151
+homepage: https://www.nano-editor.org/
+license:
+    - GPL-3.0-or-later
+    - GFDL-1.2-or-later
+component: system.utils
+summary:
+    - ^nano-docs : Documentation for nano
+    - Small and friendly text editor
+description: |
+    GNU nano is a small and friendly text editor.
+builddeps:
+    - pkgconfig(ncursesw)
+rundeps:
+    - file
+    - ^nano-docs :
+        - man-db
+        - info
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	if p.Summary != "Small and friendly text editor" {
+		t.Fatalf("Wrong summary: %s", p.Summary)
+	}
+	if p.Description != "GNU nano is a small and friendly text editor." {
+		t.Fatalf("Wrong description: %s", p.Description)
+	}
+	if p.Homepage != "https://www.nano-editor.org/" {
+		t.Fatalf("Wrong homepage: %s", p.Homepage)
+	}
+	if len(p.Licenses) != 2 || len(p.BuildDeps) != 1 || len(p.RunDeps) != 3 {
+		t.Fatalf("Wrong licenses or dependencies: %v %v %v", p.Licenses, p.BuildDeps, p.RunDeps)
+	}
+	if strings.Join(p.Provides, " ") != "nano nano-docs" {
+		t.Fatalf("Wrong subpackages: %v", p.Provides)
+	}
+}
+
+func TestNewYmlPackageGitRef(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 7.2
+release: 120
+git_ref: v7.2
+source:
+    - git+https://git.savannah.gnu.org/git/nano.git : 6e3c4d9ad4c47c3fa5e7c2d4e2b0b8a1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7
+    - https://www.nano-editor.org/dist/v7/nano-7.2.tar.xz : 86f3442768bd2873cec693f83cdf80b4b444ad3cc14760b74361474fc87a4526
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	if len(p.Sources) != 2 || !p.Sources[0].IsGit() || p.Sources[1].IsGit() {
+		t.Fatalf("Wrong sources: %v", p.Sources)
+	}
+	git, ok := p.Sources[0].(*source.GitArchiveSource)
+	if !ok || git.Ref != "v7.2" || git.File != "nano.git" {
+		t.Fatalf("Wrong git source: %+v", p.Sources[0])
+	}
+	if problems := source.Validate(git); len(problems) > 0 {
+		t.Fatalf("Valid git source has problems: %v", problems)
+	}
+	git.Ref = ""
+	if problems := source.Validate(git); len(problems) != 1 {
+		t.Fatalf("Expected a missing git_ref, got: %v", problems)
+	}
+}
+
+func TestSetBuildTime(t *testing.T) {
+	p := &Package{}
+	if err := p.SetBuildTime("2024-01-01T00:00:00Z"); err != nil {
+		t.Fatalf("Rejected a valid build time: %v", err)
+	}
+	if !p.FixedTime || p.BuildTime.Unix() != 1704067200 {
+		t.Fatalf("Wrong build time stored: %v", p.BuildTime)
+	}
+	for _, ts := range []string{
+		"1999-12-31T23:59:59Z",
+		time.Now().Add(time.Hour).Format(time.RFC3339),
+		"2024-01-01",
+	} {
+		if err := (&Package{}).SetBuildTime(ts); err == nil {
+			t.Fatalf("Accepted an invalid build time: %s", ts)
+		}
+	}
+}
+
+func TestValidateComponent(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 151
+component:
+    - system.utils
+    - ^nano-docs : desktop.gnome.doc
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	if len(p.Components) != 2 {
+		t.Fatalf("Invalid number of components: %d vs expected 2", len(p.Components))
+	}
+	if err := p.ValidateComponent(); err != nil {
+		t.Fatalf("Rejected valid components: %v", err)
+	}
+	p.Components = []string{"system.util"}
+	if err := p.ValidateComponent(); err == nil {
+		t.Fatal("Accepted an unknown component")
+	}
+	p.Components = nil
+	if err := p.ValidateComponent(); err != ErrNoComponent {
+		t.Fatalf("Expected ErrNoComponent, got: %v", err)
+	}
+
+	legacy, err := NewPackage(LegacyTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load legacy package: %v", err)
+	}
+	if err := legacy.ValidateComponent(); err != nil {
+		t.Fatalf("Rejected valid legacy component: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+// A PackageManager installs and maintains the packages within a root. The
+// EopkgManager is the only implementation used for real builds.
+type PackageManager interface {
+	// Init will prepare the root for use by the package manager
+	Init() error
+
+	// CopyAssets will copy any required host-side assets into the root
+	CopyAssets() error
+
+	// StartDBUS will bring up the system bus within the root
+	StartDBUS() error
+
+	// StopDBUS will tear down the system bus within the root
+	StopDBUS() error
+
+	// Cleanup will release any host resources used by the root
+	Cleanup()
+
+	// Upgrade will upgrade every package in the root
+	Upgrade() error
+
+	// RefreshRepos will refresh the repository indexes without upgrading
+	RefreshRepos() error
+
+	// Rollback will undo the most recent upgrade of the root
+	Rollback() error
+
+	// InstallComponent will install every package in the component
+	InstallComponent(comp string) error
+
+	// InstallBuildDeps will install the build dependencies of the recipe,
+	// given by its path inside the root
+	InstallBuildDeps(recipe string) error
+
+	// InstallPackages will install the named packages in a single transaction
+	InstallPackages(pkgs []string) error
+
+	// DryRunInstall will return the conflicts that installing the named
+	// packages would cause
+	DryRunInstall(packages []string) ([]string, error)
+
+	// DryRunComponent will return the conflicts that installing the
+	// component would cause
+	DryRunComponent(comp string) ([]string, error)
+
+	// SetExtras will set the extra packages and components to install
+	SetExtras(pkgs, components []string)
+
+	// HasExtras will return true if any extra packages or components are set
+	HasExtras() bool
+
+	// InstallExtras will install the extra packages and components
+	InstallExtras() error
+
+	// SetPins will set the packages to be held at a fixed version, by name
+	SetPins(pins map[string]string)
+
+	// ApplyPins will install each pinned package at its pinned version
+	ApplyPins() error
+
+	// ListRepos will return the repositories configured in the root, in
+	// order of priority
+	ListRepos() ([]*EopkgRepo, error)
+
+	// AddRepo will add the repository to the root, failing with a
+	// RepoExistsError if the name is taken
+	AddRepo(id, source string) error
+
+	// RemoveRepo will remove the repository from the root
+	RemoveRepo(id string) error
+
+	// SetRepoPriority will move the repository to the given position,
+	// where 0 is the highest priority
+	SetRepoPriority(id string, position int) error
+}
+
+// EopkgManager must remain usable as a PackageManager
+var _ PackageManager = (*EopkgManager)(nil)
@@ -0,0 +1,185 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mockPackageManager records each call made to it, failing the calls named
+// in errs
+type mockPackageManager struct {
+	calls     []string
+	errs      map[string]error
+	conflicts []string
+	repos     []*EopkgRepo
+	extras    []string
+}
+
+func newMockPackageManager() *mockPackageManager {
+	return &mockPackageManager{errs: make(map[string]error)}
+}
+
+func (m *mockPackageManager) record(call string) error {
+	m.calls = append(m.calls, call)
+	return m.errs[strings.Fields(call)[0]]
+}
+
+// SetActivePID allows the mock to also stand in as the PidNotifier
+func (m *mockPackageManager) SetActivePID(int) {}
+
+func (m *mockPackageManager) Init() error       { return m.record("Init") }
+func (m *mockPackageManager) CopyAssets() error { return m.record("CopyAssets") }
+func (m *mockPackageManager) StartDBUS() error  { return m.record("StartDBUS") }
+func (m *mockPackageManager) StopDBUS() error   { return m.record("StopDBUS") }
+func (m *mockPackageManager) Cleanup()          { m.record("Cleanup") }
+func (m *mockPackageManager) Upgrade() error    { return m.record("Upgrade") }
+func (m *mockPackageManager) Rollback() error   { return m.record("Rollback") }
+
+func (m *mockPackageManager) RefreshRepos() error { return m.record("RefreshRepos") }
+
+func (m *mockPackageManager) InstallComponent(comp string) error {
+	return m.record("InstallComponent " + comp)
+}
+
+func (m *mockPackageManager) InstallBuildDeps(recipe string) error {
+	return m.record("InstallBuildDeps " + recipe)
+}
+
+func (m *mockPackageManager) InstallPackages(pkgs []string) error {
+	return m.record("InstallPackages " + strings.Join(pkgs, " "))
+}
+
+func (m *mockPackageManager) DryRunInstall(packages []string) ([]string, error) {
+	return m.conflicts, m.record("DryRunInstall " + strings.Join(packages, " "))
+}
+
+func (m *mockPackageManager) DryRunComponent(comp string) ([]string, error) {
+	return m.conflicts, m.record("DryRunComponent " + comp)
+}
+
+func (m *mockPackageManager) SetExtras(pkgs, components []string) { m.extras = pkgs }
+func (m *mockPackageManager) HasExtras() bool                     { return len(m.extras) > 0 }
+func (m *mockPackageManager) InstallExtras() error                { return m.record("InstallExtras") }
+
+func (m *mockPackageManager) SetPins(pins map[string]string) {}
+func (m *mockPackageManager) ApplyPins() error               { return m.record("ApplyPins") }
+
+func (m *mockPackageManager) ListRepos() ([]*EopkgRepo, error) {
+	return m.repos, m.record("ListRepos")
+}
+
+func (m *mockPackageManager) AddRepo(id, source string) error {
+	return m.record(fmt.Sprintf("AddRepo %s %s", id, source))
+}
+
+func (m *mockPackageManager) RemoveRepo(id string) error {
+	return m.record("RemoveRepo " + id)
+}
+
+func (m *mockPackageManager) SetRepoPriority(id string, position int) error {
+	return m.record(fmt.Sprintf("SetRepoPriority %s %d", id, position))
+}
+
+func TestPrepareRoot(t *testing.T) {
+	pman := newMockPackageManager()
+	pman.repos = []*EopkgRepo{{ID: "Solus", URI: "https://example.com/eopkg-index.xml.xz"}}
+	profile := &Profile{
+		RemoveRepos: []string{"*"},
+		Repos: map[string]*Repo{
+			"Unstable": {Name: "Unstable", URI: "https://example.com/unstable/eopkg-index.xml.xz"},
+		},
+	}
+	pkg := &Package{Type: PackageTypeYpkg}
+	if err := pkg.PrepareRoot(pman, profile, pman, nil, NewStageTimer()); err != nil {
+		t.Fatalf("Failed to prepare root: %v", err)
+	}
+	expected := []string{
+		"Init",
+		"StartDBUS",
+		"ListRepos",
+		"RemoveRepo Solus",
+		"AddRepo Unstable https://example.com/unstable/eopkg-index.xml.xz",
+		"ListRepos",
+		"Upgrade",
+		"DryRunComponent system.devel",
+		"InstallComponent system.devel",
+		"InstallExtras",
+		"ApplyPins",
+	}
+	if !reflect.DeepEqual(pman.calls, expected) {
+		t.Fatalf("Wrong package manager calls:\n%v\nexpected:\n%v", pman.calls, expected)
+	}
+}
+
+func TestPrepareRootDistcc(t *testing.T) {
+	DistccHosts = []string{"192.168.1.2"}
+	defer func() { DistccHosts = nil }()
+	pman := newMockPackageManager()
+	pkg := &Package{Type: PackageTypeYpkg}
+	if err := pkg.PrepareRoot(pman, &Profile{}, pman, nil, NewStageTimer()); err != nil {
+		t.Fatalf("Failed to prepare root: %v", err)
+	}
+	if call := pman.calls[len(pman.calls)-2]; call != "InstallPackages distcc" {
+		t.Fatalf("distcc was not installed before pinning, got: %s", call)
+	}
+}
+
+func TestPrepareRootFailure(t *testing.T) {
+	pman := newMockPackageManager()
+	pman.errs["Upgrade"] = errors.New("mirror unreachable")
+	timer := NewStageTimer()
+	pkg := &Package{Type: PackageTypeYpkg}
+	err := timer.Fail(pkg.PrepareRoot(pman, &Profile{}, pman, nil, timer))
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != StageUpgrade {
+		t.Fatalf("Expected a failure in the upgrade stage, got: %v", err)
+	}
+	for _, call := range pman.calls {
+		if strings.HasPrefix(call, "InstallComponent") {
+			t.Fatal("Installed system.devel after a failed upgrade")
+		}
+	}
+}
+
+func TestPrepareRootConflict(t *testing.T) {
+	pman := newMockPackageManager()
+	pman.conflicts = []string{"foo conflicts with: bar"}
+	pkg := &Package{Type: PackageTypeYpkg}
+	err := pkg.PrepareRoot(pman, &Profile{}, pman, nil, NewStageTimer())
+	if !errors.Is(err, ErrDependencyConflict) {
+		t.Fatalf("Expected a dependency conflict, got: %v", err)
+	}
+	if last := pman.calls[len(pman.calls)-1]; last != "DryRunComponent system.devel" {
+		t.Fatalf("Continued after a conflict, last call: %s", last)
+	}
+}
+
+func TestPrepareRootIcecc(t *testing.T) {
+	pman := newMockPackageManager()
+	pkg := &Package{Type: PackageTypeYpkg, IceCCEnabled: true}
+	if err := pkg.PrepareRoot(pman, &Profile{}, pman, nil, NewStageTimer()); err != nil {
+		t.Fatalf("Failed to prepare root: %v", err)
+	}
+	if call := pman.calls[len(pman.calls)-2]; call != "InstallPackages "+IceccPackage {
+		t.Fatalf("icecc was not installed before pinning, got: %s", call)
+	}
+}
@@ -0,0 +1,289 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EopkgInstallArchive is the archive within each .eopkg holding its files
+const EopkgInstallArchive = "install.tar.xz"
+
+// PolicySeverity is how serious a violation of the packaging policy is
+type PolicySeverity string
+
+const (
+	// PolicyWarning violations are logged, but do not fail the build
+	PolicyWarning PolicySeverity = "warning"
+
+	// PolicyError violations fail the build
+	PolicyError PolicySeverity = "error"
+)
+
+var (
+	// PolicyCheck will run the PolicyCheckers over the packages produced by
+	// the build
+	PolicyCheck bool
+
+	// PolicyCheckers are the checks run by PolicyCheck
+	PolicyCheckers = []PolicyChecker{&DefaultPolicyChecker{Rules: DefaultPolicyRules}}
+
+	// ErrPolicyViolation is matched by a PolicyViolationError, via errors.Is
+	ErrPolicyViolation = errors.New("The packages violate the packaging policy")
+
+	// ErrUnknownPolicyRule is returned when enabling a rule that doesn't exist
+	ErrUnknownPolicyRule = errors.New("Unknown policy rule")
+)
+
+// A PolicyViolation is a single breach of the packaging policy
+type PolicyViolation struct {
+	Rule     string
+	Severity PolicySeverity
+	Message  string
+}
+
+// A PolicyChecker checks a built .eopkg against the packaging policy
+type PolicyChecker interface {
+	// Check will return every violation of the policy by the .eopkg
+	Check(eopkgPath string) []PolicyViolation
+}
+
+// A PolicyViolationError is returned when the packages have violations of
+// PolicyError severity
+type PolicyViolationError struct {
+	Errors int
+}
+
+// Error returns a summary of the violations found
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("Found %d violation(s) of the packaging policy", e.Errors)
+}
+
+// Is allows matching the PolicyViolationError against ErrPolicyViolation
+func (e *PolicyViolationError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// A PolicyRule checks each file installed by a package, returning a message
+// describing the violation, or "" if there is none
+type PolicyRule struct {
+	Name     string
+	Severity PolicySeverity
+	Check    func(pkg string, file *tar.Header) string
+}
+
+// DefaultPolicyRules are the rules of the DefaultPolicyChecker
+var DefaultPolicyRules = []PolicyRule{
+	{
+		// Some packages, such as sudo, genuinely need it
+		Name:     "setuid",
+		Severity: PolicyWarning,
+		Check: func(pkg string, file *tar.Header) string {
+			if file.Typeflag == tar.TypeReg && file.Mode&(04000|02000) != 0 {
+				return fmt.Sprintf("/%s is setuid or setgid (%04o)", file.Name, file.Mode&07777)
+			}
+			return ""
+		},
+	},
+	{
+		Name:     "world-writable",
+		Severity: PolicyError,
+		Check: func(pkg string, file *tar.Header) string {
+			// Sticky directories such as /tmp are writable by design
+			if file.Typeflag == tar.TypeSymlink || file.Mode&01002 != 00002 {
+				return ""
+			}
+			return fmt.Sprintf("/%s is world-writable (%04o)", file.Name, file.Mode&07777)
+		},
+	},
+	{
+		Name:     "libtool-archive",
+		Severity: PolicyError,
+		Check: func(pkg string, file *tar.Header) string {
+			if file.Typeflag != tar.TypeDir && strings.HasSuffix(file.Name, ".la") {
+				return fmt.Sprintf("/%s is a libtool archive", file.Name)
+			}
+			return ""
+		},
+	},
+	{
+		Name:     "static-library",
+		Severity: PolicyError,
+		Check: func(pkg string, file *tar.Header) string {
+			if strings.HasSuffix(pkg, "-devel") || file.Typeflag == tar.TypeDir || !strings.HasSuffix(file.Name, ".a") {
+				return ""
+			}
+			return fmt.Sprintf("/%s is a static library outside of a -devel package", file.Name)
+		},
+	},
+}
+
+// NewDefaultPolicyChecker will return a DefaultPolicyChecker with only the
+// named rules of DefaultPolicyRules, or every rule if none are named
+func NewDefaultPolicyChecker(names []string) (*DefaultPolicyChecker, error) {
+	if len(names) < 1 {
+		return &DefaultPolicyChecker{Rules: DefaultPolicyRules}, nil
+	}
+	checker := &DefaultPolicyChecker{}
+	for _, name := range names {
+		found := false
+		for _, rule := range DefaultPolicyRules {
+			if rule.Name == name {
+				checker.Rules = append(checker.Rules, rule)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: %s", ErrUnknownPolicyRule, name)
+		}
+	}
+	return checker, nil
+}
+
+// A DefaultPolicyChecker applies each of its rules to every file installed by
+// the package
+type DefaultPolicyChecker struct {
+	Rules []PolicyRule
+}
+
+// Check will apply the rules to the files of the .eopkg. A package that
+// cannot be read is itself a violation.
+func (c *DefaultPolicyChecker) Check(eopkgPath string) []PolicyViolation {
+	var violations []PolicyViolation
+	err := walkEopkgFiles(eopkgPath, func(pkg string, file *tar.Header) {
+		for _, rule := range c.Rules {
+			if msg := rule.Check(pkg, file); msg != "" {
+				violations = append(violations, PolicyViolation{
+					Rule:     rule.Name,
+					Severity: rule.Severity,
+					Message:  msg,
+				})
+			}
+		}
+	})
+	if err != nil {
+		violations = append(violations, PolicyViolation{
+			Rule:     "unreadable",
+			Severity: PolicyError,
+			Message:  fmt.Sprintf("Failed to read the files of the package, reason: %s", strings.TrimSpace(err.Error())),
+		})
+	}
+	return violations
+}
+
+// walkEopkgFiles will call fn with the name of the package and each file in
+// its install archive
+func walkEopkgFiles(path string, fn func(pkg string, file *tar.Header)) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	var meta *zip.File
+	var install *zip.File
+	for _, f := range archive.File {
+		switch f.Name {
+		case EopkgMetadataFile:
+			meta = f
+		case EopkgInstallArchive:
+			install = f
+		}
+	}
+	if meta == nil || install == nil {
+		return fmt.Errorf("Missing %s or %s", EopkgMetadataFile, EopkgInstallArchive)
+	}
+
+	r, err := meta.Open()
+	if err != nil {
+		return err
+	}
+	var metadata eopkgMetadata
+	err = xml.NewDecoder(r).Decode(&metadata)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to parse %s, reason: %s\n", EopkgMetadataFile, err)
+	}
+
+	r, err = install.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd := exec.Command("xz", "--decompress", "--stdout")
+	cmd.Stdin = r
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	tr := tar.NewReader(out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// xz would otherwise block writing the rest of the archive forever
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("Failed to read %s, reason: %s\n", EopkgInstallArchive, err)
+		}
+		hdr.Name = strings.TrimPrefix(hdr.Name, "./")
+		fn(metadata.Name, hdr)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("Failed to decompress %s, reason: %s\n", EopkgInstallArchive, err)
+	}
+	return nil
+}
+
+// CheckPolicy will run the PolicyCheckers over the .eopkg files, logging
+// each violation, and returning a PolicyViolationError if any are errors
+func CheckPolicy(eopkgs []string) error {
+	errs := 0
+	sorted := append([]string{}, eopkgs...)
+	sort.Strings(sorted)
+	for _, eopkg := range sorted {
+		for _, checker := range PolicyCheckers {
+			for _, v := range checker.Check(eopkg) {
+				if v.Severity == PolicyError {
+					log.Errorf("%s: [%s] %s\n", filepath.Base(eopkg), v.Rule, v.Message)
+					errs++
+				} else {
+					log.Warnf("%s: [%s] %s\n", filepath.Base(eopkg), v.Rule, v.Message)
+				}
+			}
+		}
+	}
+	if errs > 0 {
+		return &PolicyViolationError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writePolicyEopkg will write an .eopkg installing the given files to dir
+func writePolicyEopkg(t *testing.T, dir, name string, files []*tar.Header) string {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, hdr := range files {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to add %s: %v", hdr.Name, err)
+		}
+	}
+	tw.Close()
+	return writeEopkg(t, dir, name, archive.Bytes())
+}
+
+// writeEopkg will write an .eopkg with the given install archive to dir
+func writeEopkg(t *testing.T, dir, name string, archive []byte) string {
+	cmd := exec.Command("xz", "--compress", "--stdout")
+	cmd.Stdin = bytes.NewReader(archive)
+	compressed, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to compress install archive: %v", err)
+	}
+
+	path := filepath.Join(dir, name+"-1.0-1-1-x86_64.eopkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create package: %v", err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	m, _ := w.Create(EopkgMetadataFile)
+	m.Write([]byte("<PISI><Package><Name>" + name + "</Name></Package></PISI>"))
+	i, _ := w.Create(EopkgInstallArchive)
+	i.Write(compressed)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	return path
+}
+
+func TestDefaultPolicyChecker(t *testing.T) {
+	dir := t.TempDir()
+	files := []*tar.Header{
+		{Name: "usr/bin/sudo", Mode: 04755, Typeflag: tar.TypeReg},
+		{Name: "usr/share/foo/state", Mode: 00666, Typeflag: tar.TypeReg},
+		{Name: "usr/share/foo/tmp", Mode: 01777, Typeflag: tar.TypeDir},
+		{Name: "usr/lib64/libfoo.so", Linkname: "libfoo.so.1", Mode: 00777, Typeflag: tar.TypeSymlink},
+		{Name: "usr/lib64/libfoo.la", Mode: 00644, Typeflag: tar.TypeReg},
+		{Name: "usr/lib64/libfoo.a", Mode: 00644, Typeflag: tar.TypeReg},
+	}
+	checker := &DefaultPolicyChecker{Rules: DefaultPolicyRules}
+
+	var rules []string
+	for _, v := range checker.Check(writePolicyEopkg(t, dir, "foo", files)) {
+		rules = append(rules, v.Rule)
+	}
+	expected := []string{"setuid", "world-writable", "libtool-archive", "static-library"}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Wrong violations %v, expected %v", rules, expected)
+	}
+
+	// Static libraries belong in -devel packages
+	for _, v := range checker.Check(writePolicyEopkg(t, dir, "foo-devel", files[5:])) {
+		t.Fatalf("Unexpected violation in a -devel package: %v", v)
+	}
+
+	broken := filepath.Join(dir, "broken.eopkg")
+	ioutil.WriteFile(broken, []byte("not a package"), 00644)
+	if v := checker.Check(broken); len(v) != 1 || v[0].Severity != PolicyError {
+		t.Fatalf("An unreadable package should be an error, got %v", v)
+	}
+}
+
+func TestWalkEopkgFilesTruncated(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "usr/bin/foo", Mode: 00755, Typeflag: tar.TypeReg})
+	offset := archive.Len()
+	size := int64(8 * 1024 * 1024)
+	tw.WriteHeader(&tar.Header{Name: "usr/share/foo/data", Mode: 00644, Size: size, Typeflag: tar.TypeReg})
+	tw.Write(make([]byte, size))
+	tw.Close()
+	// Lose half of the second header, leaving far more output than a pipe
+	// will hold behind the corrupt block
+	data := archive.Bytes()
+	truncated := append(append([]byte{}, data[:offset]...), data[offset+256:]...)
+	path := writeEopkg(t, t.TempDir(), "foo", truncated)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- walkEopkgFiles(path, func(string, *tar.Header) {})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Expected an error for a truncated install archive")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out reading a truncated install archive")
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	dir := t.TempDir()
+	warn := writePolicyEopkg(t, dir, "sudo", []*tar.Header{{Name: "usr/bin/sudo", Mode: 04755, Typeflag: tar.TypeReg}})
+	if err := CheckPolicy([]string{warn}); err != nil {
+		t.Fatalf("Warnings should not fail the build, got: %v", err)
+	}
+	bad := writePolicyEopkg(t, dir, "foo", []*tar.Header{{Name: "usr/lib64/libfoo.la", Mode: 00644, Typeflag: tar.TypeReg}})
+	err := CheckPolicy([]string{warn, bad})
+	var policyErr *PolicyViolationError
+	if !errors.As(err, &policyErr) || policyErr.Errors != 1 || !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("Expected a single policy error, got: %v", err)
+	}
+}
+
+func TestNewDefaultPolicyChecker(t *testing.T) {
+	checker, err := NewDefaultPolicyChecker([]string{"setuid"})
+	if err != nil || len(checker.Rules) != 1 || checker.Rules[0].Name != "setuid" {
+		t.Fatalf("Expected only the setuid rule, got %v %v", checker, err)
+	}
+	if _, err := NewDefaultPolicyChecker([]string{"nonsense"}); err == nil {
+		t.Fatal("Expected an unknown rule to fail")
+	}
+}
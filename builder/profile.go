@@ -17,21 +17,24 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // A Repo is a definition of a repository to add to the eopkg root during
 // the build process.
 type Repo struct {
-	Name      string `toml:"-"`         // Name of the repo, set by implementation not yoml
-	URI       string `toml:"uri"`       // URI of the repository
-	Local     bool   `toml:"local"`     // Local repository for bindmounting
-	AutoIndex bool   `toml:"autoindex"` // Enable automatic indexing of the repo
+	Name      string `toml:"-"         yaml:"name"`      // Name of the repo, set by implementation not yoml
+	URI       string `toml:"uri"       yaml:"uri"`       // URI of the repository
+	Local     bool   `toml:"local"     yaml:"local"`     // Local repository for bindmounting
+	AutoIndex bool   `toml:"autoindex" yaml:"autoindex"` // Enable automatic indexing of the repo
 }
 
 // A Profile is a configuration defining what backing image to use, what repos
@@ -42,15 +45,81 @@ type Profile struct {
 	Name        string           `toml:"-"`            // Name of this profile, set by file name not toml
 	RemoveRepos []string         `toml:"remove_repos"` // A set of repos to remove. ["*"] is valid here.
 	Repos       map[string]*Repo `toml:"repo"`         // Allow defining custom repos
+	PreInstall  []string         `toml:"-"`            // Packages to install before every build, from the ProfileConfig
+	Snapshot    string           `toml:"snapshot"`     // URL of dated repository snapshots, i.e. https://example.com/{date}/eopkg-index.xml.xz
+	Bootstrap   *BootstrapConfig `toml:"bootstrap"`    // How to build the image from scratch, when there is none to download
+}
+
+// A ProfileConfig holds additional configuration for a profile, kept in the
+// images directory alongside the backing image.
+type ProfileConfig struct {
+	ExtraRepos []*Repo           `yaml:"extra_repos"` // Repos to add after those of the profile
+	PreInstall []string          `yaml:"pre_install"` // Packages to install before every build
+	Env        map[string]string `yaml:"env"`         // Variables to set within the chroot
 }
 
 var (
 	// ProfileSuffix is the fixed extension for solbuild profile files
 	ProfileSuffix = ".profile"
+
+	// ProfileConfigSuffix is the fixed extension for profile configuration
+	// files in the images directory
+	ProfileConfigSuffix = ".yml"
+)
+
+var (
+	// ErrInvalidAlias is returned when a profile alias cannot be resolved
+	ErrInvalidAlias = errors.New("Invalid profile alias")
+
+	// ProfileAliases map short names to the profiles they stand for
+	ProfileAliases = make(map[string]string)
 )
 
-// NewProfile will attempt to load the named profile from the system paths
+// ResolveProfileAlias will return the name of the profile an alias stands
+// for, or the name unchanged if it is not an alias
+func ResolveProfileAlias(name string) string {
+	if target, ok := ProfileAliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// AliasesOf will return the aliases of the named profile, sorted
+func AliasesOf(name string) []string {
+	var aliases []string
+	for alias, target := range ProfileAliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// ValidateProfileAliases will ensure that every alias stands for one of the
+// given profiles, and does not hide a profile of the same name
+func ValidateProfileAliases(aliases map[string]string, profiles map[string]*Profile) error {
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		target := aliases[alias]
+		if _, ok := profiles[alias]; ok {
+			return fmt.Errorf("%s: '%s' is already the name of a profile", ErrInvalidAlias, alias)
+		}
+		if _, ok := profiles[target]; !ok {
+			return fmt.Errorf("%s: '%s' stands for unknown profile '%s'", ErrInvalidAlias, alias, target)
+		}
+	}
+	return nil
+}
+
+// NewProfile will attempt to load the named profile from the system paths.
+// Aliases are resolved to the profile they stand for.
 func NewProfile(name string) (*Profile, error) {
+	name = ResolveProfileAlias(name)
 	for _, p := range ConfigPaths {
 		fp := filepath.Join(p, fmt.Sprintf("%s%s", name, ProfileSuffix))
 		if !PathExists(fp) {
@@ -127,3 +196,76 @@ func NewProfileFromPath(path string) (*Profile, error) {
 
 	return profile, nil
 }
+
+// LoadProfileConfig will load the configuration for the named profile from
+// the images directory. An empty configuration is returned if there is none.
+func LoadProfileConfig(name string) (*ProfileConfig, error) {
+	return NewProfileConfigFromPath(filepath.Join(ImagesDir, name+ProfileConfigSuffix))
+}
+
+// NewProfileConfigFromPath will attempt to load a profile configuration from
+// the given file name. An empty configuration is returned if there is none.
+func NewProfileConfigFromPath(path string) (*ProfileConfig, error) {
+	config := &ProfileConfig{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err = yaml.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("Invalid profile configuration %s, reason: %s\n", path, err)
+	}
+	for _, repo := range config.ExtraRepos {
+		if repo.Name == "" || repo.URI == "" {
+			return nil, fmt.Errorf("Invalid profile configuration %s, reason: extra repos need a name and uri\n", path)
+		}
+	}
+	for key := range config.Env {
+		if key == "" || strings.ContainsRune(key, '=') {
+			return nil, fmt.Errorf("Invalid profile configuration %s, reason: bad variable name '%s'\n", path, key)
+		}
+		if DeniedEnvironment[strings.ToUpper(key)] {
+			return nil, fmt.Errorf("Invalid profile configuration %s, reason: %s may not be set\n", path, key)
+		}
+	}
+	return config, nil
+}
+
+// Merge will return a copy of the profile with the extra repos and packages
+// of the configuration added
+func (c *ProfileConfig) Merge(profile *Profile) *Profile {
+	merged := *profile
+	merged.Repos = make(map[string]*Repo, len(profile.Repos)+len(c.ExtraRepos))
+	for name, repo := range profile.Repos {
+		merged.Repos[name] = repo
+	}
+	// Only an explicit list of repos to add needs extending
+	explicit := len(profile.AddRepos) > 0 && !(len(profile.AddRepos) == 1 && profile.AddRepos[0] == "*")
+	if explicit {
+		merged.AddRepos = append([]string{}, profile.AddRepos...)
+	}
+	for _, repo := range c.ExtraRepos {
+		if _, ok := merged.Repos[repo.Name]; !ok && explicit {
+			merged.AddRepos = append(merged.AddRepos, repo.Name)
+		}
+		merged.Repos[repo.Name] = repo
+	}
+	merged.PreInstall = append(append([]string{}, profile.PreInstall...), c.PreInstall...)
+	return &merged
+}
+
+// Environment will set the variables of the configuration in the chroot
+// environment, in a stable order
+func (c *ProfileConfig) Environment(env []string) []string {
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = setEnv(env, key, c.Env[key])
+	}
+	return env
+}
@@ -17,6 +17,12 @@
 package builder
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -62,3 +68,92 @@ func TestLoadProfile(t *testing.T) {
 		t.Fatalf("Invalid AddRepos: %s", profile.AddRepos[0])
 	}
 }
+
+func TestLoadProfileConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-profile")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main-x86_64"+ProfileConfigSuffix)
+
+	config, err := NewProfileConfigFromPath(path)
+	if err != nil {
+		t.Fatalf("Failed to load missing configuration: %v", err)
+	}
+	if len(config.ExtraRepos) != 0 || len(config.PreInstall) != 0 || len(config.Env) != 0 {
+		t.Fatalf("Missing configuration is not empty: %v", config)
+	}
+
+	data := `extra_repos:
+  - name: Extra
+    uri: https://example.com/extra/eopkg-index.xml.xz
+pre_install:
+  - ccache
+env:
+  CFLAGS_EXTRA: -g
+`
+	if err := ioutil.WriteFile(path, []byte(data), 00644); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+	if config, err = NewProfileConfigFromPath(path); err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	profile := &Profile{
+		Name:     "main-x86_64",
+		AddRepos: []string{"Solus"},
+		Repos:    map[string]*Repo{"Solus": {Name: "Solus", URI: "https://example.com/eopkg-index.xml.xz"}},
+	}
+	merged := config.Merge(profile)
+	if !reflect.DeepEqual(merged.AddRepos, []string{"Solus", "Extra"}) {
+		t.Fatalf("Extra repo was not enabled: %v", merged.AddRepos)
+	}
+	if merged.Repos["Extra"] == nil || len(profile.Repos) != 1 {
+		t.Fatal("Extra repo was not merged into a copy of the profile")
+	}
+	if !reflect.DeepEqual(merged.PreInstall, []string{"ccache"}) {
+		t.Fatalf("Wrong packages to install: %v", merged.PreInstall)
+	}
+	env := config.Environment([]string{"PATH=/usr/bin"})
+	if !reflect.DeepEqual(env, []string{"PATH=/usr/bin", "CFLAGS_EXTRA=-g"}) {
+		t.Fatalf("Wrong environment: %v", env)
+	}
+
+	denied := "env:\n  PATH: /tmp\n"
+	if err := ioutil.WriteFile(path, []byte(denied), 00644); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+	if _, err = NewProfileConfigFromPath(path); err == nil {
+		t.Fatal("Allowed the profile to set PATH")
+	}
+}
+
+func TestProfileAliases(t *testing.T) {
+	profiles := map[string]*Profile{
+		"unstable-x86_64": {Name: "unstable-x86_64"},
+		"main-x86_64":     {Name: "main-x86_64"},
+	}
+	aliases := map[string]string{"u": "unstable-x86_64", "unstable": "unstable-x86_64", "m": "main-x86_64"}
+	if err := ValidateProfileAliases(aliases, profiles); err != nil {
+		t.Fatalf("Expected valid aliases, got: %v", err)
+	}
+	if err := ValidateProfileAliases(map[string]string{"s": "stable-x86_64"}, profiles); !strings.HasPrefix(fmt.Sprint(err), ErrInvalidAlias.Error()) {
+		t.Fatalf("Expected alias of unknown profile to be invalid, got: %v", err)
+	}
+	if err := ValidateProfileAliases(map[string]string{"main-x86_64": "unstable-x86_64"}, profiles); err == nil {
+		t.Fatalf("Expected alias hiding a profile to be invalid")
+	}
+
+	defer func(saved map[string]string) { ProfileAliases = saved }(ProfileAliases)
+	ProfileAliases = aliases
+	if name := ResolveProfileAlias("u"); name != "unstable-x86_64" {
+		t.Fatalf("Expected u to resolve to unstable-x86_64, got: %s", name)
+	}
+	if name := ResolveProfileAlias("main-x86_64"); name != "main-x86_64" {
+		t.Fatalf("Expected profile name to be unchanged, got: %s", name)
+	}
+	if got := AliasesOf("unstable-x86_64"); !reflect.DeepEqual(got, []string{"u", "unstable"}) {
+		t.Fatalf("Expected aliases [u unstable], got: %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrProfileMounted is returned when deleting a profile which is still in use
+var ErrProfileMounted = errors.New("The profile is still mounted")
+
+// ProfileState is everything solbuild has stored on disk for a profile,
+// outside of the profile definition itself
+type ProfileState struct {
+	Profile *Profile      // The profile owning the state
+	Image   *BackingImage // The backing image of the profile
+	Paths   []string      // Files and directories which currently exist
+	roots   []string      // Directories which may still have mounts beneath them
+}
+
+// NewProfileState will find the state kept for the profile: its images, the
+// root used to update them, and the overlays of its builds beneath overlayRoot.
+// Only the paths which exist are included.
+func NewProfileState(profile *Profile, overlayRoot string) *ProfileState {
+	return newProfileState(profile, NewBackingImage(profile.Image), overlayRoot)
+}
+
+// newProfileState will find the state kept for the profile within img
+func newProfileState(profile *Profile, img *BackingImage, overlayRoot string) *ProfileState {
+	s := &ProfileState{
+		Profile: profile,
+		Image:   img,
+		roots:   []string{img.RootDir, filepath.Join(overlayRoot, profile.Name)},
+	}
+	for _, path := range []string{img.ImagePath, img.ImagePathXZ, img.StampPath, img.HashesPath, img.LockPath} {
+		if PathExists(path) {
+			s.Paths = append(s.Paths, path)
+		}
+	}
+	for _, root := range s.roots {
+		if PathExists(root) {
+			s.Paths = append(s.Paths, root)
+		}
+	}
+	return s
+}
+
+// SharedWith will return the names of any other profiles using the same
+// backing image, which would lose it along with this profile
+func (s *ProfileState) SharedWith(profiles map[string]*Profile) []string {
+	var names []string
+	for name, p := range profiles {
+		if name != s.Profile.Name && p.Image == s.Profile.Image {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActiveMounts will return anything still mounted within the profile's state
+func (s *ProfileState) ActiveMounts() ([]string, error) {
+	var mounts []string
+	for _, root := range s.roots {
+		under, err := ActiveMountsUnder(root)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, under...)
+	}
+	return mounts, nil
+}
+
+// Delete will remove all of the profile's state. Nothing is removed while the
+// profile is mounted or locked by another process. The profile may be
+// initialised again afterwards.
+func (s *ProfileState) Delete() error {
+	mounts, err := s.ActiveMounts()
+	if err != nil {
+		return err
+	}
+	if len(mounts) > 0 {
+		return fmt.Errorf("%s: %s", ErrProfileMounted, strings.Join(mounts, ", "))
+	}
+	var lock *LockFile
+	if PathExists(filepath.Dir(s.Image.LockPath)) {
+		if lock, err = NewLockFile(s.Image.LockPath); err != nil {
+			return err
+		}
+		if err = lock.Lock(); err != nil {
+			if err == ErrOwnedLockFile {
+				return fmt.Errorf("Profile is in use by another process (%s,%d)", lock.GetOwnerProcess(), lock.GetOwnerPID())
+			}
+			return err
+		}
+	}
+	for _, path := range s.Paths {
+		if path == s.Image.LockPath {
+			continue
+		}
+		log.Debugf("Removing %s\n", path)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("Failed to remove %s, reason: %s\n", path, err)
+		}
+	}
+	if lock != nil {
+		return lock.Clean()
+	}
+	return nil
+}
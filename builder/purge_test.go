@@ -0,0 +1,86 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfileStateDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-purge")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := filepath.Join(dir, "images")
+	img := &BackingImage{
+		Name:        "unstable-x86_64",
+		ImagePath:   filepath.Join(images, "unstable-x86_64"+ImageSuffix),
+		ImagePathXZ: filepath.Join(images, "unstable-x86_64"+ImageCompressedSuffix),
+		LockPath:    filepath.Join(images, "unstable-x86_64.lock"),
+		StampPath:   filepath.Join(images, "unstable-x86_64"+StampSuffix),
+		RootDir:     filepath.Join(dir, "roots", "unstable-x86_64"),
+	}
+	profile := &Profile{Name: "unstable-x86_64", Image: "unstable-x86_64"}
+	overlays := filepath.Join(dir, "overlay")
+	config := filepath.Join(images, "unstable-x86_64"+ProfileConfigSuffix)
+	other := filepath.Join(images, "main-x86_64"+ImageSuffix)
+
+	for _, d := range []string{images, img.RootDir, filepath.Join(overlays, "unstable-x86_64", "nano", "tmp")} {
+		if err := os.MkdirAll(d, 00755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for _, f := range []string{img.ImagePath, img.StampPath, config, other} {
+		if err := ioutil.WriteFile(f, []byte("x"), 00644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	s := newProfileState(profile, img, overlays)
+	expected := []string{img.ImagePath, img.StampPath, img.RootDir, filepath.Join(overlays, "unstable-x86_64")}
+	if !reflect.DeepEqual(s.Paths, expected) {
+		t.Fatalf("Expected paths %v, got: %v", expected, s.Paths)
+	}
+	shared := s.SharedWith(map[string]*Profile{
+		"unstable-x86_64": profile,
+		"local":           {Name: "local", Image: "unstable-x86_64"},
+		"main-x86_64":     {Name: "main-x86_64", Image: "main-x86_64"},
+	})
+	if !reflect.DeepEqual(shared, []string{"local"}) {
+		t.Fatalf("Expected image to be shared with local, got: %v", shared)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatalf("Failed to delete profile: %v", err)
+	}
+	for _, p := range append(expected, img.LockPath) {
+		if PathExists(p) {
+			t.Fatalf("Expected %s to be removed", p)
+		}
+	}
+	for _, p := range []string{config, other} {
+		if !PathExists(p) {
+			t.Fatalf("Expected %s to be kept", p)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"strings"
+	"sync"
+)
+
+// A reaperStep releases a single resource during cleanup
+type reaperStep struct {
+	name     string
+	release  func() error
+	released bool
+}
+
+// A Reaper releases the resources acquired by an operation, in the order
+// they were added. Each resource is released at most once, so the Reaper
+// may safely be invoked repeatedly and concurrently, i.e. by a deferred
+// cleanup racing a signal handler. Resources that fail to release are
+// retried by the next invocation.
+type Reaper struct {
+	lock  sync.Mutex
+	steps []*reaperStep
+}
+
+// NewReaper creates a new Reaper with no resources to release
+func NewReaper() *Reaper {
+	return &Reaper{}
+}
+
+// Add will register a resource to be released by the Reaper
+func (r *Reaper) Add(name string, release func() error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.steps = append(r.steps, &reaperStep{name: name, release: release})
+}
+
+// Reap will release every resource that has not yet been released. Failures
+// do not stop the remaining resources from being released.
+func (r *Reaper) Reap() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var failed []string
+	for _, step := range r.steps {
+		if step.released {
+			continue
+		}
+		log.Debugf("Releasing %s\n", step.name)
+		if err := step.release(); err != nil {
+			log.Errorf("Failed to release %s, reason: %s\n", step.name, err)
+			failed = append(failed, step.name)
+			continue
+		}
+		step.released = true
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to release: %s\n", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Pending returns the names of the resources yet to be released
+func (r *Reaper) Pending() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var pending []string
+	for _, step := range r.steps {
+		if !step.released {
+			pending = append(pending, step.name)
+		}
+	}
+	return pending
+}
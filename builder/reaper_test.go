@@ -0,0 +1,134 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fakeMounts stands in for the mount table, with mounts that stay busy for
+// a number of unmount attempts
+type fakeMounts struct {
+	lock     sync.Mutex
+	mounted  map[string]bool
+	busy     map[string]int
+	unmounts map[string]int
+	detached map[string]int
+}
+
+func newFakeMounts(points ...string) *fakeMounts {
+	f := &fakeMounts{
+		mounted:  make(map[string]bool),
+		busy:     make(map[string]int),
+		unmounts: make(map[string]int),
+		detached: make(map[string]int),
+	}
+	for _, p := range points {
+		f.mounted[p] = true
+	}
+	return f
+}
+
+func (f *fakeMounts) Unmount(point string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.mounted[point] {
+		return syscall.EINVAL
+	}
+	f.unmounts[point]++
+	if f.busy[point] > 0 {
+		f.busy[point]--
+		return syscall.EBUSY
+	}
+	f.mounted[point] = false
+	return nil
+}
+
+func (f *fakeMounts) Detach(point string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.mounted[point] {
+		return syscall.EINVAL
+	}
+	f.detached[point]++
+	f.mounted[point] = false
+	return nil
+}
+
+func TestReaperSignalDuringCleanup(t *testing.T) {
+	mounts := newFakeMounts("/var/cache/solbuild/root", "/var/cache/solbuild/root/proc")
+	r := NewReaper()
+	var wg sync.WaitGroup
+	r.Add("proc", func() error {
+		// A signal arrives mid-cleanup and invokes the reaper again
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Reap(); err != nil {
+				t.Errorf("Concurrent reap failed: %v", err)
+			}
+		}()
+		return mounts.Unmount("/var/cache/solbuild/root/proc")
+	})
+	r.Add("root", func() error {
+		return mounts.Unmount("/var/cache/solbuild/root")
+	})
+	if err := r.Reap(); err != nil {
+		t.Fatalf("Failed to reap: %v", err)
+	}
+	wg.Wait()
+	if err := r.Reap(); err != nil {
+		t.Fatalf("Repeated reap failed: %v", err)
+	}
+	for point, count := range mounts.unmounts {
+		if count != 1 {
+			t.Fatalf("Expected a single unmount of %s, got %d", point, count)
+		}
+	}
+}
+
+func TestReaperResume(t *testing.T) {
+	mounts := newFakeMounts("/dev/loop0", "/var/cache/solbuild/root")
+	mounts.busy["/var/cache/solbuild/root"] = 1
+	r := NewReaper()
+	r.Add("root", func() error {
+		return mounts.Unmount("/var/cache/solbuild/root")
+	})
+	r.Add("loop device", func() error {
+		return mounts.Detach("/dev/loop0")
+	})
+	if err := r.Reap(); err == nil {
+		t.Fatal("Expected the busy mount to fail")
+	}
+	if mounts.detached["/dev/loop0"] != 1 {
+		t.Fatal("Failure stopped later resources from being released")
+	}
+	if pending := r.Pending(); len(pending) != 1 || pending[0] != "root" {
+		t.Fatalf("Wrong pending resources: %v", pending)
+	}
+	if err := r.Reap(); err != nil {
+		t.Fatalf("Failed to resume reaping: %v", err)
+	}
+	if mounts.unmounts["/var/cache/solbuild/root"] != 2 || mounts.detached["/dev/loop0"] != 1 {
+		t.Fatalf("Wrong release counts: unmounts=%v detached=%v", mounts.unmounts, mounts.detached)
+	}
+	if len(r.Pending()) != 0 {
+		t.Fatalf("Resources left pending: %v", r.Pending())
+	}
+}
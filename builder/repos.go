@@ -17,20 +17,64 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/disk"
 	"os"
 	"path/filepath"
+	"syscall"
 )
 
 const (
 	// BindRepoDir is where we make repos available from the host side
 	BindRepoDir = "/hostRepos"
+
+	// LocalRepoName is the name of the repository added for LocalRepo
+	LocalRepoName = "solbuild-local"
+
+	// repoLockFile serialises indexing and adding packages to a local repo
+	repoLockFile = ".solbuild-repo.lock"
 )
 
+// LocalRepo is a directory of packages, such as those built earlier in a
+// batch, added to the root as the highest priority repository
+var LocalRepo string
+
+// LockRepoDir will wait for an exclusive lock on the local repository at
+// dir, which is released by closing the returned file
+func LockRepoDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, repoLockFile), os.O_RDWR|os.O_CREATE, 00644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to lock repository %s, reason: %s\n", dir, err)
+	}
+	return f, nil
+}
+
+// AddToLocalRepo will copy the packages into the local repository at dir
+func AddToLocalRepo(dir string, eopkgs []string) error {
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return err
+	}
+	lock, err := LockRepoDir(dir)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	for _, eopkg := range eopkgs {
+		if err := disk.CopyFile(eopkg, filepath.Join(dir, filepath.Base(eopkg))); err != nil {
+			return fmt.Errorf("Failed to add %s to repository, reason: %s\n", filepath.Base(eopkg), err)
+		}
+	}
+	return nil
+}
+
 // addLocalRepo will try to add the repo and bind mount it into the target
-func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, repo *Repo) error {
+func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager PackageManager, repo *Repo) error {
 	// Ensure the source exists too. Sorta helpful like that.
 	if !PathExists(repo.URI) {
 		return fmt.Errorf("Local repo does not exist")
@@ -56,8 +100,15 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 	if repo.AutoIndex {
 		log.Debugf("Reindexing repository %s\n", repo.Name)
 
+		// Packages may be added by others while we index
+		lock, err := LockRepoDir(repo.URI)
+		if err != nil {
+			return err
+		}
+		defer lock.Close()
+
 		command := fmt.Sprintf("cd %s/%s; %s", BindRepoDir, repo.Name, eopkgCommand("eopkg index --skip-signing ."))
-		err := ChrootExec(notif, o.MountPoint, command)
+		err = ChrootExec(notif, o.MountPoint, command)
 		notif.SetActivePID(0)
 		if err != nil {
 			return err
@@ -71,10 +122,29 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 
 	// Now add the local repo
 	chrootLocal := filepath.Join(BindRepoDir, repo.Name, "eopkg-index.xml.xz")
-	return pkgManager.AddRepo(repo.Name, chrootLocal)
+	return addRepo(pkgManager, repo.Name, chrootLocal)
+}
+
+// addRepo will add the repo, replacing any existing repo of the same name
+// that has a different URI
+func addRepo(pkgManager PackageManager, id, uri string) error {
+	err := pkgManager.AddRepo(id, uri)
+	var exists *RepoExistsError
+	if !errors.As(err, &exists) {
+		return err
+	}
+	if exists.URI == uri {
+		log.Debugf("Repository %s is already configured\n", id)
+		return nil
+	}
+	log.Debugf("Replacing repository %s %s\n", id, exists.URI)
+	if err := pkgManager.RemoveRepo(id); err != nil {
+		return err
+	}
+	return pkgManager.AddRepo(id, uri)
 }
 
-func (p *Package) removeRepos(pkgManager *EopkgManager, repos []string) error {
+func (p *Package) removeRepos(pkgManager PackageManager, repos []string) error {
 	if len(repos) < 1 {
 		return nil
 	}
@@ -88,7 +158,7 @@ func (p *Package) removeRepos(pkgManager *EopkgManager, repos []string) error {
 }
 
 // addRepos will add the specified filtered set of repos to the rootfs
-func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, repos []*Repo) error {
+func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager PackageManager, repos []*Repo) error {
 	if len(repos) < 1 {
 		return nil
 	}
@@ -102,7 +172,7 @@ func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManag
 			continue
 		}
 		log.Debugf("Adding repo to system %s %s\n", repo.Name, repo.URI)
-		if err := pkgManager.AddRepo(repo.Name, repo.URI); err != nil {
+		if err := addRepo(pkgManager, repo.Name, repo.URI); err != nil {
 			return fmt.Errorf("Failed to add repo to system %s, reason: %s\n", repo.Name, err)
 		}
 	}
@@ -111,8 +181,8 @@ func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManag
 
 // ConfigureRepos will attempt to configure the repos according to the configuration
 // of the manager.
-func (p *Package) ConfigureRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, profile *Profile) error {
-	repos, err := pkgManager.GetRepos()
+func (p *Package) ConfigureRepos(notif PidNotifier, o *Overlay, pkgManager PackageManager, profile *Profile) error {
+	repos, err := pkgManager.ListRepos()
 	if err != nil {
 		return err
 	}
@@ -146,5 +216,26 @@ func (p *Package) ConfigureRepos(notif PidNotifier, o *Overlay, pkgManager *Eopk
 		}
 	}
 
-	return p.addRepos(notif, o, pkgManager, addRepos)
+	if err := p.addRepos(notif, o, pkgManager, addRepos); err != nil {
+		return err
+	}
+	return p.addBuildRepo(notif, o, pkgManager)
+}
+
+// addBuildRepo will add the LocalRepo, if any, ahead of every other repo so
+// that its packages are preferred
+func (p *Package) addBuildRepo(notif PidNotifier, o *Overlay, pkgManager PackageManager) error {
+	if LocalRepo == "" {
+		return nil
+	}
+	repo := &Repo{
+		Name:      LocalRepoName,
+		URI:       LocalRepo,
+		Local:     true,
+		AutoIndex: true,
+	}
+	if err := p.addRepos(notif, o, pkgManager, []*Repo{repo}); err != nil {
+		return err
+	}
+	return pkgManager.SetRepoPriority(LocalRepoName, 0)
 }
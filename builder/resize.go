@@ -0,0 +1,110 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GiB is the size of a gigabyte, as images are sized in binary units
+const GiB int64 = 1024 * 1024 * 1024
+
+var (
+	// ErrImageShrink is returned when resizing an image to no larger than it
+	// is now
+	ErrImageShrink = errors.New("Images may only be grown")
+
+	// ErrImageInUse is returned when resizing an image that is still attached
+	// to a loop device, such as by a running build
+	ErrImageInUse = errors.New("The image is still in use")
+)
+
+// imageSize will return the size of the image file in bytes
+func (b *BackingImage) imageSize() (int64, error) {
+	st, err := os.Stat(b.ImagePath)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to stat image %s, reason: %s\n", b.ImagePath, err)
+	}
+	return st.Size(), nil
+}
+
+// loopDevices will return any loop devices the image is attached to
+func (b *BackingImage) loopDevices() ([]string, error) {
+	out, err := exec.Command("losetup", "--associated", b.ImagePath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list loop devices for %s, reason: %s\n", b.ImagePath, err)
+	}
+	var devices []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			devices = append(devices, line[:i])
+		}
+	}
+	return devices, nil
+}
+
+// Resize will grow the image to newSizeGB gigabytes, for images that have run
+// out of space after many updates. The image is unmounted if needed, checked
+// with e2fsck, extended and then its filesystem grown with resize2fs.
+func (b *BackingImage) Resize(newSizeGB int) error {
+	before, err := b.imageSize()
+	if err != nil {
+		return err
+	}
+	newSize := int64(newSizeGB) * GiB
+	if newSize <= before {
+		return fmt.Errorf("%s: %s is already %s, larger than %dG", ErrImageShrink, b.Name, FormatBytes(before), newSizeGB)
+	}
+	if err := UnmountTree(b.RootDir); err != nil {
+		return fmt.Errorf("Failed to unmount image %s, reason: %s\n", b.Name, err)
+	}
+	devices, err := b.loopDevices()
+	if err != nil {
+		return err
+	}
+	if len(devices) > 0 {
+		return fmt.Errorf("%s: %s", ErrImageInUse, strings.Join(devices, ", "))
+	}
+
+	log.Infof("Checking filesystem of image %s\n", b.Name)
+	// -p repairs only what is safe without asking, exit status 1 means that
+	// errors were corrected
+	if out, err := exec.Command("e2fsck", "-f", "-p", b.ImagePath).CombinedOutput(); err != nil {
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() > 1 {
+			return fmt.Errorf("Failed to check filesystem of %s, reason: %s\n%s", b.ImagePath, err, out)
+		}
+	}
+	if err := os.Truncate(b.ImagePath, newSize); err != nil {
+		return fmt.Errorf("Failed to extend image %s, reason: %s\n", b.ImagePath, err)
+	}
+	log.Infof("Resizing filesystem of image %s\n", b.Name)
+	if out, err := exec.Command("resize2fs", b.ImagePath).CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to resize filesystem of %s, reason: %s\n%s", b.ImagePath, err, out)
+	}
+
+	after, err := b.imageSize()
+	if err != nil {
+		return err
+	}
+	log.Infof("Resized image %s from %s to %s\n", b.Name, FormatBytes(before), FormatBytes(after))
+	return nil
+}
@@ -0,0 +1,49 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResizeRefusesShrink(t *testing.T) {
+	dir := t.TempDir()
+	b := &BackingImage{
+		Name:      "test",
+		ImagePath: filepath.Join(dir, "test.img"),
+		RootDir:   filepath.Join(dir, "root"),
+	}
+	f, err := os.Create(b.ImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(2 * GiB); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for _, size := range []int{1, 2} {
+		if err := b.Resize(size); err == nil || !strings.HasPrefix(err.Error(), ErrImageShrink.Error()) {
+			t.Errorf("Resize(%d) should refuse to shrink, got %v", size, err)
+		}
+	}
+	if st, err := os.Stat(b.ImagePath); err != nil || st.Size() != 2*GiB {
+		t.Fatalf("Image should be untouched, got %v %v", st, err)
+	}
+}
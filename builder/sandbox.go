@@ -0,0 +1,128 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"strings"
+)
+
+// A SandboxConfig disables individual namespace types, for when solbuild is
+// itself running within a restricted container. Each option degrades the
+// isolation of the build.
+type SandboxConfig struct {
+	NoNetNS   bool // Don't isolate networking, the build may reach the network
+	NoUserNS  bool // Don't use a user namespace. None is used today, so this is accepted for compatibility
+	NoMountNS bool // Don't use a mount namespace, mounts are visible on the host
+}
+
+// Sandbox is consulted whenever we enter a new namespace. This must be set
+// before the Manager is created.
+var Sandbox SandboxConfig
+
+// ParseSandboxFlags will parse the comma separated sandbox flags, i.e.
+// "no-net-ns,no-mount-ns"
+func ParseSandboxFlags(value string) (SandboxConfig, error) {
+	var config SandboxConfig
+	for _, flag := range strings.Split(value, ",") {
+		switch strings.TrimSpace(flag) {
+		case "":
+			continue
+		case "no-net-ns":
+			config.NoNetNS = true
+		case "no-user-ns":
+			config.NoUserNS = true
+		case "no-mount-ns":
+			config.NoMountNS = true
+		default:
+			return config, fmt.Errorf("Unknown sandbox flag: %s", flag)
+		}
+	}
+	return config, nil
+}
+
+// Warn will log a warning for every namespace that has been disabled
+func (s SandboxConfig) Warn() {
+	if s.NoNetNS {
+		log.Warnln("Network namespace disabled, builds will not be isolated from the network")
+	}
+	if s.NoUserNS {
+		log.Debugln("User namespace disabled, though builds do not currently use one")
+	}
+	if s.NoMountNS {
+		log.Warnln("Mount namespace disabled, build mounts will be visible to the host")
+	}
+}
+
+// An IsolationLevel determines how far a build is isolated from the host
+type IsolationLevel int
+
+const (
+	// IsolationFull builds in an overlayfs root without networking
+	IsolationFull IsolationLevel = iota
+
+	// IsolationNetworkOnly builds without networking, directly in the image root
+	IsolationNetworkOnly
+
+	// IsolationNone builds with networking, directly in the image root
+	IsolationNone
+)
+
+// isolationLevels maps each IsolationLevel to its name
+var isolationLevels = map[IsolationLevel]string{
+	IsolationFull:        "full",
+	IsolationNetworkOnly: "network-only",
+	IsolationNone:        "none",
+}
+
+// Isolation is the isolation level used for builds
+var Isolation = IsolationFull
+
+// String returns the name of the isolation level
+func (l IsolationLevel) String() string {
+	if name, ok := isolationLevels[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(l))
+}
+
+// Set will parse the named isolation level, i.e. "network-only"
+func (l *IsolationLevel) Set(value string) error {
+	for level, name := range isolationLevels {
+		if name == strings.TrimSpace(value) {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown isolation level: %s", value)
+}
+
+// Type returns the type name of the isolation level, for use with pflag
+func (l *IsolationLevel) Type() string {
+	return "isolation-level"
+}
+
+// UsesOverlay determines whether builds run in an overlayfs root
+func (l IsolationLevel) UsesOverlay() bool {
+	return l == IsolationFull
+}
+
+// DropsNetwork determines whether builds are cut off from the network
+func (l IsolationLevel) DropsNetwork() bool {
+	return l != IsolationNone
+}
@@ -0,0 +1,58 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"testing"
+)
+
+func TestParseSandboxFlags(t *testing.T) {
+	config, err := ParseSandboxFlags("no-net-ns, no-mount-ns")
+	if err != nil {
+		t.Fatalf("Failed to parse valid flags: %v", err)
+	}
+	if !config.NoNetNS || config.NoUserNS || !config.NoMountNS {
+		t.Fatalf("Wrong sandbox config: %+v", config)
+	}
+	if _, err := ParseSandboxFlags("no-pid-ns"); err == nil {
+		t.Fatal("Accepted an unknown sandbox flag")
+	}
+}
+
+func TestIsolationLevel(t *testing.T) {
+	var level IsolationLevel
+	if level != IsolationFull {
+		t.Fatalf("Wrong default isolation level: %s", level)
+	}
+	for _, name := range []string{"full", "network-only", "none"} {
+		if err := level.Set(name); err != nil {
+			t.Fatalf("Failed to set isolation level %s: %v", name, err)
+		}
+		if level.String() != name {
+			t.Fatalf("Isolation level %s round tripped as %s", name, level)
+		}
+	}
+	if err := level.Set("partial"); err == nil {
+		t.Fatal("Accepted an unknown isolation level")
+	}
+	if level != IsolationNone {
+		t.Fatalf("Isolation level changed by an invalid value: %s", level)
+	}
+	if IsolationNetworkOnly.UsesOverlay() || !IsolationNetworkOnly.DropsNetwork() {
+		t.Fatal("network-only should drop networking without an overlay")
+	}
+}
@@ -0,0 +1,36 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+// SearchOverlayName names the temporary overlay used to search the
+// repositories of a profile
+const SearchOverlayName = ".search"
+
+// Search will search the repositories known to the backing image of the
+// profile for packages matching the query. Nothing is installed, and the
+// repositories are not refreshed, so the results are those of the last
+// update of the image.
+func (m *Manager) Search(query string) ([]PackageInfo, error) {
+	var results []PackageInfo
+	err := m.withTempOverlay(SearchOverlayName, "searching", false, func(overlay *Overlay) error {
+		var err error
+		ChrootEnvironment = SaneEnvironment("root", "/root")
+		results, err = NewEopkgManager(m, overlay.MountPoint).SearchPackage(query)
+		return err
+	})
+	return results, err
+}
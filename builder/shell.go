@@ -0,0 +1,125 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"os"
+)
+
+// ShellOverlayName names the overlay used for interactive shells. It begins
+// with a dot so that it can never clash with the overlay of a package.
+const ShellOverlayName = ".shell"
+
+// ShellCommand is the login shell spawned by Shell
+const ShellCommand = "/bin/bash -l"
+
+// Shell will spawn an interactive login shell as root within the backing
+// image of the profile, without loading a package. The overlay is temporary
+// and is removed again once the shell exits. When readOnly is set, the image
+// is mounted without an upper layer so that nothing may be changed.
+func (m *Manager) Shell(readOnly bool) error {
+	return m.withTempOverlay(ShellOverlayName, "shell", readOnly, func(overlay *Overlay) error {
+		if readOnly {
+			log.Debugln("Leaving /etc/hosts and /etc/resolv.conf untouched in the read-only root")
+		} else if err := overlay.ConfigureNetworking(); err != nil {
+			return err
+		}
+		ChrootEnvironment = SaneEnvironment("root", "/root")
+		commands.SetStdin(os.Stdin)
+		err := ChrootExecStdin(m, overlay.MountPoint, ShellCommand)
+		commands.SetStdin(nil)
+		m.SetActivePID(0)
+		return err
+	})
+}
+
+// withTempOverlay will mount a temporary overlay of the backing image of the
+// profile, without loading a package, and call fn with it. Only the loopback
+// device is available within the overlay, which is removed again once fn
+// returns. The name must begin with a dot so that it can never clash with
+// the overlay of a package.
+func (m *Manager) withTempOverlay(name, opType string, readOnly bool, fn func(*Overlay) error) error {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return ErrInvalidProfile
+	}
+	if m.pkg != nil {
+		m.lock.Unlock()
+		return ErrManagerInitialised
+	}
+	pkg := &Package{Name: name, Type: PackageTypeXML}
+	overlay, err := NewOverlay(m.Config, m.profile, m.image, pkg)
+	if err != nil {
+		m.lock.Unlock()
+		return err
+	}
+	overlay.ReadOnly = readOnly
+	m.pkg = pkg
+	m.overlay = overlay
+	m.lock.Unlock()
+
+	defer m.removeTempOverlay()
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(overlay.LockPath, opType); err != nil {
+		return err
+	}
+	if err := overlay.CleanExisting(); err != nil {
+		return err
+	}
+
+	log.Debugf("Beginning %s: profile='%s' image='%s' read-only='%t'\n", opType, m.profile.Name, m.image.Name, readOnly)
+	if err := overlay.Mount(); err != nil {
+		return err
+	}
+	if !readOnly {
+		if err := overlay.ConfigureHost(); err != nil {
+			return err
+		}
+	}
+	if err := overlay.MountVFS(); err != nil {
+		return err
+	}
+	if err := DropNetworking(); err != nil {
+		return err
+	}
+	return fn(overlay)
+}
+
+// removeTempOverlay will delete a temporary overlay, so long as nothing
+// remains mounted within it
+func (m *Manager) removeTempOverlay() {
+	// Another process may own the overlay
+	if !m.didStart {
+		return
+	}
+	mounts, err := ActiveMountsUnder(m.overlay.BaseDir)
+	if err != nil || len(mounts) > 0 {
+		log.Warnf("Leaving temporary overlay in place as it may still be mounted: %s\n", m.overlay.BaseDir)
+		return
+	}
+	if err := m.overlay.CleanExisting(); err != nil {
+		log.Warnf("Failed to remove temporary overlay, reason: %s\n", err)
+	}
+}
@@ -0,0 +1,178 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// SidecarSuffix is appended to the name of a recipe to find the options
+	// for building it, i.e. package.yml.solbuild
+	SidecarSuffix = ".solbuild"
+
+	// SidecarFile may instead hold the options, beside the recipe
+	SidecarFile = ".solbuild.yml"
+)
+
+var (
+	// ErrInvalidSidecar is returned when the options of a package can't be
+	// used
+	ErrInvalidSidecar = errors.New("Invalid package options")
+
+	// OptionFlags records the package options given on the command line,
+	// which take precedence over those of the package
+	OptionFlags struct {
+		Tmpfs           bool // Covers both tmpfs and memory
+		Timeout         bool
+		ExtraComponents bool
+	}
+)
+
+// PackageOptions are how solbuild should build a particular package, for
+// packages that always need special treatment. Unset options are left to
+// the recipe, configuration and command line.
+type PackageOptions struct {
+	Networking      *bool    `yaml:"networking"`       // Permit the build to use the network
+	Tmpfs           *bool    `yaml:"tmpfs"`            // Build within a tmpfs, or never
+	Memory          string   `yaml:"memory"`           // Size of the tmpfs, i.e. 8G
+	Timeout         string   `yaml:"timeout"`          // Longest the build may take, i.e. 8h
+	ExtraComponents []string `yaml:"extra_components"` // Components to install before building
+	BuildSize       string   `yaml:"build_size"`       // Space the build needs, i.e. 40G
+
+	Path      string        `yaml:"-"` // Where the options were loaded from
+	timeout   time.Duration // The parsed Timeout
+	buildSize int64         // The parsed BuildSize
+}
+
+// LoadPackageOptions will load the options beside the recipe at path, if
+// there are any. Unknown options are an error, so that mistakes are noticed.
+func LoadPackageOptions(recipe string) (*PackageOptions, error) {
+	var found []string
+	for _, path := range []string{recipe + SidecarSuffix, filepath.Join(filepath.Dir(recipe), SidecarFile)} {
+		if st, err := os.Stat(path); err == nil && !st.IsDir() {
+			found = append(found, path)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	if len(found) > 1 {
+		log.Warnf("Found both %s, using %s\n", strings.Join(found, " and "), found[0])
+	}
+	b, err := ioutil.ReadFile(found[0])
+	if err != nil {
+		return nil, err
+	}
+	opts := &PackageOptions{Path: found[0]}
+	if err := yaml.UnmarshalStrict(b, opts); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", ErrInvalidSidecar, found[0], err)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", ErrInvalidSidecar, found[0], err)
+	}
+	return opts, nil
+}
+
+// validate will ensure each option that is set has a usable value
+func (o *PackageOptions) validate() error {
+	if o.Memory = strings.TrimSpace(o.Memory); o.Memory != "" {
+		if _, err := ParseBytes(o.Memory); err != nil {
+			return fmt.Errorf("memory: %s", err)
+		}
+	}
+	if o.BuildSize = strings.TrimSpace(o.BuildSize); o.BuildSize != "" {
+		size, err := ParseBytes(o.BuildSize)
+		if err != nil {
+			return fmt.Errorf("build_size: %s", err)
+		}
+		o.buildSize = size
+	}
+	if o.Timeout = strings.TrimSpace(o.Timeout); o.Timeout != "" {
+		d, err := time.ParseDuration(o.Timeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("timeout: expected a duration such as 8h, got '%s'", o.Timeout)
+		}
+		o.timeout = d
+	}
+	for _, comp := range o.ExtraComponents {
+		if strings.TrimSpace(comp) == "" {
+			return errors.New("extra_components: empty component name")
+		}
+	}
+	return nil
+}
+
+// applyPackageOptions will apply the options of the package to the build,
+// unless they were overridden on the command line, logging each one used
+func (m *Manager) applyPackageOptions() {
+	o := m.pkg.Options
+	if o == nil {
+		return
+	}
+	log.Infof("Using package options from %s\n", o.Path)
+	if o.Networking != nil {
+		m.pkg.CanNetwork = *o.Networking
+		log.Infof("Package option: networking %s\n", enabled(*o.Networking))
+	}
+	if o.Tmpfs != nil || o.Memory != "" {
+		if OptionFlags.Tmpfs {
+			log.Infoln("Package option: tmpfs overridden on the command line")
+		} else {
+			if o.Tmpfs != nil {
+				m.Config.EnableTmpfs = *o.Tmpfs
+				log.Infof("Package option: tmpfs %s\n", enabled(*o.Tmpfs))
+			}
+			if o.Memory != "" {
+				m.Config.TmpfsSize = o.Memory
+				log.Infof("Package option: tmpfs size %s\n", o.Memory)
+			}
+		}
+	}
+	if o.Timeout != "" {
+		if OptionFlags.Timeout {
+			log.Infoln("Package option: timeout overridden on the command line")
+		} else {
+			PhaseTimeouts.CompileTimeout = o.timeout
+			log.Infof("Package option: build timeout %s\n", o.timeout)
+		}
+	}
+	if len(o.ExtraComponents) > 0 {
+		if OptionFlags.ExtraComponents {
+			log.Infoln("Package option: extra components overridden on the command line")
+		} else {
+			m.pkg.ExtraComponents = o.ExtraComponents
+			log.Infof("Package option: extra components %s\n", strings.Join(o.ExtraComponents, ", "))
+		}
+	}
+}
+
+// enabled will describe a boolean option
+func enabled(on bool) string {
+	if on {
+		return "enabled"
+	}
+	return "disabled"
+}
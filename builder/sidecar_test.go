@@ -0,0 +1,69 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackageOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-sidecar")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	recipe := filepath.Join(dir, "package.yml")
+	if opts, err := LoadPackageOptions(recipe); opts != nil || err != nil {
+		t.Fatalf("Expected no options, got %+v: %v", opts, err)
+	}
+
+	sidecar := recipe + SidecarSuffix
+	ioutil.WriteFile(sidecar, []byte("networking: true\ntmpfs: false\ntimeout: 8h\nbuild_size: 40G\nextra_components:\n    - system.devel.extra\n"), 00644)
+	opts, err := LoadPackageOptions(recipe)
+	if err != nil {
+		t.Fatalf("Failed to load options: %v", err)
+	}
+	if opts.Path != sidecar || !*opts.Networking || *opts.Tmpfs || opts.timeout != 8*time.Hour || len(opts.ExtraComponents) != 1 || opts.buildSize != 40*1024*1024*1024 {
+		t.Fatalf("Wrong options: %+v", opts)
+	}
+
+	defer func() {
+		PhaseTimeouts = DefaultPhaseDurations
+		OptionFlags.Timeout = false
+	}()
+	m := &Manager{Config: &Config{EnableTmpfs: true}, pkg: &Package{Name: "rust", Options: opts}}
+	OptionFlags.Timeout = true
+	m.applyPackageOptions()
+	if !m.pkg.CanNetwork || m.Config.EnableTmpfs || len(m.pkg.ExtraComponents) != 1 {
+		t.Fatalf("Options were not applied: %+v %+v", m.pkg, m.Config)
+	}
+	if PhaseTimeouts.CompileTimeout != DefaultPhaseDurations.CompileTimeout {
+		t.Fatal("Package timeout took precedence over the command line")
+	}
+
+	for _, invalid := range []string{"networkin: true\n", "timeout: soon\n", "memory: lots\n", "build_size: huge\n"} {
+		ioutil.WriteFile(sidecar, []byte(invalid), 00644)
+		if _, err := LoadPackageOptions(recipe); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidSidecar.Error()) {
+			t.Fatalf("Accepted invalid options '%s': %v", invalid, err)
+		}
+	}
+}
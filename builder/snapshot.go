@@ -0,0 +1,142 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"strings"
+	"time"
+)
+
+const (
+	// OverrideRepoName is the name of the repository added in place of all
+	// others by RepoURL or RepoSnapshot
+	OverrideRepoName = "Solus"
+
+	// SnapshotDateFormat is the format of the date given by RepoSnapshot
+	SnapshotDateFormat = "2006-01-02"
+)
+
+var (
+	// ErrNoSnapshotTemplate is returned when building against a snapshot with
+	// a profile that has no snapshot URL
+	ErrNoSnapshotTemplate = errors.New("The profile has no snapshot URL")
+
+	// ErrInvalidSnapshot is returned for a malformed snapshot date or template
+	ErrInvalidSnapshot = errors.New("Invalid repository snapshot")
+
+	// RepoURL replaces every repository of the build root with this one, for a
+	// single build. When RepoSnapshot is also set it may be a template, as
+	// with the snapshot URL of a profile.
+	RepoURL string
+
+	// RepoSnapshot replaces every repository of the build root with the
+	// snapshot of the repository from this date, i.e. 2024-01-31
+	RepoSnapshot string
+
+	// BuildRepos are the URIs of the repositories enabled within the build
+	// root, in order of priority, recorded so the build may be reproduced
+	BuildRepos []string
+)
+
+// snapshotFields are the date components that may be used in a snapshot URL
+var snapshotFields = map[string]string{
+	"{date}":  SnapshotDateFormat,
+	"{year}":  "2006",
+	"{month}": "01",
+	"{day}":   "02",
+}
+
+// ParseSnapshotDate will parse the date of a repository snapshot
+func ParseSnapshotDate(date string) (time.Time, error) {
+	t, err := time.Parse(SnapshotDateFormat, date)
+	if err != nil {
+		return t, fmt.Errorf("%s: '%s' is not a date such as 2024-01-31", ErrInvalidSnapshot, date)
+	}
+	return t, nil
+}
+
+// SnapshotURL will fill in the date components of the template, any of
+// {date}, {year}, {month} and {day}, to find the snapshot from that date
+func SnapshotURL(template, date string) (string, error) {
+	t, err := ParseSnapshotDate(date)
+	if err != nil {
+		return "", err
+	}
+	uri := template
+	for field, layout := range snapshotFields {
+		uri = strings.Replace(uri, field, t.Format(layout), -1)
+	}
+	if uri == template {
+		return "", fmt.Errorf("%s: '%s' has no date component", ErrInvalidSnapshot, template)
+	}
+	return uri, nil
+}
+
+// OverrideRepos will return a copy of the profile whose only remote
+// repository is given by RepoURL or RepoSnapshot, or the profile unchanged
+// when neither is set. Every repository of the image is removed, while the
+// local repositories of the profile are kept.
+func (p *Profile) OverrideRepos() (*Profile, error) {
+	if RepoURL == "" && RepoSnapshot == "" {
+		return p, nil
+	}
+	uri := RepoURL
+	if RepoSnapshot != "" {
+		template := RepoURL
+		if template == "" {
+			template = p.Snapshot
+		}
+		if template == "" {
+			return nil, fmt.Errorf("%s: %s", ErrNoSnapshotTemplate, p.Name)
+		}
+		var err error
+		if uri, err = SnapshotURL(template, RepoSnapshot); err != nil {
+			return nil, err
+		}
+	}
+	overridden := *p
+	overridden.RemoveRepos = []string{"*"}
+	overridden.AddRepos = nil
+	overridden.Repos = map[string]*Repo{
+		OverrideRepoName: {Name: OverrideRepoName, URI: uri},
+	}
+	for name, repo := range p.Repos {
+		if repo.Local {
+			overridden.Repos[name] = repo
+		}
+	}
+	log.Infof("Using repository %s in place of those of profile %s\n", uri, p.Name)
+	return &overridden, nil
+}
+
+// recordRepos will record the repositories enabled within the build root
+func recordRepos(pkgManager PackageManager) error {
+	repos, err := pkgManager.ListRepos()
+	if err != nil {
+		return err
+	}
+	BuildRepos = nil
+	for _, repo := range repos {
+		if repo.Active {
+			BuildRepos = append(BuildRepos, repo.URI)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnapshotURL(t *testing.T) {
+	uri, err := SnapshotURL("https://example.com/{year}/{month}/{day}/{date}/eopkg-index.xml.xz", "2024-01-31")
+	if err != nil {
+		t.Fatalf("Failed to expand snapshot URL: %v", err)
+	}
+	if uri != "https://example.com/2024/01/31/2024-01-31/eopkg-index.xml.xz" {
+		t.Fatalf("Wrong snapshot URL: %s", uri)
+	}
+	if _, err := SnapshotURL("https://example.com/eopkg-index.xml.xz", "2024-01-31"); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidSnapshot.Error()) {
+		t.Fatalf("Expected a template without a date to fail, got: %v", err)
+	}
+	if _, err := SnapshotURL("https://example.com/{date}/eopkg-index.xml.xz", "31/01/2024"); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidSnapshot.Error()) {
+		t.Fatalf("Expected an invalid date to fail, got: %v", err)
+	}
+}
+
+func TestOverrideRepos(t *testing.T) {
+	defer func() { RepoURL, RepoSnapshot = "", "" }()
+	profile := &Profile{
+		Name:     "test",
+		AddRepos: []string{"Unstable", "Local"},
+		Snapshot: "https://example.com/{date}/eopkg-index.xml.xz",
+		Repos: map[string]*Repo{
+			"Unstable": {Name: "Unstable", URI: "https://example.com/unstable/eopkg-index.xml.xz"},
+			"Local":    {Name: "Local", URI: "/var/lib/myrepo", Local: true},
+		},
+	}
+	if p, err := profile.OverrideRepos(); err != nil || p != profile {
+		t.Fatalf("Profile should be unchanged without an override, got: %v", err)
+	}
+
+	RepoSnapshot = "2024-01-31"
+	p, err := profile.OverrideRepos()
+	if err != nil {
+		t.Fatalf("Failed to override repos: %v", err)
+	}
+	if len(p.RemoveRepos) != 1 || p.RemoveRepos[0] != "*" || p.AddRepos != nil {
+		t.Fatalf("Every repository should be replaced, got remove %v add %v", p.RemoveRepos, p.AddRepos)
+	}
+	if repo := p.Repos[OverrideRepoName]; repo == nil || repo.URI != "https://example.com/2024-01-31/eopkg-index.xml.xz" {
+		t.Fatalf("Wrong override repository: %v", repo)
+	}
+	if _, ok := p.Repos["Unstable"]; ok {
+		t.Fatal("Remote repositories of the profile should be replaced")
+	}
+	if _, ok := p.Repos["Local"]; !ok {
+		t.Fatal("Local repositories of the profile should be kept")
+	}
+	if len(profile.Repos) != 2 || profile.RemoveRepos != nil {
+		t.Fatal("The original profile should not be changed")
+	}
+
+	profile.Snapshot = ""
+	if _, err := profile.OverrideRepos(); err == nil || !strings.HasPrefix(err.Error(), ErrNoSnapshotTemplate.Error()) {
+		t.Fatalf("Expected a missing snapshot URL to fail, got: %v", err)
+	}
+	RepoURL = "https://mirror.example.com/{year}/eopkg-index.xml.xz"
+	if p, err := profile.OverrideRepos(); err != nil || p.Repos[OverrideRepoName].URI != "https://mirror.example.com/2024/eopkg-index.xml.xz" {
+		t.Fatalf("--repo-url should serve as the snapshot template, got: %v", err)
+	}
+}
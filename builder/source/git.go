@@ -28,12 +28,10 @@ import (
 	"strings"
 )
 
-const (
+var (
 	// GitSourceDir is the base directory for all cached git sources
 	GitSourceDir = "/var/lib/solbuild/sources/git"
-)
 
-var (
 	// ErrGitNoContinue is returned when git processing cannot continue
 	ErrGitNoContinue = errors.New("Fatal errors in git fetch")
 )
@@ -300,6 +298,11 @@ func (g *GitSource) GetBindConfiguration(sourcedir string) BindConfiguration {
 	}
 }
 
+// IsGit will always return true
+func (g *GitSource) IsGit() bool {
+	return true
+}
+
 // GetIdentifier will return a human readable string to represent this
 // git source in the event of errors.
 func (g *GitSource) GetIdentifier() string {
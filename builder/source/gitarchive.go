@@ -0,0 +1,156 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package source
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/libosdev/commands"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoGitRef is returned when fetching a git archive source without a ref
+var ErrNoGitRef = errors.New("Git sources require a git_ref to check out")
+
+// A GitArchiveSource is a git repository, given by a git+https:// or git://
+// URI, checked out at a single ref and cached as a tarball. Unlike a
+// GitSource the tarball is verified by its sha256sum, so it is fetched only
+// once and builds are reproducible.
+type GitArchiveSource struct {
+	*SimpleSource
+	Ref string // Tag, branch or commit to check out, from git_ref
+}
+
+// IsGitURI will determine whether the URI is that of a git repository
+func IsGitURI(uri string) bool {
+	return strings.HasPrefix(uri, "git+https://") || strings.HasPrefix(uri, "git://")
+}
+
+// NewGitArchive will create a new GitArchiveSource for the URI, which is
+// checked out at the ref and verified by the sha256sum of the tarball
+func NewGitArchive(uri, ref, validator string) (*GitArchiveSource, error) {
+	simple, err := NewSimple(uri, validator, false)
+	if err != nil {
+		return nil, err
+	}
+	return &GitArchiveSource{SimpleSource: simple, Ref: ref}, nil
+}
+
+// IsGit will always return true
+func (g *GitArchiveSource) IsGit() bool {
+	return true
+}
+
+// GetIdentifier will return the URI and ref of this source
+func (g *GitArchiveSource) GetIdentifier() string {
+	return fmt.Sprintf("%s#%s", g.URI, g.Ref)
+}
+
+// cloneURI returns the URI git clones from, without the git+ prefix
+func (g *GitArchiveSource) cloneURI() string {
+	return strings.TrimPrefix(g.URI, "git+")
+}
+
+// prefix returns the directory the tarball extracts to
+func (g *GitArchiveSource) prefix() string {
+	name := strings.TrimSuffix(g.File, ".git")
+	return fmt.Sprintf("%s-%s/", name, strings.Replace(g.Ref, "/", "-", -1))
+}
+
+// isCommit will determine whether the ref is a full commit hash, which
+// cannot be cloned by name
+func (g *GitArchiveSource) isCommit() bool {
+	return isHex(g.Ref, 40)
+}
+
+// checkout will make a shallow checkout of the ref into dir
+func (g *GitArchiveSource) checkout(dir string) error {
+	if !g.isCommit() {
+		return commands.ExecStdoutArgs("git", []string{"clone", "--depth", "1", "--branch", g.Ref, g.cloneURI(), dir})
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", g.cloneURI()},
+		{"fetch", "--depth", "1", "origin", g.Ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		if err := commands.ExecStdoutArgsDir(dir, "git", args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch will make a shallow clone of the ref, named by its commit, and
+// archive it into a tarball. git archive gives every file the time of the
+// commit, so the tarball is the same whenever the commit is fetched.
+func (g *GitArchiveSource) Fetch() error {
+	if g.Ref == "" {
+		return &FetchError{Err: ErrNoGitRef}
+	}
+	if err := os.MkdirAll(SourceStagingDir, 00755); err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(SourceStagingDir, "git-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	log.Debugf("Cloning git source %s at %s\n", g.cloneURI(), g.Ref)
+	clone := filepath.Join(staging, "clone")
+	if err := os.Mkdir(clone, 00755); err != nil {
+		return err
+	}
+	if err := g.checkout(clone); err != nil {
+		return &FetchError{Err: fmt.Errorf("Failed to clone %s, reason: %s", g.cloneURI(), err), Transient: true}
+	}
+	out, err := exec.Command("git", "-C", clone, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("Failed to find the commit of %s, reason: %s", g.Ref, err)
+	}
+	commit := strings.TrimSpace(string(out))
+	checkout := filepath.Join(staging, commit)
+	if err := os.Rename(clone, checkout); err != nil {
+		return err
+	}
+	log.Debugf("Archiving git source %s at commit %s\n", g.File, commit)
+
+	destPath := filepath.Join(staging, g.File)
+	args := []string{"-C", checkout, "archive", "--format=tar", "--prefix=" + g.prefix(), "-o", destPath, "HEAD"}
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to archive %s, reason: %s\n%s", g.File, err, out)
+	}
+
+	hash, err := g.GetSHA256Sum(destPath)
+	if err != nil {
+		return err
+	}
+	if hash != g.validator {
+		return &FetchError{Err: fmt.Errorf("Checksum mismatch for %s at commit %s: %s vs expected %s", g.File, commit, hash, g.validator)}
+	}
+	tgtDir := filepath.Join(SourceDir, hash)
+	if err := os.MkdirAll(tgtDir, 00755); err != nil {
+		return err
+	}
+	return os.Rename(destPath, filepath.Join(tgtDir, g.File))
+}
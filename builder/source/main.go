@@ -17,18 +17,57 @@
 package source
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
-const (
+var (
 	// SourceDir is where we store all tarballs
 	SourceDir = "/var/lib/solbuild/sources"
 
 	// SourceStagingDir is where we initially fetch downloads
 	SourceStagingDir = "/var/lib/solbuild/sources/staging"
+
+	// DisableProgress will stop progress bars being drawn during downloads
+	DisableProgress bool
+
+	// Deadline aborts any download still running at this time, unless zero
+	Deadline time.Time
 )
 
+// A FetchError is returned when a source could not be fetched, recording
+// whether the failure is transient and the fetch may be retried.
+type FetchError struct {
+	Err       error
+	Transient bool
+}
+
+// Error returns the underlying error message
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient will determine whether the fetch error may succeed if retried,
+// such as a connection reset or timeout. Anything else, i.e. a 404 or a
+// checksum mismatch, is treated as permanent.
+func IsTransient(err error) bool {
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe.Transient
+	}
+	return false
+}
+
 // A BindConfiguration is used by a source as a way to express bind
 // mounts required for a given source.
 //
@@ -64,6 +103,9 @@ type Source interface {
 	// GetIdentifier will return the appropriate representation for a given
 	// source URL.
 	GetIdentifier() string
+
+	// IsGit will determine whether the source is fetched from git
+	IsGit() bool
 }
 
 // New will return a new source for the specified URL.
@@ -84,9 +126,59 @@ func New(uri, validator string, legacy bool) (Source, error) {
 	if strings.HasPrefix(uri, "git|") {
 		return NewGit(uri[len("git|"):], validator)
 	}
+	// The ref is set from the git_ref of the package
+	if IsGitURI(uri) {
+		return NewGitArchive(uri, "", validator)
+	}
 	return NewSimple(uri, validator, legacy)
 }
 
+// Validate will check that the source is well formed, returning a
+// description of each problem found.
+func Validate(src Source) []string {
+	var problems []string
+	switch s := src.(type) {
+	case *SimpleSource:
+		if s.url.Scheme == "" || s.url.Host == "" {
+			problems = append(problems, fmt.Sprintf("Invalid URI: %s", s.URI))
+		}
+		length, kind := 64, "sha256sum"
+		if s.legacy {
+			length, kind = 40, "sha1sum"
+		}
+		if !isHex(s.validator, length) {
+			problems = append(problems, fmt.Sprintf("Invalid %s '%s', expected %d hexadecimal characters", kind, s.validator, length))
+		}
+	case *GitArchiveSource:
+		if s.url.Host == "" {
+			problems = append(problems, fmt.Sprintf("Invalid git URI: %s", s.URI))
+		}
+		if !isHex(s.validator, 64) {
+			problems = append(problems, fmt.Sprintf("Invalid sha256sum '%s', expected 64 hexadecimal characters", s.validator))
+		}
+		if strings.TrimSpace(s.Ref) == "" {
+			problems = append(problems, "Missing git_ref")
+		}
+	case *GitSource:
+		if u, err := url.Parse(s.URI); err != nil || u.Scheme == "" {
+			problems = append(problems, fmt.Sprintf("Invalid git URI: %s", s.URI))
+		}
+		if strings.TrimSpace(s.Ref) == "" {
+			problems = append(problems, "Missing git ref")
+		}
+	}
+	return problems
+}
+
+// isHex will determine whether the string is a hexadecimal hash of the length
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 // PathExists is a helper function to determine the existence of a file path
 func PathExists(path string) bool {
 	if st, err := os.Stat(path); err == nil && st != nil {
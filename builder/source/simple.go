@@ -28,6 +28,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // A SimpleSource is a tarball or other source for a package
@@ -78,6 +79,16 @@ func (s *SimpleSource) GetBindConfiguration(rootfs string) BindConfiguration {
 	}
 }
 
+// IsGit will always return false
+func (s *SimpleSource) IsGit() bool {
+	return false
+}
+
+// GetValidator will return the expected hash of this source
+func (s *SimpleSource) GetValidator() string {
+	return s.validator
+}
+
 // GetPath gets the path on the filesystem of the source
 func (s *SimpleSource) GetPath(hash string) string {
 	return filepath.Join(SourceDir, hash, s.File)
@@ -107,6 +118,11 @@ func (s *SimpleSource) GetSHA256Sum(path string) (string, error) {
 	return hex.EncodeToString(sum), nil
 }
 
+// IsLegacy will determine if the source is validated by a sha1sum
+func (s *SimpleSource) IsLegacy() bool {
+	return s.legacy
+}
+
 // IsFetched will determine if the source is already present
 func (s *SimpleSource) IsFetched() bool {
 	return PathExists(s.GetPath(s.validator))
@@ -124,6 +140,7 @@ func (s *SimpleSource) download(destination string) error {
 	if err != nil {
 		return err
 	}
+	defer out.Close()
 
 	pbar := pb.New64(0)
 	pbar.Set(pb.Bytes, true)
@@ -140,7 +157,8 @@ func (s *SimpleSource) download(destination string) error {
 		pbar.SetTotal(int64(total))
 		pbar.SetCurrent(int64(now))
 
-		return true
+		// Returning false aborts the transfer
+		return Deadline.IsZero() || time.Now().Before(Deadline)
 	}
 
 	hnd.Setopt(curl.OPT_WRITEFUNCTION, writer)
@@ -149,13 +167,47 @@ func (s *SimpleSource) download(destination string) error {
 	// Enforce internal 300 second connect timeout in libcurl
 	hnd.Setopt(curl.OPT_CONNECTTIMEOUT, 0)
 	hnd.Setopt(curl.OPT_USERAGENT, fmt.Sprintf("solbuild 1.5.2.0"))
+	// Treat HTTP errors as failures rather than saving the error page
+	hnd.Setopt(curl.OPT_FAILONERROR, 1)
 
-	pbar.Start()
+	if !DisableProgress {
+		pbar.Start()
+	}
 	defer func() {
 		pbar.Finish()
 	}()
 
-	return hnd.Perform()
+	if err := hnd.Perform(); err != nil {
+		return classifyCurlError(hnd, err)
+	}
+	return nil
+}
+
+// classifyCurlError will wrap the curl error in a FetchError, determining
+// whether it is worth retrying the download.
+func classifyCurlError(hnd *curl.CURL, err error) error {
+	ce, ok := err.(curl.CurlError)
+	if !ok {
+		return err
+	}
+	transient := false
+	switch ce {
+	case 6, 7, 18, 28, 35, 52, 55, 56:
+		// Couldn't resolve or connect, partial file, timeout, TLS handshake,
+		// empty reply, send or receive failure
+		transient = true
+	case 22:
+		// HTTP error, only server side and rate limiting errors are transient
+		if code, infoErr := hnd.Getinfo(curl.INFO_RESPONSE_CODE); infoErr == nil {
+			if status, ok := code.(int); ok {
+				if status >= 500 || status == 408 || status == 429 {
+					transient = true
+				}
+				err = fmt.Errorf("%s (HTTP %d)", err, status)
+			}
+		}
+	}
+	return &FetchError{Err: err, Transient: transient}
 }
 
 // Fetch will download the given source and cache it locally
@@ -182,6 +234,18 @@ func (s *SimpleSource) Fetch() error {
 		return err
 	}
 
+	// Validate it, there's no sense in retrying a mismatch
+	sum := hash
+	if s.legacy {
+		if sum, err = s.GetSHA1Sum(destPath); err != nil {
+			return err
+		}
+	}
+	if sum != s.validator {
+		os.Remove(destPath)
+		return &FetchError{Err: fmt.Errorf("Checksum mismatch for %s: %s vs expected %s", s.File, sum, s.validator)}
+	}
+
 	// Make the target directory
 	tgtDir := filepath.Join(SourceDir, hash)
 	if !PathExists(tgtDir) {
@@ -202,6 +266,10 @@ func (s *SimpleSource) Fetch() error {
 			return err
 		}
 		tgtLink := filepath.Join(SourceDir, sha)
+		// Already linked when replacing a corrupted source
+		if _, err := os.Lstat(tgtLink); err == nil {
+			return nil
+		}
 		if err := os.Symlink(hash, tgtLink); err != nil {
 			return err
 		}
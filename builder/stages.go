@@ -0,0 +1,277 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+)
+
+// A Stage is a distinct step in the build process. Stages are used both for
+// timing reports and to map build failures to an exit code.
+type Stage int
+
+const (
+	// StageActivate is the bring up of the overlay root
+	StageActivate Stage = iota
+
+	// StageFetch is the copying of assets and fetching of sources
+	StageFetch
+
+	// StageUpgrade is the repo configuration and upgrade of the root
+	StageUpgrade
+
+	// StageDevel is the installation of the system.devel component
+	StageDevel
+
+	// StageDeps is the installation of the package build dependencies
+	StageDeps
+
+	// StageBuild is the actual compilation of the package
+	StageBuild
+
+	// StageCollect is the collection of the build artifacts
+	StageCollect
+
+	// StageTest is the check step of a package.yml, which ypkg-build runs
+	// as part of the build. A build only enters it once the check step has
+	// failed, so that the failure is told apart from any other.
+	StageTest
+)
+
+// stageNames are the human readable names for each Stage
+var stageNames = map[Stage]string{
+	StageActivate: "activate",
+	StageFetch:    "fetch",
+	StageUpgrade:  "upgrade",
+	StageDevel:    "system.devel",
+	StageDeps:     "deps",
+	StageBuild:    "build",
+	StageCollect:  "collect",
+	StageTest:     "test",
+}
+
+// stageTitles describe what happens during each Stage, for banners
+var stageTitles = map[Stage]string{
+	StageActivate: "Activating build root",
+	StageFetch:    "Fetching sources",
+	StageUpgrade:  "Upgrading base image",
+	StageDevel:    "Installing system.devel",
+	StageDeps:     "Installing build deps",
+	StageBuild:    "Building package",
+	StageCollect:  "Collecting packages",
+	StageTest:     "Running tests",
+}
+
+const (
+	// MetricsSuffix is the extension for build metrics files
+	MetricsSuffix = ".metrics.json"
+
+	// StageExitCodeBase is the exit code used for a failure in the first
+	// stage. Each following stage increments this by one.
+	StageExitCodeBase = 10
+)
+
+// String returns the human readable name of the stage
+func (s Stage) String() string {
+	if name, ok := stageNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("stage-%d", int(s))
+}
+
+// Title returns a short description of the stage, i.e. "Upgrading base image"
+func (s Stage) Title() string {
+	if title, ok := stageTitles[s]; ok {
+		return title
+	}
+	return s.String()
+}
+
+// ExitCode returns the exit code to use when a build fails in this stage
+func (s Stage) ExitCode() int {
+	return StageExitCodeBase + int(s)
+}
+
+// A StageError is returned when a build fails in a specific stage
+type StageError struct {
+	Stage Stage
+	Err   error
+}
+
+// Error returns the underlying error message
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode will return the exit code appropriate for the given build error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var se *StageError
+	if errors.As(err, &se) {
+		return se.Stage.ExitCode()
+	}
+	return 1
+}
+
+// A StageTiming records how long a single stage took
+type StageTiming struct {
+	Stage    Stage         `json:"-"`
+	Name     string        `json:"stage"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"duration"`
+	Failed   bool          `json:"failed,omitempty"`
+}
+
+// A StageTimer tracks the time spent in each stage of a build
+type StageTimer struct {
+	Timings []*StageTiming
+
+	current  *StageTiming
+	started  time.Time
+	hooks    []func(Stage)
+	complete []func(Stage, error)
+}
+
+// NewStageTimer returns a new, empty StageTimer
+func NewStageTimer() *StageTimer {
+	return &StageTimer{}
+}
+
+// OnStart will register a function to be called whenever a new stage starts
+func (t *StageTimer) OnStart(fn func(Stage)) {
+	t.hooks = append(t.hooks, fn)
+}
+
+// OnComplete will register a function to be called whenever a stage ends,
+// with the error it failed with, if any
+func (t *StageTimer) OnComplete(fn func(Stage, error)) {
+	t.complete = append(t.complete, fn)
+}
+
+// Start will end the currently running stage, if any, and begin timing
+// the given stage.
+func (t *StageTimer) Start(s Stage) {
+	t.Stop()
+	t.current = &StageTiming{Stage: s, Name: s.String()}
+	t.started = time.Now()
+	for _, fn := range t.hooks {
+		fn(s)
+	}
+}
+
+// Stop will end the currently running stage
+func (t *StageTimer) Stop() {
+	t.stop(nil)
+}
+
+// stop will end the currently running stage, which failed if err is set
+func (t *StageTimer) stop(err error) {
+	if t.current == nil {
+		return
+	}
+	s := t.current.Stage
+	t.current.Duration = time.Since(t.started)
+	t.current.Seconds = t.current.Duration.Seconds()
+	t.Timings = append(t.Timings, t.current)
+	t.current = nil
+	for _, fn := range t.complete {
+		fn(s, err)
+	}
+}
+
+// Fail will mark the currently running stage as failed and end it, returning
+// the error wrapped in a StageError.
+func (t *StageTimer) Fail(err error) error {
+	if t.current == nil {
+		return err
+	}
+	s := t.current.Stage
+	t.current.Failed = true
+	t.stop(err)
+	return &StageError{Stage: s, Err: err}
+}
+
+// Total returns the combined duration of all completed stages
+func (t *StageTimer) Total() time.Duration {
+	var total time.Duration
+	for _, st := range t.Timings {
+		total += st.Duration
+	}
+	return total
+}
+
+// WriteSummary will write a table of the stage timings to the writer
+func (t *StageTimer) WriteSummary(w io.Writer) {
+	if len(t.Timings) < 1 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tDURATION\t")
+	for _, st := range t.Timings {
+		status := ""
+		if st.Failed {
+			status = "FAILED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", st.Name, st.Duration.Round(time.Millisecond), status)
+	}
+	fmt.Fprintf(tw, "total\t%s\t\n", t.Total().Round(time.Millisecond))
+	tw.Flush()
+	if BuildPeakDisk > 0 {
+		fmt.Fprintf(w, "\nPeak disk usage: %s\n", FormatBytes(BuildPeakDisk))
+	}
+}
+
+// BuildMetrics are the stage timings of a build as written to disk, along
+// with the version of solbuild that ran it
+type BuildMetrics struct {
+	Solbuild VersionInfo    `json:"solbuild"`
+	BuildID  string         `json:"build_id,omitempty"`
+	Repos    []string       `json:"repos,omitempty"`
+	Ccache   *CcacheStats   `json:"ccache,omitempty"`
+	PeakDisk int64          `json:"peak_disk_usage,omitempty"`
+	Stages   []*StageTiming `json:"stages"`
+}
+
+// WriteJSON will write the stage timings as JSON to the given path
+func (t *StageTimer) WriteJSON(path string) error {
+	metrics := &BuildMetrics{
+		Solbuild: GetVersionInfo(),
+		BuildID:  BuildID,
+		Repos:    BuildRepos,
+		Ccache:   BuildCcache,
+		PeakDisk: BuildPeakDisk,
+		Stages:   t.Timings,
+	}
+	b, err := json.MarshalIndent(metrics, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 00644)
+}
@@ -0,0 +1,166 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MountInfoPath lists every mount visible to solbuild
+	MountInfoPath = "/proc/self/mountinfo"
+
+	// UnmountRetries is the number of attempts made to unmount a busy mount
+	// before it is lazily detached
+	UnmountRetries = 5
+)
+
+// UnmountBackoff is the delay before the first retry of a busy unmount, which
+// doubles with each following attempt
+var UnmountBackoff = 100 * time.Millisecond
+
+// parseMountInfo will return the mount points listed in mountinfo
+func parseMountInfo(r io.Reader) ([]string, error) {
+	var mounts []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPath(fields[4]))
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath will decode the octal escapes used in mountinfo paths,
+// i.e. "\040" for a space
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// mountsUnder will return the mounts at or beneath root, deepest first, so
+// that children are always unmounted before their parents
+func mountsUnder(mounts []string, root string) []string {
+	var under []string
+	seen := make(map[string]bool)
+	for _, m := range mounts {
+		if (m == root || strings.HasPrefix(m, root+"/")) && !seen[m] {
+			under = append(under, m)
+			seen[m] = true
+		}
+	}
+	sort.SliceStable(under, func(i, j int) bool {
+		return strings.Count(under[i], "/") > strings.Count(under[j], "/")
+	})
+	return under
+}
+
+// ActiveMountsUnder will return the mounts currently at or beneath root,
+// deepest first
+func ActiveMountsUnder(root string) ([]string, error) {
+	f, err := os.Open(MountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, reason: %s\n", MountInfoPath, err)
+	}
+	return mountsUnder(mounts, root), nil
+}
+
+// UnmountTree will unmount everything at or beneath root, children first.
+// Processes still using the tree are killed, busy mounts are retried with a
+// backoff, and as a last resort are lazily detached.
+func UnmountTree(root string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	remaining, err := ActiveMountsUnder(root)
+	if err != nil {
+		return err
+	}
+	if len(remaining) < 1 {
+		return nil
+	}
+	MurderDeathKill(root)
+
+	var failed []string
+	for _, m := range remaining {
+		if err := unmountWithRetry(m); err != nil {
+			log.Errorf("Failed to unmount %s, reason: %s\n", m, err)
+			failed = append(failed, m)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to unmount: %s\n", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// unmountWithRetry will attempt to unmount the mount point, retrying while
+// it is busy and finally detaching it lazily
+func unmountWithRetry(mountPoint string) error {
+	backoff := UnmountBackoff
+	for attempt := 1; ; attempt++ {
+		err := syscall.Unmount(mountPoint, 0)
+		switch err {
+		case nil, syscall.EINVAL, syscall.ENOENT:
+			// Already gone
+			return nil
+		case syscall.EBUSY:
+		default:
+			return err
+		}
+		if attempt >= UnmountRetries {
+			break
+		}
+		log.Debugf("Mount %s is busy, retrying in %s\n", mountPoint, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		MurderDeathKill(mountPoint)
+	}
+	log.Warnf("Lazily detaching busy mount %s\n", mountPoint)
+	return syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+}
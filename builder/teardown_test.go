@@ -0,0 +1,58 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+const mountInfo = `22 1 0:21 / / rw,relatime shared:1 - btrfs /dev/sda1 rw
+120 22 0:45 / /var/cache/solbuild/main-x86_64/nano/img ro,relatime - squashfs /dev/loop0 ro
+121 22 0:46 / /var/cache/solbuild/main-x86_64/nano/union rw,relatime - overlay overlay rw
+122 121 0:5 / /var/cache/solbuild/main-x86_64/nano/union/dev rw,nosuid - devtmpfs devtmpfs rw
+123 122 0:47 / /var/cache/solbuild/main-x86_64/nano/union/dev/pts rw,nosuid - devpts devpts rw
+124 121 0:48 / /var/cache/solbuild/main-x86_64/nano/union/home/build/YPKG/sources/nano\0405.8.tar.xz ro - btrfs /dev/sda1 rw
+125 22 0:49 / /var/cache/solbuild/main-x86_64/nano-docs/union rw,relatime - overlay overlay rw
+`
+
+func TestMountsUnder(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(mountInfo))
+	if err != nil {
+		t.Fatalf("Failed to parse mountinfo: %v", err)
+	}
+	if len(mounts) != 7 {
+		t.Fatalf("Invalid number of mounts: %d vs expected 7", len(mounts))
+	}
+	under := mountsUnder(mounts, "/var/cache/solbuild/main-x86_64/nano")
+	if len(under) != 5 {
+		t.Fatalf("Invalid number of mounts under root: %d vs expected 5: %v", len(under), under)
+	}
+	if !strings.HasSuffix(under[0], "/nano 5.8.tar.xz") {
+		t.Fatalf("Deepest mount must be first, and unescaped: %s", under[0])
+	}
+	for i := 1; i < len(under); i++ {
+		if strings.Count(under[i], "/") > strings.Count(under[i-1], "/") {
+			t.Fatalf("Parent %s unmounted before child %s", under[i-1], under[i])
+		}
+	}
+	for _, m := range under {
+		if strings.Contains(m, "nano-docs") {
+			t.Fatalf("Matched a sibling mount: %s", m)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder/source"
+	"sync"
+	"time"
+)
+
+// PhaseDurations are the longest each phase of a build may run for before it
+// is killed. A zero duration never times out.
+type PhaseDurations struct {
+	FetchTimeout      time.Duration // Fetching the sources
+	UpgradeTimeout    time.Duration // Upgrading the build root
+	DepInstallTimeout time.Duration // Installing system.devel, then the build deps
+	CompileTimeout    time.Duration // Building the package
+}
+
+var (
+	// DefaultPhaseDurations are the timeouts used unless overridden
+	DefaultPhaseDurations = PhaseDurations{
+		FetchTimeout:      30 * time.Minute,
+		UpgradeTimeout:    time.Hour,
+		DepInstallTimeout: time.Hour,
+		CompileTimeout:    4 * time.Hour,
+	}
+
+	// PhaseTimeouts are the timeouts for the phases of each build
+	PhaseTimeouts = DefaultPhaseDurations
+
+	// ErrPhaseTimeout is matched by any PhaseTimeoutError
+	ErrPhaseTimeout = errors.New("Build phase timed out")
+)
+
+// For returns the timeout of the phase the stage belongs to
+func (d PhaseDurations) For(s Stage) time.Duration {
+	switch s {
+	case StageFetch:
+		return d.FetchTimeout
+	case StageUpgrade:
+		return d.UpgradeTimeout
+	case StageDevel, StageDeps:
+		return d.DepInstallTimeout
+	case StageBuild:
+		return d.CompileTimeout
+	default:
+		return 0
+	}
+}
+
+// A PhaseTimeoutError is returned when a phase of the build runs for longer
+// than its timeout
+type PhaseTimeoutError struct {
+	Stage   Stage
+	Timeout time.Duration
+}
+
+// Error will name the phase and its timeout
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("The %s phase timed out after %s", e.Stage, e.Timeout)
+}
+
+// Is will match ErrPhaseTimeout
+func (e *PhaseTimeoutError) Is(target error) bool {
+	return target == ErrPhaseTimeout
+}
+
+// A phaseWatchdog enforces the timeout of each phase as the StageTimer moves
+// through them. Processes are stopped through kill, while downloads are
+// aborted at the source deadline.
+type phaseWatchdog struct {
+	durations PhaseDurations
+	kill      func()
+
+	lock    sync.Mutex
+	stage   Stage
+	started time.Time
+	timer   *time.Timer
+}
+
+// newPhaseWatchdog will return a watchdog calling kill when a phase times out
+func newPhaseWatchdog(durations PhaseDurations, kill func()) *phaseWatchdog {
+	return &phaseWatchdog{
+		durations: durations,
+		kill:      kill,
+	}
+}
+
+// Start will begin timing the phase of the stage, and is registered with
+// StageTimer.OnStart
+func (w *phaseWatchdog) Start(s Stage) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopTimer()
+	w.stage = s
+	w.started = time.Now()
+	source.Deadline = time.Time{}
+	timeout := w.durations.For(s)
+	if timeout <= 0 {
+		return
+	}
+	if s == StageFetch {
+		source.Deadline = w.started.Add(timeout)
+	}
+	w.timer = time.AfterFunc(timeout, func() {
+		log.Errorf("The %s phase timed out after %s, stopping it\n", s, timeout)
+		w.kill()
+	})
+}
+
+// Stop will disarm the watchdog
+func (w *phaseWatchdog) Stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopTimer()
+	source.Deadline = time.Time{}
+}
+
+// stopTimer will cancel any pending timeout
+func (w *phaseWatchdog) stopTimer() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// Wrap will replace the error of a stage that ran out of time with a
+// PhaseTimeoutError, as whatever was killed fails in its own way
+func (w *phaseWatchdog) Wrap(err error) error {
+	var se *StageError
+	if !errors.As(err, &se) {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	timeout := w.durations.For(se.Stage)
+	if se.Stage != w.stage || timeout <= 0 || time.Since(w.started) < timeout {
+		return err
+	}
+	log.Debugf("Phase %s failed after timing out, reason: %s\n", se.Stage, se.Err)
+	return &StageError{Stage: se.Stage, Err: &PhaseTimeoutError{Stage: se.Stage, Timeout: timeout}}
+}
@@ -0,0 +1,72 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"github.com/getsolus/solbuild/builder/source"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseWatchdog(t *testing.T) {
+	killed := make(chan struct{}, 1)
+	durations := PhaseDurations{FetchTimeout: time.Hour, CompileTimeout: 20 * time.Millisecond}
+	w := newPhaseWatchdog(durations, func() { killed <- struct{}{} })
+
+	w.Start(StageFetch)
+	if source.Deadline.IsZero() {
+		t.Fatal("Fetch phase did not set a download deadline")
+	}
+	w.Start(StageDeps)
+	if !source.Deadline.IsZero() {
+		t.Fatal("Download deadline was not cleared")
+	}
+	failure := &StageError{Stage: StageDeps, Err: errors.New("eopkg failed")}
+	if err := w.Wrap(failure); err != failure {
+		t.Fatalf("Phase without a timeout was wrapped: %v", err)
+	}
+
+	w.Start(StageBuild)
+	select {
+	case <-killed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out phase was not killed")
+	}
+	err := w.Wrap(&StageError{Stage: StageBuild, Err: errors.New("signal: killed")})
+	if !errors.Is(err, ErrPhaseTimeout) || !strings.Contains(err.Error(), "build phase") {
+		t.Fatalf("Expected a timeout of the build phase, got: %v", err)
+	}
+	if ExitCode(err) != StageBuild.ExitCode() {
+		t.Fatalf("Timeout lost the stage exit code: %d", ExitCode(err))
+	}
+	w.Stop()
+}
+
+func TestPhaseDurationsFor(t *testing.T) {
+	d := DefaultPhaseDurations
+	if d.For(StageFetch) != 30*time.Minute || d.For(StageUpgrade) != time.Hour || d.For(StageBuild) != 4*time.Hour {
+		t.Fatalf("Wrong default timeouts: %+v", d)
+	}
+	if d.For(StageDevel) != d.DepInstallTimeout || d.For(StageDeps) != d.DepInstallTimeout {
+		t.Fatal("Dependency stages should share a timeout")
+	}
+	if d.For(StageCollect) != 0 || d.For(StageActivate) != 0 {
+		t.Fatal("Only fetch, upgrade, deps and build phases time out")
+	}
+}
@@ -0,0 +1,177 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// MemInfoPath describes the memory of the host
+	MemInfoPath = "/proc/meminfo"
+
+	// TmpfsMemoryShare is the percentage of the available memory used by a
+	// tmpfs when no size is given
+	TmpfsMemoryShare = 75
+
+	// tmpfsFullShare is the percentage of a tmpfs left free, below which it
+	// is assumed to have filled up when a build fails
+	tmpfsFullShare = 1
+)
+
+var (
+	// TmpfsCeiling is the largest tmpfs sized from the available memory.
+	// Zero places no limit beyond the memory itself.
+	TmpfsCeiling int64
+
+	// ErrTmpfsFull is matched by any TmpfsFullError
+	ErrTmpfsFull = errors.New("The tmpfs filled up during the build")
+)
+
+// A TmpfsFullError is returned when a tmpfs build fails once it has run out
+// of space, as the cause is hidden within the build output
+type TmpfsFullError struct {
+	Size int64
+	Err  error
+}
+
+// Error will describe the failure, and how to avoid it
+func (e *TmpfsFullError) Error() string {
+	return fmt.Sprintf("%s (%s): %s. Build without --tmpfs, or set build_size in the package options to build on disk automatically",
+		ErrTmpfsFull, FormatBytes(e.Size), strings.TrimSpace(e.Err.Error()))
+}
+
+// Is will match ErrTmpfsFull
+func (e *TmpfsFullError) Is(target error) bool {
+	return target == ErrTmpfsFull
+}
+
+// Unwrap returns the failure of the build
+func (e *TmpfsFullError) Unwrap() error {
+	return e.Err
+}
+
+// PlanTmpfs will determine the size of a tmpfs for a build, and whether one
+// should be used at all. A size that was given is used as is. Otherwise the
+// tmpfs may use TmpfsMemoryShare of the available memory, up to the ceiling
+// when set. When the package needs more space to build than the tmpfs would
+// have, it is built on disk instead. Zero means unknown, or unset.
+func PlanTmpfs(size, available, ceiling, buildSize int64) (int64, bool) {
+	if size == 0 {
+		size = available * TmpfsMemoryShare / 100
+		if ceiling > 0 && size > ceiling {
+			size = ceiling
+		}
+	}
+	if buildSize > 0 && size < buildSize {
+		return size, false
+	}
+	return size, true
+}
+
+// readMemAvailable will return the memory available to start new
+// applications without swapping, in bytes
+func readMemAvailable(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || fields[0] != "MemAvailable:" || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("No MemAvailable in %s", path)
+}
+
+// sizeTmpfs will size the tmpfs of a build when none was given, or fall back
+// to building on disk when the package needs more space than it would have
+func (m *Manager) sizeTmpfs() {
+	if !m.Config.EnableTmpfs {
+		return
+	}
+	var size, buildSize int64
+	if m.Config.TmpfsSize != "" {
+		var err error
+		// Any other syntax understood by mount, i.e. 50%, is used as is
+		if size, err = ParseBytes(m.Config.TmpfsSize); err != nil {
+			return
+		}
+	}
+	if m.pkg.Options != nil {
+		buildSize = m.pkg.Options.buildSize
+	}
+	available := int64(0)
+	if size == 0 {
+		var err error
+		if available, err = readMemAvailable(MemInfoPath); err != nil {
+			log.Warnf("Unable to size the tmpfs, leaving it unbounded, reason: %s\n", err)
+			return
+		}
+	}
+	size, ok := PlanTmpfs(size, available, TmpfsCeiling, buildSize)
+	if !ok {
+		log.Warnf("The package needs %s to build, more than the %s tmpfs, building on disk instead\n", FormatBytes(buildSize), FormatBytes(size))
+		m.Config.EnableTmpfs = false
+		return
+	}
+	if m.Config.TmpfsSize == "" {
+		log.Infof("Using a %s tmpfs, %d%% of the available memory\n", FormatBytes(size), TmpfsMemoryShare)
+		m.Config.TmpfsSize = strconv.FormatInt(size, 10)
+	}
+}
+
+// tmpfsFilled will determine whether a tmpfs of the given total size is
+// out of space
+func tmpfsFilled(free, total int64) bool {
+	return total > 0 && free*100 < total*tmpfsFullShare
+}
+
+// tmpfsFull will replace the failure of a tmpfs build with a TmpfsFullError
+// when the tmpfs has filled up, which is almost certainly the cause
+func (o *Overlay) tmpfsFull(err error) error {
+	if !o.EnableTmpfs {
+		return err
+	}
+	var st syscall.Statfs_t
+	if serr := syscall.Statfs(o.BaseDir, &st); serr != nil {
+		return err
+	}
+	total := int64(st.Blocks) * int64(st.Bsize)
+	if !tmpfsFilled(int64(st.Bavail)*int64(st.Bsize), total) {
+		return err
+	}
+	return &TmpfsFullError{Size: total, Err: err}
+}
@@ -0,0 +1,88 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanTmpfs(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+	plans := []struct {
+		size, available, ceiling, buildSize int64
+		expected                            int64
+		ok                                  bool
+	}{
+		{0, 16 * gib, 0, 0, 12 * gib, true},
+		{0, 16 * gib, 8 * gib, 0, 8 * gib, true},
+		{0, 16 * gib, 32 * gib, 0, 12 * gib, true},
+		{4 * gib, 16 * gib, 2 * gib, 0, 4 * gib, true},
+		{0, 16 * gib, 0, 10 * gib, 12 * gib, true},
+		{0, 16 * gib, 0, 40 * gib, 12 * gib, false},
+		{4 * gib, 0, 0, 5 * gib, 4 * gib, false},
+	}
+	for _, p := range plans {
+		size, ok := PlanTmpfs(p.size, p.available, p.ceiling, p.buildSize)
+		if size != p.expected || ok != p.ok {
+			t.Fatalf("Planned %d %v for %+v", size, ok, p)
+		}
+	}
+}
+
+func TestReadMemAvailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-meminfo")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "meminfo")
+	ioutil.WriteFile(path, []byte("MemTotal:       32768000 kB\nMemFree:         1024000 kB\nMemAvailable:   16384000 kB\n"), 00644)
+	available, err := readMemAvailable(path)
+	if err != nil {
+		t.Fatalf("Failed to read memory: %v", err)
+	}
+	if available != 16384000*1024 {
+		t.Fatalf("Wrong available memory: %d", available)
+	}
+	ioutil.WriteFile(path, []byte("MemTotal:       32768000 kB\n"), 00644)
+	if _, err := readMemAvailable(path); err == nil {
+		t.Fatal("Read available memory that was missing")
+	}
+}
+
+func TestTmpfsFull(t *testing.T) {
+	if !tmpfsFilled(0, 1024) || !tmpfsFilled(10, 2048) {
+		t.Fatal("Full tmpfs was not detected")
+	}
+	if tmpfsFilled(512, 1024) || tmpfsFilled(0, 0) {
+		t.Fatal("Tmpfs was wrongly detected as full")
+	}
+	err := &TmpfsFullError{Size: 1024, Err: fmt.Errorf("Failed to build\n")}
+	if !errors.Is(err, ErrTmpfsFull) || errors.Unwrap(err) != err.Err {
+		t.Fatalf("Wrong error matching: %v", err)
+	}
+	o := &Overlay{}
+	build := errors.New("Failed to build")
+	if o.tmpfsFull(build) != build {
+		t.Fatal("Disk build failure was replaced")
+	}
+}
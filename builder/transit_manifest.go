@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -55,8 +56,26 @@ type TransitManifest struct {
 	// version agnostic.
 	Manifest TransitManifestHeader `toml:"manifest"`
 
+	// When the package was built, fixed if requested for reproducibility
+	BuildTime time.Time `toml:"build_time"`
+
+	// The version of solbuild that built the package
+	Solbuild string `toml:"solbuild"`
+
+	// Identifies the build in the logs of the build server
+	BuildID string `toml:"build_id,omitempty"`
+
+	// The repositories enabled within the build root, in order of priority
+	Repos []string `toml:"repos,omitempty"`
+
+	// The ccache statistics of the build, when ccache was used
+	Ccache *CcacheStats `toml:"ccache,omitempty"`
+
 	// A list of files that accompanied this .tram upload
 	File []TransitManifestFile `toml:"file"`
+
+	// How long each stage of the build took
+	Timing []TransitManifestTiming `toml:"timing,omitempty"`
 }
 
 // TransitManifestFile provides simple verification data for each file in the
@@ -70,6 +89,16 @@ type TransitManifestFile struct {
 	Sha256 string `toml:"sha256"`
 }
 
+// TransitManifestTiming records the duration of a single build stage
+type TransitManifestTiming struct {
+
+	// Name of the stage, i.e. build
+	Stage string `toml:"stage"`
+
+	// Duration of the stage in seconds
+	Duration float64 `toml:"duration"`
+}
+
 // NewTransitManifest will attempt to load the transit manifest from the
 // named path and perform *basic* validation.
 func NewTransitManifest(target string) *TransitManifest {
@@ -78,6 +107,10 @@ func NewTransitManifest(target string) *TransitManifest {
 			Version: "1.0",
 			Target:  target,
 		},
+		Solbuild: GetVersionInfo().String(),
+		BuildID:  BuildID,
+		Repos:    BuildRepos,
+		Ccache:   BuildCcache,
 	}
 }
 
@@ -98,6 +131,16 @@ func (t *TransitManifest) AddFile(path string) error {
 	return nil
 }
 
+// AddTimings will record the given stage timings in the manifest
+func (t *TransitManifest) AddTimings(timings []*StageTiming) {
+	for _, st := range timings {
+		t.Timing = append(t.Timing, TransitManifestTiming{
+			Stage:    st.Name,
+			Duration: st.Seconds,
+		})
+	}
+}
+
 // Write will dump the manifest to the given file path
 func (t *TransitManifest) Write(path string) error {
 	blob := bytes.Buffer{}
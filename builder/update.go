@@ -17,14 +17,32 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/disk"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-func (b *BackingImage) updatePackages(notif PidNotifier, pkgManager *EopkgManager) error {
+// ErrNoActiveRepos is returned when updating an image without any active repos
+var ErrNoActiveRepos = errors.New("The image has no active repositories to update from")
+
+// ErrNoImageOrigin is returned when checking for an update of an image with
+// no hash recorded when it was downloaded, such as a clone, or an image
+// initialised before hashes were recorded
+var ErrNoImageOrigin = errors.New("The image has no recorded origin to check")
+
+// ImageHashTimeout is the maximum time to wait for the published hash of an
+// image
+var ImageHashTimeout = 30 * time.Second
+
+func (b *BackingImage) updatePackages(notif PidNotifier, pkgManager PackageManager) error {
 	log.Debugln("Initialising package manager")
 
 	if err := pkgManager.Init(); err != nil {
@@ -37,6 +55,22 @@ func (b *BackingImage) updatePackages(notif PidNotifier, pkgManager *EopkgManage
 		return fmt.Errorf("Failed to start d-bus, reason: %s\n", err)
 	}
 
+	// Repos are discovered exactly as they are for builds
+	repos, err := pkgManager.ListRepos()
+	if err != nil {
+		return err
+	}
+	active := 0
+	for _, repo := range repos {
+		log.Debugf("Image repository %s %s (active: %v)\n", repo.ID, repo.URI, repo.Active)
+		if repo.Active {
+			active++
+		}
+	}
+	if active < 1 {
+		return ErrNoActiveRepos
+	}
+
 	log.Debugln("Upgrading builder image")
 	if err := pkgManager.Upgrade(); err != nil {
 		return fmt.Errorf("Failed to perform upgrade, reason: %s\n", err)
@@ -56,11 +90,9 @@ func (b *BackingImage) updatePackages(notif PidNotifier, pkgManager *EopkgManage
 	return nil
 }
 
-// Update will attempt to update the backing image to the latest version
-// internally.
-func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error {
+// mountRoot will mount the backing image and its /proc at the RootDir
+func (b *BackingImage) mountRoot() error {
 	mountMan := disk.GetMountManager()
-	log.Debugf("Updating backing image %s\n", b.Name)
 
 	if !PathExists(b.RootDir) {
 		if err := os.MkdirAll(b.RootDir, 00755); err != nil {
@@ -87,6 +119,17 @@ func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error
 	if err := mountMan.Mount("proc", procPoint, "proc", "nosuid", "noexec"); err != nil {
 		return fmt.Errorf("Failed to mount /proc, reason: %s\n", err)
 	}
+	return nil
+}
+
+// Update will attempt to update the backing image to the latest version
+// internally.
+func (b *BackingImage) Update(notif PidNotifier, pkgManager PackageManager) error {
+	log.Debugf("Updating backing image %s\n", b.Name)
+
+	if err := b.mountRoot(); err != nil {
+		return err
+	}
 
 	// Hand over to package management to do the updates
 	if err := b.updatePackages(notif, pkgManager); err != nil {
@@ -98,7 +141,92 @@ func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error
 		return err
 	}
 
+	if err := b.WriteStamp(); err != nil {
+		return err
+	}
+
 	log.Debugf("Image successfully updated %s\n", b.Name)
 
 	return nil
 }
+
+// Rollback will attempt to revert the most recent upgrade of the backing image
+func (b *BackingImage) Rollback(notif PidNotifier, pkgManager PackageManager) error {
+	log.Debugf("Rolling back backing image %s\n", b.Name)
+
+	if err := b.mountRoot(); err != nil {
+		return err
+	}
+
+	if err := pkgManager.Init(); err != nil {
+		return fmt.Errorf("Failed to initialise package manager, reason: %s\n", err)
+	}
+
+	log.Debugln("Starting D-BUS")
+	if err := pkgManager.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %s\n", err)
+	}
+
+	if err := pkgManager.Rollback(); err != nil {
+		return err
+	}
+
+	log.Debugln("Stopping D-BUS")
+	if err := pkgManager.StopDBUS(); err != nil {
+		return fmt.Errorf("Failed to stop d-bus, reason: %s\n", err)
+	}
+
+	log.Debugf("Image successfully rolled back %s\n", b.Name)
+	return nil
+}
+
+// CheckForUpdate will compare the hash recorded when the image was
+// downloaded against the sha256sum published beside the remote image,
+// without downloading the image itself. The installed image is changed by
+// updates, so its own hash is never compared. The remote hash is returned
+// along with whether it differs.
+func (b *BackingImage) CheckForUpdate() (bool, string, error) {
+	hashes, err := b.loadHashes()
+	if err != nil {
+		return false, "", err
+	}
+	if b.HashURI == "" || hashes == nil || hashes.Initial == "" {
+		return false, "", ErrNoImageOrigin
+	}
+	remote, err := fetchImageHash(b.HashURI)
+	if err != nil {
+		return false, "", err
+	}
+	log.Debugf("Image %s downloaded sha256 %s, remote %s\n", b.Name, hashes.Initial, remote)
+	return hashes.Initial != remote, remote, nil
+}
+
+// fetchImageHash will download the sha256sum at uri, which may be followed
+// by the file name in the format of sha256sum
+func fetchImageHash(uri string) (string, error) {
+	client := &http.Client{Timeout: ImageHashTimeout}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch image hash %s, reason: %s\n", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to fetch image hash %s, reason: %s\n", uri, resp.Status)
+	}
+	// Anything longer cannot be a hash file
+	b, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 4096})
+	if err != nil {
+		return "", fmt.Errorf("Failed to read image hash %s, reason: %s\n", uri, err)
+	}
+	return parseImageHash(uri, b)
+}
+
+// parseImageHash will parse the sha256sum read from source, which may be
+// followed by the file name in the format of sha256sum
+func parseImageHash(source string, b []byte) (string, error) {
+	fields := strings.Fields(string(b))
+	if len(fields) < 1 || len(fields[0]) != 64 {
+		return "", fmt.Errorf("Invalid image hash %s: %q\n", source, strings.TrimSpace(string(b)))
+	}
+	return strings.ToLower(fields[0]), nil
+}
@@ -0,0 +1,97 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckForUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-update")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b := &BackingImage{
+		Name:       "unstable-x86_64",
+		ImagePath:  filepath.Join(dir, "unstable-x86_64.img"),
+		HashesPath: filepath.Join(dir, "unstable-x86_64"+ImageHashesSuffix),
+	}
+	if err := ioutil.WriteFile(b.ImagePath, []byte("image"), 00644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	local, err := FileSha256sum(b.ImagePath)
+	if err != nil {
+		t.Fatalf("Failed to hash image: %v", err)
+	}
+
+	remote := local
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unstable-x86_64.img.sha256":
+			fmt.Fprintf(w, "%s  unstable-x86_64.img\n", remote)
+		case "/garbage.sha256":
+			fmt.Fprintln(w, "<html>Not a hash</html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	b.HashURI = srv.URL + "/unstable-x86_64.img.sha256"
+	if _, _, err := b.CheckForUpdate(); !errors.Is(err, ErrNoImageOrigin) {
+		t.Fatalf("Expected ErrNoImageOrigin without recorded hashes, got %v", err)
+	}
+	if err := b.RecordHash(true); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+	available, hash, err := b.CheckForUpdate()
+	if err != nil || available || hash != local {
+		t.Fatalf("Expected image to be up to date, got %v %s: %v", available, hash, err)
+	}
+
+	// Updating the image locally must not report an update
+	if err := ioutil.WriteFile(b.ImagePath, []byte("updated image"), 00644); err != nil {
+		t.Fatalf("Failed to update image: %v", err)
+	}
+	if err := b.RecordHash(false); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+	if available, _, err = b.CheckForUpdate(); err != nil || available {
+		t.Fatalf("Expected a locally updated image to be up to date, got %v: %v", available, err)
+	}
+
+	remote = "4d967a30111bf29f0eba01c448b375c1629b2fed01cdfcc3aed91f1b57d5dd5e"
+	available, hash, err = b.CheckForUpdate()
+	if err != nil || !available || hash != remote {
+		t.Fatalf("Expected an update to be available, got %v %s: %v", available, hash, err)
+	}
+
+	for _, uri := range []string{"/missing.sha256", "/garbage.sha256"} {
+		b.HashURI = srv.URL + uri
+		if _, _, err := b.CheckForUpdate(); err == nil {
+			t.Fatalf("Expected an error for %s", uri)
+		}
+	}
+}
@@ -17,15 +17,16 @@
 package builder
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	log "github.com/DataDrake/waterlog"
 	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/libosdev/disk"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -57,6 +58,15 @@ func (p *Package) ActivateRoot(overlay *Overlay) error {
 		return err
 	}
 
+	if err := overlay.ConfigureHost(); err != nil {
+		return err
+	}
+
+	// A crashed build may have left its bus behind in a reused overlay
+	if err := CleanStaleDBus(overlay.MountPoint); err != nil {
+		return err
+	}
+
 	// Add build user
 	if p.Type == PackageTypeYpkg {
 		if err := AddBuildUser(overlay.MountPoint); err != nil {
@@ -78,8 +88,9 @@ func (p *Package) DeactivateRoot(overlay *Overlay) {
 	mountMan.UnmountAll()
 }
 
-// MurderDeathKill will find all processes with a root matching the given root
-// and set about killing them, to assist in clean closing.
+// MurderDeathKill will find all processes with a root or working directory
+// at or beneath the given root and set about killing them, to assist in
+// clean closing.
 func MurderDeathKill(root string) error {
 	path, err := filepath.EvalSymlinks(root)
 	if err != nil {
@@ -93,14 +104,10 @@ func MurderDeathKill(root string) error {
 	}
 
 	for _, f := range files {
-		fpath := filepath.Join("/proc", f.Name(), "cwd")
-
-		spath, err := filepath.EvalSymlinks(fpath)
-		if err != nil {
+		if _, err := strconv.Atoi(f.Name()); err != nil {
 			continue
 		}
-
-		if spath != path {
+		if !processUnder(filepath.Join("/proc", f.Name()), path) {
 			continue
 		}
 
@@ -124,19 +131,42 @@ func MurderDeathKill(root string) error {
 	return nil
 }
 
+// processUnder will determine whether the process has its root or working
+// directory at or beneath the given path
+func processUnder(proc, path string) bool {
+	for _, link := range []string{"root", "cwd"} {
+		spath, err := os.Readlink(filepath.Join(proc, link))
+		if err != nil {
+			continue
+		}
+		if spath == path || strings.HasPrefix(spath, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // TouchFile will create the file if it doesn't exist, enabling use of bind
 // mounts.
+//
+// Creation is exclusive so that concurrent callers cannot race each other,
+// and the timestamps are only set when we were the one to create the file.
 func TouchFile(path string) error {
-	w, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 00644)
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 00644)
 	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
 		return err
 	}
 	defer w.Close()
-	return nil
+	now := time.Now()
+	return os.Chtimes(path, now, now)
 }
 
 // SaneEnvironment will generate a clean environment for the chroot'd
-// processes to use
+// processes to use. Only whitelisted variables are passed from the host,
+// see EnvironmentPassthrough.
 func SaneEnvironment(username, home string) []string {
 	environment := []string{
 		"PATH=/usr/bin:/usr/sbin:/bin/:/sbin",
@@ -146,31 +176,13 @@ func SaneEnvironment(username, home string) []string {
 		fmt.Sprintf("USER=%s", username),
 		fmt.Sprintf("USERNAME=%s", username),
 	}
-	// Consider an option to even filter these out
-	permitted := []string{
-		"http_proxy",
-		"https_proxy",
-		"no_proxy",
-		"ftp_proxy",
-		"TERM",
-	}
+	environment = append(environment, passthroughEnvironment()...)
 	if !DisableColors {
-		permitted = append(permitted, "TERM")
-	}
-	for _, p := range permitted {
-		env := os.Getenv(p)
-		if env == "" {
-			p = strings.ToUpper(p)
-			env = os.Getenv(p)
-		}
-		if env == "" {
-			continue
+		if term := os.Getenv("TERM"); term != "" {
+			environment = setEnv(environment, "TERM", term)
 		}
-		environment = append(environment,
-			fmt.Sprintf("%s=%s", p, env))
-	}
-	if DisableColors {
-		environment = append(environment, "TERM=dumb")
+	} else {
+		environment = setEnv(environment, "TERM", "dumb")
 	}
 	return environment
 }
@@ -178,26 +190,66 @@ func SaneEnvironment(username, home string) []string {
 // ChrootExec is a simple wrapper to return a correctly set up chroot command,
 // so that we can store the PID, for long running tasks
 func ChrootExec(notif PidNotifier, dir, command string) error {
-	args := []string{dir, "/bin/sh", "-c", command}
-	c := exec.Command("chroot", args...)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
+	return ChrootExecCapture(notif, dir, command, nil)
+}
+
+// ChrootExecCapture is identical to ChrootExec, but additionally copies all
+// output of the command to capture, when set
+func ChrootExecCapture(notif PidNotifier, dir, command string, capture io.Writer) error {
+	c := chrootCommand(dir, command)
+	if RawOutput || ChrootOutput == nil {
+		c.Stdout = consoleStdout()
+		c.Stderr = os.Stderr
+	} else {
+		stdout := ChrootOutput.Writer(consoleStdout())
+		stderr := ChrootOutput.Writer(os.Stderr)
+		defer stdout.Flush()
+		defer stderr.Flush()
+		c.Stdout = stdout
+		c.Stderr = stderr
+	}
+	if capture != nil {
+		c.Stdout = io.MultiWriter(c.Stdout, capture)
+		c.Stderr = io.MultiWriter(c.Stderr, capture)
+	}
 	c.Stdin = nil
 	c.Env = ChrootEnvironment
-	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	c.SysProcAttr.Setsid = true
 
 	if err := c.Start(); err != nil {
 		return err
 	}
 	notif.SetActivePID(c.Process.Pid)
+	if HeartbeatInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go heartbeat(command, done)
+	}
 	return c.Wait()
 }
 
+// ChrootExecOutput will run the command within the chroot, returning its
+// combined output rather than passing it through
+func ChrootExecOutput(notif PidNotifier, dir, command string) (string, error) {
+	c := chrootCommand(dir, command)
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stdout
+	c.Env = ChrootEnvironment
+
+	if err := c.Start(); err != nil {
+		return "", err
+	}
+	notif.SetActivePID(c.Process.Pid)
+	err := c.Wait()
+	notif.SetActivePID(0)
+	return stdout.String(), err
+}
+
 // ChrootExecStdin is almost identical to ChrootExec, except it permits a stdin
 // to be associated with the command
 func ChrootExecStdin(notif PidNotifier, dir, command string) error {
-	args := []string{dir, "/bin/sh", "-c", command}
-	c := exec.Command("chroot", args...)
+	c := chrootCommand(dir, command)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	c.Stdin = os.Stdin
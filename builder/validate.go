@@ -0,0 +1,170 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"github.com/getsolus/solbuild/builder/source"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// SourceCheckTimeout is the maximum time we'll wait for a source to
+	// respond when checking that it is reachable
+	SourceCheckTimeout = 30 * time.Second
+)
+
+var (
+	// ErrSourceCollision is matched by any SourceCollisionError
+	ErrSourceCollision = errors.New("Sources share a file name")
+)
+
+// A SourceCollisionError is returned when several sources would be bound to
+// the same file within the build
+type SourceCollisionError struct {
+	File string
+	URIs []string
+}
+
+// Error will list the colliding sources
+func (e *SourceCollisionError) Error() string {
+	return fmt.Sprintf("Sources share the file name %s, rename them with a #fragment: %s", e.File, strings.Join(e.URIs, ", "))
+}
+
+// Is will match ErrSourceCollision
+func (e *SourceCollisionError) Is(target error) bool {
+	return target == ErrSourceCollision
+}
+
+// sourceFile returns the name the source is bound as in the source directory
+func sourceFile(src source.Source) string {
+	switch s := src.(type) {
+	case *source.SimpleSource:
+		return s.File
+	case *source.GitArchiveSource:
+		return s.File
+	case *source.GitSource:
+		return s.BaseName
+	}
+	return ""
+}
+
+// cachedTarball returns the tarball of a source cached by its hash, either a
+// simple source or a git source archived at a ref
+func cachedTarball(src source.Source) (*source.SimpleSource, bool) {
+	switch s := src.(type) {
+	case *source.SimpleSource:
+		return s, true
+	case *source.GitArchiveSource:
+		return s.SimpleSource, true
+	}
+	return nil, false
+}
+
+// SourceCollisions will find the sources that would be bound on top of each
+// other, in the order they are declared. Renamed sources are compared by
+// their new name.
+func (p *Package) SourceCollisions() []*SourceCollisionError {
+	var collisions []*SourceCollisionError
+	byFile := make(map[string]*SourceCollisionError)
+	for _, src := range p.Sources {
+		file := sourceFile(src)
+		c, ok := byFile[file]
+		if !ok {
+			c = &SourceCollisionError{File: file}
+			byFile[file] = c
+		}
+		c.URIs = append(c.URIs, src.GetIdentifier())
+		if len(c.URIs) == 2 {
+			collisions = append(collisions, c)
+		}
+	}
+	return collisions
+}
+
+// A ValidationProblem is a single issue found in a build recipe
+type ValidationProblem struct {
+	Field   string // The field or source at fault
+	Message string // What is wrong with it
+	Warning bool   // Warnings don't cause validation to fail
+}
+
+// String will return a human readable form of the problem
+func (v ValidationProblem) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Message)
+}
+
+// Validate will check the recipe for problems without building it. When
+// network is set, every source is also checked to be reachable.
+func (p *Package) Validate(network bool) []ValidationProblem {
+	var problems []ValidationProblem
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, ValidationProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.Release < 1 {
+		add("release", "Release must be at least 1, not %d", p.Release)
+	}
+	if err := p.ValidateComponent(); err != nil {
+		add("component", "%s", err)
+	}
+	if len(p.Sources) < 1 {
+		add("source", "No sources are declared")
+	}
+
+	for _, c := range p.SourceCollisions() {
+		add("source", "%s", c)
+	}
+
+	for _, src := range p.Sources {
+		id := src.GetIdentifier()
+		for _, problem := range source.Validate(src) {
+			add(id, "%s", problem)
+		}
+
+		if !network {
+			continue
+		}
+		if s, ok := src.(*source.SimpleSource); ok {
+			if err := checkReachable(s.URI); err != nil {
+				add(id, "Unreachable, reason: %s", err)
+			}
+		}
+	}
+	return problems
+}
+
+// checkReachable will issue a HEAD request to ensure the URI is available.
+// Only HTTP sources can be checked.
+func checkReachable(uri string) error {
+	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+		return nil
+	}
+	client := &http.Client{Timeout: SourceCheckTimeout}
+	resp, err := client.Head(uri)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+	return nil
+}
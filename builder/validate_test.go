@@ -0,0 +1,113 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 0
+component: system.utils
+source:
+    - https://www.nano-editor.org/dist/v5/nano-5.8.tar.xz : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768c
+    - https://mirror.example.com/nano-5.8.tar.xz : e43b63db
+    - not a uri : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768c
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	var errs, warnings int
+	for _, problem := range p.Validate(false) {
+		if problem.Warning {
+			warnings++
+		} else {
+			errs++
+		}
+	}
+	// Release, the duplicate filename, the short hash and the invalid URI
+	if errs != 4 {
+		t.Fatalf("Invalid number of problems: %d vs expected 4", errs)
+	}
+	if warnings != 0 {
+		t.Fatalf("Invalid number of warnings: %d vs expected 0", warnings)
+	}
+
+	legacy, err := NewPackage(LegacyTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load legacy package: %v", err)
+	}
+	if problems := legacy.Validate(false); len(problems) != 0 {
+		t.Fatalf("Valid legacy package has problems: %v", problems)
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: nano
+version: 5.8
+release: 1
+source:
+    - https://www.nano-editor.org/dist/v5/nano-5.8.tar.xz : e43b63db
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	if err := p.ValidateSources(); err == nil {
+		t.Fatal("Accepted a source with a short hash")
+	}
+	legacy, err := NewPackage(LegacyTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load legacy package: %v", err)
+	}
+	if err := legacy.ValidateSources(); err != nil {
+		t.Fatalf("Rejected valid sources: %v", err)
+	}
+}
+
+func TestSourceCollisions(t *testing.T) {
+	p, err := NewYmlPackageFromBytes([]byte(`name: fonts
+version: 1.0
+release: 1
+source:
+    - https://example.com/regular/font.zip : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768c
+    - https://example.com/bold/font.zip : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768d
+    - https://example.com/italic/font.zip#font-italic.zip : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768e
+    - https://example.com/light/font.zip : e43b63db2f78336e2aa123e8d015dbabc1720a15361714bfd4b1bb4e5e87768f
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	collisions := p.SourceCollisions()
+	if len(collisions) != 1 {
+		t.Fatalf("Invalid number of collisions: %d vs expected 1", len(collisions))
+	}
+	if !errors.Is(collisions[0], ErrSourceCollision) {
+		t.Fatalf("Collision does not match ErrSourceCollision: %v", collisions[0])
+	}
+	expected := []string{
+		"https://example.com/regular/font.zip",
+		"https://example.com/bold/font.zip",
+		"https://example.com/light/font.zip",
+	}
+	if c := collisions[0]; c.File != "font.zip" || !reflect.DeepEqual(c.URIs, expected) {
+		t.Fatalf("Wrong collision: %s %v", c.File, c.URIs)
+	}
+}
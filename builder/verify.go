@@ -0,0 +1,187 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder/source"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// SourceStampsFile records the cached sources that have already been
+	// verified, within the source directory
+	SourceStampsFile = "verified.json"
+)
+
+var (
+	// VerifySources will re-verify the hash of cached sources before they
+	// are used by a build
+	VerifySources bool
+)
+
+// sourceStamp records the state of a cached source when its hash was verified
+type sourceStamp struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Inode   uint64 `json:"inode"`
+	Hash    string `json:"hash"`
+}
+
+// SourceStamps avoids hashing cached sources that have not changed since
+// they were last verified. A file is trusted only while its size, mtime and
+// inode match the stamp, and any problem with the stamps themselves results
+// in the file being hashed again.
+type SourceStamps struct {
+	path   string
+	stamps map[string]sourceStamp
+	dirty  bool
+}
+
+// LoadSourceStamps will load the stamps stored at path. Missing or corrupted
+// stamps are discarded, so that every source is hashed again.
+func LoadSourceStamps(path string) *SourceStamps {
+	s := &SourceStamps{
+		path:   path,
+		stamps: make(map[string]sourceStamp),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read source stamps %s, reason: %s\n", path, err)
+		}
+		return s
+	}
+	if err = json.Unmarshal(b, &s.stamps); err != nil {
+		log.Warnf("Discarding corrupted source stamps %s, reason: %s\n", path, err)
+		s.stamps = make(map[string]sourceStamp)
+	}
+	return s
+}
+
+// Verify will determine whether the file at path has the expected hash,
+// which is a sha1sum for legacy sources. The file is only hashed when it
+// has changed since it was last verified.
+func (s *SourceStamps) Verify(path, expected string, legacy bool) (bool, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	current := sourceStamp{
+		Size:    st.Size(),
+		ModTime: st.ModTime().UnixNano(),
+	}
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		current.Inode = sys.Ino
+	}
+	if stamp, ok := s.stamps[path]; ok && stamp.Hash == expected {
+		current.Hash = stamp.Hash
+		if stamp == current {
+			return true, nil
+		}
+	}
+	log.Debugf("Verifying cached source %s\n", path)
+	sum, err := hashFile(path, legacy)
+	if err != nil {
+		return false, err
+	}
+	s.dirty = true
+	if sum != expected {
+		delete(s.stamps, path)
+		return false, nil
+	}
+	current.Hash = sum
+	s.stamps[path] = current
+	return true, nil
+}
+
+// Save will write the stamps back out if they have changed
+func (s *SourceStamps) Save() error {
+	if !s.dirty {
+		return nil
+	}
+	b, err := json.Marshal(s.stamps)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 00755); err != nil {
+		return err
+	}
+	// Never leave a partially written file behind
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 00644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// verifyCached will check the cached copy of src, returning false when it
+// must be fetched again. Only sources cached as tarballs are verified.
+func (s *SourceStamps) verifyCached(src source.Source) (bool, error) {
+	simple, ok := cachedTarball(src)
+	if !ok {
+		return true, nil
+	}
+	path := simple.GetPath(simple.GetValidator())
+	valid, err := s.Verify(path, simple.GetValidator(), simple.IsLegacy())
+	if err != nil {
+		return false, fmt.Errorf("Failed to verify cached source %s, reason: %s\n", path, err)
+	}
+	if valid {
+		return true, nil
+	}
+	log.Warnf("Cached source %s does not match its hash, fetching it again\n", simple.File)
+	if err = os.Remove(path); err != nil {
+		return false, fmt.Errorf("Failed to remove corrupted source %s, reason: %s\n", path, err)
+	}
+	return false, nil
+}
+
+// hashFile will return the sha256sum of the file at path, or the sha1sum
+// of legacy sources
+func hashFile(path string, legacy bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var h hash.Hash
+	if legacy {
+		h = sha1.New()
+	} else {
+		h = sha256.New()
+	}
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
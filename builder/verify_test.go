@@ -0,0 +1,98 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceStamps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-stamps")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "nano-5.8.tar.xz")
+	if err = ioutil.WriteFile(source, []byte("nano"), 00644); err != nil {
+		t.Fatalf("Failed to write source: %s", err)
+	}
+	expected, err := hashFile(source, false)
+	if err != nil {
+		t.Fatalf("Failed to hash source: %s", err)
+	}
+	stampsPath := filepath.Join(dir, SourceStampsFile)
+
+	stamps := LoadSourceStamps(stampsPath)
+	if valid, err := stamps.Verify(source, expected, false); err != nil || !valid {
+		t.Fatalf("Expected source to verify, got %v: %v", valid, err)
+	}
+	if err = stamps.Save(); err != nil {
+		t.Fatalf("Failed to save stamps: %s", err)
+	}
+	stamps = LoadSourceStamps(stampsPath)
+	if len(stamps.stamps) != 1 {
+		t.Fatalf("Expected 1 stamp after reloading, got %d", len(stamps.stamps))
+	}
+	if valid, err := stamps.Verify(source, expected, false); err != nil || !valid {
+		t.Fatalf("Expected stamped source to verify, got %v: %v", valid, err)
+	}
+
+	// Same size, but a new mtime
+	if err = ioutil.WriteFile(source, []byte("vim!"), 00644); err != nil {
+		t.Fatalf("Failed to modify source: %s", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(source, later, later); err != nil {
+		t.Fatalf("Failed to set source mtime: %s", err)
+	}
+	if valid, _ := stamps.Verify(source, expected, false); valid {
+		t.Fatal("Modified source should not verify")
+	}
+	if _, ok := stamps.stamps[source]; ok {
+		t.Fatal("Stamp should be dropped for a modified source")
+	}
+
+	// Corrupted stamps must never skip verification
+	if err = ioutil.WriteFile(stampsPath, []byte("{\"trunc"), 00644); err != nil {
+		t.Fatalf("Failed to corrupt stamps: %s", err)
+	}
+	stamps = LoadSourceStamps(stampsPath)
+	if valid, _ := stamps.Verify(source, expected, false); valid {
+		t.Fatal("Modified source should not verify with corrupted stamps")
+	}
+}
+
+func TestHashFileLegacy(t *testing.T) {
+	f, err := ioutil.TempFile("", "solbuild-hash")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("nano")
+	f.Close()
+	sum, err := hashFile(f.Name(), true)
+	if err != nil {
+		t.Fatalf("Failed to hash file: %s", err)
+	}
+	if sum != "e6efbd8aed7a6a63e6ec49365245a32bdc913b43" {
+		t.Fatalf("Unexpected sha1sum: %s", sum)
+	}
+}
@@ -0,0 +1,104 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// These are set at compile time, i.e.
+//
+//	go build -ldflags "-X github.com/getsolus/solbuild/builder.GitCommit=$(git rev-parse --short HEAD)"
+var (
+	// Version is the current public version of solbuild
+	Version = "1.5.2.0"
+
+	// BuildDate is when this executable was built
+	BuildDate = "unknown"
+
+	// GitCommit is the commit this executable was built from
+	GitCommit = "unknown"
+)
+
+// VersionInfo describes the solbuild executable, and is included in the
+// files written for each build
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// GetVersionInfo returns the version of this executable
+func GetVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String will describe the version on a single line
+func (v VersionInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", v.Version, v.GitCommit, v.BuildDate, v.GoVersion)
+}
+
+// Capabilities are the features of the host that builds depend upon
+type Capabilities struct {
+	Overlayfs bool `json:"overlayfs"`
+	Xz        bool `json:"xz"`
+	Zstd      bool `json:"zstd"`
+}
+
+// DetectCapabilities will determine the capabilities of the running host
+func DetectCapabilities() Capabilities {
+	return Capabilities{
+		Overlayfs: hasFilesystem("/proc/filesystems", "overlay"),
+		Xz:        hasCommand("xz"),
+		Zstd:      hasCommand("zstd"),
+	}
+}
+
+// hasFilesystem will determine if the kernel supports the named filesystem,
+// according to the list at path
+func hasFilesystem(path, name string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCommand will determine if the named executable is in the PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,92 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-metrics")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	timer := NewStageTimer()
+	timer.Start(StageFetch)
+	timer.Stop()
+	path := filepath.Join(dir, "nano"+MetricsSuffix)
+	if err := timer.WriteJSON(path); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	var metrics BuildMetrics
+	if err := json.Unmarshal(b, &metrics); err != nil {
+		t.Fatalf("Failed to parse metrics: %v", err)
+	}
+	if metrics.Solbuild != GetVersionInfo() {
+		t.Fatalf("Wrong version in metrics: %v", metrics.Solbuild)
+	}
+	if len(metrics.Stages) != 1 || metrics.Stages[0].Name != StageFetch.String() {
+		t.Fatalf("Wrong stages in metrics: %v", metrics.Stages)
+	}
+}
+
+func TestHasFilesystem(t *testing.T) {
+	f, err := ioutil.TempFile("", "solbuild-filesystems")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("nodev\tsysfs\nnodev\toverlay\n\text4\n")
+	f.Close()
+	if !hasFilesystem(f.Name(), "overlay") || !hasFilesystem(f.Name(), "ext4") {
+		t.Fatal("Failed to find listed filesystems")
+	}
+	if hasFilesystem(f.Name(), "sys") || hasFilesystem(f.Name()+".missing", "overlay") {
+		t.Fatal("Found a filesystem that is not listed")
+	}
+}
+
+func TestTransitManifestVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solbuild-tram")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nano-5.8-1"+TransitManifestSuffix)
+	if err := NewTransitManifest("unstable").Write(path); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if !strings.Contains(string(b), GetVersionInfo().String()) {
+		t.Fatalf("Missing solbuild version in manifest:\n%s", b)
+	}
+}
@@ -0,0 +1,259 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	// WebhookTimeout is the maximum amount of time we'll wait on any one
+	// webhook before giving up on it.
+	WebhookTimeout = 30 * time.Second
+)
+
+// A Webhook is an endpoint that will be notified of build completion
+type Webhook struct {
+	URL      string `toml:"url"`      // Endpoint to POST the notification to
+	Template string `toml:"template"` // Optional text/template for the request body
+}
+
+// A BuildNotification is sent to every configured webhook when a build
+// has completed, regardless of whether it succeeded.
+type BuildNotification struct {
+	Name     string  `json:"name"`
+	Version  string  `json:"version"`
+	Release  int     `json:"release"`
+	Profile  string  `json:"profile"`
+	Success  bool    `json:"success"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration"` // Duration of the build in seconds
+	LogFile  string  `json:"log_file,omitempty"`
+
+	SolbuildVersion string `json:"solbuild_version"`
+}
+
+// NewBuildNotification will create a notification for the given package
+// and build result.
+func NewBuildNotification(pkg *Package, profile *Profile, duration time.Duration, err error) *BuildNotification {
+	n := &BuildNotification{
+		Name:     pkg.Name,
+		Version:  pkg.Version,
+		Release:  pkg.Release,
+		Profile:  profile.Name,
+		Success:  err == nil,
+		Duration: duration.Seconds(),
+
+		SolbuildVersion: Version,
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// Body will generate the request body for this webhook. Without a template
+// the notification is sent as plain JSON.
+func (w *Webhook) Body(n *BuildNotification) ([]byte, error) {
+	if w.Template == "" {
+		return json.Marshal(n)
+	}
+	tmpl, err := template.New(w.URL).Parse(w.Template)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid webhook template, reason: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n); err != nil {
+		return nil, fmt.Errorf("Failed to execute webhook template, reason: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Send will POST the notification to the webhook
+func (w *Webhook) Send(n *BuildNotification) error {
+	body, err := w.Body(n)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: WebhookTimeout}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// NotifyWebhooks will send the notification to all of the given webhooks.
+// Delivery failures are only logged, they must never affect the build.
+func NotifyWebhooks(hooks []Webhook, n *BuildNotification) {
+	for i := range hooks {
+		hook := &hooks[i]
+		log.Debugf("Notifying webhook %s\n", hook.URL)
+		if err := hook.Send(n); err != nil {
+			log.Warnf("Failed to notify webhook %s, reason: %s\n", hook.URL, err)
+		}
+	}
+}
+
+const (
+	// WebhookQueueSize is the number of build events a WebhookListener will
+	// hold while earlier events are being sent, after which events are
+	// dropped rather than holding up the build
+	WebhookQueueSize = 1024
+
+	// WebhookEventPhaseStart is sent as each stage of the build starts
+	WebhookEventPhaseStart = "phase_start"
+
+	// WebhookEventPhaseComplete is sent as each stage of the build ends
+	WebhookEventPhaseComplete = "phase_complete"
+
+	// WebhookEventLogLine is sent for each line of output from the chroot
+	WebhookEventLogLine = "log_line"
+)
+
+// A BuildEvent is sent by a WebhookListener for each event of a build
+type BuildEvent struct {
+	Event   string    `json:"event"`
+	Phase   string    `json:"phase"`
+	Package string    `json:"package"`
+	BuildID string    `json:"build_id,omitempty"`
+	Time    time.Time `json:"time"`
+	Success *bool     `json:"success,omitempty"` // Only for phase_complete
+	Error   string    `json:"error,omitempty"`
+	Line    string    `json:"line,omitempty"`
+}
+
+// A WebhookListener will POST each event of a build as JSON to a URL. Events
+// are queued and sent in order by a single goroutine, so that a slow or
+// unreachable endpoint never holds up the build.
+type WebhookListener struct {
+	URL     string
+	Package string
+
+	queue   chan *BuildEvent
+	done    chan struct{}
+	client  *http.Client
+	dropped int64 // Accessed atomically
+	once    sync.Once
+}
+
+// NewWebhookListener will return a WebhookListener for the build of the named
+// package, sending events to url until it is closed
+func NewWebhookListener(url, pkg string) *WebhookListener {
+	l := &WebhookListener{
+		URL:     url,
+		Package: pkg,
+		queue:   make(chan *BuildEvent, WebhookQueueSize),
+		done:    make(chan struct{}),
+		client:  &http.Client{Timeout: WebhookTimeout},
+	}
+	go l.run()
+	return l
+}
+
+// OnPhaseStart will send a phase_start event
+func (l *WebhookListener) OnPhaseStart(phase Stage) {
+	l.enqueue(&BuildEvent{Event: WebhookEventPhaseStart, Phase: phase.String()})
+}
+
+// OnPhaseComplete will send a phase_complete event
+func (l *WebhookListener) OnPhaseComplete(phase Stage, err error) {
+	success := err == nil
+	e := &BuildEvent{Event: WebhookEventPhaseComplete, Phase: phase.String(), Success: &success}
+	if err != nil {
+		e.Error = strings.TrimSpace(err.Error())
+	}
+	l.enqueue(e)
+}
+
+// OnLogLine will send a log_line event
+func (l *WebhookListener) OnLogLine(phase Stage, line string) {
+	l.enqueue(&BuildEvent{Event: WebhookEventLogLine, Phase: phase.String(), Line: line})
+}
+
+// enqueue will queue the event to be sent, dropping it if the queue is full
+func (l *WebhookListener) enqueue(e *BuildEvent) {
+	e.Package = l.Package
+	e.BuildID = BuildID
+	e.Time = time.Now().UTC()
+	select {
+	case l.queue <- e:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
+
+// run will send each queued event in turn. After the first failure the
+// endpoint is assumed to be down, and the remaining events are discarded.
+func (l *WebhookListener) run() {
+	defer close(l.done)
+	failed := false
+	for e := range l.queue {
+		if failed {
+			continue
+		}
+		if err := l.send(e); err != nil {
+			log.Warnf("Failed to send build events to %s, reason: %s\n", l.URL, err)
+			failed = true
+		}
+	}
+}
+
+// send will POST a single event
+func (l *WebhookListener) send(e *BuildEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Post(l.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// Close will wait for the queued events to be sent, for no longer than
+// WebhookTimeout, once the build is complete
+func (l *WebhookListener) Close() error {
+	l.once.Do(func() { close(l.queue) })
+	select {
+	case <-l.done:
+	case <-time.After(WebhookTimeout):
+		log.Warnf("Timed out sending build events to %s\n", l.URL)
+	}
+	if dropped := atomic.LoadInt64(&l.dropped); dropped > 0 {
+		log.Warnf("Dropped %d build event(s) for %s as they could not be sent quickly enough\n", dropped, l.URL)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/level"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer records the body of every request, replying with status
+type webhookServer struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies []string
+}
+
+func newWebhookServer(status int) *webhookServer {
+	s := &webhookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.lock.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.lock.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *webhookServer) received() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// captureLog will collect the warnings logged until the end of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := log.Level()
+	log.SetOutput(&buf)
+	log.SetLevel(level.Warn)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stdout)
+		log.SetLevel(prev)
+	})
+	return &buf
+}
+
+func testNotification() *BuildNotification {
+	pkg := &Package{Name: "nano", Version: "5.4", Release: 131}
+	return NewBuildNotification(pkg, &Profile{Name: "main-x86_64"}, 90*time.Second, nil)
+}
+
+func TestWebhookDefaultPayload(t *testing.T) {
+	srv := newWebhookServer(http.StatusOK)
+	defer srv.Close()
+
+	m := &Manager{
+		Config:  &Config{EnableNotify: true, Webhooks: []Webhook{{URL: srv.URL}}},
+		pkg:     &Package{Name: "nano", Version: "5.4", Release: 131},
+		profile: &Profile{Name: "main-x86_64"},
+		logFile: "/var/log/solbuild/nano.log",
+		lock:    new(sync.Mutex),
+	}
+	m.notify(90*time.Second, nil)
+
+	bodies := srv.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected one notification, got %d", len(bodies))
+	}
+	var n BuildNotification
+	if err := json.Unmarshal([]byte(bodies[0]), &n); err != nil {
+		t.Fatalf("Notification is not JSON: %v", err)
+	}
+	expected := BuildNotification{
+		Name:     "nano",
+		Version:  "5.4",
+		Release:  131,
+		Profile:  "main-x86_64",
+		Success:  true,
+		Duration: 90,
+		LogFile:  "/var/log/solbuild/nano.log",
+
+		SolbuildVersion: Version,
+	}
+	if n != expected {
+		t.Fatalf("Expected notification %+v, got %+v", expected, n)
+	}
+}
+
+func TestWebhookFailedBuild(t *testing.T) {
+	pkg := &Package{Name: "nano", Version: "5.4", Release: 131}
+	n := NewBuildNotification(pkg, &Profile{Name: "main-x86_64"}, time.Second, errors.New("build failed"))
+	if n.Success || n.Error != "build failed" {
+		t.Fatalf("Expected a failed notification, got %+v", n)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	srv := newWebhookServer(http.StatusOK)
+	defer srv.Close()
+
+	hooks := []Webhook{{URL: srv.URL, Template: `{"text": "{{.Name}}-{{.Version}}-{{.Release}} built: {{.Success}}"}`}}
+	NotifyWebhooks(hooks, testNotification())
+
+	bodies := srv.received()
+	if len(bodies) != 1 || bodies[0] != `{"text": "nano-5.4-131 built: true"}` {
+		t.Fatalf("Wrong templated notification: %v", bodies)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	srv := newWebhookServer(http.StatusInternalServerError)
+	defer srv.Close()
+	logged := captureLog(t)
+
+	hook := Webhook{URL: srv.URL}
+	if err := hook.Send(testNotification()); err == nil {
+		t.Fatal("Expected an error for a 500 response")
+	}
+	NotifyWebhooks([]Webhook{hook}, testNotification())
+	if !strings.Contains(logged.String(), "Failed to notify webhook "+srv.URL) {
+		t.Fatalf("Expected the failure to be logged, got: %s", logged.String())
+	}
+}
+
+func TestWebhookBadTemplate(t *testing.T) {
+	broken := newWebhookServer(http.StatusOK)
+	defer broken.Close()
+	working := newWebhookServer(http.StatusOK)
+	defer working.Close()
+	logged := captureLog(t)
+
+	hooks := []Webhook{
+		{URL: broken.URL, Template: "{{.Name"},
+		{URL: working.URL},
+	}
+	NotifyWebhooks(hooks, testNotification())
+
+	if len(broken.received()) != 0 {
+		t.Fatal("Notification sent despite an invalid template")
+	}
+	if len(working.received()) != 1 {
+		t.Fatal("Invalid template stopped other webhooks being notified")
+	}
+	if !strings.Contains(logged.String(), "Invalid webhook template") {
+		t.Fatalf("Expected the invalid template to be logged, got: %s", logged.String())
+	}
+}
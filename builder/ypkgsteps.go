@@ -0,0 +1,66 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"regexp"
+	"sync"
+)
+
+var (
+	// ypkgStepFailed matches ypkg-build reporting the step of the build that
+	// failed, i.e. "check failed for nano"
+	ypkgStepFailed = regexp.MustCompile(`\b(\w+) failed for \S+`)
+
+	// ansiEscape matches the colour codes ypkg-build may emit
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// A ypkgSteps follows the output of ypkg-build, to tell a failure of the
+// check step, which runs the package tests, from any other build failure
+type ypkgSteps struct {
+	lock   sync.Mutex
+	failed string // Step reported as failed, if any
+}
+
+// watchYpkgSteps will follow the build output. Nothing is followed when the
+// output is passed straight through.
+func watchYpkgSteps(output *OutputLogger) *ypkgSteps {
+	s := &ypkgSteps{}
+	if output != nil {
+		output.OnLine(s.line)
+	}
+	return s
+}
+
+// line will record the step reported as failed within a line of output
+func (s *ypkgSteps) line(line string) {
+	match := ypkgStepFailed.FindStringSubmatch(ansiEscape.ReplaceAllString(line, ""))
+	if match == nil {
+		return
+	}
+	s.lock.Lock()
+	s.failed = match[1]
+	s.lock.Unlock()
+}
+
+// checkFailed will determine whether the check step failed
+func (s *ypkgSteps) checkFailed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.failed == "check"
+}
@@ -0,0 +1,52 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestYpkgStepsCheckFailed(t *testing.T) {
+	var log bytes.Buffer
+	out := NewOutputLogger(&log)
+	steps := watchYpkgSteps(out)
+	w := out.Writer(&bytes.Buffer{})
+	w.Write([]byte("[Build] Running step: check\nFAIL: test-suite\n\x1b[31mcheck\x1b[0m failed for nano\n"))
+	w.Flush()
+	if !steps.checkFailed() {
+		t.Fatal("Failure of the check step was not detected")
+	}
+}
+
+func TestYpkgStepsBuildFailed(t *testing.T) {
+	var log bytes.Buffer
+	out := NewOutputLogger(&log)
+	steps := watchYpkgSteps(out)
+	w := out.Writer(&bytes.Buffer{})
+	w.Write([]byte("[Build] Running step: build\nmake: *** [all] Error 2\nbuild failed for nano\n"))
+	w.Flush()
+	if steps.checkFailed() {
+		t.Fatal("Failure of the build step was taken for the check step")
+	}
+}
+
+func TestYpkgStepsRawOutput(t *testing.T) {
+	if steps := watchYpkgSteps(nil); steps.checkFailed() {
+		t.Fatal("Failure of the check step reported without any output")
+	}
+}
@@ -0,0 +1,401 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// BatchRepoDir is the local repository of the packages built by a
+// dependency ordered batch, within the output directory
+const BatchRepoDir = ".solbuild-repo"
+
+// BatchParallelDir holds the output directory of each package of a parallel
+// batch, within the output directory, until its build has finished
+const BatchParallelDir = ".solbuild-parallel"
+
+// A batch is a set of recipes built by separate solbuild processes, so that
+// every build is isolated from the last. Progress is saved to the output
+// directory after every package, so that a batch that stopped early can
+// continue with --resume.
+type batch struct {
+	state     *builder.BatchState
+	pkgs      []*builder.Package // In the same order as the state entries
+	levels    [][]int            // Entries that may be built at the same time
+	outputDir string
+	repoDir   string // Local repository of the packages built, if chained
+	exe       string
+	args      []string // Arguments for the build of each recipe
+	parallel  int
+
+	lock        sync.Mutex
+	failed      bool
+	interrupted int32
+	processes   map[*os.Process]bool
+}
+
+// BuildBatch will build each of the recipes as a batch. With --dep-order
+// the recipes are found within a directory, and built in the order of their
+// dependencies, each with the packages built before it available.
+func BuildBatch(args []string, sFlags *BuildFlags) {
+	if !builder.UseDocker {
+		RequireRoot("build packages")
+	}
+	if sFlags.DepOrder != "" && len(args) > 0 {
+		log.Fatalln("The --dep-order flag cannot be combined with a list of recipes")
+	}
+	if sFlags.Parallel < 0 {
+		log.Fatalln("The number of parallel builds cannot be negative")
+	}
+	if sFlags.Parallel > 1 && sFlags.DepOrder == "" {
+		log.Fatalln("The --parallel flag requires --dep-order")
+	}
+	outputDir, err := filepath.Abs(".")
+	if err != nil {
+		log.Fatalf("Unable to find working directory, reason: %s\n", err)
+	}
+	statePath := filepath.Join(outputDir, builder.BatchStateFile)
+
+	var previous *builder.BatchState
+	if sFlags.Resume {
+		previous, err = builder.LoadBatchState(statePath)
+		if os.IsNotExist(err) {
+			log.Warnln("There is no previous batch build to resume, building every package")
+		} else if err != nil {
+			log.Fatalf("Unable to resume the batch build, remove %s to start again, reason: %s\n", statePath, err)
+		}
+	}
+	recipes := args
+	if sFlags.DepOrder != "" {
+		if recipes, err = builder.FindRecipes(sFlags.DepOrder); err != nil {
+			log.Fatalf("Failed to find recipes in %s, reason: %s\n", sFlags.DepOrder, err)
+		}
+		if len(recipes) == 0 {
+			log.Fatalf("No package.yml or pspec.xml found within %s\n", sFlags.DepOrder)
+		}
+	} else if len(recipes) == 0 && previous != nil {
+		for _, entry := range previous.Entries {
+			recipes = append(recipes, entry.Recipe)
+		}
+	}
+
+	var pkgs []*builder.Package
+	for _, arg := range recipes {
+		path, err := ResolveRecipe(arg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		pkg, err := builder.NewPackage(path)
+		if err != nil {
+			log.Fatalf("Failed to load package %s: %s\n", path, err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	b := &batch{
+		outputDir: outputDir,
+		parallel:  1,
+		processes: make(map[*os.Process]bool),
+	}
+	if sFlags.DepOrder != "" {
+		levels, err := builder.DependencyOrder(pkgs)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		pkgs = nil
+		for _, level := range levels {
+			var entries []int
+			for _, pkg := range level {
+				entries = append(entries, len(pkgs))
+				pkgs = append(pkgs, pkg)
+			}
+			b.levels = append(b.levels, entries)
+		}
+		log.Infof("Building %d package(s) in %d dependency level(s)\n", len(pkgs), len(levels))
+		b.repoDir = filepath.Join(outputDir, BatchRepoDir)
+		if sFlags.Parallel > 1 {
+			b.parallel = sFlags.Parallel
+		}
+	} else {
+		var entries []int
+		for i := range pkgs {
+			entries = append(entries, i)
+		}
+		b.levels = [][]int{entries}
+	}
+	b.pkgs = pkgs
+
+	if b.state, err = builder.NewBatchState(statePath, pkgs); err != nil {
+		log.Fatalln(err)
+	}
+	if previous != nil {
+		log.Infof("Resuming batch build, skipping %d package(s) built previously\n", b.state.Resume(previous))
+	}
+	if b.exe, err = os.Executable(); err != nil {
+		log.Fatalf("Unable to find the solbuild executable, reason: %s\n", err)
+	}
+	b.args = batchArgs(os.Args[1:], args)
+	if b.repoDir != "" {
+		if err := os.MkdirAll(b.repoDir, 00755); err != nil {
+			log.Fatalf("Failed to create batch repository, reason: %s\n", err)
+		}
+		b.args = append(b.args, "--local-repo", b.repoDir)
+	}
+
+	b.run()
+
+	if err := b.state.Save(); err != nil {
+		log.Errorf("Failed to save batch state, reason: %s\n", err)
+	}
+	printBatchSummary(b.state)
+	summaryPath := filepath.Join(outputDir, builder.BatchSummaryFile)
+	if err := b.state.WriteSummary(summaryPath); err != nil {
+		log.Errorf("Failed to write batch summary, reason: %s\n", err)
+	}
+	if b.state.Count(builder.BatchFailed) > 0 || b.state.Count(builder.BatchPending) > 0 {
+		log.Errorln("Batch build incomplete, continue it with --resume")
+		os.Exit(1)
+	}
+	Complete(fmt.Sprintf("Built %d package(s)", len(b.state.Entries)))
+}
+
+// run will build each level of the batch in turn, stopping after the first
+// level with a failure
+func (b *batch) run() {
+	// Each build cleans up after itself when interrupted, so just stop
+	// once the current builds have exited
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	defer close(ch)
+	defer signal.Stop(ch)
+	go func() {
+		for sig := range ch {
+			atomic.StoreInt32(&b.interrupted, 1)
+			// Interrupts from the terminal reach the builds already
+			if sig != syscall.SIGTERM {
+				continue
+			}
+			b.lock.Lock()
+			for p := range b.processes {
+				p.Signal(sig)
+			}
+			b.lock.Unlock()
+		}
+	}()
+
+	for _, level := range b.levels {
+		queue := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < b.parallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for entry := range queue {
+					b.build(entry)
+				}
+			}()
+		}
+		for _, entry := range level {
+			if b.stopped() {
+				break
+			}
+			if !b.state.Entries[entry].Built() {
+				queue <- entry
+			}
+		}
+		close(queue)
+		wg.Wait()
+		if b.stopped() {
+			return
+		}
+	}
+}
+
+// stopped will determine whether no further builds should be started
+func (b *batch) stopped() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.failed || atomic.LoadInt32(&b.interrupted) == 1
+}
+
+// build will build a single entry of the batch
+func (b *batch) build(i int) {
+	if b.stopped() {
+		return
+	}
+	entry, pkg := b.state.Entries[i], b.pkgs[i]
+	b.save()
+	log.Infof("Building %s (%d of %d)\n", entry.Name, i+1, len(b.state.Entries))
+	c := exec.Command(b.exe, append(b.args, entry.Recipe)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	start := time.Now()
+	dir, err := b.buildDir(entry)
+	if err == nil {
+		c.Dir = dir
+		err = c.Start()
+	}
+	if err == nil {
+		b.lock.Lock()
+		b.processes[c.Process] = true
+		b.lock.Unlock()
+		err = c.Wait()
+		b.lock.Lock()
+		delete(b.processes, c.Process)
+		b.lock.Unlock()
+	}
+	if dir != "" && dir != b.outputDir {
+		if mErr := mergeOutput(dir, b.outputDir); mErr != nil {
+			log.Errorln(mErr)
+			if err == nil {
+				err = mErr
+			}
+		}
+	}
+	artifacts, _ := builder.NewArtifacts(b.outputDir, pkg, start)
+	if err == nil && b.repoDir != "" {
+		if err = builder.AddToLocalRepo(b.repoDir, artifacts); err != nil {
+			log.Errorln(err)
+		}
+	}
+
+	b.lock.Lock()
+	entry.Duration = time.Since(start)
+	entry.Artifacts = len(artifacts)
+	if err != nil && atomic.LoadInt32(&b.interrupted) == 1 {
+		log.Errorf("Build of %s interrupted\n", entry.Name)
+	} else if err != nil {
+		entry.Result = builder.BatchFailed
+		entry.Error = err.Error()
+		b.failed = true
+		log.Errorf("Failed to build %s, stopping the batch build\n", entry.Name)
+	} else {
+		entry.Result = builder.BatchSucceeded
+	}
+	b.lock.Unlock()
+	b.save()
+}
+
+// buildDir will return the working directory for the build of entry, where
+// its output is written. Parallel builds each have their own directory, so
+// that they cannot replace the files of another build.
+func (b *batch) buildDir(entry *builder.BatchEntry) (string, error) {
+	if b.parallel < 2 {
+		return b.outputDir, nil
+	}
+	dir := filepath.Join(b.outputDir, BatchParallelDir, entry.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("Failed to clean output directory %s, reason: %s\n", dir, err)
+	}
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return "", fmt.Errorf("Failed to create output directory %s, reason: %s\n", dir, err)
+	}
+	usr := builder.GetUserInfo()
+	if err := os.Chown(dir, usr.UID, usr.GID); err != nil {
+		log.Errorf("Error in restoring file ownership %s, reason: %s\n", dir, err)
+	}
+	return dir, nil
+}
+
+// mergeOutput will move the files a parallel build wrote to dir into the
+// output directory, and remove dir
+func mergeOutput(dir, outputDir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to read output directory %s, reason: %s\n", dir, err)
+	}
+	for _, f := range files {
+		src := filepath.Join(dir, f.Name())
+		tgt := filepath.Join(outputDir, f.Name())
+		if err := os.Rename(src, tgt); err != nil {
+			return fmt.Errorf("Failed to move %s to %s, reason: %s\n", src, tgt, err)
+		}
+	}
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+	// Only empty once every parallel build has finished
+	os.Remove(filepath.Dir(dir))
+	return nil
+}
+
+// save will write out the progress of the batch
+func (b *batch) save() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.state.Save(); err != nil {
+		log.Errorf("Failed to save batch state, reason: %s\n", err)
+	}
+}
+
+// batchArgs will return the arguments solbuild was invoked with, less the
+// recipes and batch options, to use for the build of each recipe
+func batchArgs(args, recipes []string) []string {
+	remove := make(map[string]int)
+	for _, recipe := range recipes {
+		remove[recipe]++
+	}
+	// Recipes follow the flags, so remove them from the end
+	kept := make([]string, 0, len(args))
+	for i := len(args) - 1; i >= 0; i-- {
+		arg := args[i]
+		if remove[arg] > 0 {
+			remove[arg]--
+			continue
+		}
+		switch {
+		case arg == "--resume", strings.HasPrefix(arg, "--dep-order="), strings.HasPrefix(arg, "--parallel="):
+			continue
+		case arg == "--dep-order", arg == "--parallel":
+			// Drop the value that followed
+			if len(kept) > 0 {
+				kept = kept[1:]
+			}
+			continue
+		}
+		kept = append([]string{arg}, kept...)
+	}
+	return kept
+}
+
+// printBatchSummary will print the result of every package in the batch
+func printBatchSummary(state *builder.BatchState) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tRESULT\tDURATION\tARTIFACTS")
+	for _, entry := range state.Entries {
+		duration := "-"
+		if entry.Duration > 0 {
+			duration = entry.Duration.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", entry.Name, entry.Result, duration, entry.Artifacts)
+	}
+	w.Flush()
+}
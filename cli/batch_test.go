@@ -0,0 +1,70 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBatchArgs(t *testing.T) {
+	args := []string{"-p", "main-x86_64", "build", "--resume", "-t", "nano", "gdb/package.yml", "nano"}
+	got := strings.Join(batchArgs(args, []string{"nano", "gdb/package.yml", "nano"}), " ")
+	if expected := "-p main-x86_64 build -t"; got != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, got)
+	}
+	args = []string{"build", "--dep-order", "recipes", "--parallel", "4", "--no-dbus"}
+	if got := strings.Join(batchArgs(args, nil), " "); got != "build --no-dbus" {
+		t.Fatalf("Expected 'build --no-dbus', got '%s'", got)
+	}
+}
+
+func TestMergeOutput(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "solbuild-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outputDir)
+	dir := filepath.Join(outputDir, BatchParallelDir, "nano")
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		t.Fatal(err)
+	}
+	name := "nano-5.5-1-1-x86_64.eopkg"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 00644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeOutput(dir, outputDir); err != nil {
+		t.Fatalf("Failed to merge output: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+		t.Fatalf("Expected %s in the output directory: %s", name, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, BatchParallelDir)); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed", BatchParallelDir)
+	}
+}
+
+func TestProfileArgs(t *testing.T) {
+	args := []string{"build", "-p", "main-x86_64,unstable-x86_64", "--fail-fast", "nano"}
+	got := strings.Join(profileArgs(args, []string{"nano"}, "unstable-x86_64", "/src/nano/package.yml"), " ")
+	if expected := "build -p main-x86_64,unstable-x86_64 --fail-fast --profile unstable-x86_64 /src/nano/package.yml"; got != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, got)
+	}
+}
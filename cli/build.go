@@ -17,14 +17,16 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/getsolus/solbuild/builder"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -46,50 +48,291 @@ type BuildFlags struct {
 	Memory          string `short:"m" long:"memory"             desc:"Set the tmpfs size to use"`
 	TransitManifest string `long:"transit-manifest"             desc:"Create transit manifest for the given target"`
 	ABIReport       bool   `short:"r" long:"disable-abi-report" desc:"Don't generate an ABI report of the completed build"`
+	LintSources     bool   `long:"lint-sources"                 desc:"Run cppcheck or shellcheck over the sources before building"`
+	Notify          bool   `long:"notify"                       desc:"Notify configured webhooks on completion"`
+	NoNotify        bool   `long:"no-notify"                    desc:"Don't notify configured webhooks on completion"`
+	Metrics         bool   `long:"metrics"                      desc:"Write build stage timings as JSON to the output directory"`
+	RawOutput       bool   `long:"raw-output"                   desc:"Pass build output straight through without prefixes"`
+	NoHooks         bool   `long:"no-hooks"                     desc:"Don't run the pre and post build hooks"`
+	AllowPreBuild   bool   `long:"allow-prebuild-hooks"         desc:"Run the prebuild commands of a trusted package.yml as root on the host"`
+	Incremental     bool   `long:"incremental"                  desc:"Reuse the existing build root if the base image is unchanged"`
+	Timestamp       string `long:"timestamp"                    desc:"Use a fixed ISO-8601 build time, i.e. 2024-01-01T00:00:00Z"`
+	Env             string `long:"env"                          desc:"Comma separated list of KEY[=VALUE] variables to pass into the chroot, given once"`
+	ComponentDB     string `long:"component-db"                 desc:"Validate components against the given JSON list"`
+	FetchRetries    int    `long:"fetch-retries"                desc:"Number of attempts to fetch each source (default 3)"`
+	PackageRetries  int    `long:"package-retries"              desc:"Number of attempts for package operations that fail due to the network (default 3)"`
+	SandboxFlags    string `long:"sandbox-flags"                desc:"Comma separated namespaces to disable: no-net-ns, no-user-ns, no-mount-ns"`
+	DNS             string `long:"dns"                          desc:"Use this DNS server for packages that are permitted to network"`
+	IsolationLevel  string `long:"isolation-level"              desc:"Build isolation: full, network-only (no overlay) or none (no overlay, networking)"`
+	ExtraPackage    string `long:"extra-package"                desc:"Comma separated list of extra packages to install for debugging"`
+	ExtraComponent  string `long:"extra-component"              desc:"Comma separated list of extra components to install for debugging"`
+	Pin             string `long:"pin"                          desc:"Comma separated list of name=version packages to hold at a fixed version"`
+	ColorOutput     bool   `long:"color-output"                 desc:"Print a coloured banner as each build phase starts"`
+	CrossArch       string `long:"cross-arch"                   desc:"Cross compile for the given architecture, i.e. aarch64"`
+	MinDiskSpace    string `long:"min-disk-space"               desc:"Free disk space required to start, i.e. 10G (default 5G, 0 disables)"`
+	ForceUpgrade    bool   `long:"force-upgrade"                desc:"Always upgrade the build root, even if the image was recently updated"`
+	Overwrite       bool   `long:"overwrite"                    desc:"Replace packages already in the output directory"`
+	ExtraAssets     string `long:"extra-assets"                 desc:"Comma separated list of file patterns beside the recipe to copy into the build, i.e. *.patch"`
+	MaxAssetSize    string `long:"max-asset-size"               desc:"Largest file to copy into the build as an asset, i.e. 100M (default 0, no limit)"`
+	VerifySources   bool   `long:"verify-sources"               desc:"Verify the hash of cached sources that changed since they were last verified"`
+	FetchTimeout    string `long:"fetch-timeout"                desc:"Longest the sources may take to fetch, i.e. 10m (default 30m, 0 disables)"`
+	UpgradeTimeout  string `long:"upgrade-timeout"              desc:"Longest the build root may take to upgrade (default 1h, 0 disables)"`
+	CompileTimeout  string `long:"compile-timeout"              desc:"Longest the package may take to build (default 4h, 0 disables)"`
+	Docker          bool   `long:"docker"                       desc:"Build within a Docker container instead of an overlayfs root"`
+	NoDBus          bool   `long:"no-dbus"                      desc:"Don't start D-BUS in the build root, for environments where it is unavailable"`
+	SkipBuilt       bool   `long:"skip-built"                   desc:"Skip the build if this release already succeeded with the profile"`
+	AssertVersion   string `long:"assert-version"               desc:"Fail the build if the packages produced do not have this version"`
+	Resume          bool   `long:"resume"                       desc:"Resume the previous batch build, skipping packages already built"`
+	DepOrder        string `long:"dep-order"                    desc:"Build every recipe within the given directory, in the order of their dependencies"`
+	Parallel        int    `long:"parallel"                     desc:"Number of independent packages to build at once with --dep-order"`
+	LocalRepo       string `long:"local-repo"                   desc:"Index the given directory of packages and prefer it over every other repository"`
+	BuildID         string `long:"build-id"                     desc:"Tag the logs and manifests of the build with this ID (default: a random UUID)"`
+	RepoURL         string `long:"repo-url"                     desc:"Build against only this repository instead of those of the image and profile"`
+	RepoSnapshot    string `long:"repo-snapshot"                desc:"Build against the snapshot of the repository from this date, i.e. 2024-01-31"`
+	PolicyCheck     bool   `long:"policy-check"                 desc:"Check the packages produced against the packaging policy, failing on errors"`
+	FailFast        bool   `long:"fail-fast"                    desc:"Stop building against further profiles after the first failure"`
+	WebhookURL      string `long:"webhook-url"                  desc:"POST each phase and line of output of the build as JSON to this URL"`
+	Distcc          bool   `long:"distcc"                       desc:"Distribute compilation to the hosts of DISTCC_HOSTS, or ~/.config/solbuild/distcc.conf"`
+	Icecc           bool   `long:"icecc"                        desc:"Distribute compilation through the icecream daemon of the host"`
+	FailOnABIBreak  bool   `long:"fail-on-abi-break"            desc:"Fail the build if sonames or symbols were removed since the previous ABI report"`
 }
 
 // BuildArgs are arguments for the "build" sub-command
 type BuildArgs struct {
-	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] file to build."`
+	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] files, or package directories, to build in order."`
 }
 
 // BuildRun carries out the "build" sub-command
 func BuildRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
 	sFlags := s.Flags.(*BuildFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	SetLogLevel(rFlags)
 
+	SetCIMode(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 		builder.DisableColors = true
 	}
 
+	buildID := sFlags.BuildID
+	if buildID == "" {
+		id, err := builder.NewBuildID()
+		if err != nil {
+			log.Fatalf("Failed to generate a build ID, reason: %s\n", err)
+		}
+		buildID = id
+	}
+	if err := builder.SetBuildID(buildID); err != nil {
+		log.Fatalln(err)
+	}
+
+	if sFlags.Notify && sFlags.NoNotify {
+		log.Fatalln("The --notify and --no-notify flags are mutually exclusive")
+	}
+
+	if sFlags.Distcc && sFlags.Icecc {
+		log.Fatalln("The --distcc and --icecc flags are mutually exclusive")
+	}
+
+	if flagCount(os.Args[1:], "--env") > 1 {
+		log.Fatalln("The --env flag may only be given once, as a comma separated list")
+	}
+
+	if sFlags.RawOutput {
+		builder.RawOutput = true
+	}
+
+	if sFlags.NoHooks {
+		log.Debugln("Not running build hooks")
+		builder.DisableHooks = true
+	}
+	if sFlags.AllowPreBuild && (sFlags.NoHooks || sFlags.Docker) {
+		log.Fatalln("The --allow-prebuild-hooks flag cannot be combined with --no-hooks or --docker")
+	}
+	builder.AllowPreBuildHooks = sFlags.AllowPreBuild
+
+	builder.NoDBus = sFlags.NoDBus
+
+	if sFlags.SandboxFlags != "" {
+		sandbox, err := builder.ParseSandboxFlags(sFlags.SandboxFlags)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		builder.Sandbox = sandbox
+	}
+
+	if sFlags.DNS != "" {
+		SetDNSServer(sFlags.DNS)
+	}
+
+	if sFlags.MinDiskSpace != "" {
+		size, err := builder.ParseBytes(sFlags.MinDiskSpace)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		builder.MinDiskSpace = size
+	}
+
+	if sFlags.MaxAssetSize != "" {
+		size, err := builder.ParseBytes(sFlags.MaxAssetSize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		builder.MaxAssetSize = size
+	}
+
+	for _, timeout := range []struct {
+		flag  string
+		value string
+		dest  *time.Duration
+	}{
+		{"--fetch-timeout", sFlags.FetchTimeout, &builder.PhaseTimeouts.FetchTimeout},
+		{"--upgrade-timeout", sFlags.UpgradeTimeout, &builder.PhaseTimeouts.UpgradeTimeout},
+		{"--compile-timeout", sFlags.CompileTimeout, &builder.PhaseTimeouts.CompileTimeout},
+	} {
+		if timeout.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(timeout.value)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid %s '%s', expected a duration such as 90m\n", timeout.flag, timeout.value)
+		}
+		*timeout.dest = d
+	}
+	// Flags take precedence over the options of the package
+	builder.OptionFlags.Tmpfs = sFlags.Tmpfs
+	builder.OptionFlags.Timeout = sFlags.CompileTimeout != ""
+	builder.OptionFlags.ExtraComponents = sFlags.ExtraComponent != ""
+
+	if sFlags.CrossArch != "" {
+		if _, ok := builder.CrossTargets[sFlags.CrossArch]; !ok {
+			log.Fatalf("Unsupported cross architecture '%s', expected one of: %s\n", sFlags.CrossArch, strings.Join(builder.CrossArches(), ", "))
+		}
+		builder.CrossArch = sFlags.CrossArch
+	}
+
+	if sFlags.IsolationLevel != "" {
+		if err := builder.Isolation.Set(sFlags.IsolationLevel); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if sFlags.FetchRetries < 0 {
+		log.Fatalln("The number of fetch retries cannot be negative")
+	} else if sFlags.FetchRetries > 0 {
+		builder.FetchRetries = sFlags.FetchRetries
+	}
+
+	if sFlags.PackageRetries < 0 {
+		log.Fatalln("The number of package retries cannot be negative")
+	}
+
+	if sFlags.LintSources {
+		builder.LintSources = true
+	}
+
+	if sFlags.ForceUpgrade {
+		builder.ForceUpgrade = true
+	}
+
+	if sFlags.PolicyCheck {
+		builder.PolicyCheck = true
+	}
+
+	if sFlags.Overwrite {
+		builder.OverwriteArtifacts = true
+	}
+
+	if sFlags.ExtraAssets != "" {
+		globs, err := builder.ParseAssetGlobs(splitList(sFlags.ExtraAssets))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		builder.ExtraAssets = globs
+	}
+
+	if sFlags.RepoSnapshot != "" {
+		if _, err := builder.ParseSnapshotDate(sFlags.RepoSnapshot); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	builder.RepoURL = sFlags.RepoURL
+	builder.RepoSnapshot = sFlags.RepoSnapshot
+
+	if sFlags.Docker {
+		if sFlags.CrossArch != "" || sFlags.Incremental {
+			log.Fatalln("The --docker flag cannot be combined with --cross-arch or --incremental")
+		}
+		if sFlags.RepoURL != "" || sFlags.RepoSnapshot != "" {
+			log.Fatalln("The --docker flag cannot be combined with --repo-url or --repo-snapshot")
+		}
+		if sFlags.ExtraPackage != "" || sFlags.ExtraComponent != "" || sFlags.Pin != "" {
+			log.Fatalln("The --docker flag cannot be combined with --extra-package, --extra-component or --pin")
+		}
+		builder.UseDocker = true
+	}
+
 	if sFlags.ABIReport {
+		if sFlags.FailOnABIBreak {
+			log.Fatalln("The --fail-on-abi-break and --disable-abi-report flags are mutually exclusive")
+		}
 		log.Debugln("Not attempting generation of an ABI report")
 		builder.DisableABIReport = true
 	}
+	builder.FailOnABIBreak = sFlags.FailOnABIBreak
 
-	// Allow loading a build recipe from an arbitrary location
-	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
-	pkgPath := strings.Join(s.Args.(*BuildArgs).Path, "")
-	if len(pkgPath) == 0 {
-		// Otherwise look for a suitable file in the current directory
-		pkgPath = FindLikelyArg()
+	// A recipe is built against several profiles one after another
+	if profiles := splitList(rFlags.Profile); len(profiles) > 1 {
+		BuildProfiles(profiles, s.Args.(*BuildArgs).Path, sFlags)
+		return
+	}
+
+	// Several recipes are built one after another as a batch
+	if args := s.Args.(*BuildArgs).Path; len(args) > 1 || sFlags.Resume || sFlags.DepOrder != "" {
+		BuildBatch(args, sFlags)
+		return
 	}
-	if len(pkgPath) == 0 {
-		log.Fatalln("No package.yml or pspec.xml file in current directory and no file provided.")
+
+	if sFlags.LocalRepo != "" {
+		repo, err := filepath.Abs(sFlags.LocalRepo)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if st, err := os.Stat(repo); err != nil || !st.IsDir() {
+			log.Fatalf("No such directory: %s\n", sFlags.LocalRepo)
+		}
+		builder.LocalRepo = repo
+	}
+
+	// Allow loading a build recipe from an arbitrary location, or a package directory
+	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
+	// Otherwise look for a suitable file in the current directory
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*BuildArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to run build packages")
+	// Docker builds are isolated by the container, and need no root
+	if !builder.UseDocker {
+		RequireRoot("build packages")
 	}
 	// Initialise the build manager
 	manager, err := builder.NewManager()
 	if err != nil {
 		os.Exit(1)
 	}
+	// Takes precedence over the configuration
+	if sFlags.PackageRetries > 0 {
+		builder.PackageRetries = sFlags.PackageRetries
+	}
+	if sFlags.VerifySources {
+		builder.VerifySources = true
+	}
+	if sFlags.Distcc {
+		if err := builder.EnableDistcc(); err != nil {
+			log.Fatalln(err)
+		}
+	}
 	// Safety first..
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
 		os.Exit(1)
@@ -98,7 +341,44 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 	if err != nil {
 		log.Fatalf("Failed to load package: %s\n", err)
 	}
+	pkg.AssertVersion = sFlags.AssertVersion
+	pkg.IceCCEnabled = sFlags.Icecc
+	if sFlags.ComponentDB != "" {
+		if err := builder.LoadComponentDB(sFlags.ComponentDB); err != nil {
+			log.Fatalf("Failed to load component database: %s\n", err)
+		}
+	}
+	if err := pkg.ValidateComponent(); err != nil {
+		log.Fatalf("Invalid package component: %s\n", err)
+	}
+	if sFlags.SkipBuilt {
+		profile := manager.GetProfile().Name
+		built, err := builder.NewBuildDatabase(builder.BuildDatabasePath).HasSucceeded(pkg.Name, pkg.Release, profile)
+		if err != nil {
+			log.Fatalf("Failed to read build history, reason: %s\n", err)
+		}
+		if built {
+			Complete(fmt.Sprintf("%s-%s-%d has already been built for %s, skipping", pkg.Name, pkg.Version, pkg.Release, profile))
+			return
+		}
+	}
+	if sFlags.Timestamp != "" {
+		if err := pkg.SetBuildTime(sFlags.Timestamp); err != nil {
+			log.Fatalf("Invalid --timestamp: %s\n", err)
+		}
+	}
 	manager.SetManifestTarget(sFlags.TransitManifest)
+	manager.SetMetrics(sFlags.Metrics)
+	manager.SetIncremental(sFlags.Incremental)
+	manager.AddEnvironment(splitEnv(sFlags.Env))
+	if sFlags.WebhookURL != "" {
+		manager.SetListener(builder.NewWebhookListener(sFlags.WebhookURL, pkg.Name))
+	}
+	if sFlags.Notify {
+		manager.SetNotify(true)
+	} else if sFlags.NoNotify {
+		manager.SetNotify(false)
+	}
 	// Set the package
 	if err := manager.SetPackage(pkg); err != nil {
 		if err == builder.ErrProfileNotInstalled {
@@ -106,13 +386,39 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 		}
 		os.Exit(1)
 	}
+	if !builder.UseDocker {
+		if err := manager.SetExtras(splitList(sFlags.ExtraPackage), splitList(sFlags.ExtraComponent)); err != nil {
+			os.Exit(1)
+		}
+	}
+	if sFlags.Pin != "" {
+		pins, err := builder.ParsePins(sFlags.Pin)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := manager.SetPins(pins); err != nil {
+			os.Exit(1)
+		}
+	}
+	if sFlags.ColorOutput {
+		EnablePhaseColors(rFlags)
+		manager.OnStage(func(s builder.Stage) {
+			PrintPhase(s.Title())
+		})
+	}
 	// FIXME: Handle memory args properly.
 	if sFlags.Tmpfs == true {
 		// The general problem here is that this always resets the config values even if nil.
 		manager.SetTmpfs(sFlags.Tmpfs, sFlags.Memory)
 	}
 	if err := manager.Build(); err != nil {
-		log.Fatalln("Failed to build packages")
+		var se *builder.StageError
+		if errors.As(err, &se) && se.Stage == builder.StageTest {
+			log.Errorln("Package built, but tests failed")
+		} else {
+			log.Errorln("Failed to build packages")
+		}
+		os.Exit(builder.ExitCode(err))
 	}
-	log.Infoln("Building succeeded")
+	Complete("Building succeeded")
 }
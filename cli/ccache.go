@@ -0,0 +1,77 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+)
+
+func init() {
+	cmd.Register(&Ccache)
+}
+
+// Ccache shows or resets the statistics of the shared ccache
+var Ccache = cmd.Sub{
+	Name:  "ccache",
+	Short: "Show or reset the statistics of the ccache shared by builds",
+	Flags: &CcacheFlags{},
+	Run:   CcacheRun,
+}
+
+// CcacheFlags are flags for the "ccache" sub-command
+type CcacheFlags struct {
+	Show bool `short:"s" long:"show" desc:"Show the statistics of the cache (default)"`
+	Zero bool `short:"z" long:"zero" desc:"Reset the statistics of the cache"`
+}
+
+// CcacheRun carries out the "ccache" sub-command
+func CcacheRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*CcacheFlags)
+	SetLogLevel(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	if sFlags.Show && sFlags.Zero {
+		log.Fatalln("The --show and --zero flags are mutually exclusive")
+	}
+	RequireRoot("manage the ccache")
+	args := []string{"--show-stats"}
+	if sFlags.Zero {
+		args = []string{"--zero-stats"}
+	}
+	for _, dir := range builder.CcacheDirectories {
+		if !builder.PathExists(dir) {
+			log.Debugf("Skipping missing ccache directory %s\n", dir)
+			continue
+		}
+		c, err := builder.CcacheCommand(dir, args...)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !quiet {
+			fmt.Printf("%s:\n", dir)
+		}
+		if err := c.Run(); err != nil {
+			log.Fatalf("Failed to run ccache on %s, reason: %s\n", dir, err)
+		}
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/getsolus/solbuild/builder"
 	"os"
 	"strings"
@@ -35,41 +34,46 @@ func init() {
 var Chroot = cmd.Sub{
 	Name:  "chroot",
 	Short: "Interactively chroot into the package's build environment",
+	Flags: &ChrootFlags{},
 	Args:  &ChrootArgs{},
 	Run:   ChrootRun,
 }
 
+// ChrootFlags are flags for the "chroot" sub-command
+type ChrootFlags struct {
+	DNS string `long:"dns" desc:"Use this DNS server for packages that are permitted to network"`
+}
+
 // ChrootArgs are arguments for the "chroot" sub-command
 type ChrootArgs struct {
-	Path []string `zero:"yes" desc:"Chroot into the environment for a [package.yml|pspec.xml] receipe."`
+	Path []string `zero:"yes" desc:"Chroot into the environment for a [package.yml|pspec.xml] receipe, or package directory."`
 }
 
 // ChrootRun carries out the "chroot" sub-command
 func ChrootRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	sFlags := s.Flags.(*ChrootFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 		builder.DisableColors = true
 	}
 
-	// Allow chrooting into an environment for a build recipe for a given file
-	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
-	pkgPath := strings.Join(s.Args.(*ChrootArgs).Path, "")
-	if len(pkgPath) == 0 {
-		// Otherwise look for a suitable file to chroot into from the current directory
-		pkgPath = FindLikelyArg()
-	}
-	if len(pkgPath) == 0 {
-		log.Fatalln("No package.yml or pspec.xml found in current directory and no file provided.")
+	if sFlags.DNS != "" {
+		SetDNSServer(sFlags.DNS)
 	}
 
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to use chroot")
+	// Allow chrooting into an environment for a build recipe for a given file or directory
+	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
+	// Otherwise look for a suitable file to chroot into from the current directory
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*ChrootArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
 	}
 
+	RequireRoot("chroot into a build root")
+
 	// Initialise the build manager
 	manager, err := builder.NewManager()
 	if err != nil {
@@ -93,5 +97,5 @@ func ChrootRun(r *cmd.Root, s *cmd.Sub) {
 	if err := manager.Chroot(); err != nil {
 		log.Fatalln("Chroot failure")
 	}
-	log.Infoln("Chroot complete")
+	Complete("Chroot complete")
 }
@@ -0,0 +1,349 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	cmd.Register(&Completion)
+	cmd.Register(&Candidates)
+	completionSubs = []*cmd.Sub{
+		&Build, &Ccache, &Chroot, &Completion, &DeleteCache, &DeleteProfile, &Diff, &Export, &Fetch,
+		&History, &Index, &Info, &Init, &Resize, &Rollback, &Search, &Shell, &Update, &Validate,
+		&VerifyImage, &Version,
+	}
+}
+
+// Completion prints a shell completion script
+var Completion = cmd.Sub{
+	Name:  "completion",
+	Short: "Print the completion script for bash, zsh or fish",
+	Args:  &CompletionArgs{},
+	Run:   CompletionRun,
+}
+
+// CompletionArgs are arguments for the "completion" sub-command
+type CompletionArgs struct {
+	Shell string `desc:"Shell to complete for: bash, zsh or fish"`
+}
+
+// Candidates is used by the completion scripts to find the profiles and
+// recipes matching the word being completed
+var Candidates = cmd.Sub{
+	Name:   "__complete",
+	Short:  "Print the completion candidates for the current word",
+	Hidden: true,
+	Args:   &CandidatesArgs{},
+	Run:    CandidatesRun,
+}
+
+// CandidatesArgs are arguments for the "__complete" sub-command
+type CandidatesArgs struct {
+	Kind   string   `desc:"Kind of candidate: profile or recipe"`
+	Prefix []string `zero:"yes" desc:"The word being completed"`
+}
+
+// completionSubs are the sub-commands offered by the completion scripts
+var completionSubs []*cmd.Sub
+
+// CompletionRun carries out the "completion" sub-command
+func CompletionRun(r *cmd.Root, s *cmd.Sub) {
+	shell := s.Args.(*CompletionArgs).Shell
+	script, ok := completionScripts[shell]
+	if !ok {
+		log.Fatalf("Unsupported shell '%s', expected one of: bash, zsh, fish\n", shell)
+	}
+	if err := script.Execute(os.Stdout, newCompletionData(r)); err != nil {
+		log.Fatalf("Failed to generate completion script, reason: %s\n", err)
+	}
+}
+
+// CandidatesRun carries out the "__complete" sub-command
+func CandidatesRun(_ *cmd.Root, s *cmd.Sub) {
+	args := s.Args.(*CandidatesArgs)
+	prefix := strings.Join(args.Prefix, "")
+	var candidates []string
+	switch args.Kind {
+	case "profile":
+		var aliases map[string]string
+		if config, err := builder.NewConfig(); err == nil {
+			aliases = config.Aliases
+		}
+		candidates = profileCandidates(builder.ConfigPaths, aliases, prefix)
+	case "recipe":
+		candidates = recipeCandidates(prefix)
+	}
+	for _, c := range candidates {
+		fmt.Println(c)
+	}
+}
+
+// profileCandidates returns the names of the profiles within paths that
+// start with prefix, including both the built-in and custom profiles, along
+// with any aliases
+func profileCandidates(paths []string, aliases map[string]string, prefix string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, p := range paths {
+		profiles, _ := filepath.Glob(filepath.Join(p, "*"+builder.ProfileSuffix))
+		for _, profile := range profiles {
+			name := strings.TrimSuffix(filepath.Base(profile), builder.ProfileSuffix)
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for alias := range aliases {
+		if strings.HasPrefix(alias, prefix) && !seen[alias] {
+			seen[alias] = true
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recipeSearchDepthCompletion is how far beneath a directory a recipe may be
+// for the directory to be offered, i.e. packages/n/nano/package.yml
+const recipeSearchDepthCompletion = 2
+
+// recipeCandidates returns the recipes, and directories leading to recipes,
+// that start with prefix. Directories end with a separator, so that the
+// shell continues completing within them.
+func recipeCandidates(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	entries, err := ioutil.ReadDir(dirOrDot(dir))
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := dir + name
+		if entry.IsDir() {
+			if hasRecipe(path, recipeSearchDepthCompletion) {
+				candidates = append(candidates, path+string(filepath.Separator))
+			}
+		} else if isRecipe(name) {
+			candidates = append(candidates, path)
+		}
+	}
+	return candidates
+}
+
+// hasRecipe will determine if dir, or any directory up to depth levels
+// beneath it, contains a recipe
+func hasRecipe(dir string, depth int) bool {
+	entries, err := ioutil.ReadDir(dirOrDot(dir))
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isRecipe(entry.Name()) {
+			return true
+		}
+	}
+	if depth < 1 {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && hasRecipe(filepath.Join(dir, entry.Name()), depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecipe will determine if the file name is that of a build recipe
+func isRecipe(name string) bool {
+	return name == "package.yml" || name == "pspec.xml"
+}
+
+// dirOrDot will return the current directory in place of an empty one
+func dirOrDot(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// completionSub describes a sub-command to the completion scripts
+type completionSub struct {
+	Name   string
+	Short  string
+	Flags  []string
+	Recipe bool
+}
+
+// completionData is passed to the completion script templates
+type completionData struct {
+	Name        string
+	GlobalFlags []string
+	Subs        []completionSub
+}
+
+// newCompletionData will describe the sub-commands and their flags
+func newCompletionData(r *cmd.Root) completionData {
+	data := completionData{
+		Name:        r.Name,
+		GlobalFlags: flagNames(r.Flags),
+	}
+	for _, s := range completionSubs {
+		sub := completionSub{
+			Name:   s.Name,
+			Short:  s.Short,
+			Flags:  flagNames(s.Flags),
+			Recipe: hasPathArg(s.Args),
+		}
+		data.Subs = append(data.Subs, sub)
+		if s.Alias != "" {
+			sub.Name = s.Alias
+			data.Subs = append(data.Subs, sub)
+		}
+	}
+	return data
+}
+
+// flagNames will list the long and short names of each flag in the struct
+func flagNames(flags interface{}) []string {
+	if flags == nil {
+		return nil
+	}
+	t := reflect.TypeOf(flags).Elem()
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if long := t.Field(i).Tag.Get("long"); long != "" {
+			names = append(names, "--"+long)
+		}
+		if short := t.Field(i).Tag.Get("short"); short != "" {
+			names = append(names, "-"+short)
+		}
+	}
+	return names
+}
+
+// hasPathArg will determine if the arguments take a recipe path
+func hasPathArg(args interface{}) bool {
+	if args == nil {
+		return false
+	}
+	_, ok := reflect.TypeOf(args).Elem().FieldByName("Path")
+	return ok
+}
+
+// completionScripts are the templates for each supported shell
+var completionScripts = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Parse(bashCompletion)),
+	"zsh":  template.Must(template.New("zsh").Parse(zshCompletion)),
+	"fish": template.Must(template.New("fish").Parse(fishCompletion)),
+}
+
+const bashCompletion = `# bash completion for {{.Name}}
+
+_{{.Name}}() {
+    local cur prev sub i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -p|--profile) ((i++)) ;;
+            -*) ;;
+            *) sub="${COMP_WORDS[i]}"; break ;;
+        esac
+    done
+
+    case "$prev" in
+        -p|--profile)
+            COMPREPLY=($(compgen -W "$({{.Name}} __complete profile "$cur" 2>/dev/null)" -- "$cur"))
+            return
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        local flags="{{range .GlobalFlags}}{{.}} {{end}}"
+        case "$sub" in
+{{- range .Subs}}
+            {{.Name}}) flags+="{{range .Flags}}{{.}} {{end}}" ;;
+{{- end}}
+        esac
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+
+    case "$sub" in
+        "")
+            COMPREPLY=($(compgen -W "{{range .Subs}}{{.Name}} {{end}}" -- "$cur"))
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            ;;
+{{- range .Subs}}{{if .Recipe}}
+        {{.Name}})
+            COMPREPLY=($({{$.Name}} __complete recipe "$cur" 2>/dev/null))
+            # Keep completing within a directory
+            if [[ ${#COMPREPLY[@]} -eq 1 && "${COMPREPLY[0]}" == */ ]]; then
+                compopt -o nospace 2>/dev/null
+            fi
+            ;;
+{{- end}}{{end}}
+    esac
+}
+
+complete -F _{{.Name}} {{.Name}}
+`
+
+const zshCompletion = `#compdef {{.Name}}
+# zsh completion for {{.Name}}, using the bash completion
+
+autoload -U +X bashcompinit && bashcompinit
+` + bashCompletion
+
+const fishCompletion = `# fish completion for {{.Name}}
+
+complete -c {{.Name}} -f
+complete -c {{.Name}} -s p -l profile -x -a '({{.Name}} __complete profile (commandline -ct) 2>/dev/null)'
+{{- range .GlobalFlags}}{{if and (ne . "--profile") (eq (slice . 0 2) "--")}}
+complete -c {{$.Name}} -l '{{slice . 2}}'
+{{- end}}{{end}}
+
+complete -c {{.Name}} -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+{{- range $sub := .Subs}}
+complete -c {{$.Name}} -n '__fish_use_subcommand' -a '{{$sub.Name}}' -d {{printf "%q" $sub.Short}}
+{{- range $sub.Flags}}{{if eq (slice . 0 2) "--"}}
+complete -c {{$.Name}} -n '__fish_seen_subcommand_from {{$sub.Name}}' -l '{{slice . 2}}'
+{{- end}}{{end}}
+{{- if $sub.Recipe}}
+complete -c {{$.Name}} -n '__fish_seen_subcommand_from {{$sub.Name}}' -a '({{$.Name}} __complete recipe (commandline -ct) 2>/dev/null)'
+{{- end}}
+{{- end}}
+`
@@ -0,0 +1,121 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree will create the files beneath root, with directories ending in /
+func writeTree(t *testing.T, root string, paths ...string) {
+	for _, p := range paths {
+		full := filepath.Join(root, p)
+		if strings.HasSuffix(p, "/") {
+			if err := os.MkdirAll(full, 00755); err != nil {
+				t.Fatalf("Failed to create %s: %v", p, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 00755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(p), err)
+		}
+		if err := ioutil.WriteFile(full, nil, 00644); err != nil {
+			t.Fatalf("Failed to write %s: %v", p, err)
+		}
+	}
+}
+
+func TestProfileCandidates(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-completion")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeTree(t, root,
+		"etc/unstable-x86_64.profile",
+		"etc/local-unstable.profile",
+		"etc/unstable-x86_64.yml",
+		"usr/main-x86_64.profile",
+		"usr/unstable-x86_64.profile",
+	)
+	paths := []string{filepath.Join(root, "etc"), filepath.Join(root, "usr")}
+
+	all := profileCandidates(paths, map[string]string{"u": "unstable-x86_64"}, "")
+	expected := []string{"local-unstable", "main-x86_64", "u", "unstable-x86_64"}
+	if !reflect.DeepEqual(all, expected) {
+		t.Fatalf("Expected %v, got %v", expected, all)
+	}
+	if got := profileCandidates(paths, nil, "un"); !reflect.DeepEqual(got, []string{"unstable-x86_64"}) {
+		t.Fatalf("Expected only unstable-x86_64, got %v", got)
+	}
+}
+
+func TestRecipeCandidates(t *testing.T) {
+	root, err := ioutil.TempDir("", "solbuild-completion")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeTree(t, root,
+		"packages/n/nano/package.yml",
+		"packages/n/nano/files/fix.patch",
+		"packages/n/nasm/pspec.xml",
+		"packages/n/nasm/actions.py",
+		"packages/empty/",
+		"packages/.git/package.yml",
+		"docs/README.md",
+	)
+	base := root + "/"
+	tests := map[string][]string{
+		base:                      {base + "packages/"},
+		base + "pa":               {base + "packages/"},
+		base + "do":               nil,
+		base + "packages/":        {base + "packages/n/"},
+		base + "packages/.":       {base + "packages/.git/"},
+		base + "packages/n/na":    {base + "packages/n/nano/", base + "packages/n/nasm/"},
+		base + "packages/n/nano/": {base + "packages/n/nano/package.yml"},
+		base + "packages/n/nasm/": {base + "packages/n/nasm/pspec.xml"},
+		base + "missing/":         nil,
+	}
+	for prefix, expected := range tests {
+		if got := recipeCandidates(prefix); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Expected %v for '%s', got %v", expected, prefix, got)
+		}
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	data := newCompletionData(&Root)
+	for shell, script := range completionScripts {
+		var buf bytes.Buffer
+		if err := script.Execute(&buf, data); err != nil {
+			t.Fatalf("Failed to generate %s completion: %v", shell, err)
+		}
+		out := buf.String()
+		for _, want := range []string{"__complete profile", "__complete recipe", "overlay", "delete-cache"} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("Missing '%s' in %s completion", want, shell)
+			}
+		}
+	}
+}
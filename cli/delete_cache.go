@@ -20,7 +20,6 @@ import (
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/getsolus/solbuild/builder"
 	"github.com/getsolus/solbuild/builder/source"
 	"os"
@@ -49,15 +48,11 @@ type DeleteCacheFlags struct {
 func DeleteCacheRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
 	sFlags := s.Flags.(*DeleteCacheFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	SetLogLevel(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 	}
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to delete caches")
-	}
+	RequireRoot("delete caches")
 	manager, err := builder.NewManager()
 	if err != nil {
 		log.Fatalf("Failed to create new Manager: %e\n", err)
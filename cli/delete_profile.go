@@ -0,0 +1,109 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"strings"
+)
+
+func init() {
+	cmd.Register(&DeleteProfile)
+}
+
+// DeleteProfile removes everything stored on disk for a solbuild profile
+var DeleteProfile = cmd.Sub{
+	Name:  "delete-profile",
+	Alias: "dp",
+	Short: "Delete the images, roots and overlays of a solbuild profile",
+	Flags: &DeleteProfileFlags{},
+	Run:   DeleteProfileRun,
+}
+
+// DeleteProfileFlags are the flags for the "delete-profile" sub-command
+type DeleteProfileFlags struct {
+	Yes bool `short:"y" long:"yes" desc:"Delete without asking for confirmation"`
+}
+
+// DeleteProfileRun carries out the "delete-profile" sub-command
+func DeleteProfileRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*DeleteProfileFlags)
+	SetLogLevel(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	RequireRoot("delete profiles")
+	manager, err := builder.NewManager()
+	if err != nil {
+		log.Fatalf("Failed to create new Manager: %s\n", err)
+	}
+	name := rFlags.Profile
+	if name == "" {
+		name = manager.Config.DefaultProfile
+	}
+	profile, err := builder.NewProfile(name)
+	if err != nil {
+		builder.EmitProfileError(name)
+		os.Exit(1)
+	}
+	state := builder.NewProfileState(profile, manager.Config.OverlayRootDir)
+	if len(state.Paths) == 0 {
+		log.Infof("Nothing is stored for profile '%s'\n", profile.Name)
+		return
+	}
+	fmt.Printf("The following will be deleted for profile '%s':\n", profile.Name)
+	for _, p := range state.Paths {
+		fmt.Printf("    %s\n", p)
+	}
+	if profiles, err := builder.GetAllProfiles(); err == nil {
+		if shared := state.SharedWith(profiles); len(shared) > 0 {
+			log.Warnf("The image '%s' is also used by: %s\n", profile.Image, strings.Join(shared, ", "))
+		}
+	}
+	if !sFlags.Yes {
+		if !isTerminal(os.Stdin) {
+			log.Fatalln("Refusing to delete without confirmation, pass --yes to continue")
+		}
+		if !confirm("Delete these files?") {
+			log.Infoln("Nothing was deleted")
+			return
+		}
+	}
+	if err := state.Delete(); err != nil {
+		log.Fatalf("Failed to delete profile '%s', reason: %s\n", profile.Name, err)
+	}
+	Complete(fmt.Sprintf("Deleted profile '%s'", profile.Name))
+}
+
+// confirm will ask the user a yes or no question on the terminal, defaulting
+// to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
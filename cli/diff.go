@@ -0,0 +1,74 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+)
+
+func init() {
+	cmd.Register(&Diff)
+}
+
+// Diff lists the changes made within a build overlay
+var Diff = cmd.Sub{
+	Name:  "diff",
+	Short: "List the files a build added, modified or deleted in its root",
+	Flags: &DiffFlags{},
+	Run:   DiffRun,
+}
+
+// DiffFlags are flags for the "diff" sub-command
+type DiffFlags struct {
+	Overlay string `long:"overlay" desc:"Overlay directory to inspect, i.e. /var/cache/solbuild/unstable-x86_64/nano"`
+}
+
+// DiffRun carries out the "diff" sub-command
+func DiffRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*DiffFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	if sFlags.Overlay == "" {
+		log.Fatalln("The overlay directory must be given with --overlay")
+	}
+	RequireRoot("inspect overlays")
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+	// The overlay is compared against the image of the profile
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	files, err := manager.Diff(sFlags.Overlay)
+	if err != nil {
+		log.Fatalf("Failed to inspect overlay, reason: %s\n", err)
+	}
+	for _, f := range files {
+		fmt.Printf("%-8s  %s\n", f.ChangeType, f.Path)
+	}
+}
@@ -0,0 +1,103 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	cmd.Register(&Export)
+}
+
+// Export writes the build root of a package out as a tarball
+var Export = cmd.Sub{
+	Name:  "export",
+	Short: "Export the package's build environment as a tarball",
+	Flags: &ExportFlags{},
+	Args:  &ExportArgs{},
+	Run:   ExportRun,
+}
+
+// ExportFlags are flags for the "export" sub-command
+type ExportFlags struct {
+	Output        string `short:"o" long:"output" desc:"Write the environment to this file, i.e. env.tar.gz"`
+	PreserveOwner bool   `long:"preserve-owner"   desc:"Keep the uid and gid of every file, rather than making root the owner"`
+}
+
+// ExportArgs are arguments for the "export" sub-command
+type ExportArgs struct {
+	Path []string `zero:"yes" desc:"Export the environment for a [package.yml|pspec.xml] recipe, or package directory."`
+}
+
+// ExportRun carries out the "export" sub-command
+func ExportRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*ExportFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+		builder.DisableColors = true
+	}
+	if sFlags.Output == "" {
+		log.Fatalln("The file to export to must be given with --output")
+	}
+	output, err := filepath.Abs(sFlags.Output)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	builder.ExportPreserveOwner = sFlags.PreserveOwner
+
+	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*ExportArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	RequireRoot("export a build root")
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	pkg, err := builder.NewPackage(pkgPath)
+	if err != nil {
+		log.Fatalf("Failed to load package: %s\n", err)
+	}
+	if err := manager.SetPackage(pkg); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+		os.Exit(1)
+	}
+	if err := manager.Export(output); err != nil {
+		log.Fatalf("Failed to export the build root, reason: %s\n", err)
+	}
+	Complete(fmt.Sprintf("Exported the build root to %s", output))
+}
@@ -0,0 +1,79 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"strings"
+)
+
+func init() {
+	cmd.Register(&Fetch)
+}
+
+// Fetch exports the sources of a package without building it
+var Fetch = cmd.Sub{
+	Name:  "fetch",
+	Short: "Fetch the sources of the given package into a directory",
+	Flags: &FetchFlags{},
+	Args:  &FetchArgs{},
+	Run:   FetchRun,
+}
+
+// FetchFlags are flags for the "fetch" sub-command
+type FetchFlags struct {
+	Output string `short:"o" long:"output" desc:"Directory to export the sources to (default: current directory)"`
+}
+
+// FetchArgs are arguments for the "fetch" sub-command
+type FetchArgs struct {
+	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] file, or package directory, to fetch."`
+}
+
+// FetchRun carries out the "fetch" sub-command
+func FetchRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*FetchFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+		builder.DisableColors = true
+	}
+
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*FetchArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	RequireRoot("fetch sources into the source cache")
+	pkg, err := builder.NewPackage(pkgPath)
+	if err != nil {
+		log.Fatalf("Failed to load package: %s\n", err)
+	}
+
+	outputDir := sFlags.Output
+	if outputDir == "" {
+		outputDir = "."
+	}
+	if err := pkg.ExportSources(outputDir); err != nil {
+		log.Fatalf("Failed to export sources: %s\n", err)
+	}
+	Complete("Sources exported to " + outputDir)
+}
@@ -0,0 +1,88 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	cmd.Register(&History)
+}
+
+// History prints the past builds recorded by solbuild
+var History = cmd.Sub{
+	Name:  "history",
+	Short: "Print the past builds of a package, or of all packages",
+	Args:  &HistoryArgs{},
+	Run:   HistoryRun,
+}
+
+// HistoryArgs are arguments for the "history" sub-command
+type HistoryArgs struct {
+	Package []string `zero:"yes" desc:"Name of the package to print the builds of"`
+}
+
+// HistoryRun carries out the "history" sub-command
+func HistoryRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	SetLogLevel(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	args := s.Args.(*HistoryArgs).Package
+	if len(args) > 1 {
+		log.Fatalln("The history of only one package may be printed at a time")
+	}
+	name := strings.Join(args, "")
+	records, err := builder.NewBuildDatabase(builder.BuildDatabasePath).Records(name)
+	if err != nil {
+		log.Fatalf("Failed to read build history, reason: %s\n", err)
+	}
+	if len(records) == 0 {
+		log.Infoln("No builds have been recorded")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tPACKAGE\tVERSION\tPROFILE\tRESULT\tDURATION\tPEAK DISK\tCOMMIT")
+	for _, record := range records {
+		result := "success"
+		if !record.Success {
+			result = "failed"
+		}
+		commit := record.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		disk := "-"
+		if record.PeakDisk > 0 {
+			disk = builder.FormatBytes(record.PeakDisk)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s-%d\t%s\t%s\t%s\t%s\t%s\n",
+			record.Started.Local().Format("2006-01-02 15:04"), record.Name, record.Version, record.Release,
+			record.Profile, result, record.Duration.Round(time.Second), disk, commit)
+	}
+	w.Flush()
+}
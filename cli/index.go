@@ -21,7 +21,6 @@ import (
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/getsolus/solbuild/builder"
 	"os"
 )
@@ -54,15 +53,12 @@ type IndexArgs struct {
 func IndexRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
 	sFlags := s.Flags.(*IndexFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 	}
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to use index")
-	}
+	RequireRoot("index packages")
 	// Initialise the build manager
 	manager, err := builder.NewManager()
 	if err != nil {
@@ -84,5 +80,5 @@ func IndexRun(r *cmd.Root, s *cmd.Sub) {
 	if err := manager.Index(args.Dir); err != nil {
 		log.Fatalln("Index failure")
 	}
-	log.Infoln("Indexing complete")
+	Complete("Indexing complete")
 }
@@ -0,0 +1,112 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	cmd.Register(&Info)
+}
+
+// Info prints the metadata solbuild parses from a build recipe
+var Info = cmd.Sub{
+	Name:  "info",
+	Short: "Print the package metadata parsed from the given package",
+	Flags: &InfoFlags{},
+	Args:  &InfoArgs{},
+	Run:   InfoRun,
+}
+
+// InfoFlags are flags for the "info" sub-command
+type InfoFlags struct {
+	JSON bool `long:"json" desc:"Print the metadata as JSON"`
+}
+
+// InfoArgs are arguments for the "info" sub-command
+type InfoArgs struct {
+	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] file, or package directory, to inspect."`
+}
+
+// InfoRun carries out the "info" sub-command
+func InfoRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*InfoFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*InfoArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	pkg, err := builder.NewPackage(pkgPath)
+	if err != nil {
+		log.Fatalf("Failed to load package: %s\n", err)
+	}
+	info := pkg.Info()
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(info); err != nil {
+			log.Fatalf("Failed to encode package info: %s\n", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	row := func(key string, value interface{}) {
+		fmt.Fprintf(w, "%s:\t%v\n", key, value)
+	}
+	row("Name", info.Name)
+	row("Version", info.Version)
+	row("Release", info.Release)
+	row("Type", info.Type)
+	row("Summary", info.Summary)
+	row("Component", strings.Join(info.Components, ", "))
+	row("License", strings.Join(info.Licenses, ", "))
+	if info.Homepage != "" {
+		row("Homepage", info.Homepage)
+	}
+	row("Sources", len(info.Sources))
+	row("Build dependencies", len(info.BuildDeps))
+	row("Run dependencies", len(info.RunDeps))
+	w.Flush()
+
+	for _, src := range info.Sources {
+		if src.Type == "git" {
+			fmt.Printf("    %s (ref %s)\n", src.URI, src.Ref)
+		} else {
+			fmt.Printf("    %s (%s %s)\n", src.URI, src.HashType, src.Hash)
+		}
+	}
+	if info.Type == builder.PackageTypeYpkg && info.Description != "" {
+		fmt.Printf("\n%s\n", strings.TrimSpace(info.Description))
+	}
+}
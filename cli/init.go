@@ -21,9 +21,7 @@ import (
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/cheggaaa/pb/v3"
-	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/solbuild/builder"
 	"io"
 	"net/http"
@@ -45,21 +43,22 @@ var Init = cmd.Sub{
 
 // InitFlags are flags for the "init" sub-command
 type InitFlags struct {
-	AutoUpdate bool `short:"u" long:"update" desc:"Automatically update the new image"`
+	AutoUpdate bool   `short:"u" long:"update"  desc:"Automatically update the new image"`
+	NoDBus     bool   `long:"no-dbus"            desc:"Don't start D-BUS when updating the new image"`
+	Local      string `long:"local"              desc:"Install the image from this .img.xz or .img file instead of downloading it"`
+	Bootstrap  bool   `long:"bootstrap"          desc:"Build the image from scratch as described by the profile, instead of downloading it"`
 }
 
 // InitRun carries out the "init" sub-command
 func InitRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 	}
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to run init profiles")
-	}
+	RequireRoot("initialise profiles")
+	builder.NoDBus = s.Flags.(*InitFlags).NoDBus
 	// Now we'll update the newly initialised image
 	manager, err := builder.NewManager()
 	if err != nil {
@@ -69,8 +68,17 @@ func InitRun(r *cmd.Root, s *cmd.Sub) {
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
 		log.Fatalln(err.Error())
 	}
-	doInit(manager)
 	sFlags := s.Flags.(*InitFlags)
+	if sFlags.Bootstrap && sFlags.Local != "" {
+		log.Fatalln("The --bootstrap and --local flags are mutually exclusive")
+	}
+	if sFlags.Bootstrap {
+		doBootstrap(manager)
+	} else if sFlags.Local != "" {
+		doInitLocal(manager, sFlags.Local)
+	} else {
+		doInit(manager)
+	}
 	if sFlags.AutoUpdate {
 		doUpdate(manager)
 	}
@@ -99,10 +107,48 @@ func doInit(manager *builder.Manager) {
 	}
 	// Decompress the image
 	log.Debugf("Decompressing backing image, source: '%s' target: '%s'\n", bk.ImagePathXZ, bk.ImagePath)
-	if err := commands.ExecStdoutArgsDir(builder.ImagesDir, "unxz", []string{bk.ImagePathXZ}); err != nil {
+	if err := builder.DecompressImage(bk.ImagePathXZ, bk.ImagePath); err != nil {
 		log.Fatalf("Failed to decompress image '%s', reason: %s\n", bk.ImagePathXZ, err)
 	}
-	log.Infoln("Profile successfully initialised")
+	// Allow verify-image to detect later corruption
+	if err := bk.RecordHash(true); err != nil {
+		log.Warnf("Unable to record the hash of the image, reason: %s\n", err)
+	}
+	Complete("Profile successfully initialised")
+}
+
+// doBootstrap will build the image of the profile from scratch
+func doBootstrap(manager *builder.Manager) {
+	prof := manager.GetProfile()
+	if builder.NewBackingImage(prof.Image).IsInstalled() {
+		log.Warnf("'%s' has already been initialised\n", prof.Name)
+		return
+	}
+	if err := manager.Bootstrap(); err != nil {
+		log.Fatalf("Failed to bootstrap image '%s' for profile '%s', reason: %s\n", prof.Image, prof.Name, err)
+	}
+	Complete("Profile successfully initialised")
+}
+
+// doInitLocal will install the image of the profile from a local file
+func doInitLocal(manager *builder.Manager, path string) {
+	prof := manager.GetProfile()
+	bk := builder.NewBackingImage(prof.Image)
+	if bk.IsInstalled() {
+		log.Warnf("'%s' has already been initialised\n", prof.Name)
+		return
+	}
+	if err := os.MkdirAll(builder.ImagesDir, 00755); err != nil {
+		log.Fatalf("Failed to create images directory '%s', reason: %s", builder.ImagesDir, err)
+	}
+	if err := bk.InstallLocal(path); err != nil {
+		log.Fatalf("Failed to install image '%s' for profile '%s', reason: %s\n", path, prof.Name, err)
+	}
+	// Allow verify-image to detect later corruption
+	if err := bk.RecordHash(true); err != nil {
+		log.Warnf("Unable to record the hash of the image, reason: %s\n", err)
+	}
+	Complete("Profile successfully initialised")
 }
 
 // Downloads an image using net/http.
@@ -124,7 +170,9 @@ func downloadImage(bk *builder.BackingImage) (err error) {
 	defer resp.Body.Close()
 	bar := pb.New64(resp.ContentLength).Set(pb.Bytes, true)
 	reader := bar.NewProxyReader(resp.Body)
-	bar.Start()
+	if !builder.CIMode {
+		bar.Start()
+	}
 	defer bar.Finish()
 	bytesRemaining := resp.ContentLength
 	done := false
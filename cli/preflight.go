@@ -0,0 +1,48 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"os"
+	"strings"
+)
+
+// RequireRoot will exit with an actionable error unless running as root. It
+// is called by every sub-command that mounts, chroots or writes to the
+// solbuild directories, before any work is done. The info, validate, version
+// and completion sub-commands, along with update --check, run without it.
+func RequireRoot(action string) {
+	if msg := rootError(action, os.Geteuid(), isTerminal(os.Stdin), os.Args); msg != "" {
+		log.Fatalln(msg)
+	}
+}
+
+// rootError returns the error explaining how to run the command as root,
+// or an empty string when running as root already
+func rootError(action string, euid int, terminal bool, args []string) string {
+	if euid == 0 {
+		return ""
+	}
+	command := strings.Join(args, " ")
+	if !terminal {
+		// A password prompt from sudo could never be answered
+		return fmt.Sprintf("You must be root to %s, and there is no terminal for sudo to ask for a password. Run it with 'sudo -n %s' after allowing it in sudoers, or from a terminal.", action, command)
+	}
+	return fmt.Sprintf("You must be root to %s, run it with sudo: sudo %s", action, command)
+}
@@ -0,0 +1,37 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRootError(t *testing.T) {
+	args := []string{"solbuild", "build", "-p", "main-x86_64"}
+	if msg := rootError("build packages", 0, false, args); msg != "" {
+		t.Fatalf("Expected no error as root, got: %s", msg)
+	}
+	msg := rootError("build packages", 1000, true, args)
+	if !strings.Contains(msg, "build packages") || !strings.Contains(msg, "sudo solbuild build -p main-x86_64") {
+		t.Fatalf("Expected a sudo suggestion, got: %s", msg)
+	}
+	msg = rootError("build packages", 1000, false, args)
+	if !strings.Contains(msg, "sudo -n solbuild build -p main-x86_64") || !strings.Contains(msg, "no terminal") {
+		t.Fatalf("Expected a non-interactive sudo suggestion, got: %s", msg)
+	}
+}
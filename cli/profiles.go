@@ -0,0 +1,158 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	log "github.com/DataDrake/waterlog"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// A profileBuild is the outcome of building the recipe against one of the
+// profiles of a multi-profile build
+type profileBuild struct {
+	profile   string
+	result    string
+	duration  time.Duration
+	artifacts int
+}
+
+// BuildProfiles will build a single recipe against each of the profiles in
+// turn, each by a separate solbuild process. The packages of each profile are
+// collected into a subdirectory of the output directory named for it. Sources
+// are fetched by the first build alone, as the source cache is shared.
+func BuildProfiles(profiles []string, args []string, sFlags *BuildFlags) {
+	if !builder.UseDocker {
+		RequireRoot("build packages")
+	}
+	if len(args) > 1 || sFlags.Resume || sFlags.DepOrder != "" {
+		log.Fatalln("Multiple profiles cannot be combined with multiple recipes, --resume or --dep-order")
+	}
+	seen := make(map[string]bool)
+	for _, profile := range profiles {
+		if seen[profile] {
+			log.Fatalf("The profile %s was given more than once\n", profile)
+		}
+		seen[profile] = true
+	}
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0]
+	}
+	path, err := ResolveRecipe(arg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		log.Fatalln(err)
+	}
+	pkg, err := builder.NewPackage(path)
+	if err != nil {
+		log.Fatalf("Failed to load package %s: %s\n", path, err)
+	}
+	outputDir, err := filepath.Abs(".")
+	if err != nil {
+		log.Fatalf("Unable to find working directory, reason: %s\n", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Unable to find the solbuild executable, reason: %s\n", err)
+	}
+
+	// Each build cleans up after itself when interrupted, so just stop once
+	// the current build has exited
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(ch)
+
+	usr := builder.GetUserInfo()
+	builds := make([]*profileBuild, len(profiles))
+	failed, stopped := false, false
+	for i, profile := range profiles {
+		builds[i] = &profileBuild{profile: profile, result: "not built"}
+		if stopped {
+			continue
+		}
+		dir := filepath.Join(outputDir, profile)
+		if err := os.MkdirAll(dir, 00755); err != nil {
+			log.Fatalf("Failed to create output directory %s, reason: %s\n", dir, err)
+		}
+		if err := os.Chown(dir, usr.UID, usr.GID); err != nil {
+			log.Errorf("Error in restoring file ownership %s, reason: %s\n", dir, err)
+		}
+		log.Infof("Building %s against %s (%d of %d)\n", pkg.Name, profile, i+1, len(profiles))
+		c := exec.Command(exe, profileArgs(os.Args[1:], args, profile, path)...)
+		c.Dir = dir
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		start := time.Now()
+		err := c.Run()
+		builds[i].duration = time.Since(start)
+		artifacts, _ := builder.NewArtifacts(dir, pkg, start)
+		builds[i].artifacts = len(artifacts)
+		if err != nil {
+			builds[i].result = "failed"
+			failed = true
+			stopped = sFlags.FailFast
+			log.Errorf("Failed to build %s against %s\n", pkg.Name, profile)
+		} else {
+			builds[i].result = "succeeded"
+		}
+		select {
+		case <-ch:
+			log.Errorln("Build interrupted, not building against the remaining profiles")
+			failed, stopped = true, true
+		default:
+		}
+	}
+
+	printProfileSummary(builds)
+	if failed {
+		os.Exit(1)
+	}
+	Complete(fmt.Sprintf("Built %s against %d profile(s)", pkg.Name, len(profiles)))
+}
+
+// profileArgs will return the arguments solbuild was invoked with, less the
+// recipes, to build the recipe against the profile. The profile follows the
+// original list of profiles, so that it takes precedence.
+func profileArgs(args, recipes []string, profile, recipe string) []string {
+	return append(batchArgs(args, recipes), "--profile", profile, recipe)
+}
+
+// printProfileSummary will print the result of the build against each
+// profile, side by side
+func printProfileSummary(builds []*profileBuild) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tRESULT\tDURATION\tARTIFACTS")
+	for _, b := range builds {
+		duration := "-"
+		if b.duration > 0 {
+			duration = b.duration.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", b.profile, b.result, duration, b.artifacts)
+	}
+	w.Flush()
+}
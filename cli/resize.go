@@ -0,0 +1,89 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+)
+
+func init() {
+	cmd.Register(&Resize)
+}
+
+// Resize grows the image of a solbuild profile
+var Resize = cmd.Sub{
+	Name:  "resize",
+	Short: "Grow the image of a solbuild profile",
+	Flags: &ResizeFlags{},
+	Run:   ResizeRun,
+}
+
+// ResizeFlags are flags for the "resize" sub-command
+type ResizeFlags struct {
+	Size string `short:"s" long:"size" desc:"New size of the image in gigabytes, i.e. 10G"`
+}
+
+// parseImageSize will parse a size given in whole gigabytes
+func parseImageSize(size string) (int, error) {
+	bytes, err := builder.ParseBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	if bytes < builder.GiB || bytes%builder.GiB != 0 {
+		return 0, fmt.Errorf("Image size must be a whole number of gigabytes: %s", size)
+	}
+	return int(bytes / builder.GiB), nil
+}
+
+// ResizeRun carries out the "resize" sub-command
+func ResizeRun(r *cmd.Root, c *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := c.Flags.(*ResizeFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	if sFlags.Size == "" {
+		log.Fatalln("The new size of the image must be given with --size")
+	}
+	size, err := parseImageSize(sFlags.Size)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	RequireRoot("resize images")
+	manager, err := builder.NewManager()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	if err := manager.Resize(size); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+			os.Exit(1)
+		}
+		log.Fatalf("Failed to resize image, reason: %s\n", err)
+	}
+	Complete(fmt.Sprintf("Image '%s' resized to %dG", manager.GetProfile().Image, size))
+}
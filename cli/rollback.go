@@ -0,0 +1,69 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+)
+
+func init() {
+	cmd.Register(&Rollback)
+}
+
+// Rollback reverts the most recent upgrade of a solbuild image
+var Rollback = cmd.Sub{
+	Name:  "rollback",
+	Short: "Revert the last update of a solbuild profile",
+	Run:   RollbackRun,
+}
+
+// RollbackRun carries out the "rollback" sub-command
+func RollbackRun(r *cmd.Root, c *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	RequireRoot("roll back profiles")
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	// Safety first..
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+		os.Exit(1)
+	}
+	if err := manager.Rollback(); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		} else {
+			log.Errorf("Failed to roll back profile: %s\n", err)
+		}
+		os.Exit(1)
+	}
+	Complete("Rollback complete")
+}
@@ -17,8 +17,17 @@
 package cli
 
 import (
+	"fmt"
 	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/level"
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder/source"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 func init() {
@@ -36,23 +45,204 @@ var Root = cmd.Root{
 // GlobalFlags are available to all sub-commands
 type GlobalFlags struct {
 	Debug   bool   `short:"d" long:"debug"    desc:"Enable debug message"`
+	Quiet   bool   `short:"q" long:"quiet"    desc:"Only print errors and the final status"`
 	NoColor bool   `short:"n" long:"no-color" desc:"Disable color output"`
 	Profile string `short:"p" long:"profile"  desc:"Build profile to use"`
+	CI      bool   `long:"ci"                 desc:"Enable non-interactive CI mode"`
+	Version bool   `long:"version"            desc:"Print the solbuild version and exit"`
+}
+
+// quiet is set when only errors and the final status should be printed
+var quiet bool
+
+// SetLogLevel will set the log level from the global flags. Quiet mode also
+// hides the chroot output and progress bars.
+func SetLogLevel(rFlags *GlobalFlags) {
+	if rFlags.Debug && rFlags.Quiet {
+		log.Fatalln("The --debug and --quiet flags are mutually exclusive")
+	}
+	if rFlags.Debug {
+		log.SetLevel(level.Debug)
+	}
+	if rFlags.Quiet {
+		log.SetLevel(level.Error)
+		quiet = true
+		builder.QuietOutput = true
+		source.DisableProgress = true
+	}
+}
+
+// Complete will print the final status of a successful command, which is
+// still shown in quiet mode
+func Complete(status string) {
+	if quiet {
+		fmt.Println(status)
+		return
+	}
+	log.Infoln(status)
+}
+
+// SetCIMode will enable CI mode when requested, or automatically when running
+// under a CI system without a terminal. CI mode disables colours and progress
+// bars, and emits keepalive output during long running commands.
+func SetCIMode(rFlags *GlobalFlags) {
+	if !rFlags.CI {
+		if os.Getenv("CI") != "true" || isTerminal(os.Stdout) {
+			return
+		}
+		log.Debugln("CI environment detected, enabling CI mode")
+	}
+	rFlags.NoColor = true
+	builder.CIMode = true
+	source.DisableProgress = true
+}
+
+// SetDNSServer will use the given DNS server for builds that are permitted
+// to network, exiting if it isn't a valid IP address
+func SetDNSServer(server string) {
+	if net.ParseIP(server) == nil {
+		log.Fatalf("Invalid DNS server '%s', expected an IP address\n", server)
+	}
+	builder.DNSServer = server
+}
+
+// isTerminal will determine whether the file is attached to a terminal
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return st.Mode()&os.ModeCharDevice != 0
+}
+
+// recipeSearchDepth is how many parent directories FindLikelyArg will search
+const recipeSearchDepth = 2
+
+// findRecipe will look for a build recipe within dir, preferring package.yml
+// over the legacy pspec.xml format.
+func findRecipe(dir string) string {
+	var found []string
+	for _, name := range []string{"package.yml", "pspec.xml"} {
+		p := filepath.Join(dir, name)
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			found = append(found, p)
+		}
+	}
+	if len(found) < 1 {
+		return ""
+	}
+	if len(found) > 1 {
+		log.Warnf("Found both %s, using %s\n", strings.Join(found, " and "), found[0])
+	}
+	return found[0]
 }
 
 // FindLikelyArg will look in the current directory to see if common path names exist,
-// for when it is acceptable to omit a filename.
+// for when it is acceptable to omit a filename. The parent directories are also
+// searched, so that it works from within a package's files/ directory. The
+// path returned is absolute.
 func FindLikelyArg() string {
-	lookPaths := []string{
-		"package.yml",
-		"pspec.xml",
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		return ""
 	}
-	for _, p := range lookPaths {
-		if st, err := os.Stat(p); err == nil {
-			if st != nil {
-				return p
-			}
+	for i := 0; i <= recipeSearchDepth; i++ {
+		if p := findRecipe(dir); p != "" {
+			return p
 		}
+		dir = filepath.Dir(dir)
 	}
 	return ""
 }
+
+// ResolveRecipe will determine the build recipe to use from the argument,
+// which may be the recipe itself, a package directory, or empty to search
+// from the current directory. When the recipe is found in a parent
+// directory, that becomes the working directory, so that the output is
+// written next to the recipe.
+func ResolveRecipe(arg string) (string, error) {
+	if arg == "" {
+		if p := FindLikelyArg(); p != "" {
+			return p, chdirRecipe(p)
+		}
+		return "", fmt.Errorf("No package.yml or pspec.xml found in the current directory or its %d parent directories", recipeSearchDepth)
+	}
+	st, err := os.Stat(arg)
+	if err != nil {
+		return "", fmt.Errorf("No such file or directory: %s", arg)
+	}
+	if !st.IsDir() {
+		return arg, nil
+	}
+	if p := findRecipe(arg); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("No package.yml or pspec.xml found in %s", arg)
+}
+
+// chdirRecipe will change to the directory of the recipe, when the current
+// directory is not already that directory
+func chdirRecipe(recipe string) error {
+	wd, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(recipe)
+	if dir == wd {
+		return nil
+	}
+	log.Infof("Found %s in a parent directory, working from %s\n", filepath.Base(recipe), dir)
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("Unable to change to the directory of %s, reason: %s", recipe, err)
+	}
+	return nil
+}
+
+// splitList will split a comma separated flag value into its non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envAssign matches the start of a KEY=VALUE environment variable
+var envAssign = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// splitEnv will split a comma separated list of KEY[=VALUE] variables. A
+// value may itself contain commas, so the list is only split where a new
+// KEY= starts, or after a KEY without a value.
+func splitEnv(value string) []string {
+	var vars []string
+	for _, item := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed == "" {
+			continue
+		}
+		last := len(vars) - 1
+		if last >= 0 && strings.Contains(vars[last], "=") && !envAssign.MatchString(trimmed) {
+			vars[last] += "," + item
+			continue
+		}
+		vars = append(vars, trimmed)
+	}
+	return vars
+}
+
+// flagCount will count how many times a long flag is given in args, as
+// repeated flags are not accumulated, only the last value is kept
+func flagCount(args []string, flag string) int {
+	count := 0
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			count++
+		}
+	}
+	return count
+}
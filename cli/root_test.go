@@ -0,0 +1,84 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveRecipeParent(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	dir, err := ioutil.TempDir("", "solbuild-recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	recipe := filepath.Join(dir, "package.yml")
+	if err := ioutil.WriteFile(recipe, nil, 00644); err != nil {
+		t.Fatal(err)
+	}
+	files := filepath.Join(dir, "files")
+	if err := os.Mkdir(files, 00755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(files); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ResolveRecipe("")
+	if err != nil {
+		t.Fatalf("Failed to find recipe: %s", err)
+	}
+	if got != recipe {
+		t.Fatalf("Expected '%s', got '%s'", recipe, got)
+	}
+	if cwd, _ := os.Getwd(); cwd != dir {
+		t.Fatalf("Expected to work from '%s', got '%s'", dir, cwd)
+	}
+}
+
+func TestSplitEnv(t *testing.T) {
+	tests := map[string]string{
+		"FOO, BAR":                      "FOO|BAR",
+		"NO_PROXY=localhost,.lan,FOO=1": "NO_PROXY=localhost,.lan|FOO=1",
+		"HTTP_PROXY,NO_PROXY=a,b":       "HTTP_PROXY|NO_PROXY=a,b",
+		"FOO=1,,BAR=2":                  "FOO=1|BAR=2",
+		"":                              "",
+	}
+	for value, expected := range tests {
+		if got := strings.Join(splitEnv(value), "|"); got != expected {
+			t.Errorf("Expected '%s' for '%s', got '%s'", expected, value, got)
+		}
+	}
+}
+
+func TestFlagCount(t *testing.T) {
+	args := []string{"build", "--env", "FOO", "--env=BAR=1", "--envy", "--", "--env"}
+	if count := flagCount(args, "--env"); count != 2 {
+		t.Fatalf("Expected --env twice, got %d", count)
+	}
+}
@@ -0,0 +1,92 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	cmd.Register(&Search)
+}
+
+// Search looks for packages in the repositories of a profile
+var Search = cmd.Sub{
+	Name:  "search",
+	Short: "Search the repositories of a profile for packages",
+	Args:  &SearchArgs{},
+	Run:   SearchRun,
+}
+
+// SearchArgs are arguments for the "search" sub-command
+type SearchArgs struct {
+	Query []string `desc:"Terms to search the package names and summaries for"`
+}
+
+// SearchRun carries out the "search" sub-command
+func SearchRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	SetLogLevel(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+		builder.DisableColors = true
+	}
+	query := strings.Join(s.Args.(*SearchArgs).Query, " ")
+	if strings.TrimSpace(query) == "" {
+		log.Fatalln("Nothing to search for")
+	}
+	RequireRoot("search the repositories of a profile")
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+	// Safety first..
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	results, err := manager.Search(query)
+	if err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+			os.Exit(1)
+		}
+		log.Fatalf("Search failed: %s\n", err)
+	}
+	if len(results) == 0 {
+		log.Infof("No packages match '%s'\n", query)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tSUMMARY")
+	for _, result := range results {
+		version := "-"
+		if result.Version != "" {
+			version = fmt.Sprintf("%s-%d", result.Version, result.Release)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Name, version, result.Summary)
+	}
+	w.Flush()
+}
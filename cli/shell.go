@@ -0,0 +1,74 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+)
+
+func init() {
+	cmd.Register(&Shell)
+}
+
+// Shell opens an interactive shell inside the bare base image of a profile
+var Shell = cmd.Sub{
+	Name:  "shell",
+	Short: "Interactively explore the base image of a profile",
+	Flags: &ShellFlags{},
+	Run:   ShellRun,
+}
+
+// ShellFlags are flags for the "shell" sub-command
+type ShellFlags struct {
+	ReadOnly bool `long:"read-only" desc:"Mount the image read-only, so that nothing may be changed"`
+}
+
+// ShellRun carries out the "shell" sub-command
+func ShellRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*ShellFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+		builder.DisableColors = true
+	}
+	RequireRoot("open a shell in a profile")
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+	// Safety first..
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	if err := manager.Shell(sFlags.ReadOnly); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+			os.Exit(1)
+		}
+		log.Fatalf("Shell failure: %s\n", err)
+	}
+	Complete("Shell complete")
+}
@@ -21,7 +21,6 @@ import (
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	log "github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
-	"github.com/DataDrake/waterlog/level"
 	"github.com/getsolus/solbuild/builder"
 	"os"
 )
@@ -35,21 +34,35 @@ var Update = cmd.Sub{
 	Name:  "update",
 	Alias: "up",
 	Short: "Update a solbuild profile",
+	Flags: &UpdateFlags{},
 	Run:   UpdateRun,
 }
 
+// UpdateFlags are flags for the "update" sub-command
+type UpdateFlags struct {
+	Check  bool `long:"check"   desc:"Report whether a newer image is available without updating, exiting with 2 if so"`
+	NoDBus bool `long:"no-dbus" desc:"Don't start D-BUS in the image, for environments where it is unavailable"`
+}
+
+// ExitUpdateAvailable is the exit status of update --check when the image
+// is out of date
+const ExitUpdateAvailable = 2
+
 // UpdateRun carries out the "update" sub-command
 func UpdateRun(r *cmd.Root, c *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags)
-	if rFlags.Debug {
-		log.SetLevel(level.Debug)
-	}
+	sFlags := c.Flags.(*UpdateFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
 	if rFlags.NoColor {
 		log.SetFormat(format.Un)
 	}
-	if os.Geteuid() != 0 {
-		log.Fatalln("You must be root to run init profiles")
+	if sFlags.Check {
+		checkForUpdate(rFlags)
+		return
 	}
+	RequireRoot("update profiles")
+	builder.NoDBus = sFlags.NoDBus
 	// Initialise the build manager
 	manager, err := builder.NewManager()
 	if err != nil {
@@ -69,3 +82,30 @@ func UpdateRun(r *cmd.Root, c *cmd.Sub) {
 		os.Exit(1)
 	}
 }
+
+// checkForUpdate will report whether a newer image is available for the
+// profile, exiting with ExitUpdateAvailable if so
+func checkForUpdate(rFlags *GlobalFlags) {
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+		os.Exit(1)
+	}
+	bk := builder.NewBackingImage(manager.GetProfile().Image)
+	available, hash, err := bk.CheckForUpdate()
+	if err != nil {
+		log.Fatalf("Failed to check for an update of %s, reason: %s\n", bk.Name, err)
+	}
+	if !available {
+		fmt.Println("up to date")
+		return
+	}
+	log.Debugf("New image sha256 %s\n", hash)
+	fmt.Println("update available")
+	os.Exit(ExitUpdateAvailable)
+}
@@ -0,0 +1,60 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"regexp"
+)
+
+const (
+	// phaseColor is the ANSI escape used to highlight phase banners
+	phaseColor = "\033[1;36m"
+
+	// resetColor is the ANSI escape to restore the default colour
+	resetColor = "\033[0m"
+)
+
+var (
+	// ansiEscape matches the ANSI escape sequences used for colour
+	ansiEscape = regexp.MustCompile("\033\\[[0-9;]*m")
+
+	// colorPhases is set when phase banners should be coloured
+	colorPhases bool
+)
+
+// EnablePhaseColors will colour the phase banners, when printing to a terminal
+func EnablePhaseColors(rFlags *GlobalFlags) {
+	colorPhases = !rFlags.NoColor && isTerminal(os.Stdout)
+}
+
+// PrintPhase will print a banner marking the start of a phase, which is also
+// written to the build log without colour
+func PrintPhase(name string) {
+	banner := fmt.Sprintf("=== %s ===", name)
+	if colorPhases {
+		banner = phaseColor + banner + resetColor
+	}
+	if !quiet {
+		fmt.Println(banner)
+	}
+	if builder.ChrootOutput != nil {
+		builder.ChrootOutput.Annotate("phase", ansiEscape.ReplaceAllString(banner, ""))
+	}
+}
@@ -0,0 +1,85 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+	"strings"
+)
+
+func init() {
+	cmd.Register(&Validate)
+}
+
+// Validate checks a build recipe for problems without building it
+var Validate = cmd.Sub{
+	Name:  "validate",
+	Short: "Check the given package for problems without building it",
+	Flags: &ValidateFlags{},
+	Args:  &ValidateArgs{},
+	Run:   ValidateRun,
+}
+
+// ValidateFlags are flags for the "validate" sub-command
+type ValidateFlags struct {
+	Network bool `long:"network" desc:"Check that every source is reachable"`
+}
+
+// ValidateArgs are arguments for the "validate" sub-command
+type ValidateArgs struct {
+	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] file, or package directory, to validate."`
+}
+
+// ValidateRun carries out the "validate" sub-command
+func ValidateRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	sFlags := s.Flags.(*ValidateFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+
+	pkgPath, err := ResolveRecipe(strings.Join(s.Args.(*ValidateArgs).Path, ""))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	pkg, err := builder.NewPackage(pkgPath)
+	if err != nil {
+		log.Fatalf("Failed to load package: %s\n", err)
+	}
+
+	failed := 0
+	for _, problem := range pkg.Validate(sFlags.Network) {
+		if problem.Warning {
+			log.Warnln(problem)
+			continue
+		}
+		log.Errorln(problem)
+		failed++
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%s has %d problem(s)\n", pkgPath, failed)
+		os.Exit(1)
+	}
+	log.Goodf("%s is valid\n", pkgPath)
+}
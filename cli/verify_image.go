@@ -0,0 +1,82 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"github.com/DataDrake/cli-ng/v2/cmd"
+	log "github.com/DataDrake/waterlog"
+	"github.com/DataDrake/waterlog/format"
+	"github.com/getsolus/solbuild/builder"
+	"os"
+)
+
+func init() {
+	cmd.Register(&VerifyImage)
+}
+
+// VerifyImage checks the installed image of a profile for corruption
+var VerifyImage = cmd.Sub{
+	Name:  "verify-image",
+	Alias: "vi",
+	Short: "Check the installed image of a solbuild profile for corruption",
+	Run:   VerifyImageRun,
+}
+
+// VerifyImageRun carries out the "verify-image" sub-command
+func VerifyImageRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)
+	SetLogLevel(rFlags)
+	SetCIMode(rFlags)
+	if rFlags.NoColor {
+		log.SetFormat(format.Un)
+	}
+	RequireRoot("verify images")
+	manager, err := builder.NewManager()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	profile := manager.GetProfile()
+	report, err := manager.VerifyImage()
+	if err != nil {
+		if err == builder.ErrProfileNotInstalled {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+			os.Exit(1)
+		}
+		log.Fatalf("Failed to verify image, reason: %s\n", err)
+	}
+	switch report.State {
+	case builder.ImagePristine:
+		Complete(fmt.Sprintf("Image '%s' is pristine", profile.Image))
+	case builder.ImageUpdated:
+		Complete(fmt.Sprintf("Image '%s' is intact, and has been modified by updates since init", profile.Image))
+	case builder.ImageUnrecorded:
+		log.Warnf("No hash was recorded for image '%s', only its filesystem could be checked\n", profile.Image)
+		Complete(fmt.Sprintf("Image '%s' has a clean filesystem", profile.Image))
+	default:
+		if !report.Clean {
+			log.Errorf("The filesystem of image '%s' has errors:\n%s\n", profile.Image, report.Fsck)
+		} else {
+			log.Errorf("Image '%s' has changed since it was last updated by solbuild, sha256 %s\n", profile.Image, report.Sha256)
+		}
+		log.Errorf("Image '%s' is damaged. Replace it with 'solbuild delete-profile -p %s' followed by 'solbuild init -p %s'\n", profile.Image, profile.Name, profile.Name)
+		os.Exit(1)
+	}
+}
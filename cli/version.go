@@ -17,13 +17,11 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/DataDrake/cli-ng/v2/cmd"
-)
-
-const (
-	// SolbuildVersion is the current public version of solbuild
-	SolbuildVersion = "1.5.2.0"
+	"github.com/getsolus/solbuild/builder"
+	"os"
 )
 
 func init() {
@@ -34,11 +32,65 @@ func init() {
 var Version = cmd.Sub{
 	Name:  "version",
 	Short: "Print the solbuild version and exit",
+	Flags: &VersionFlags{},
 	Run:   VersionRun,
 }
 
+// VersionFlags are flags for the "version" sub-command
+type VersionFlags struct {
+	JSON bool `long:"json" desc:"Print the version and capabilities as JSON"`
+}
+
+// versionOutput is the JSON form of the version
+type versionOutput struct {
+	builder.VersionInfo
+	Capabilities builder.Capabilities `json:"capabilities"`
+}
+
 // VersionRun carries out the "version" sub-command
-func VersionRun(_ *cmd.Root, _ *cmd.Sub) {
-	fmt.Printf("solbuild version %v\n\nCopyright © 2016-2021 Solus Project\n", SolbuildVersion)
+func VersionRun(_ *cmd.Root, s *cmd.Sub) {
+	info := builder.GetVersionInfo()
+	caps := builder.DetectCapabilities()
+	if s != nil && s.Flags.(*VersionFlags).JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(versionOutput{info, caps}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode version: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("solbuild version %v\n\n", info.Version)
+	fmt.Printf("Git commit: %s\n", info.GitCommit)
+	fmt.Printf("Build date: %s\n", info.BuildDate)
+	fmt.Printf("Go version: %s\n", info.GoVersion)
+	fmt.Printf("\nOverlayfs:  %s\n", supported(caps.Overlayfs))
+	fmt.Printf("xz:         %s\n", supported(caps.Xz))
+	fmt.Printf("zstd:       %s\n", supported(caps.Zstd))
+	fmt.Printf("\nCopyright © 2016-2021 Solus Project\n")
 	fmt.Println("Licensed under the Apache License, Version 2.0")
 }
+
+// supported describes whether a capability is available
+func supported(available bool) string {
+	if available {
+		return "available"
+	}
+	return "unavailable"
+}
+
+// Run will run the requested sub-command. The --version flag is handled
+// first, as it is valid without a sub-command, along with --json.
+func Run() {
+	for _, arg := range os.Args[1:] {
+		if arg == "--version" {
+			flags := &VersionFlags{}
+			for _, arg := range os.Args[1:] {
+				flags.JSON = flags.JSON || arg == "--json"
+			}
+			VersionRun(&Root, &cmd.Sub{Flags: flags})
+			os.Exit(0)
+		}
+	}
+	Root.Run()
+}